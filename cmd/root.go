@@ -80,6 +80,93 @@ func initConfig() {
 	viper.BindEnv("NATS_URL")
 	viper.SetDefault("NATS_URL", "nats://nats:4222")
 
+	viper.BindEnv("NATS_OUTAGE_THRESHOLD")
+	viper.SetDefault("NATS_OUTAGE_THRESHOLD", 60)
+
+	viper.BindEnv("CLI_IDLE_TIMEOUT")
+	viper.SetDefault("CLI_IDLE_TIMEOUT", 600)
+
+	viper.BindEnv("CLI_MAX_SESSIONS_PER_USER")
+	viper.SetDefault("CLI_MAX_SESSIONS_PER_USER", 2)
+
+	viper.BindEnv("TUNNEL_BIND_HOST")
+	viper.SetDefault("TUNNEL_BIND_HOST", "127.0.0.1")
+
+	viper.BindEnv("TUNNEL_IDLE_TIMEOUT")
+	viper.SetDefault("TUNNEL_IDLE_TIMEOUT", 300)
+
+	viper.BindEnv("BLOB_DIR")
+	viper.SetDefault("BLOB_DIR", "/var/lib/barkeeper/blobs")
+
+	viper.BindEnv("FILE_TRANSFER_MAX_CONCURRENT")
+	viper.SetDefault("FILE_TRANSFER_MAX_CONCURRENT", 8)
+
+	viper.BindEnv("FILE_TRANSFER_MAX_PER_DEVICE")
+	viper.SetDefault("FILE_TRANSFER_MAX_PER_DEVICE", 1)
+
+	viper.BindEnv("FILE_TRANSFER_MAX_UPLOAD_SIZE")
+	viper.SetDefault("FILE_TRANSFER_MAX_UPLOAD_SIZE", 256*1024*1024)
+
+	viper.BindEnv("FIRMWARE_REBOOT_TIMEOUT")
+	viper.SetDefault("FIRMWARE_REBOOT_TIMEOUT", 900)
+
+	viper.BindEnv("CONFIG_BACKUP_INTERVAL")
+	viper.SetDefault("CONFIG_BACKUP_INTERVAL", 86400)
+
+	viper.BindEnv("CONFIG_BACKUP_CONCURRENCY")
+	viper.SetDefault("CONFIG_BACKUP_CONCURRENCY", 8)
+
+	viper.BindEnv("ADMIN_USERS")
+	viper.SetDefault("ADMIN_USERS", "")
+
+	viper.BindEnv("TRUSTED_PROXIES")
+	viper.SetDefault("TRUSTED_PROXIES", "")
+
+	viper.BindEnv("JETSTREAM_ENABLED")
+	viper.SetDefault("JETSTREAM_ENABLED", false)
+
+	viper.BindEnv("JETSTREAM_STREAM")
+	viper.SetDefault("JETSTREAM_STREAM", "IOTCORE_EVENTS")
+
+	viper.BindEnv("JETSTREAM_MAX_AGE")
+	viper.SetDefault("JETSTREAM_MAX_AGE", 604800)
+
+	viper.BindEnv("WEBHOOK_MAX_ATTEMPTS")
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 8)
+
+	viper.BindEnv("WEBHOOK_BACKOFF")
+	viper.SetDefault("WEBHOOK_BACKOFF", 10)
+
+	viper.BindEnv("WEBHOOK_TIMEOUT")
+	viper.SetDefault("WEBHOOK_TIMEOUT", 10)
+
+	viper.BindEnv("TELEMETRY_RAW_RETENTION")
+	viper.SetDefault("TELEMETRY_RAW_RETENTION", 604800)
+
+	viper.BindEnv("TELEMETRY_5M_RETENTION")
+	viper.SetDefault("TELEMETRY_5M_RETENTION", 2592000)
+
+	viper.BindEnv("TELEMETRY_1H_RETENTION")
+	viper.SetDefault("TELEMETRY_1H_RETENTION", 31536000)
+
+	viper.BindEnv("TRACING_EXPORTER")
+	viper.SetDefault("TRACING_EXPORTER", "none")
+
+	viper.BindEnv("TRACING_OTLP_ENDPOINT")
+	viper.SetDefault("TRACING_OTLP_ENDPOINT", "localhost:4318")
+
+	viper.BindEnv("TRACING_SAMPLE_RATIO")
+	viper.SetDefault("TRACING_SAMPLE_RATIO", 1.0)
+
+	viper.BindEnv("DRAIN_WAVE_SIZE")
+	viper.SetDefault("DRAIN_WAVE_SIZE", 50)
+
+	viper.BindEnv("DRAIN_WAVE_INTERVAL")
+	viper.SetDefault("DRAIN_WAVE_INTERVAL", 5)
+
+	viper.BindEnv("DRAIN_TIMEOUT")
+	viper.SetDefault("DRAIN_TIMEOUT", 300)
+
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Printf(`Config file not found because "%s"`, err)
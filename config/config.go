@@ -7,6 +7,69 @@ type Config struct {
 	DatabaseURL   string `mapstructure:"DATABASE_URL" yaml:"database_url"`
 	NATSServerURL string `mapstructure:"NATS_URL" yaml:"nats_url"`
 
+	// The server drains itself if NATS doesn't reconnect within the outage
+	// threshold in seconds, zero waits forever
+	NATSOutageThreshold int `mapstructure:"NATS_OUTAGE_THRESHOLD" yaml:"nats_outage_threshold"`
+
+	// Remote CLI sessions
+	CLIIdleTimeout        int `mapstructure:"CLI_IDLE_TIMEOUT" yaml:"cli_idle_timeout"`
+	CLIMaxSessionsPerUser int `mapstructure:"CLI_MAX_SESSIONS_PER_USER" yaml:"cli_max_sessions_per_user"`
+
+	// TCP tunnels through devices
+	TunnelBindHost    string `mapstructure:"TUNNEL_BIND_HOST" yaml:"tunnel_bind_host"`
+	TunnelIdleTimeout int    `mapstructure:"TUNNEL_IDLE_TIMEOUT" yaml:"tunnel_idle_timeout"`
+
+	// File transfers
+	BlobDir                   string `mapstructure:"BLOB_DIR" yaml:"blob_dir"`
+	FileTransferMaxConcurrent int    `mapstructure:"FILE_TRANSFER_MAX_CONCURRENT" yaml:"file_transfer_max_concurrent"`
+	FileTransferMaxPerDevice  int    `mapstructure:"FILE_TRANSFER_MAX_PER_DEVICE" yaml:"file_transfer_max_per_device"`
+
+	// Maximum size of uploaded files in bytes, 0 disables the limit
+	FileTransferMaxUploadSize int64 `mapstructure:"FILE_TRANSFER_MAX_UPLOAD_SIZE" yaml:"file_transfer_max_upload_size"`
+
+	// Firmware updates
+	FirmwareRebootTimeout int `mapstructure:"FIRMWARE_REBOOT_TIMEOUT" yaml:"firmware_reboot_timeout"`
+
+	// Configuration archive, periodic backups are disabled with interval 0
+	ConfigBackupInterval    int `mapstructure:"CONFIG_BACKUP_INTERVAL" yaml:"config_backup_interval"`
+	ConfigBackupConcurrency int `mapstructure:"CONFIG_BACKUP_CONCURRENCY" yaml:"config_backup_concurrency"`
+
+	// Comma separated list of the users which may call devices in maintenance
+	AdminUsers string `mapstructure:"ADMIN_USERS" yaml:"admin_users"`
+
+	// Comma separated list of the IP addresses and networks (CIDR) of the
+	// reverse proxies which authenticate the users. The user of the
+	// X-Forwarded-User header is only accepted from these proxies.
+	TrustedProxies string `mapstructure:"TRUSTED_PROXIES" yaml:"trusted_proxies"`
+
+	// Durable event stream, the events are kept for max age seconds
+	JetStreamEnabled bool   `mapstructure:"JETSTREAM_ENABLED" yaml:"jetstream_enabled"`
+	JetStreamStream  string `mapstructure:"JETSTREAM_STREAM" yaml:"jetstream_stream"`
+	JetStreamMaxAge  int    `mapstructure:"JETSTREAM_MAX_AGE" yaml:"jetstream_max_age"`
+
+	// Outbound webhooks, backoff and timeout in seconds
+	WebhookMaxAttempts int `mapstructure:"WEBHOOK_MAX_ATTEMPTS" yaml:"webhook_max_attempts"`
+	WebhookBackoff     int `mapstructure:"WEBHOOK_BACKOFF" yaml:"webhook_backoff"`
+	WebhookTimeout     int `mapstructure:"WEBHOOK_TIMEOUT" yaml:"webhook_timeout"`
+
+	// Device telemetry, the samples and rollups are kept for the retention
+	// in seconds
+	TelemetryRawRetention int `mapstructure:"TELEMETRY_RAW_RETENTION" yaml:"telemetry_raw_retention"`
+	Telemetry5mRetention  int `mapstructure:"TELEMETRY_5M_RETENTION" yaml:"telemetry_5m_retention"`
+	Telemetry1hRetention  int `mapstructure:"TELEMETRY_1H_RETENTION" yaml:"telemetry_1h_retention"`
+
+	// Tracing exporter 'none', 'stdout' or 'otlp', the OTLP exporter sends
+	// the spans to the collector endpoint via HTTP
+	TracingExporter     string  `mapstructure:"TRACING_EXPORTER" yaml:"tracing_exporter"`
+	TracingOTLPEndpoint string  `mapstructure:"TRACING_OTLP_ENDPOINT" yaml:"tracing_otlp_endpoint"`
+	TracingSampleRatio  float64 `mapstructure:"TRACING_SAMPLE_RATIO" yaml:"tracing_sample_ratio"`
+
+	// Drain mode, the control channels are closed in waves of the size every
+	// interval seconds. The server shuts down after the timeout in seconds.
+	DrainWaveSize     int `mapstructure:"DRAIN_WAVE_SIZE" yaml:"drain_wave_size"`
+	DrainWaveInterval int `mapstructure:"DRAIN_WAVE_INTERVAL" yaml:"drain_wave_interval"`
+	DrainTimeout      int `mapstructure:"DRAIN_TIMEOUT" yaml:"drain_timeout"`
+
 	// Version
 	BuildVersion string `yaml:"-"`
 	BuildHash    string `yaml:"-"`
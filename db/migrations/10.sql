@@ -0,0 +1,19 @@
+-- +migrate Up
+ALTER TABLE devices ADD COLUMN labels text NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS device_groups (
+    id                 serial,
+    namespace          text NOT NULL,
+    name               text NOT NULL,
+    description        text NOT NULL DEFAULT '',
+    selector           text NOT NULL DEFAULT '',
+    members            text NOT NULL DEFAULT '',
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    UNIQUE (namespace, name)
+);
+
+-- +migrate Down
+DROP TABLE device_groups;
+ALTER TABLE devices DROP COLUMN labels;
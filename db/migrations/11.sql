@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS maintenances (
+    id                 serial,
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    reason             text NOT NULL DEFAULT '',
+    reject_calls       boolean NOT NULL DEFAULT false,
+    set_by             text NOT NULL DEFAULT '',
+    until              timestamp NOT NULL,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    UNIQUE (namespace, device_id)
+);
+
+-- +migrate Down
+DROP TABLE maintenances;
@@ -0,0 +1,41 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS rules (
+    id                 serial,
+    namespace          text NOT NULL DEFAULT '',
+    name               text NOT NULL,
+    description        text NOT NULL DEFAULT '',
+    enabled            boolean NOT NULL DEFAULT true,
+    topic              text NOT NULL DEFAULT '',
+    source_type        text NOT NULL DEFAULT '',
+    source_id          text NOT NULL DEFAULT '',
+    conditions         text NOT NULL DEFAULT '[]',
+    actions            text NOT NULL DEFAULT '[]',
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id                 serial,
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    rule_id            int NOT NULL,
+    severity           text NOT NULL,
+    message            text NOT NULL DEFAULT '',
+    status             text NOT NULL,
+    count              int NOT NULL DEFAULT 1,
+    last_event_id      int NOT NULL DEFAULT 0,
+    acknowledged_by    text NOT NULL DEFAULT '',
+    acknowledged_at    timestamp,
+    resolved_by        text NOT NULL DEFAULT '',
+    resolved_at        timestamp,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX alerts_device_idx ON alerts (namespace, device_id, status);
+
+-- +migrate Down
+DROP TABLE alerts;
+DROP TABLE rules;
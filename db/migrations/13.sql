@@ -0,0 +1,37 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS webhooks (
+    id                 serial,
+    namespace          text NOT NULL DEFAULT '',
+    url                text NOT NULL,
+    secret             text NOT NULL DEFAULT '',
+    topics             text NOT NULL DEFAULT '',
+    description        text NOT NULL DEFAULT '',
+    enabled            boolean NOT NULL DEFAULT true,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id                 serial,
+    webhook_id         int NOT NULL,
+    namespace          text NOT NULL,
+    topic              text NOT NULL,
+    payload            text NOT NULL,
+    status             text NOT NULL,
+    attempts           int NOT NULL DEFAULT 0,
+    next_attempt_at    timestamp,
+    last_attempt_at    timestamp,
+    last_status_code   int NOT NULL DEFAULT 0,
+    last_error         text NOT NULL DEFAULT '',
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id);
+CREATE INDEX webhook_deliveries_status_idx ON webhook_deliveries (status, next_attempt_at);
+
+-- +migrate Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
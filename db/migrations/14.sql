@@ -0,0 +1,5 @@
+-- +migrate Up
+CREATE INDEX events_created_at_idx ON events (created_at);
+
+-- +migrate Down
+DROP INDEX events_created_at_idx;
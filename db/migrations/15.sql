@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS outbox (
+    id                 serial,
+    event_id           int NOT NULL,
+    attempts           int NOT NULL DEFAULT 0,
+    next_attempt_at    timestamp NOT NULL DEFAULT now(),
+    last_error         text NOT NULL DEFAULT '',
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX outbox_next_attempt_at_idx ON outbox (next_attempt_at);
+
+-- +migrate Down
+DROP TABLE outbox;
@@ -0,0 +1,47 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS metric_mappings (
+    id                 serial,
+    namespace          text NOT NULL DEFAULT '',
+    metric             text NOT NULL,
+    topic              text NOT NULL DEFAULT '',
+    path               text NOT NULL,
+    unit               text NOT NULL DEFAULT '',
+    description        text NOT NULL DEFAULT '',
+    enabled            boolean NOT NULL DEFAULT true,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS metric_samples (
+    event_id           int NOT NULL,
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    metric             text NOT NULL,
+    timestamp          timestamp NOT NULL,
+    value              double precision NOT NULL,
+    PRIMARY KEY (event_id, metric)
+);
+
+CREATE INDEX metric_samples_series_idx ON metric_samples (namespace, device_id, metric, timestamp);
+CREATE INDEX metric_samples_timestamp_idx ON metric_samples (timestamp);
+
+CREATE TABLE IF NOT EXISTS metric_rollups (
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    metric             text NOT NULL,
+    resolution         int NOT NULL,
+    bucket             timestamp NOT NULL,
+    count              int NOT NULL,
+    sum                double precision NOT NULL,
+    min                double precision NOT NULL,
+    max                double precision NOT NULL,
+    PRIMARY KEY (namespace, device_id, metric, resolution, bucket)
+);
+
+CREATE INDEX metric_rollups_bucket_idx ON metric_rollups (resolution, bucket);
+
+-- +migrate Down
+DROP TABLE metric_rollups;
+DROP TABLE metric_samples;
+DROP TABLE metric_mappings;
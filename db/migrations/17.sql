@@ -0,0 +1,10 @@
+-- +migrate Up
+ALTER TABLE maintenances ADD COLUMN group_id int NOT NULL DEFAULT 0;
+ALTER TABLE maintenances DROP CONSTRAINT maintenances_namespace_device_id_key;
+ALTER TABLE maintenances ADD UNIQUE (namespace, device_id, group_id);
+
+-- +migrate Down
+DELETE FROM maintenances WHERE group_id<>0;
+ALTER TABLE maintenances DROP CONSTRAINT maintenances_namespace_device_id_group_id_key;
+ALTER TABLE maintenances ADD UNIQUE (namespace, device_id);
+ALTER TABLE maintenances DROP COLUMN group_id;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE firmware_campaigns ADD COLUMN owner text NOT NULL DEFAULT '';
+ALTER TABLE firmware_campaigns ADD COLUMN lease_until timestamp NOT NULL DEFAULT now();
+
+-- +migrate Down
+ALTER TABLE firmware_campaigns DROP COLUMN lease_until;
+ALTER TABLE firmware_campaigns DROP COLUMN owner;
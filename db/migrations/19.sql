@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE file_transfers ADD COLUMN owner text NOT NULL DEFAULT '';
+ALTER TABLE file_transfers ADD COLUMN lease_until timestamp NOT NULL DEFAULT now();
+
+-- +migrate Down
+ALTER TABLE file_transfers DROP COLUMN lease_until;
+ALTER TABLE file_transfers DROP COLUMN owner;
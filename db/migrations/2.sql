@@ -0,0 +1,11 @@
+-- +migrate Up
+ALTER TABLE sessions ADD COLUMN protocol_version int NOT NULL DEFAULT 1;
+ALTER TABLE sessions ADD COLUMN features text NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN firmware_version text NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN hardware_model text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE sessions DROP COLUMN hardware_model;
+ALTER TABLE sessions DROP COLUMN firmware_version;
+ALTER TABLE sessions DROP COLUMN features;
+ALTER TABLE sessions DROP COLUMN protocol_version;
@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS transcripts (
+    id                 serial,
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    kind               text NOT NULL,
+    username           text NOT NULL,
+    started_at         timestamp NOT NULL DEFAULT now(),
+    ended_at           timestamp,
+    close_reason       text NOT NULL DEFAULT '',
+    content            text NOT NULL DEFAULT '[]',
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+-- +migrate Down
+DROP TABLE transcripts;
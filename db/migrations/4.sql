@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE devices ADD COLUMN tunnel_ports text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE devices DROP COLUMN tunnel_ports;
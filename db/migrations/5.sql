@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS file_transfers (
+    id                 serial,
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    direction          text NOT NULL,
+    path               text NOT NULL,
+    size               bigint NOT NULL DEFAULT 0,
+    transfer_offset    bigint NOT NULL DEFAULT 0,
+    checksum           text NOT NULL DEFAULT '',
+    status             text NOT NULL,
+    error              text NOT NULL DEFAULT '',
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+-- +migrate Down
+DROP TABLE file_transfers;
@@ -0,0 +1,48 @@
+-- +migrate Up
+ALTER TABLE file_transfers ADD COLUMN blob text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS firmware_images (
+    id                 serial,
+    version            text NOT NULL,
+    hardware_models    text NOT NULL DEFAULT '',
+    filename           text NOT NULL,
+    size               bigint NOT NULL DEFAULT 0,
+    checksum           text NOT NULL,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS firmware_campaigns (
+    id                 serial,
+    namespace          text NOT NULL,
+    image_id           int NOT NULL REFERENCES firmware_images (id),
+    batch_size         int NOT NULL DEFAULT 1,
+    max_failure_rate   double precision NOT NULL DEFAULT 0,
+    status             text NOT NULL,
+    error              text NOT NULL DEFAULT '',
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS firmware_updates (
+    id                 serial,
+    campaign_id        int NOT NULL REFERENCES firmware_campaigns (id),
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    status             text NOT NULL,
+    error              text NOT NULL DEFAULT '',
+    transfer_id        int NOT NULL DEFAULT 0,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX firmware_updates_campaign_id_idx ON firmware_updates (campaign_id);
+
+-- +migrate Down
+DROP TABLE firmware_updates;
+DROP TABLE firmware_campaigns;
+DROP TABLE firmware_images;
+ALTER TABLE file_transfers DROP COLUMN blob;
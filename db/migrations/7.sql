@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS config_versions (
+    id                 serial,
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    version            int NOT NULL,
+    checksum           text NOT NULL,
+    content            text NOT NULL,
+    source             text NOT NULL,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    UNIQUE (namespace, device_id, version)
+);
+
+-- +migrate Down
+DROP TABLE config_versions;
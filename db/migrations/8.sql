@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS twins (
+    id                 serial,
+    namespace          text NOT NULL,
+    device_id          text NOT NULL,
+    desired            text NOT NULL DEFAULT '{}',
+    reported           text NOT NULL DEFAULT '{}',
+    version            int NOT NULL DEFAULT 1,
+    created_at         timestamp NOT NULL DEFAULT now(),
+    updated_at         timestamp NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    UNIQUE (namespace, device_id)
+);
+
+-- +migrate Down
+DROP TABLE twins;
@@ -0,0 +1,27 @@
+-- +migrate Up
+ALTER TABLE devices ADD COLUMN device_type text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN name text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN location text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN asset_tag text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN device_group text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN hardware_model text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN hardware_revision text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN hardware_serial_number text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN firmware_version text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN network_hostname text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN network_domainname text NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN network_primary_ipv4_address text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE devices DROP COLUMN network_primary_ipv4_address;
+ALTER TABLE devices DROP COLUMN network_domainname;
+ALTER TABLE devices DROP COLUMN network_hostname;
+ALTER TABLE devices DROP COLUMN firmware_version;
+ALTER TABLE devices DROP COLUMN hardware_serial_number;
+ALTER TABLE devices DROP COLUMN hardware_revision;
+ALTER TABLE devices DROP COLUMN hardware_model;
+ALTER TABLE devices DROP COLUMN device_group;
+ALTER TABLE devices DROP COLUMN asset_tag;
+ALTER TABLE devices DROP COLUMN location;
+ALTER TABLE devices DROP COLUMN name;
+ALTER TABLE devices DROP COLUMN device_type;
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
+)
+
+// handleDrain starts the drain mode of the server. The control channels are
+// closed in waves and the server shuts down afterwards. Only admin users may
+// drain the server, they have to be authenticated by a trusted proxy.
+func (h *Handler) handleDrain(c echo.Context) error {
+	user, ok := h.adminUser(c)
+	if !ok {
+		return c.JSON(http.StatusForbidden, "draining the server requires an admin user")
+	}
+
+	log.Infof("drain requested by '%s'", user)
+	h.drain()
+
+	return c.JSON(http.StatusAccepted, nil)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+// handleFetchAlerts returns the alerts filtered by the query parameters
+// 'namespace', 'deviceId', 'status', 'severity' and 'ruleId'
+func (h *Handler) handleFetchAlerts(c echo.Context) error {
+	m, err := h.store.Alerts().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	for id, elem := range m {
+		if !matchesAlertFilters(&elem, c) {
+			delete(m, id)
+		}
+	}
+
+	return c.JSON(http.StatusOK, resource.NewAlertList(m))
+}
+
+// handleFetchDeviceAlerts returns the alerts of the device filtered by the
+// query parameters 'status' and 'severity'
+func (h *Handler) handleFetchDeviceAlerts(c echo.Context) error {
+	d, status, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	m, err := h.store.Alerts().FindByNamespaceAndDeviceID(d.Namespace, d.DeviceID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	for id, elem := range m {
+		if !matchesAlertFilters(&elem, c) {
+			delete(m, id)
+		}
+	}
+
+	return c.JSON(http.StatusOK, resource.NewAlertList(m))
+}
+
+func (h *Handler) handleGetAlertByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("aid"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := h.store.Alerts().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewAlert(m))
+}
+
+func (h *Handler) handleAcknowledgeAlert(c echo.Context) error {
+	return h.changeAlert(c, h.rules.Acknowledge)
+}
+
+func (h *Handler) handleResolveAlert(c echo.Context) error {
+	return h.changeAlert(c, h.rules.Resolve)
+}
+
+// changeAlert applies the state change on behalf of the user of the request.
+// Resolved alerts can't be changed anymore.
+func (h *Handler) changeAlert(c echo.Context, change func(id int32, user string) (*model.Alert, error)) error {
+	id, err := strconv.Atoi(c.Param("aid"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := change(int32(id), h.requestUser(c))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil && err == storage.ErrConflict {
+		return c.JSON(http.StatusConflict, "alert is resolved")
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewAlert(m))
+}
+
+func matchesAlertFilters(m *model.Alert, c echo.Context) bool {
+	filters := map[string]string{
+		"namespace": m.Namespace,
+		"deviceId":  m.DeviceID,
+		"status":    m.Status,
+		"severity":  m.Severity,
+		"ruleId":    strconv.Itoa(int(m.RuleID)),
+	}
+	for param, value := range filters {
+		if q := c.QueryParam(param); q != "" && q != value {
+			return false
+		}
+	}
+	return true
+}
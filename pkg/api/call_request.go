@@ -1,27 +1,66 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/metrics"
 	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/tracing"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// headerCallID is the response header containing the ID of a call request
+const headerCallID = "X-Call-ID"
+
+const mimeApplicationNDJSON = "application/x-ndjson"
+
+// errNATSUnavailable is returned while the NATS connection is reconnecting.
+// The request is rejected instead of waiting for the reconnect.
+var errNATSUnavailable = errors.New("NATS connection is unavailable, try again later")
+
+// requestErrorReason returns the error reason of a reply for a failed
+// request to the controller
+func requestErrorReason(err error) string {
+	if err == errNATSUnavailable {
+		return proto.ErrReasonTemporarilyUnavailable.String()
+	}
+	return "ERR_TECHNICAL_EXCEPTION"
+}
+
 func (h *Handler) handleCallRequest(c echo.Context) error {
 	namespace := c.Param("namespace")
 	deviceID := c.Param("id")
+	ctx := c.Request().Context()
 
+	_, span := tracing.StartStore(ctx, "Devices.FindByNamespaceAndDeviceID")
 	_, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	tracing.End(span, err)
 	if err != nil && err == storage.ErrNotFound {
 		return c.JSON(http.StatusNotFound, err)
 	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
+	rejected, err := h.rejectCall(c, namespace, deviceID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	} else if rejected != nil {
+		return c.JSON(http.StatusConflict, rejected)
+	}
+
 	req := &message.CallRequest{}
 	if err := c.Bind(req); err != nil {
 		return c.JSON(http.StatusBadRequest, err)
@@ -29,21 +68,200 @@ func (h *Handler) handleCallRequest(c echo.Context) error {
 	// Override these attributes
 	req.TargetType = message.TargetTypeDevice
 	req.TargetID = deviceID
+	_, req.BypassMaintenance = h.adminUser(c)
+
+	// The call ID allows the requestor to cancel the call while it's
+	// running. It's always generated, otherwise a client could take over the
+	// ID of another call.
+	req.CallID = nuid.Next()
+	req.Requestor = h.requestUser(c)
+	c.Response().Header().Set(headerCallID, req.CallID)
+
+	// Clients which accept NDJSON receive the progressive results of the
+	// device as they happen. The controller relays them in any case, every
+	// reply resets the timeout of the call.
+	stream := c.QueryParam("stream") == "true" ||
+		strings.Contains(c.Request().Header.Get(echo.HeaderAccept), mimeApplicationNDJSON)
+	req.Stream = true
+
+	if !h.nc.IsConnected() {
+		return c.JSON(http.StatusServiceUnavailable, message.CallReply{
+			CallID:      req.CallID,
+			Status:      message.ReplyStatusError,
+			ErrorReason: requestErrorReason(errNATSUnavailable),
+		})
+	}
 
 	data, err := json.Marshal(req)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
-	msg, err := h.nc.Request(fmt.Sprintf("iotcore.devicecontrol.v1.%s.call", namespace), data, 16*time.Second)
+	ctx, span = tracing.Start(ctx, "client call",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("device.id", deviceID),
+			attribute.String("call.id", req.CallID),
+			attribute.String("call.command", req.Command),
+		))
+	defer span.End()
+
+	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.call", namespace)
+	if stream {
+		return h.streamCallReplies(c, namespace, req, tracing.NewMsg(ctx, h.nc, subj, data))
+	}
+
+	start := time.Now()
+	var rep *message.CallReply
+	err = h.requestCall(ctx, namespace, req, tracing.NewMsg(ctx, h.nc, subj, data), func(r *message.CallReply) error {
+		rep = r
+		return nil
+	})
+	metrics.ObserveCall(metrics.HopClient, start)
 	if err != nil {
+		if err == nats.ErrTimeout {
+			metrics.CallTimeouts.WithLabelValues(metrics.HopClient).Inc()
+		}
+		metrics.NATSRequestErrors.WithLabelValues("call").Inc()
+		tracing.RecordError(span, err)
 		return c.JSON(http.StatusInternalServerError, err)
 	}
+	if rep.Status == message.ReplyStatusError {
+		tracing.Fail(span, rep.ErrorReason)
+	}
+
+	return c.JSON(http.StatusOK, rep)
+}
+
+// streamCallReplies sends the call request and writes every reply of the
+// streamed call as a line of a chunked NDJSON response. The response ends
+// with the final reply. The call is cancelled if the client disconnects.
+func (h *Handler) streamCallReplies(c echo.Context, namespace string, call *message.CallRequest, req *nats.Msg) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, mimeApplicationNDJSON)
+	res.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(res)
+
+	err := h.requestCall(c.Request().Context(), namespace, call, req, func(rep *message.CallReply) error {
+		if err := enc.Encode(rep); err != nil {
+			return err // Client has gone
+		}
+		res.Flush()
+		return nil
+	})
+	if err == nil || err == context.Canceled {
+		return nil
+	}
 
-	rep := message.CallReply{}
+	// The headers are sent already, therefore we report the error as final
+	// reply.
+	rep := message.CallReply{
+		CallID:      call.CallID,
+		Status:      message.ReplyStatusError,
+		ErrorReason: "ERR_TECHNICAL_EXCEPTION",
+	}
+	if err == nats.ErrTimeout {
+		rep.ErrorReason = "ERR_RESULT_TIMEOUT"
+	}
+	if err := enc.Encode(rep); err == nil {
+		res.Flush()
+	}
+	return nil
+}
+
+// requestCall sends the call request and passes every reply to fn until the
+// final reply. Every reply resets the timeout. The call is cancelled if the
+// context is done or fn fails, e.g. because the client disconnected.
+func (h *Handler) requestCall(ctx context.Context, namespace string, call *message.CallRequest, req *nats.Msg, fn func(rep *message.CallReply) error) error {
+	inbox := nats.NewInbox()
+	sub, err := h.nc.SubscribeSync(inbox)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	req.Reply = inbox
+	if err := h.nc.PublishMsg(req); err != nil {
+		return err
+	}
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, 16*time.Second)
+		msg, err := sub.NextMsgWithContext(waitCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				go h.cancelCall(namespace, call.CallID, call.Requestor)
+				return ctx.Err()
+			}
+			return nats.ErrTimeout
+		}
+
+		rep := &message.CallReply{}
+		if err := json.Unmarshal(msg.Data, rep); err != nil {
+			return err
+		}
+		if err := fn(rep); err != nil {
+			go h.cancelCall(namespace, call.CallID, call.Requestor)
+			return err
+		}
+		if !rep.Partial {
+			return nil
+		}
+	}
+}
+
+// cancelCall cancels a running call whose requestor has gone
+func (h *Handler) cancelCall(namespace, callID, requestor string) {
+	data, err := json.Marshal(message.CancelRequest{CallID: callID, Requestor: requestor})
+	if err != nil {
+		return
+	}
+
+	_, err = h.nc.Request(fmt.Sprintf("iotcore.devicecontrol.v1.%s.cancel", namespace), data, 5*time.Second)
+	if err != nil && err != nats.ErrTimeout {
+		log.Errorf("failed to cancel call '%s': %s", callID, err)
+	}
+}
+
+func (h *Handler) handleCancelCallRequest(c echo.Context) error {
+	namespace := c.QueryParam("namespace")
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// Only the requestor of the call may cancel it
+	req := message.CancelRequest{
+		CallID:    c.Param("id"),
+		Requestor: h.requestUser(c),
+	}
+
+	if !h.nc.IsConnected() {
+		return c.JSON(http.StatusServiceUnavailable, errNATSUnavailable.Error())
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	// Only the control channel running the call replies. If nobody replies
+	// the call doesn't exist or has already finished.
+	msg, err := h.nc.Request(fmt.Sprintf("iotcore.devicecontrol.v1.%s.cancel", namespace), data, 5*time.Second)
+	if err != nil && err == nats.ErrTimeout {
+		return c.JSON(http.StatusNotFound, storage.ErrNotFound)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	rep := message.CancelReply{}
 	if err := json.Unmarshal(msg.Data, &rep); err != nil {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
+	if rep.Status == message.ReplyStatusError {
+		return c.JSON(http.StatusConflict, rep)
+	}
+
 	return c.JSON(http.StatusOK, rep)
 }
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/config"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+	"github.com/pkg/errors"
+)
+
+// disconnectedConn returns a NATS connection which is reconnecting to its
+// stopped server
+func disconnectedConn(t *testing.T) *nats.Conn {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	disconnectedCh := make(chan struct{})
+	nc, err := nats.Connect(s.ClientURL(),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Hour),
+		nats.DisconnectErrHandler(func(*nats.Conn, error) { close(disconnectedCh) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Shutdown()
+	select {
+	case <-disconnectedCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NATS connection wasn't disconnected")
+	}
+
+	return nc
+}
+
+func TestRequestErrorReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errNATSUnavailable, proto.ErrReasonTemporarilyUnavailable.String()},
+		{nats.ErrTimeout, "ERR_TECHNICAL_EXCEPTION"},
+		{errors.New("failed"), "ERR_TECHNICAL_EXCEPTION"},
+	}
+
+	for _, tc := range tests {
+		if got := requestErrorReason(tc.err); got != tc.want {
+			t.Errorf("requestErrorReason(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRequestsWhileDisconnected(t *testing.T) {
+	nc := disconnectedConn(t)
+	defer nc.Close()
+
+	store := memory.NewStore()
+	if err := store.Devices().Create(&model.Device{Namespace: "default", DeviceID: "dev1"}); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{cfg: &config.Config{}, nc: nc, store: store}
+
+	// The call is rejected right away instead of waiting for the reconnect
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"command":"show"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("namespace", "id")
+	c.SetParamValues("default", "dev1")
+	if err := h.handleCallRequest(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("call status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	rep := message.CallReply{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.ErrorReason != proto.ErrReasonTemporarilyUnavailable.String() || rep.CallID == "" {
+		t.Errorf("call reply = %+v, want %s with call ID", rep, proto.ErrReasonTemporarilyUnavailable)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("call1")
+	if err := h.handleCancelCallRequest(c); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("cancel status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// The requests of targeted calls fail for each device
+	err := h.requestDevice(context.Background(), "iotcore.devicecontrol.v1.default.call", message.CallRequest{}, &message.CallReply{})
+	if err != errNATSUnavailable {
+		t.Errorf("request error = %v, want %v", err, errNATSUnavailable)
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamKindCLI is the stream kind of an interactive CLI session
+const streamKindCLI = "cli"
+
+// transcriptFlushInterval defines how often the transcript of a running CLI
+// session is saved.
+const transcriptFlushInterval = 30 * time.Second
+
+// cliHandler upgrades the request to a websocket and connects it with an
+// interactive CLI stream of the device. Everything sent and received is
+// recorded in a transcript.
+func (h *Handler) cliHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		namespace := c.Param("namespace")
+		deviceID := c.Param("id")
+		user := h.requestUser(c)
+
+		_, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+		if err != nil && err == storage.ErrNotFound {
+			return c.JSON(http.StatusNotFound, err)
+		} else if err != nil {
+			return c.JSON(http.StatusInternalServerError, err)
+		}
+
+		if !h.cliSessions.acquire(user) {
+			return c.JSON(http.StatusTooManyRequests,
+				fmt.Sprintf("user '%s' reached the limit of %d CLI sessions", user, h.cfg.CLIMaxSessionsPerUser))
+		}
+		defer h.cliSessions.release(user)
+
+		stream, err := h.openDeviceStream(namespace, deviceID, streamKindCLI, nil)
+		if err == errDeviceNotConnected {
+			return c.JSON(http.StatusServiceUnavailable, err.Error())
+		} else if e, ok := err.(*streamOpenError); ok {
+			return c.JSON(http.StatusConflict, e.Error())
+		} else if err != nil {
+			return c.JSON(http.StatusInternalServerError, err)
+		}
+
+		conn, _, _, err := ws.UpgradeHTTP(c.Request(), c.Response())
+		if err != nil {
+			log.Error("api: failed to upgrade to websocket: ", err)
+			stream.Close("websocket upgrade failed", true)
+			return nil
+		}
+		defer conn.Close()
+
+		rec, err := h.newTranscriptRecorder(namespace, deviceID, streamKindCLI, user)
+		if err != nil {
+			log.Error("api: failed to create transcript: ", err)
+			stream.Close("transcript recording failed", true)
+			return nil
+		}
+
+		log.Infof("api: user '%s' opened CLI session on device '%s'", user, deviceID)
+
+		// Read the input of the user in the background. The reader stops
+		// when the connection is closed.
+		inputCh := make(chan []byte)
+		readErrCh := make(chan error, 1)
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+		go func() {
+			for {
+				data, op, err := wsutil.ReadClientData(conn)
+				if err != nil {
+					readErrCh <- err
+					return
+				}
+				if op != ws.OpText && op != ws.OpBinary {
+					continue
+				}
+				select {
+				case inputCh <- data:
+				case <-doneCh:
+					return
+				}
+			}
+		}()
+
+		idleTimeout := time.Duration(h.cfg.CLIIdleTimeout) * time.Second
+		idle := time.NewTimer(idleTimeout)
+		defer idle.Stop()
+		flush := time.NewTicker(transcriptFlushInterval)
+		defer flush.Stop()
+
+		var reason string
+	loop:
+		for {
+			select {
+			case data := <-inputCh:
+				if err := stream.Write(data); err != nil {
+					log.Error("api: failed to write CLI input: ", err)
+					reason = proto.ErrReasonTechnicalException.String()
+					stream.Close(reason, true)
+					break loop
+				}
+				rec.record(model.TranscriptDirectionInput, data)
+				resetTimer(idle, idleTimeout)
+			case frame := <-stream.Frames():
+				if frame.Close {
+					reason = frame.Reason
+					stream.Close(reason, false)
+					break loop
+				}
+				if err := wsutil.WriteServerMessage(conn, ws.OpBinary, frame.Data); err != nil {
+					reason = "websocket closed"
+					stream.Close(reason, true)
+					break loop
+				}
+				rec.record(model.TranscriptDirectionOutput, frame.Data)
+				resetTimer(idle, idleTimeout)
+			case <-readErrCh:
+				reason = "websocket closed"
+				stream.Close(reason, true)
+				break loop
+			case <-idle.C:
+				reason = proto.ErrReasonIdleTimeout.String()
+				stream.Close(reason, true)
+				break loop
+			case <-flush.C:
+				if err := rec.save(); err != nil {
+					log.Error("api: failed to save transcript: ", err)
+				}
+			}
+		}
+
+		log.Infof("api: CLI session of user '%s' on device '%s' closed: %s", user, deviceID, reason)
+
+		wsutil.WriteServerMessage(conn, ws.OpClose,
+			ws.NewCloseFrameBody(ws.StatusNormalClosure, reason))
+
+		if err := rec.finish(reason); err != nil {
+			log.Error("api: failed to save transcript: ", err)
+		}
+
+		return nil
+	}
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// transcriptRecorder records the data of a stream and saves it to the
+// transcript store.
+type transcriptRecorder struct {
+	sync.Mutex
+	store      storage.TranscriptStore
+	transcript *model.Transcript
+	entries    []model.TranscriptEntry
+}
+
+func (h *Handler) newTranscriptRecorder(namespace, deviceID, kind, user string) (*transcriptRecorder, error) {
+	t := &model.Transcript{
+		Namespace: namespace,
+		DeviceID:  deviceID,
+		Kind:      kind,
+		Username:  user,
+		StartedAt: time.Now().UTC(),
+		Content:   "[]",
+	}
+	if err := h.store.Transcripts().Create(t); err != nil {
+		return nil, err
+	}
+
+	return &transcriptRecorder{
+		store:      h.store.Transcripts(),
+		transcript: t,
+		entries:    make([]model.TranscriptEntry, 0),
+	}, nil
+}
+
+func (r *transcriptRecorder) record(direction string, data []byte) {
+	r.Lock()
+	r.entries = append(r.entries, model.TranscriptEntry{
+		Time:      time.Now().UTC(),
+		Direction: direction,
+		Encoding:  model.TranscriptEncodingBase64,
+		Data:      append([]byte(nil), data...),
+	})
+	r.Unlock()
+}
+
+func (r *transcriptRecorder) save() error {
+	r.Lock()
+	defer r.Unlock()
+
+	content, err := json.Marshal(r.entries)
+	if err != nil {
+		return err
+	}
+	r.transcript.Content = string(content)
+
+	return r.store.Update(r.transcript)
+}
+
+func (r *transcriptRecorder) finish(reason string) error {
+	r.Lock()
+	r.transcript.EndedAt = time.Now().UTC()
+	r.transcript.CloseReason = reason
+	r.Unlock()
+
+	return r.save()
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/config"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// newCLITestServer serves the CLI sessions of device dev1. The requests of
+// the test come from a trusted proxy.
+func newCLITestServer(t *testing.T) (*Handler, *httptest.Server, func()) {
+	nc, shutdown := runServer(t)
+
+	store := memory.NewStore()
+	if err := store.Devices().Create(&model.Device{Namespace: "default", DeviceID: "dev1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{CLIIdleTimeout: 60, CLIMaxSessionsPerUser: 1, TrustedProxies: "127.0.0.1/32"}
+	h := &Handler{
+		cfg:            cfg,
+		nc:             nc,
+		store:          store,
+		cliSessions:    newUserLimiter(cfg.CLIMaxSessionsPerUser),
+		trustedProxies: parseTrustedProxies(cfg.TrustedProxies),
+	}
+
+	e := echo.New()
+	e.GET("/:namespace/:id/cli", h.cliHandler())
+	srv := httptest.NewServer(e)
+
+	return h, srv, func() {
+		srv.Close()
+		shutdown()
+	}
+}
+
+func dialCLI(t *testing.T, srv *httptest.Server, user string) net.Conn {
+	d := ws.Dialer{Header: ws.HandshakeHeaderHTTP(http.Header{headerForwardedUser: []string{user}})}
+	conn, _, _, err := d.Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")+"/default/dev1/cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// readCLI returns the next message of the server, the opcode is close if
+// the server closed the session
+func readCLI(t *testing.T, conn net.Conn) ([]byte, ws.OpCode) {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	data, op, err := wsutil.ReadServerData(conn)
+	if _, ok := err.(wsutil.ClosedError); ok {
+		return nil, ws.OpClose
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return data, op
+}
+
+func TestCLISession(t *testing.T) {
+	h, srv, shutdown := newCLITestServer(t)
+	defer shutdown()
+	d := newFakeStreamDevice(t, h.nc, "dev1")
+
+	conn := dialCLI(t, srv, "alice")
+	defer conn.Close()
+	outbox := d.opened(t)
+
+	if err := wsutil.WriteClientMessage(conn, ws.OpText, []byte("show version\n")); err != nil {
+		t.Fatal(err)
+	}
+	if frame := d.next(t); string(frame.Data) != "show version\n" {
+		t.Errorf("device received %q, want %q", frame.Data, "show version\n")
+	}
+
+	// Terminal output isn't necessarily valid UTF-8
+	output := []byte{0x1b, '[', 'm', 0xff, '\n'}
+	d.send(t, outbox, message.StreamFrame{Data: output})
+	if data, op := readCLI(t, conn); op != ws.OpBinary || string(data) != string(output) {
+		t.Errorf("client received %q (opcode %d), want %q", data, op, output)
+	}
+
+	d.send(t, outbox, message.StreamFrame{Close: true, Reason: "bye"})
+	if _, op := readCLI(t, conn); op != ws.OpClose {
+		t.Errorf("client received opcode %d, want close", op)
+	}
+
+	// The transcript is saved when the session is closed
+	var transcript *model.Transcript
+	for i := 0; i < 100 && transcript == nil; i++ {
+		transcripts, err := h.store.Transcripts().FetchAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range transcripts {
+			if !m.EndedAt.IsZero() {
+				m := m
+				transcript = &m
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if transcript == nil {
+		t.Fatal("transcript wasn't finished")
+	}
+	if transcript.Username != "alice" || transcript.CloseReason != "bye" {
+		t.Errorf("transcript of %q closed with %q, want alice and bye", transcript.Username, transcript.CloseReason)
+	}
+
+	entries := resource.NewTranscript(transcript).Entries
+	if len(entries) != 2 {
+		t.Fatalf("transcript has %d entries, want 2", len(entries))
+	}
+	if entries[0].Direction != model.TranscriptDirectionInput || string(entries[0].Data) != "show version\n" {
+		t.Errorf("first entry = %s %q", entries[0].Direction, entries[0].Data)
+	}
+	if entries[1].Direction != model.TranscriptDirectionOutput || string(entries[1].Data) != string(output) {
+		t.Errorf("second entry = %s %q", entries[1].Direction, entries[1].Data)
+	}
+}
+
+func TestCLISessionLimit(t *testing.T) {
+	h, srv, shutdown := newCLITestServer(t)
+	defer shutdown()
+
+	// The forwarded user holds a session already
+	if !h.cliSessions.acquire("alice") {
+		t.Fatal("first session wasn't acquired")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/default/dev1/cli", nil)
+	req.Header.Set(headerForwardedUser, "alice")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusTooManyRequests)
+	}
+
+	// Another user isn't limited, the device isn't connected though
+	req.Header.Set(headerForwardedUser, "bob")
+	if res, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+}
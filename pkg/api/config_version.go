@@ -0,0 +1,131 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/client"
+	"github.com/nsyszr/lcm/pkg/diff"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+func (h *Handler) handleFetchConfigVersions(c echo.Context) error {
+	m, err := h.store.ConfigVersions().FindByNamespaceAndDeviceID(c.Param("namespace"), c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewConfigVersionList(m))
+}
+
+// handleBackupConfig retrieves the running configuration of the device. The
+// latest version is returned unchanged if the configuration didn't change.
+func (h *Handler) handleBackupConfig(c echo.Context) error {
+	namespace := c.Param("namespace")
+	deviceID := c.Param("id")
+
+	_, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	m, created, err := h.configs.Backup(namespace, deviceID, model.ConfigVersionSourceManual)
+	if err != nil {
+		return c.JSON(deviceCallErrorStatus(err), err.Error())
+	}
+
+	if !created {
+		return c.JSON(http.StatusOK, resource.NewConfigVersion(m))
+	}
+	return c.JSON(http.StatusCreated, resource.NewConfigVersion(m))
+}
+
+func (h *Handler) handleGetConfigVersion(c echo.Context) error {
+	m, status, err := h.findConfigVersion(c, c.Param("version"))
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewConfigVersion(m))
+}
+
+// handleDiffConfigVersions returns the unified diff of the versions given by
+// the query parameters 'from' and 'to'. The latest version is used if 'to'
+// is missing.
+func (h *Handler) handleDiffConfigVersions(c echo.Context) error {
+	from, status, err := h.findConfigVersion(c, c.QueryParam("from"))
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	var to *model.ConfigVersion
+	if c.QueryParam("to") == "" {
+		to, err = h.configs.Latest(c.Param("namespace"), c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, err)
+		}
+	} else {
+		to, status, err = h.findConfigVersion(c, c.QueryParam("to"))
+		if err != nil {
+			return c.JSON(status, err)
+		}
+	}
+
+	out := diff.Unified(
+		fmt.Sprintf("%s/version-%d", from.DeviceID, from.Version),
+		fmt.Sprintf("%s/version-%d", to.DeviceID, to.Version),
+		from.Content, to.Content, diff.DefaultContext)
+
+	return c.String(http.StatusOK, out)
+}
+
+// handleRestoreConfigVersion pushes the configuration of the version to the
+// device and returns the version of the resulting configuration.
+func (h *Handler) handleRestoreConfigVersion(c echo.Context) error {
+	m, status, err := h.findConfigVersion(c, c.Param("version"))
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	current, err := h.configs.Restore(m)
+	if err != nil {
+		return c.JSON(deviceCallErrorStatus(err), err.Error())
+	}
+
+	return c.JSON(http.StatusOK, resource.NewConfigVersion(current))
+}
+
+// findConfigVersion returns the given version of the device or the status
+// code of the error response.
+func (h *Handler) findConfigVersion(c echo.Context, versionParam string) (*model.ConfigVersion, int, error) {
+	version, err := strconv.Atoi(versionParam)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.configs.FindVersion(c.Param("namespace"), c.Param("id"), version)
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
+
+// deviceCallErrorStatus returns the status code for a failed device call
+func deviceCallErrorStatus(err error) int {
+	if client.IsUnavailable(err) {
+		return http.StatusServiceUnavailable
+	}
+	if _, ok := err.(*client.CallError); ok {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
@@ -2,20 +2,141 @@ package api
 
 import (
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo"
 	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/maintenance"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/selector"
 	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/targeting"
 )
 
+// deviceFilters maps the query parameters of the device list to the
+// filtered fields. A device matches if the field equals the parameter.
+var deviceFilters = map[string]func(m *model.Device) string{
+	"namespace":            func(m *model.Device) string { return m.Namespace },
+	"deviceType":           func(m *model.Device) string { return m.DeviceType },
+	"name":                 func(m *model.Device) string { return m.Name },
+	"location":             func(m *model.Device) string { return m.Location },
+	"assetTag":             func(m *model.Device) string { return m.AssetTag },
+	"group":                func(m *model.Device) string { return m.Group },
+	"hardwareModel":        func(m *model.Device) string { return m.HardwareModel },
+	"hardwareRevision":     func(m *model.Device) string { return m.HardwareRevision },
+	"hardwareSerialNumber": func(m *model.Device) string { return m.HardwareSerialNumber },
+	"firmwareVersion":      func(m *model.Device) string { return m.FirmwareVersion },
+}
+
+// handleFetchDevices returns the devices matching all given filters. The
+// query parameter 'q' searches the device ID, name, location, asset tag,
+// serial number and hostname case-insensitively. The parameter 'selector'
+// filters by labels and 'memberOf' by the device group of the namespace.
 func (h *Handler) handleFetchDevices(c echo.Context) error {
 	m, err := h.store.Devices().FetchAll()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
-	return c.JSON(http.StatusOK, resource.NewDeviceList(m))
+	query := c.QueryParams()
+	search := strings.ToLower(c.QueryParam("q"))
+
+	sel, err := selector.Parse(c.QueryParam("selector"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	var group *model.DeviceGroup
+	if name := c.QueryParam("memberOf"); name != "" {
+		// TODO(DGL) Replace hardcoded namespace
+		namespace := c.QueryParam("namespace")
+		if namespace == "" {
+			namespace = "default"
+		}
+		group, err = h.store.DeviceGroups().FindByNamespaceAndName(namespace, name)
+		if err != nil && err == storage.ErrNotFound {
+			return c.JSON(http.StatusNotFound, err)
+		} else if err != nil {
+			return c.JSON(http.StatusInternalServerError, err)
+		}
+	}
+
+	for id, elem := range m {
+		if !matchesDeviceFilters(&elem, query) || !matchesDeviceSearch(&elem, search) ||
+			!sel.Matches(elem.Labels) || (group != nil && !targeting.IsMember(group, &elem)) {
+			delete(m, id)
+		}
+	}
+
+	out := resource.NewDeviceList(m)
+	if err := h.setConnectionStatus(out.Members...); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// setConnectionStatus sets the connection status of the devices. Devices in
+// a maintenance window are reported as MAINTENANCE.
+func (h *Handler) setConnectionStatus(devices ...*resource.DeviceResource) error {
+	sessions, err := h.store.Sessions().FetchAll()
+	if err != nil {
+		return err
+	}
+	windows, err := h.store.Maintenances().FetchAll()
+	if err != nil {
+		return err
+	}
+
+	connected := make(map[string]bool)
+	for _, elem := range sessions {
+		connected[elem.Namespace+"/"+elem.DeviceID] = true
+	}
+	inMaintenance := make(map[string]bool)
+	now := time.Now()
+	for _, elem := range windows {
+		if elem.Until.After(now) {
+			inMaintenance[elem.Namespace+"/"+elem.DeviceID] = true
+		}
+	}
+
+	for _, r := range devices {
+		key := r.Namespace + "/" + r.DeviceID
+		switch {
+		case inMaintenance[key]:
+			r.ConnectionStatus = maintenance.StatusMaintenance
+		case connected[key]:
+			r.ConnectionStatus = "CONNECTED"
+		default:
+			r.ConnectionStatus = "DISCONNECTED"
+		}
+	}
+
+	return nil
+}
+
+func matchesDeviceFilters(m *model.Device, query url.Values) bool {
+	for param, field := range deviceFilters {
+		if _, ok := query[param]; ok && field(m) != query.Get(param) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesDeviceSearch(m *model.Device, search string) bool {
+	if search == "" {
+		return true
+	}
+	for _, v := range []string{m.DeviceID, m.Name, m.Location, m.AssetTag, m.HardwareSerialNumber, m.NetworkHostname} {
+		if strings.Contains(strings.ToLower(v), search) {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Handler) handleGetDeviceByID(c echo.Context) error {
@@ -32,7 +153,12 @@ func (h *Handler) handleGetDeviceByID(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, err)
 	}
 
-	return c.JSON(http.StatusOK, resource.NewDevice(m))
+	out := resource.NewDevice(m)
+	if err := h.setConnectionStatus(out); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, out)
 }
 
 func (h *Handler) handleCreateDevice(c echo.Context) error {
@@ -54,6 +180,111 @@ func (h *Handler) handleCreateDevice(c echo.Context) error {
 	return c.JSON(http.StatusCreated, resource.NewDevice(m))
 }
 
+// handleUpdateDevice replaces the settings and the inventory details of the
+// device. The namespace and the device ID can't be changed.
+func (h *Handler) handleUpdateDevice(c echo.Context) error {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	r := &resource.DeviceResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateDevice(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	existing, err := h.store.Devices().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if m.Namespace != existing.Namespace || m.DeviceID != existing.DeviceID {
+		return c.JSON(http.StatusBadRequest, "namespace and deviceId can't be changed")
+	}
+	m.ID = existing.ID
+	m.CreatedAt = existing.CreatedAt
+
+	// Keep the connection parameters if they're omitted
+	if m.SessionTimeout == 0 {
+		m.SessionTimeout = existing.SessionTimeout
+	}
+	if m.PingInterval == 0 {
+		m.PingInterval = existing.PingInterval
+	}
+	if m.PongTimeout == 0 {
+		m.PongTimeout = existing.PongTimeout
+	}
+	if m.EventsTopic == "" {
+		m.EventsTopic = existing.EventsTopic
+	}
+	if m.Labels == nil {
+		m.Labels = existing.Labels
+	}
+
+	err = h.store.Devices().Update(m)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewDevice(m))
+}
+
+func (h *Handler) handleGetDeviceLabels(c echo.Context) error {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := h.store.Devices().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewDevice(m).Labels)
+}
+
+// handleReplaceDeviceLabels replaces all labels of the device
+func (h *Handler) handleReplaceDeviceLabels(c echo.Context) error {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	labels := make(map[string]string)
+	if err := c.Bind(&labels); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if err := resource.ValidateLabels(labels); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	m, err := h.store.Devices().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	m.Labels = labels
+	if err := h.store.Devices().Update(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewDevice(m).Labels)
+}
+
 func (h *Handler) handleDeleteDevice(c echo.Context) error {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/targeting"
+)
+
+func (h *Handler) handleFetchDeviceGroups(c echo.Context) error {
+	m, err := h.store.DeviceGroups().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if namespace := c.QueryParam("namespace"); namespace != "" {
+		for id, elem := range m {
+			if elem.Namespace != namespace {
+				delete(m, id)
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, resource.NewDeviceGroupList(m))
+}
+
+func (h *Handler) handleGetDeviceGroupByID(c echo.Context) error {
+	m, status, err := h.findDeviceGroup(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewDeviceGroup(m))
+}
+
+// handleCreateDeviceGroup creates a group with static members and/or a label
+// selector. The name of the group must be unique within the namespace.
+func (h *Handler) handleCreateDeviceGroup(c echo.Context) error {
+	r := &resource.DeviceGroupResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateDeviceGroup(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	_, err = h.store.DeviceGroups().FindByNamespaceAndName(m.Namespace, m.Name)
+	if err == nil {
+		return c.JSON(http.StatusConflict, "group already exists")
+	} else if err != storage.ErrNotFound {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if err := h.store.DeviceGroups().Create(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, resource.NewDeviceGroup(m))
+}
+
+// handleUpdateDeviceGroup replaces the description, the selector and the
+// static members of the group. The namespace and the name can't be changed.
+func (h *Handler) handleUpdateDeviceGroup(c echo.Context) error {
+	existing, status, err := h.findDeviceGroup(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	r := &resource.DeviceGroupResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateDeviceGroup(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if m.Namespace != existing.Namespace || m.Name != existing.Name {
+		return c.JSON(http.StatusBadRequest, "namespace and name can't be changed")
+	}
+	m.ID = existing.ID
+	m.CreatedAt = existing.CreatedAt
+
+	if err := h.store.DeviceGroups().Update(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewDeviceGroup(m))
+}
+
+func (h *Handler) handleDeleteDeviceGroup(c echo.Context) error {
+	m, status, err := h.findDeviceGroup(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	if err := h.store.DeviceGroups().Delete(m.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// handleFetchDeviceGroupMembers returns the devices which are currently
+// members of the group
+func (h *Handler) handleFetchDeviceGroupMembers(c echo.Context) error {
+	g, status, err := h.findDeviceGroup(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	devices, err := targeting.Members(h.store, g)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	m := make(map[int32]model.Device, len(devices))
+	for _, d := range devices {
+		m[d.ID] = d
+	}
+
+	out := resource.NewDeviceList(m)
+	if err := h.setConnectionStatus(out.Members...); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, out)
+}
+
+// findDeviceGroup returns the group of the path parameter 'gid' or the
+// status code of the error response.
+func (h *Handler) findDeviceGroup(c echo.Context) (*model.DeviceGroup, int, error) {
+	id, err := strconv.Atoi(c.Param("gid"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.store.DeviceGroups().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+func newDeviceTestHandler(t *testing.T) *Handler {
+	store := memory.NewStore()
+	for _, m := range []*model.Device{
+		{Namespace: "default", DeviceID: "dev1", DeviceURI: "dev1", SessionTimeout: 120, PingInterval: 30, PongTimeout: 10,
+			Name: "Gateway", Location: "Lab 1", HardwareModel: "m1", FirmwareVersion: "2.0"},
+		{Namespace: "default", DeviceID: "dev2", DeviceURI: "dev2",
+			Name: "Router", Location: "Basement", HardwareModel: "m1", FirmwareVersion: "1.0", NetworkHostname: "lab-router"},
+		{Namespace: "other", DeviceID: "dev3", DeviceURI: "dev3", HardwareModel: "m2", HardwareSerialNumber: "SN-42"},
+	} {
+		if err := store.Devices().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &Handler{store: store}
+}
+
+func TestFetchDevicesFilters(t *testing.T) {
+	h := newDeviceTestHandler(t)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"dev1", "dev2", "dev3"}},
+		{"namespace=default", []string{"dev1", "dev2"}},
+		{"hardwareModel=m1", []string{"dev1", "dev2"}},
+		{"hardwareModel=m1&firmwareVersion=2.0", []string{"dev1"}},
+		// An empty filter matches the devices without the field
+		{"location=", []string{"dev3"}},
+		// The search matches the hostname and the serial number too
+		{"q=LAB", []string{"dev1", "dev2"}},
+		{"q=sn-4", []string{"dev3"}},
+		{"q=unknown", []string{}},
+	}
+
+	for _, tc := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil)
+		rec := httptest.NewRecorder()
+		if err := h.handleFetchDevices(e.NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", tc.query, rec.Code, http.StatusOK)
+			continue
+		}
+
+		out := resource.DeviceListResource{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(out.Members))
+		for _, r := range out.Members {
+			got = append(got, r.DeviceID)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: devices = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func updateDevice(h *Handler, id, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id)
+	h.handleUpdateDevice(c)
+	return rec
+}
+
+func TestUpdateDevice(t *testing.T) {
+	h := newDeviceTestHandler(t)
+
+	tests := []struct {
+		name string
+		id   string
+		body string
+		want int
+	}{
+		{"unknown device", "99", `{"namespace":"default","deviceId":"dev1","deviceUri":"dev1"}`, http.StatusNotFound},
+		{"changed device ID", "1", `{"namespace":"default","deviceId":"devX","deviceUri":"dev1"}`, http.StatusBadRequest},
+		{"changed namespace", "1", `{"namespace":"other","deviceId":"dev1","deviceUri":"dev1"}`, http.StatusBadRequest},
+		{"inventory", "1", `{"namespace":"default","deviceId":"dev1","deviceUri":"dev1","name":"Edge","assetTag":"A-1"}`, http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		if rec := updateDevice(h, tc.id, tc.body); rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tc.name, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+
+	// The omitted connection parameters are kept
+	m, err := h.store.Devices().FindByID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "Edge" || m.AssetTag != "A-1" {
+		t.Errorf("inventory = %q, %q, want Edge, A-1", m.Name, m.AssetTag)
+	}
+	if m.SessionTimeout != 120 || m.PingInterval != 30 || m.PongTimeout != 10 {
+		t.Errorf("connection parameters = %d, %d, %d, want 120, 30, 10", m.SessionTimeout, m.PingInterval, m.PongTimeout)
+	}
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/outbox"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	// feedBuffer is the number of events buffered per feed. Feeds which
+	// aren't consumed fast enough overflow.
+	feedBuffer = 256
+
+	// feedMaxPending limits the live events queued while stored events are
+	// replayed
+	feedMaxPending = 4096
+
+	// feedReplayPageSize is the number of stored events fetched at once
+	feedReplayPageSize = 500
+
+	// feedDedupWindow is the age of the replayed events which are expected
+	// live as well. Older events are published already, unless the outbox
+	// relay was stuck, they aren't remembered for skipping the live copy.
+	feedDedupWindow = 10 * time.Minute
+)
+
+// errFeedOverflow is returned if the live events queued during a replay
+// exceed the limit
+var errFeedOverflow = errors.New("too many events during replay")
+
+// eventFilter selects events by namespace, topic and source device. Empty
+// fields match everything.
+type eventFilter struct {
+	Namespace string
+	Topic     string
+	DeviceID  string
+}
+
+func (f eventFilter) validate() error {
+	for _, token := range []string{f.Namespace, f.Topic} {
+		if strings.ContainsAny(token, ".*> \t") {
+			return errors.Errorf("invalid filter '%s'", token)
+		}
+	}
+	return nil
+}
+
+// subject returns the NATS subject of the events matching the namespace and
+// the topic
+func (f eventFilter) subject() string {
+	return fmt.Sprintf("iotcore.devicecontrol.v1.%s.events.%s", wildcard(f.Namespace), wildcard(f.Topic))
+}
+
+func (f eventFilter) matches(m *model.Event) bool {
+	return (f.Namespace == "" || f.Namespace == m.Namespace) &&
+		(f.Topic == "" || f.Topic == m.Topic) &&
+		(f.DeviceID == "" || f.DeviceID == m.SourceID)
+}
+
+// feedEvent is an event of a feed. The ID is the publication ID of stored
+// events and 0 for events which aren't stored, e.g. device status changes.
+type feedEvent struct {
+	ID    int32
+	Event *resource.RealtimeEventResource
+}
+
+// eventFeed streams the live events matching a filter. A feed which replays
+// the stored events queues the live events until the replay is finished. The
+// queued events which were sent by the replay or queued before are skipped by
+// their publication ID. Hence the consumer gets all events without gaps or
+// duplicates.
+type eventFeed struct {
+	filter       eventFilter
+	subscription string
+	sub          *nats.Subscription
+
+	mu         sync.Mutex
+	replaying  bool
+	pending    []*nats.Msg
+	subscribed time.Time
+	sent       map[int32]bool
+
+	eventCh    chan feedEvent
+	overflowCh chan struct{}
+	closeCh    chan struct{}
+	closeOnce  sync.Once
+	overflowed sync.Once
+}
+
+// newEventFeed subscribes the events of the filter. The events are labeled
+// with the subscription. If replay is true the live events are held back
+// until replay is called.
+func newEventFeed(nc *nats.Conn, filter eventFilter, subscription string, replay bool) (*eventFeed, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	f := &eventFeed{
+		filter:       filter,
+		subscription: subscription,
+		replaying:    replay,
+		subscribed:   time.Now().UTC(),
+		sent:         make(map[int32]bool),
+		eventCh:      make(chan feedEvent, feedBuffer),
+		overflowCh:   make(chan struct{}),
+		closeCh:      make(chan struct{}),
+	}
+
+	sub, err := nc.Subscribe(filter.subject(), f.handleMsg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe events")
+	}
+	f.sub = sub
+
+	return f, nil
+}
+
+// Events returns the channel receiving the events
+func (f *eventFeed) Events() <-chan feedEvent {
+	return f.eventCh
+}
+
+// Overflow is closed if the consumer didn't keep up with the live events
+func (f *eventFeed) Overflow() <-chan struct{} {
+	return f.overflowCh
+}
+
+// Close unsubscribes the events
+func (f *eventFeed) Close() {
+	f.closeOnce.Do(func() {
+		f.sub.Unsubscribe()
+		close(f.closeCh)
+	})
+}
+
+// replay sends the stored events after the publication ID, or stored since
+// the time if it isn't zero, and then the live events queued meanwhile. It
+// blocks until the consumer received the replayed events or the feed is
+// closed.
+func (f *eventFeed) replay(store storage.Interface, afterID int32, since time.Time) error {
+	if !since.IsZero() {
+		first, err := store.Events().FindFirstIDSince(since)
+		if err == storage.ErrNotFound {
+			return f.flushPending()
+		} else if err != nil {
+			return err
+		}
+		afterID = first - 1
+	}
+
+	for {
+		page, err := store.Events().FindAfterID(afterID, feedReplayPageSize)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int32, 0, len(page))
+		for id := range page {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		for _, id := range ids {
+			m := page[id]
+			afterID = id
+			if !f.filter.matches(&m) {
+				continue
+			}
+
+			data, err := outbox.EventMessage(&m)
+			if err != nil {
+				continue
+			}
+
+			if !m.CreatedAt.Before(f.subscribed.Add(-feedDedupWindow)) {
+				f.mu.Lock()
+				f.sent[id] = true
+				f.mu.Unlock()
+			}
+
+			if !f.send(feedEvent{ID: id, Event: resource.NewRealtimeEvent(f.subscription, m.Namespace, m.Topic, data)}) {
+				return nil
+			}
+		}
+
+		if len(page) < feedReplayPageSize {
+			break
+		}
+	}
+
+	return f.flushPending()
+}
+
+// flushPending sends the live events queued during the replay and switches
+// to live delivery. The events are sent without holding the lock, the events
+// queued meanwhile are sent in the next round.
+func (f *eventFeed) flushPending() error {
+	for {
+		f.mu.Lock()
+		if len(f.pending) >= feedMaxPending {
+			f.mu.Unlock()
+			return errFeedOverflow
+		}
+		if len(f.pending) == 0 {
+			f.replaying = false
+			f.sent = nil
+			f.mu.Unlock()
+			return nil
+		}
+
+		events := make([]feedEvent, 0, len(f.pending))
+		for _, msg := range f.pending {
+			if ev, ok := f.decode(msg); ok {
+				events = append(events, ev)
+			}
+		}
+		f.pending = nil
+		f.mu.Unlock()
+
+		for _, ev := range events {
+			if !f.send(ev) {
+				return nil
+			}
+		}
+	}
+}
+
+func (f *eventFeed) handleMsg(msg *nats.Msg) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.replaying {
+		if len(f.pending) < feedMaxPending {
+			f.pending = append(f.pending, msg)
+		}
+		return
+	}
+
+	ev, ok := f.decode(msg)
+	if !ok {
+		return
+	}
+
+	select {
+	case f.eventCh <- ev:
+	default:
+		f.overflowed.Do(func() { close(f.overflowCh) })
+	}
+}
+
+// decode converts the message to an event. It returns false if the event
+// doesn't match the device filter or was replayed or queued already. The
+// caller must hold the lock.
+func (f *eventFeed) decode(msg *nats.Msg) (feedEvent, bool) {
+	// Get namespace and topic from NATS subject
+	strippedSubject := strings.TrimPrefix(msg.Subject, "iotcore.devicecontrol.v1.")
+	s := strings.Split(strippedSubject, ".")
+	if len(s) != 3 {
+		return feedEvent{}, false
+	}
+	namespace := s[0]
+	topic := s[2]
+
+	var data interface{}
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		return feedEvent{}, false
+	}
+
+	fields, _ := data.(map[string]interface{})
+	if f.filter.DeviceID != "" {
+		if id, _ := fields["source_id"].(string); id != f.filter.DeviceID {
+			return feedEvent{}, false
+		}
+	}
+
+	var id int32
+	if n, ok := fields["publication_id"].(float64); ok {
+		id = int32(n)
+	}
+	if id > 0 {
+		if f.sent[id] {
+			return feedEvent{}, false
+		}
+		if f.replaying {
+			f.sent[id] = true
+		}
+	}
+
+	return feedEvent{ID: id, Event: resource.NewRealtimeEvent(f.subscription, namespace, topic, data)}, true
+}
+
+// send blocks until the consumer received the event. It returns false if
+// the feed is closed.
+func (f *eventFeed) send(ev feedEvent) bool {
+	select {
+	case f.eventCh <- ev:
+		return true
+	case <-f.closeCh:
+		return false
+	}
+}
+
+// wildcard returns the NATS wildcard for an empty subject token
+func wildcard(token string) string {
+	if token == "" {
+		return "*"
+	}
+	return token
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// runServer starts an embedded NATS server and returns a connection to it
+func runServer(t *testing.T) (*nats.Conn, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nc, func() {
+		nc.Close()
+		s.Shutdown()
+	}
+}
+
+// publishLive publishes the event like the outbox relay
+func publishLive(t *testing.T, nc *nats.Conn, id int32) {
+	data := fmt.Sprintf(`{"source_type":"DEVICE","source_id":"dev1","publication_id":%d,"details":{}}`, id)
+	if err := nc.Publish("iotcore.devicecontrol.v1.default.events.alert", []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitPending waits until the feed queued the live events
+func waitPending(t *testing.T, f *eventFeed, n int) {
+	for i := 0; i < 100; i++ {
+		f.mu.Lock()
+		queued := len(f.pending)
+		f.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("feed didn't queue %d live events", n)
+}
+
+func expectFeedEvents(t *testing.T, f *eventFeed, ids ...int32) {
+	for _, want := range ids {
+		select {
+		case ev := <-f.Events():
+			if ev.ID != want {
+				t.Fatalf("feed sent event %d, want %d", ev.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("feed didn't send event %d", want)
+		}
+	}
+	select {
+	case ev := <-f.Events():
+		t.Fatalf("feed sent unexpected event %d", ev.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEventFeedReplay(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	// The third event can't be replayed, it's sent live only. That's the
+	// case of an event which is stored after the replay passed its ID.
+	store := memory.NewStore()
+	for _, details := range []string{`{}`, `{}`, `invalid`, `{}`} {
+		m := &model.Event{Namespace: "default", SourceType: "DEVICE", SourceID: "dev1",
+			Topic: "alert", Timestamp: time.Now().UTC(), Details: details}
+		if err := store.Events().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := newEventFeed(nc, eventFilter{Namespace: "default"}, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The live events arrive during the replay, twice because of a retry
+	for _, id := range []int32{2, 3, 4, 5, 5} {
+		publishLive(t, nc, id)
+	}
+	waitPending(t, f, 5)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- f.replay(store, 0, time.Time{}) }()
+
+	expectFeedEvents(t, f, 1, 2, 4, 3, 5)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	// The feed is live after the replay
+	publishLive(t, nc, 6)
+	expectFeedEvents(t, f, 6)
+}
+
+func TestEventFeedReplayAfterID(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	store := memory.NewStore()
+	for _, deviceID := range []string{"dev1", "dev2", "dev1"} {
+		m := &model.Event{Namespace: "default", SourceType: "DEVICE", SourceID: deviceID,
+			Topic: "alert", Timestamp: time.Now().UTC(), Details: `{}`}
+		if err := store.Events().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := newEventFeed(nc, eventFilter{DeviceID: "dev1"}, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	go f.replay(store, 1, time.Time{})
+	expectFeedEvents(t, f, 3)
+}
+
+func TestEventFeedOverflow(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	f, err := newEventFeed(nc, eventFilter{}, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.mu.Lock()
+	for i := 0; i < feedMaxPending; i++ {
+		f.pending = append(f.pending, &nats.Msg{})
+	}
+	f.mu.Unlock()
+
+	if err := f.replay(memory.NewStore(), 0, time.Time{}); err != errFeedOverflow {
+		t.Errorf("replay = %v, want overflow", err)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// sseKeepAliveInterval is the interval of the keep-alive comments
+	sseKeepAliveInterval = 15 * time.Second
+
+	// sseRetry is the reconnect delay proposed to the clients in
+	// milliseconds
+	sseRetry = 5000
+)
+
+// handleStreamEvents streams the events as Server-Sent Events. The events
+// are filtered by the query parameters 'namespace', 'topic' and 'deviceId'.
+// Stored events carry their publication ID as event ID. A client resuming
+// with the header 'Last-Event-ID', or the query parameter 'lastEventId',
+// receives the stored events it missed before the live events. Likewise the
+// query parameter 'since' replays the events stored since an RFC 3339 time.
+// Events which aren't stored, e.g. device status changes, can't be resumed.
+func (h *Handler) handleStreamEvents(c echo.Context) error {
+	filter := eventFilter{
+		Namespace: c.QueryParam("namespace"),
+		Topic:     c.QueryParam("topic"),
+		DeviceID:  c.QueryParam("deviceId"),
+	}
+	if err := filter.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("lastEventId")
+	}
+	var afterID int
+	if lastEventID != "" {
+		var err error
+		if afterID, err = strconv.Atoi(lastEventID); err != nil || afterID < 0 {
+			return c.JSON(http.StatusBadRequest, "invalid last event ID")
+		}
+	}
+
+	var since time.Time
+	if s := c.QueryParam("since"); s != "" && afterID == 0 {
+		var err error
+		if since, err = time.Parse(time.RFC3339, s); err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid since, expected RFC 3339 time")
+		}
+	}
+	replay := afterID > 0 || !since.IsZero()
+
+	feed, err := newEventFeed(h.nc, filter, "", replay)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	defer feed.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprintf(res, "retry: %d\n\n", sseRetry)
+	res.Flush()
+
+	replayErrCh := make(chan error, 1)
+	if replay {
+		go func() {
+			replayErrCh <- feed.replay(h.store, int32(afterID), since)
+		}()
+	}
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev := <-feed.Events():
+			data, err := json.Marshal(ev.Event)
+			if err != nil {
+				log.Error("api: failed to marshal event: ", err)
+				continue
+			}
+			if ev.ID > 0 {
+				fmt.Fprintf(res, "id: %d\n", ev.ID)
+			}
+			if _, err := fmt.Fprintf(res, "data: %s\n\n", data); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case err := <-replayErrCh:
+			if err != nil {
+				log.Error("api: failed to replay events: ", err)
+				return nil
+			}
+		case <-feed.Overflow():
+			log.Warnf("api: event stream client %s closed, it doesn't keep up", c.RealIP())
+			return nil
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+func newEventStreamTestServer(t *testing.T) (*Handler, *httptest.Server, func()) {
+	nc, shutdown := runServer(t)
+
+	store := memory.NewStore()
+	for _, deviceID := range []string{"dev1", "dev2", "dev1"} {
+		m := &model.Event{Namespace: "default", SourceType: "DEVICE", SourceID: deviceID,
+			Topic: "alert", Timestamp: time.Now().UTC(), Details: `{}`}
+		if err := store.Events().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &Handler{nc: nc, store: store}
+	e := echo.New()
+	e.GET("/events/stream", h.handleStreamEvents)
+	srv := httptest.NewServer(e)
+
+	return h, srv, func() {
+		srv.Close()
+		shutdown()
+	}
+}
+
+// sseEvent is an event of the stream, comments are ignored
+type sseEvent struct {
+	id    string
+	data  string
+	retry string
+}
+
+// nextSSEEvent reads the lines of the next event
+func nextSSEEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	ev := sseEvent{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if ev != (sseEvent{}) {
+				return ev
+			}
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		case strings.HasPrefix(line, "retry: "):
+			ev.retry = strings.TrimPrefix(line, "retry: ")
+		}
+	}
+}
+
+func TestStreamEventsInvalid(t *testing.T) {
+	_, srv, shutdown := newEventStreamTestServer(t)
+	defer shutdown()
+
+	for _, query := range []string{
+		"topic=a.b",
+		"namespace=a>",
+		"lastEventId=abc",
+		"lastEventId=-1",
+		"since=yesterday",
+	} {
+		res, err := http.Get(srv.URL + "/events/stream?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, res.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestStreamEventsResume(t *testing.T) {
+	h, srv, shutdown := newEventStreamTestServer(t)
+	defer shutdown()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events/stream?deviceId=dev1", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Errorf("content type = %q, want text/event-stream", ct)
+	}
+
+	r := bufio.NewReader(res.Body)
+	if ev := nextSSEEvent(t, r); ev.retry != "5000" {
+		t.Errorf("first event = %+v, want the retry delay", ev)
+	}
+
+	// The stored event of the device after the last event ID is replayed,
+	// then the live events follow
+	if ev := nextSSEEvent(t, r); ev.id != "3" || !strings.Contains(ev.data, `"source_id":"dev1"`) {
+		t.Errorf("replayed event = %+v, want event 3 of dev1", ev)
+	}
+
+	publishLive(t, h.nc, 4)
+	if ev := nextSSEEvent(t, r); ev.id != "4" {
+		t.Errorf("live event = %+v, want event 4", ev)
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/filetransfer"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+// multipartOverhead is the size allowed for the multipart envelope of an
+// uploaded file
+const multipartOverhead = 64 * 1024
+
+// handleUploadFile stores the request body, or the form file 'file' of a
+// multipart request, and transfers it to the path given by the query
+// parameter 'path' on the device.
+func (h *Handler) handleUploadFile(c echo.Context) error {
+	namespace := c.Param("namespace")
+	deviceID := c.Param("id")
+
+	filePath := c.QueryParam("path")
+	if filePath == "" {
+		return c.JSON(http.StatusBadRequest, "query parameter 'path' is required")
+	}
+
+	_, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	// Reject uploads which exceed the maximum size before reading them. The
+	// multipart envelope adds a little to the size of the file.
+	if max := h.transfers.MaxUploadSize(); max > 0 {
+		if c.Request().ContentLength > max+multipartOverhead {
+			return c.JSON(http.StatusRequestEntityTooLarge, filetransfer.ErrFileTooLarge.Error())
+		}
+		c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, max+multipartOverhead)
+	}
+
+	var r io.Reader = c.Request().Body
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	m, err := h.transfers.Upload(namespace, deviceID, filePath, r)
+	if err != nil && err == filetransfer.ErrFileTooLarge {
+		return c.JSON(http.StatusRequestEntityTooLarge, err.Error())
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusAccepted, resource.NewFileTransfer(m))
+}
+
+// handleDownloadFile starts retrieving a file from the device. The content
+// is available after the transfer completed.
+func (h *Handler) handleDownloadFile(c echo.Context) error {
+	namespace := c.Param("namespace")
+	deviceID := c.Param("id")
+
+	r := &resource.FileTransferRequestResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if r.Path == "" {
+		return c.JSON(http.StatusBadRequest, "path is required")
+	}
+
+	_, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	m, err := h.transfers.Download(namespace, deviceID, r.Path)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusAccepted, resource.NewFileTransfer(m))
+}
+
+func (h *Handler) handleFetchFileTransfers(c echo.Context) error {
+	m, err := h.store.FileTransfers().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFileTransferList(m))
+}
+
+func (h *Handler) handleGetFileTransferByID(c echo.Context) error {
+	m, status, err := h.findFileTransfer(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFileTransfer(m))
+}
+
+// handleGetFileTransferContent returns the content of an uploaded file or a
+// completely retrieved file.
+func (h *Handler) handleGetFileTransferContent(c echo.Context) error {
+	m, status, err := h.findFileTransfer(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	if m.Direction == model.FileTransferDirectionDownload && m.Status != model.FileTransferStatusCompleted {
+		return c.JSON(http.StatusConflict, fmt.Sprintf("file transfer is %s", m.Status))
+	}
+
+	return c.Attachment(h.transfers.BlobPath(m), path.Base(m.Path))
+}
+
+// findFileTransfer returns the transfer given by the ID parameter or the
+// status code of the error response.
+func (h *Handler) findFileTransfer(c echo.Context) (*model.FileTransfer, int, error) {
+	idParam := c.Param("tid")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.store.FileTransfers().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
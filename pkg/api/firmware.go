@@ -0,0 +1,209 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+// handleCreateFirmwareImage adds the form file 'file' of a multipart request
+// to the firmware repository. The form values 'version' and the comma
+// separated 'hardwareModels' describe the image.
+func (h *Handler) handleCreateFirmwareImage(c echo.Context) error {
+	version := c.FormValue("version")
+	if version == "" {
+		return c.JSON(http.StatusBadRequest, "version is required")
+	}
+
+	hardwareModels := make([]string, 0)
+	for _, elem := range strings.Split(c.FormValue("hardwareModels"), ",") {
+		if s := strings.TrimSpace(elem); s != "" {
+			hardwareModels = append(hardwareModels, s)
+		}
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	defer f.Close()
+
+	m, err := h.firmware.Repository().Add(version, hardwareModels, fh.Filename, f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, resource.NewFirmwareImage(m))
+}
+
+func (h *Handler) handleFetchFirmwareImages(c echo.Context) error {
+	m, err := h.store.FirmwareImages().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFirmwareImageList(m))
+}
+
+func (h *Handler) handleGetFirmwareImageByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("iid"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := h.store.FirmwareImages().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFirmwareImage(m))
+}
+
+// handleDeleteFirmwareImage removes an image which isn't used by any
+// campaign.
+func (h *Handler) handleDeleteFirmwareImage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("iid"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	_, err = h.store.FirmwareImages().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	campaigns, err := h.store.FirmwareCampaigns().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	for _, elem := range campaigns {
+		if elem.ImageID == int32(id) {
+			return c.JSON(http.StatusConflict, fmt.Sprintf("image is used by campaign %d", elem.ID))
+		}
+	}
+
+	if err := h.firmware.Repository().Delete(int32(id)); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleCreateFirmwareCampaign(c echo.Context) error {
+	r := &resource.FirmwareCampaignRequestResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if r.Namespace == "" {
+		return c.JSON(http.StatusBadRequest, "namespace is required")
+	}
+	if r.BatchSize < 1 {
+		return c.JSON(http.StatusBadRequest, "batchSize must be greater than zero")
+	}
+	if r.MaxFailureRate < 0 || r.MaxFailureRate > 1 {
+		return c.JSON(http.StatusBadRequest, "maxFailureRate must be between 0 and 1")
+	}
+
+	_, err := h.store.FirmwareImages().FindByID(r.ImageID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusBadRequest, "image does not exist")
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	m, err := h.firmware.CreateCampaign(r.Namespace, r.ImageID, r.DeviceIDs, r.BatchSize, r.MaxFailureRate)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, resource.NewFirmwareCampaign(m))
+}
+
+func (h *Handler) handleFetchFirmwareCampaigns(c echo.Context) error {
+	m, err := h.store.FirmwareCampaigns().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFirmwareCampaignList(m))
+}
+
+func (h *Handler) handleGetFirmwareCampaignByID(c echo.Context) error {
+	m, status, err := h.findFirmwareCampaign(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	updates, err := h.store.FirmwareUpdates().FindByCampaignID(m.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFirmwareCampaignWithUpdates(m, updates))
+}
+
+func (h *Handler) handleHaltFirmwareCampaign(c echo.Context) error {
+	m, status, err := h.findFirmwareCampaign(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+	if m.Status != model.FirmwareCampaignStatusRunning {
+		return c.JSON(http.StatusConflict, fmt.Sprintf("campaign is %s", m.Status))
+	}
+
+	m, err = h.firmware.HaltCampaign(m.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFirmwareCampaign(m))
+}
+
+func (h *Handler) handleResumeFirmwareCampaign(c echo.Context) error {
+	m, status, err := h.findFirmwareCampaign(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+	if m.Status != model.FirmwareCampaignStatusHalted {
+		return c.JSON(http.StatusConflict, fmt.Sprintf("campaign is %s", m.Status))
+	}
+
+	m, err = h.firmware.ResumeCampaign(m.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewFirmwareCampaign(m))
+}
+
+// findFirmwareCampaign returns the campaign given by the ID parameter or the
+// status code of the error response.
+func (h *Handler) findFirmwareCampaign(c echo.Context) (*model.FirmwareCampaign, int, error) {
+	id, err := strconv.Atoi(c.Param("cid"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.store.FirmwareCampaigns().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
@@ -1,23 +1,69 @@
 package api
 
 import (
+	"net"
+
 	"github.com/labstack/echo"
 	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/config"
+	"github.com/nsyszr/lcm/pkg/configarchive"
+	"github.com/nsyszr/lcm/pkg/filetransfer"
+	"github.com/nsyszr/lcm/pkg/firmware"
+	"github.com/nsyszr/lcm/pkg/maintenance"
+	"github.com/nsyszr/lcm/pkg/outbox"
+	"github.com/nsyszr/lcm/pkg/rules"
 	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/telemetry"
+	"github.com/nsyszr/lcm/pkg/twin"
+	"github.com/nsyszr/lcm/pkg/webhook"
 	log "github.com/sirupsen/logrus"
 )
 
 // Handler contains all properties to serve the API
 type Handler struct {
+	cfg   *config.Config
 	nc    *nats.Conn
 	store storage.Interface
+
+	// trustedProxies contains the networks of the proxies which
+	// authenticate the users
+	trustedProxies []*net.IPNet
+
+	cliSessions *userLimiter
+	tunnels     *tunnelRegistry
+	transfers   *filetransfer.Manager
+	firmware    *firmware.Orchestrator
+	configs     *configarchive.Archive
+	twins       *twin.Service
+	maintenance *maintenance.Manager
+	rules       *rules.Engine
+	outbox      *outbox.Relay
+	webhooks    *webhook.Dispatcher
+	telemetry   *telemetry.Service
+	drain       func()
 }
 
 // NewHandler create a new API handler
-func NewHandler(nc *nats.Conn, store storage.Interface) *Handler {
+func NewHandler(cfg *config.Config, nc *nats.Conn, store storage.Interface, transfers *filetransfer.Manager, fw *firmware.Orchestrator, configs *configarchive.Archive, twins *twin.Service, maint *maintenance.Manager, engine *rules.Engine, relay *outbox.Relay, webhooks *webhook.Dispatcher, telem *telemetry.Service, drain func()) *Handler {
 	return &Handler{
+		cfg:   cfg,
 		nc:    nc,
 		store: store,
+
+		trustedProxies: parseTrustedProxies(cfg.TrustedProxies),
+
+		cliSessions: newUserLimiter(cfg.CLIMaxSessionsPerUser),
+		tunnels:     newTunnelRegistry(),
+		transfers:   transfers,
+		firmware:    fw,
+		configs:     configs,
+		twins:       twins,
+		maintenance: maint,
+		rules:       engine,
+		outbox:      relay,
+		webhooks:    webhooks,
+		telemetry:   telem,
+		drain:       drain,
 	}
 }
 
@@ -29,13 +75,99 @@ func (h *Handler) RegisterRoutes(e *echo.Echo) {
 	api.GET("/devices", h.handleFetchDevices)
 	api.POST("/devices", h.handleCreateDevice)
 	api.GET("/devices/:id", h.handleGetDeviceByID)
+	api.PUT("/devices/:id", h.handleUpdateDevice)
 	api.DELETE("/devices/:id", h.handleDeleteDevice)
+	api.GET("/devices/:id/labels", h.handleGetDeviceLabels)
+	api.PUT("/devices/:id/labels", h.handleReplaceDeviceLabels)
+	api.GET("/devices/:id/maintenance", h.handleGetDeviceMaintenance)
+	api.PUT("/devices/:id/maintenance", h.handleSetDeviceMaintenance)
+	api.DELETE("/devices/:id/maintenance", h.handleEndDeviceMaintenance)
+	api.GET("/devices/:id/alerts", h.handleFetchDeviceAlerts)
+
+	api.GET("/groups", h.handleFetchDeviceGroups)
+	api.POST("/groups", h.handleCreateDeviceGroup)
+	api.GET("/groups/:gid", h.handleGetDeviceGroupByID)
+	api.PUT("/groups/:gid", h.handleUpdateDeviceGroup)
+	api.DELETE("/groups/:gid", h.handleDeleteDeviceGroup)
+	api.GET("/groups/:gid/devices", h.handleFetchDeviceGroupMembers)
+	api.PUT("/groups/:gid/maintenance", h.handleSetDeviceGroupMaintenance)
+	api.DELETE("/groups/:gid/maintenance", h.handleEndDeviceGroupMaintenance)
+
+	api.GET("/maintenance", h.handleFetchMaintenances)
+
+	api.GET("/rules", h.handleFetchRules)
+	api.POST("/rules", h.handleCreateRule)
+	api.GET("/rules/:rid", h.handleGetRuleByID)
+	api.PUT("/rules/:rid", h.handleUpdateRule)
+	api.DELETE("/rules/:rid", h.handleDeleteRule)
+
+	api.GET("/alerts", h.handleFetchAlerts)
+	api.GET("/alerts/:aid", h.handleGetAlertByID)
+	api.POST("/alerts/:aid/acknowledge", h.handleAcknowledgeAlert)
+	api.POST("/alerts/:aid/resolve", h.handleResolveAlert)
+
+	api.GET("/webhooks", h.handleFetchWebhooks)
+	api.POST("/webhooks", h.handleCreateWebhook)
+	api.GET("/webhooks/deadletters", h.handleFetchWebhookDeadLetters)
+	api.POST("/webhooks/deliveries/:did/redeliver", h.handleRedeliverWebhookDelivery)
+	api.GET("/webhooks/:wid", h.handleGetWebhookByID)
+	api.PUT("/webhooks/:wid", h.handleUpdateWebhook)
+	api.DELETE("/webhooks/:wid", h.handleDeleteWebhook)
+	api.GET("/webhooks/:wid/deliveries", h.handleFetchWebhookDeliveries)
+
+	api.GET("/telemetry/mappings", h.handleFetchMetricMappings)
+	api.POST("/telemetry/mappings", h.handleCreateMetricMapping)
+	api.GET("/telemetry/mappings/:mid", h.handleGetMetricMappingByID)
+	api.PUT("/telemetry/mappings/:mid", h.handleUpdateMetricMapping)
+	api.DELETE("/telemetry/mappings/:mid", h.handleDeleteMetricMapping)
+	api.GET("/telemetry/series/:namespace/:id/:metric", h.handleQueryTelemetry)
 
 	api.GET("/sessions", h.handleFetchSessions)
 
+	api.POST("/admin/drain", h.handleDrain)
+
 	api.GET("/events", h.handleFetchEvents)
+	api.GET("/events/stream", h.handleStreamEvents)
 
 	api.POST("/call/:namespace/:id", h.handleCallRequest)
+	api.DELETE("/commands/:id", h.handleCancelCallRequest)
+	api.POST("/calls/:namespace", h.handleTargetedCallRequest)
+	api.POST("/publish/:namespace", h.handleTargetedPublishRequest)
+
+	api.Any("/cli/:namespace/:id", h.cliHandler())
+	api.GET("/transcripts", h.handleFetchTranscripts)
+	api.GET("/transcripts/:id", h.handleGetTranscriptByID)
+
+	api.GET("/tunnels", h.handleFetchTunnels)
+	api.POST("/tunnels/:namespace/:id", h.handleCreateTunnel)
+	api.DELETE("/tunnels/:tid", h.handleDeleteTunnel)
+
+	api.GET("/files", h.handleFetchFileTransfers)
+	api.GET("/files/:tid", h.handleGetFileTransferByID)
+	api.GET("/files/:tid/content", h.handleGetFileTransferContent)
+	api.POST("/files/:namespace/:id/upload", h.handleUploadFile)
+	api.POST("/files/:namespace/:id/download", h.handleDownloadFile)
+
+	api.GET("/firmware/images", h.handleFetchFirmwareImages)
+	api.POST("/firmware/images", h.handleCreateFirmwareImage)
+	api.GET("/firmware/images/:iid", h.handleGetFirmwareImageByID)
+	api.DELETE("/firmware/images/:iid", h.handleDeleteFirmwareImage)
+	api.GET("/firmware/campaigns", h.handleFetchFirmwareCampaigns)
+	api.POST("/firmware/campaigns", h.handleCreateFirmwareCampaign)
+	api.GET("/firmware/campaigns/:cid", h.handleGetFirmwareCampaignByID)
+	api.POST("/firmware/campaigns/:cid/halt", h.handleHaltFirmwareCampaign)
+	api.POST("/firmware/campaigns/:cid/resume", h.handleResumeFirmwareCampaign)
+
+	api.GET("/configs/:namespace/:id/versions", h.handleFetchConfigVersions)
+	api.POST("/configs/:namespace/:id/versions", h.handleBackupConfig)
+	api.GET("/configs/:namespace/:id/versions/:version", h.handleGetConfigVersion)
+	api.POST("/configs/:namespace/:id/versions/:version/restore", h.handleRestoreConfigVersion)
+	api.GET("/configs/:namespace/:id/diff", h.handleDiffConfigVersions)
+
+	api.GET("/twins", h.handleFetchTwins)
+	api.GET("/twins/:namespace/:id", h.handleGetTwin)
+	api.PUT("/twins/:namespace/:id/desired", h.handleReplaceDesiredState)
+	api.PATCH("/twins/:namespace/:id/desired", h.handleMergeDesiredState)
 
 	api.Any("/realtime-events", h.realtimeEventsHandler())
 }
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/maintenance"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+func (h *Handler) handleFetchMaintenances(c echo.Context) error {
+	m, err := h.store.Maintenances().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if namespace := c.QueryParam("namespace"); namespace != "" {
+		for id, elem := range m {
+			if elem.Namespace != namespace {
+				delete(m, id)
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, resource.NewMaintenanceList(m))
+}
+
+func (h *Handler) handleGetDeviceMaintenance(c echo.Context) error {
+	d, status, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	m, err := maintenance.Active(h.store, d.Namespace, d.DeviceID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	} else if m == nil {
+		return c.JSON(http.StatusNotFound, storage.ErrNotFound)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewMaintenance(m))
+}
+
+// handleSetDeviceMaintenance puts the device into maintenance. The user of
+// the request is recorded.
+func (h *Handler) handleSetDeviceMaintenance(c echo.Context) error {
+	d, status, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	r := &resource.MaintenanceRequestResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	until, err := resource.ValidateMaintenanceRequest(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	m, err := h.maintenance.Set(d.Namespace, d.DeviceID, r.Reason, r.RejectCalls, h.requestUser(c), until)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewMaintenance(m))
+}
+
+func (h *Handler) handleEndDeviceMaintenance(c echo.Context) error {
+	d, status, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	err = h.maintenance.End(d.Namespace, d.DeviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// handleSetDeviceGroupMaintenance puts the group into maintenance. The
+// window applies to the devices while they are members of the group.
+func (h *Handler) handleSetDeviceGroupMaintenance(c echo.Context) error {
+	g, status, err := h.findDeviceGroup(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	r := &resource.MaintenanceRequestResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	until, err := resource.ValidateMaintenanceRequest(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	m, err := h.maintenance.SetGroup(g, r.Reason, r.RejectCalls, h.requestUser(c), until)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewMaintenance(m))
+}
+
+// handleEndDeviceGroupMaintenance ends the maintenance of the group. The
+// windows of the members themselves aren't ended.
+func (h *Handler) handleEndDeviceGroupMaintenance(c echo.Context) error {
+	g, status, err := h.findDeviceGroup(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	err = h.maintenance.EndGroup(g)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// rejectCall returns the error reply if the device is in a maintenance
+// window which rejects calls and the user of the request isn't an admin.
+// It returns nil if the call is allowed.
+func (h *Handler) rejectCall(c echo.Context, namespace, deviceID string) (*message.CallReply, error) {
+	m, err := maintenance.Active(h.store, namespace, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || !m.RejectCalls {
+		return nil, nil
+	}
+	if _, ok := h.adminUser(c); ok {
+		return nil, nil
+	}
+
+	return &message.CallReply{
+		Status:       message.ReplyStatusError,
+		ErrorReason:  proto.ErrReasonDeviceInMaintenance.String(),
+		ErrorDetails: resource.NewMaintenance(m),
+	}, nil
+}
+
+// findDevice returns the device of the path parameter 'id' or the status
+// code of the error response.
+func (h *Handler) findDevice(c echo.Context) (*model.Device, int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.store.Devices().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
@@ -2,16 +2,46 @@ package api
 
 import (
 	"encoding/json"
-	"strings"
+	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/labstack/echo"
 	"github.com/nats-io/nats.go"
 	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// realtimeSendBuffer is the number of frames buffered per connection.
+	// Clients which don't keep up are disconnected.
+	realtimeSendBuffer = 256
+
+	// realtimeHeartbeatInterval is the interval of the heartbeat frames
+	realtimeHeartbeatInterval = 30 * time.Second
+
+	// realtimeWriteTimeout limits the time a frame may take to be written
+	realtimeWriteTimeout = 10 * time.Second
+
+	// realtimeMaxSubscriptions limits the subscriptions per connection
+	realtimeMaxSubscriptions = 64
+
+	// realtimeDefaultSubscription is the ID of the subscription created from
+	// the query parameters when the connection is opened
+	realtimeDefaultSubscription = "default"
+)
+
+// realtimeEventsHandler upgrades the request to a websocket streaming the
+// events. The connection starts with a subscription built from the query
+// parameters 'namespace', 'topic', 'deviceId', 'sinceId' and 'since', which
+// matches all events without parameters. It's omitted with 'subscribe=false'.
+// Clients send subscribe and unsubscribe commands to change their
+// subscriptions.
 func (h *Handler) realtimeEventsHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		conn, _, _, err := ws.UpgradeHTTP(c.Request(), c.Response())
@@ -19,39 +49,307 @@ func (h *Handler) realtimeEventsHandler() echo.HandlerFunc {
 			log.Error("api: failed to upgrade to websocket: ", err)
 			return nil
 		}
-		// go func() {
 		defer conn.Close()
 
-		for {
+		client := newRealtimeClient(h.nc, h.store)
+		defer client.unsubscribeAll()
 
-			if _, err := h.nc.Subscribe("iotcore.devicecontrol.v1.*.events.*", func(msg *nats.Msg) {
-
-				// Get namespace and topic from NATS subject
-				strippedSubject := strings.TrimPrefix(msg.Subject, "iotcore.devicecontrol.v1.")
-				s := strings.Split(strippedSubject, ".")
-				namespace := s[0]
-				topic := s[2]
-
-				// Parse the message and send it
-				var data interface{}
-				if err := json.Unmarshal(msg.Data, &data); err == nil {
-					event := resource.NewRealtimeEvent(namespace, topic, data)
-					out, _ := json.Marshal(event)
-					err = wsutil.WriteServerMessage(conn, ws.OpText, out)
-					if err != nil {
-						log.Error("api: failed to send realtime event: ", err)
-					}
+		if c.QueryParam("subscribe") != "false" {
+			cmd, err := defaultRealtimeCommand(c)
+			if err == nil {
+				var feed *eventFeed
+				if feed, err = client.subscribe(cmd); err == nil {
+					client.startReplay(feed, cmd)
 				}
+			}
+			if err != nil {
+				client.sendJSON(resource.NewRealtimeReply(realtimeDefaultSubscription, err))
+			}
+		}
 
-			}); err != nil {
-				log.Fatal(err)
+		// Read the commands of the client in the background. The reader
+		// stops when the connection is closed.
+		readErrCh := make(chan error, 1)
+		go func() {
+			for {
+				data, op, err := wsutil.ReadClientData(conn)
+				if err != nil {
+					readErrCh <- err
+					return
+				}
+				if op != ws.OpText {
+					continue
+				}
+				client.handleCommand(data)
 			}
+		}()
 
-			select {}
+		heartbeat := time.NewTicker(realtimeHeartbeatInterval)
+		defer heartbeat.Stop()
 
+		var reason string
+	loop:
+		for {
+			select {
+			case data := <-client.sendCh:
+				if err := writeRealtimeFrame(conn, data); err != nil {
+					reason = "websocket closed"
+					break loop
+				}
+			case <-heartbeat.C:
+				data, _ := json.Marshal(resource.NewRealtimeHeartbeat())
+				if err := writeRealtimeFrame(conn, data); err != nil {
+					reason = "websocket closed"
+					break loop
+				}
+			case <-readErrCh:
+				reason = "websocket closed"
+				break loop
+			case <-client.evictCh:
+				reason = "slow consumer"
+				log.Warnf("api: realtime events client %s evicted, it doesn't keep up", conn.RemoteAddr())
+				conn.SetWriteDeadline(time.Now().Add(realtimeWriteTimeout))
+				wsutil.WriteServerMessage(conn, ws.OpClose,
+					ws.NewCloseFrameBody(ws.StatusPolicyViolation, reason))
+				break loop
+			}
 		}
-		// }()
+
+		log.Debugf("api: realtime events client %s closed: %s", conn.RemoteAddr(), reason)
 
 		return nil
 	}
 }
+
+// defaultRealtimeCommand returns the command of the subscription created
+// from the query parameters
+func defaultRealtimeCommand(c echo.Context) (*resource.RealtimeCommandResource, error) {
+	cmd := &resource.RealtimeCommandResource{
+		Action:    resource.RealtimeActionSubscribe,
+		ID:        realtimeDefaultSubscription,
+		Namespace: c.QueryParam("namespace"),
+		Topic:     c.QueryParam("topic"),
+		DeviceID:  c.QueryParam("deviceId"),
+	}
+
+	if s := c.QueryParam("sinceId"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.New("invalid sinceId")
+		}
+		cmd.SinceID = int32(id)
+	}
+	if s := c.QueryParam("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, errors.New("invalid since, expected RFC 3339 time")
+		}
+		cmd.Since = &t
+	}
+
+	return cmd, nil
+}
+
+func writeRealtimeFrame(conn net.Conn, data []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(realtimeWriteTimeout))
+	return wsutil.WriteServerMessage(conn, ws.OpText, data)
+}
+
+// realtimeClient holds the subscriptions of a websocket connection. The
+// frames are queued to the send buffer, the connection is evicted if the
+// client doesn't keep up.
+type realtimeClient struct {
+	nc    *nats.Conn
+	store storage.Interface
+
+	// closed is set when the connection ends, the reader may still handle
+	// a subscribe command then
+	mu     sync.Mutex
+	subs   map[string]*eventFeed
+	closed bool
+
+	sendCh    chan []byte
+	evictCh   chan struct{}
+	evictOnce sync.Once
+}
+
+func newRealtimeClient(nc *nats.Conn, store storage.Interface) *realtimeClient {
+	return &realtimeClient{
+		nc:      nc,
+		store:   store,
+		subs:    make(map[string]*eventFeed),
+		sendCh:  make(chan []byte, realtimeSendBuffer),
+		evictCh: make(chan struct{}),
+	}
+}
+
+func (rc *realtimeClient) handleCommand(data []byte) {
+	cmd := &resource.RealtimeCommandResource{}
+	if err := json.Unmarshal(data, cmd); err != nil {
+		rc.sendJSON(resource.NewRealtimeReply("", errors.New("invalid command")))
+		return
+	}
+
+	var feed *eventFeed
+	var err error
+	switch cmd.Action {
+	case resource.RealtimeActionSubscribe:
+		feed, err = rc.subscribe(cmd)
+	case resource.RealtimeActionUnsubscribe:
+		err = rc.unsubscribe(cmd.ID)
+	default:
+		err = errors.Errorf("unknown action '%s'", cmd.Action)
+	}
+
+	rc.sendJSON(resource.NewRealtimeReply(cmd.ID, err))
+
+	// The replayed events follow the acknowledgement
+	if feed != nil {
+		rc.startReplay(feed, cmd)
+	}
+}
+
+// subscribe subscribes the events matching the filters of the command. The
+// live events of a subscription replaying stored events are held back until
+// startReplay is called.
+func (rc *realtimeClient) subscribe(cmd *resource.RealtimeCommandResource) (*eventFeed, error) {
+	if cmd.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	if cmd.SinceID < 0 {
+		return nil, errors.New("sinceId must not be negative")
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed {
+		return nil, errors.New("connection is closed")
+	}
+	if _, ok := rc.subs[cmd.ID]; ok {
+		return nil, errors.Errorf("subscription '%s' already exists", cmd.ID)
+	}
+	if len(rc.subs) >= realtimeMaxSubscriptions {
+		return nil, errors.Errorf("limit of %d subscriptions reached", realtimeMaxSubscriptions)
+	}
+
+	filter := eventFilter{
+		Namespace: cmd.Namespace,
+		Topic:     cmd.Topic,
+		DeviceID:  cmd.DeviceID,
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+
+	replay := cmd.SinceID > 0 || cmd.Since != nil
+	feed, err := newEventFeed(rc.nc, filter, cmd.ID, replay)
+	if err != nil {
+		log.Error("api: failed to subscribe realtime events: ", err)
+		return nil, errors.New("failed to subscribe")
+	}
+	rc.subs[cmd.ID] = feed
+
+	go rc.forward(feed)
+
+	return feed, nil
+}
+
+// startReplay replays the stored events requested by the command in the
+// background. The subscription is removed if the replay fails.
+func (rc *realtimeClient) startReplay(feed *eventFeed, cmd *resource.RealtimeCommandResource) {
+	if cmd.SinceID == 0 && cmd.Since == nil {
+		return
+	}
+
+	var since time.Time
+	if cmd.Since != nil {
+		since = *cmd.Since
+	}
+
+	go func() {
+		if err := feed.replay(rc.store, cmd.SinceID, since); err != nil {
+			log.Error("api: failed to replay realtime events: ", err)
+
+			rc.mu.Lock()
+			if rc.subs[cmd.ID] == feed {
+				delete(rc.subs, cmd.ID)
+			}
+			rc.mu.Unlock()
+			feed.Close()
+
+			rc.sendJSON(resource.NewRealtimeReply(cmd.ID, errors.New("failed to replay events")))
+		}
+	}()
+}
+
+// forward queues the events of the feed until it's closed
+func (rc *realtimeClient) forward(feed *eventFeed) {
+	for {
+		select {
+		case ev := <-feed.Events():
+			data, err := json.Marshal(ev.Event)
+			if err != nil {
+				log.Error("api: failed to marshal realtime frame: ", err)
+				continue
+			}
+			select {
+			case rc.sendCh <- data:
+			case <-feed.closeCh:
+				return
+			}
+		case <-feed.Overflow():
+			rc.evict()
+			return
+		case <-feed.closeCh:
+			return
+		}
+	}
+}
+
+func (rc *realtimeClient) unsubscribe(id string) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	feed, ok := rc.subs[id]
+	if !ok {
+		return errors.Errorf("subscription '%s' not found", id)
+	}
+	delete(rc.subs, id)
+	feed.Close()
+
+	return nil
+}
+
+// unsubscribeAll removes the subscriptions and rejects new ones
+func (rc *realtimeClient) unsubscribeAll() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.closed = true
+
+	for id, feed := range rc.subs {
+		feed.Close()
+		delete(rc.subs, id)
+	}
+}
+
+// sendJSON queues the frame without blocking. A full buffer evicts the
+// client.
+func (rc *realtimeClient) sendJSON(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Error("api: failed to marshal realtime frame: ", err)
+		return
+	}
+
+	select {
+	case rc.sendCh <- data:
+	default:
+		rc.evict()
+	}
+}
+
+func (rc *realtimeClient) evict() {
+	rc.evictOnce.Do(func() { close(rc.evictCh) })
+}
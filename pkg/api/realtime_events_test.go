@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// nextFrame returns the next frame queued for the client
+func nextFrame(t *testing.T, rc *realtimeClient) map[string]interface{} {
+	select {
+	case data := <-rc.sendCh:
+		frame := make(map[string]interface{})
+		if err := json.Unmarshal(data, &frame); err != nil {
+			t.Fatal(err)
+		}
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("no frame queued")
+	}
+	return nil
+}
+
+func TestRealtimeClientCommands(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	rc := newRealtimeClient(nc, memory.NewStore())
+	defer rc.unsubscribeAll()
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{`{"action":"subscribe","id":"alerts","topic":"alert"}`, resource.RealtimeFrameAck},
+		{`{"action":"subscribe","id":"alerts"}`, resource.RealtimeFrameError},
+		{`{"action":"subscribe","topic":"alert"}`, resource.RealtimeFrameError},
+		{`{"action":"subscribe","id":"bad","topic":"a.b"}`, resource.RealtimeFrameError},
+		{`{"action":"subscribe","id":"negative","sinceId":-1}`, resource.RealtimeFrameError},
+		{`{"action":"unsubscribe","id":"unknown"}`, resource.RealtimeFrameError},
+		{`{"action":"resubscribe","id":"alerts"}`, resource.RealtimeFrameError},
+		{`invalid`, resource.RealtimeFrameError},
+	}
+
+	for _, tc := range tests {
+		rc.handleCommand([]byte(tc.command))
+		if frame := nextFrame(t, rc); frame["type"] != tc.want {
+			t.Errorf("%s: reply %v, want %s", tc.command, frame, tc.want)
+		}
+	}
+
+	// The events of the subscription are forwarded
+	publishLive(t, nc, 1)
+	frame := nextFrame(t, rc)
+	if frame["type"] != resource.RealtimeFrameEvent || frame["subscription"] != "alerts" {
+		t.Errorf("event frame = %v", frame)
+	}
+
+	rc.handleCommand([]byte(`{"action":"unsubscribe","id":"alerts"}`))
+	if frame := nextFrame(t, rc); frame["type"] != resource.RealtimeFrameAck {
+		t.Errorf("unsubscribe reply = %v", frame)
+	}
+	if n := nc.NumSubscriptions(); n != 0 {
+		t.Errorf("%d NATS subscriptions left after unsubscribe", n)
+	}
+}
+
+func TestRealtimeClientClosed(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	rc := newRealtimeClient(nc, memory.NewStore())
+	if _, err := rc.subscribe(&resource.RealtimeCommandResource{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	rc.unsubscribeAll()
+
+	// A subscribe command handled after the connection ended doesn't leak
+	// a subscription
+	if _, err := rc.subscribe(&resource.RealtimeCommandResource{ID: "b"}); err == nil {
+		t.Error("subscribe after close succeeded")
+	}
+	if n := nc.NumSubscriptions(); n != 0 {
+		t.Errorf("%d NATS subscriptions left after close", n)
+	}
+}
+
+func TestRealtimeClientLimit(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	rc := newRealtimeClient(nc, memory.NewStore())
+	defer rc.unsubscribeAll()
+
+	for i := 0; i < realtimeMaxSubscriptions; i++ {
+		if _, err := rc.subscribe(&resource.RealtimeCommandResource{ID: string(rune('A' + i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rc.subscribe(&resource.RealtimeCommandResource{ID: "over"}); err == nil {
+		t.Error("subscribe beyond the limit succeeded")
+	}
+}
+
+func TestRealtimeClientEvict(t *testing.T) {
+	rc := newRealtimeClient(nil, nil)
+
+	for i := 0; i < realtimeSendBuffer; i++ {
+		rc.sendJSON(resource.NewRealtimeHeartbeat())
+	}
+	select {
+	case <-rc.evictCh:
+		t.Fatal("client evicted before the buffer is full")
+	default:
+	}
+
+	rc.sendJSON(resource.NewRealtimeHeartbeat())
+	select {
+	case <-rc.evictCh:
+	default:
+		t.Error("client with a full buffer isn't evicted")
+	}
+}
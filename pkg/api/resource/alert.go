@@ -0,0 +1,82 @@
+package resource
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+type AlertResource struct {
+	ID             int32      `json:"id"`
+	Namespace      string     `json:"namespace"`
+	DeviceID       string     `json:"deviceId"`
+	RuleID         int32      `json:"ruleId"`
+	Severity       string     `json:"severity"`
+	Message        string     `json:"message"`
+	Status         string     `json:"status"`
+	Count          int        `json:"count"`
+	LastEventID    int32      `json:"lastEventId"`
+	AcknowledgedBy string     `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+	ResolvedBy     string     `json:"resolvedBy,omitempty"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+}
+
+type AlertListResource struct {
+	Members []*AlertResource `json:"members"`
+}
+
+func NewAlert(m *model.Alert) (out *AlertResource) {
+	out = &AlertResource{
+		ID:             m.ID,
+		Namespace:      m.Namespace,
+		DeviceID:       m.DeviceID,
+		RuleID:         m.RuleID,
+		Severity:       m.Severity,
+		Message:        m.Message,
+		Status:         m.Status,
+		Count:          m.Count,
+		LastEventID:    m.LastEventID,
+		AcknowledgedBy: m.AcknowledgedBy,
+		ResolvedBy:     m.ResolvedBy,
+	}
+
+	if !m.AcknowledgedAt.IsZero() {
+		out.AcknowledgedAt = &time.Time{}
+		*out.AcknowledgedAt = m.AcknowledgedAt.Round(time.Second)
+	}
+	if !m.ResolvedAt.IsZero() {
+		out.ResolvedAt = &time.Time{}
+		*out.ResolvedAt = m.ResolvedAt.Round(time.Second)
+	}
+	if !m.CreatedAt.IsZero() {
+		out.CreatedAt = &time.Time{}
+		*out.CreatedAt = m.CreatedAt.Round(time.Second)
+	}
+	if !m.UpdatedAt.IsZero() {
+		out.UpdatedAt = &time.Time{}
+		*out.UpdatedAt = m.UpdatedAt.Round(time.Second)
+	}
+
+	return // out
+}
+
+func NewAlertList(m map[int32]model.Alert) (out *AlertListResource) {
+	out = &AlertListResource{
+		Members: make([]*AlertResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewAlert(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
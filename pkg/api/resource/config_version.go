@@ -0,0 +1,63 @@
+package resource
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+type ConfigVersionResource struct {
+	ID        int32     `json:"id"`
+	Namespace string    `json:"namespace"`
+	DeviceID  string    `json:"deviceId"`
+	Version   int       `json:"version"`
+	Checksum  string    `json:"checksum"`
+	Source    string    `json:"source"`
+	Content   string    `json:"content,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ConfigVersionListResource struct {
+	Members []*ConfigVersionResource `json:"members"`
+}
+
+// NewConfigVersion returns the version including the configuration
+func NewConfigVersion(m *model.ConfigVersion) (out *ConfigVersionResource) {
+	out = NewConfigVersionSummary(m)
+	out.Content = m.Content
+
+	return // out
+}
+
+// NewConfigVersionSummary returns the version without the configuration
+func NewConfigVersionSummary(m *model.ConfigVersion) (out *ConfigVersionResource) {
+	out = &ConfigVersionResource{
+		ID:        m.ID,
+		Namespace: m.Namespace,
+		DeviceID:  m.DeviceID,
+		Version:   m.Version,
+		Checksum:  m.Checksum,
+		Source:    m.Source,
+		CreatedAt: m.CreatedAt,
+	}
+
+	return // out
+}
+
+func NewConfigVersionList(m map[int32]model.ConfigVersion) (out *ConfigVersionListResource) {
+	out = &ConfigVersionListResource{
+		Members: make([]*ConfigVersionResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewConfigVersionSummary(&elem))
+	}
+
+	// Default sort by version
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].Version < out.Members[j].Version
+	})
+
+	return // out
+}
@@ -6,19 +6,41 @@ import (
 	"time"
 
 	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/selector"
 )
 
 type DeviceResource struct {
-	ID             int32      `json:"id"`
-	Namespace      string     `json:"namespace"`
-	DeviceID       string     `json:"deviceId"`
-	DeviceURI      string     `json:"deviceUri"`
-	SessionTimeout int        `json:"sessionTimeout"`
-	PingInterval   int        `json:"pingInterval"`
-	PongTimeout    int        `json:"pongTimeout"`
-	EventsTopic    string     `json:"eventsTopic"`
-	CreatedAt      *time.Time `json:"createdAt,omitempty"`
-	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+	ID             int32  `json:"id"`
+	Namespace      string `json:"namespace"`
+	DeviceID       string `json:"deviceId"`
+	DeviceURI      string `json:"deviceUri"`
+	SessionTimeout int    `json:"sessionTimeout"`
+	PingInterval   int    `json:"pingInterval"`
+	PongTimeout    int    `json:"pongTimeout"`
+	EventsTopic    string `json:"eventsTopic"`
+	TunnelPorts    []int  `json:"tunnelPorts"`
+
+	DeviceType                string `json:"deviceType"`
+	Name                      string `json:"name"`
+	Location                  string `json:"location"`
+	AssetTag                  string `json:"assetTag"`
+	Group                     string `json:"group"`
+	HardwareModel             string `json:"hardwareModel"`
+	HardwareRevision          string `json:"hardwareRevision"`
+	HardwareSerialNumber      string `json:"hardwareSerialNumber"`
+	FirmwareVersion           string `json:"firmwareVersion"`
+	NetworkHostname           string `json:"networkHostname"`
+	NetworkDomainname         string `json:"networkDomainname"`
+	NetworkPrimaryIPv4Address string `json:"networkPrimaryIPv4Address"`
+
+	Labels map[string]string `json:"labels"`
+
+	// ConnectionStatus is CONNECTED, DISCONNECTED or MAINTENANCE. It's
+	// ignored on create and update.
+	ConnectionStatus string `json:"connectionStatus,omitempty"`
+
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
 }
 
 type DeviceListResource struct {
@@ -27,14 +49,34 @@ type DeviceListResource struct {
 
 func NewDevice(m *model.Device) (out *DeviceResource) {
 	out = &DeviceResource{
-		ID:             m.ID,
-		Namespace:      m.Namespace,
-		DeviceID:       m.DeviceID,
-		DeviceURI:      m.DeviceURI,
-		SessionTimeout: m.SessionTimeout,
-		PingInterval:   m.PingInterval,
-		PongTimeout:    m.PongTimeout,
-		EventsTopic:    m.EventsTopic,
+		ID:                        m.ID,
+		Namespace:                 m.Namespace,
+		DeviceID:                  m.DeviceID,
+		DeviceURI:                 m.DeviceURI,
+		SessionTimeout:            m.SessionTimeout,
+		PingInterval:              m.PingInterval,
+		PongTimeout:               m.PongTimeout,
+		EventsTopic:               m.EventsTopic,
+		TunnelPorts:               m.TunnelPorts,
+		DeviceType:                m.DeviceType,
+		Name:                      m.Name,
+		Location:                  m.Location,
+		AssetTag:                  m.AssetTag,
+		Group:                     m.Group,
+		HardwareModel:             m.HardwareModel,
+		HardwareRevision:          m.HardwareRevision,
+		HardwareSerialNumber:      m.HardwareSerialNumber,
+		FirmwareVersion:           m.FirmwareVersion,
+		NetworkHostname:           m.NetworkHostname,
+		NetworkDomainname:         m.NetworkDomainname,
+		NetworkPrimaryIPv4Address: m.NetworkPrimaryIPv4Address,
+	}
+	if out.TunnelPorts == nil {
+		out.TunnelPorts = make([]int, 0)
+	}
+	out.Labels = m.Labels
+	if out.Labels == nil {
+		out.Labels = make(map[string]string)
 	}
 
 	if !m.CreatedAt.IsZero() {
@@ -76,16 +118,51 @@ func ValidateDevice(r *DeviceResource) (m *model.Device, err error) {
 	if r.DeviceURI == "" {
 		return nil, fmt.Errorf("deviceUri is required")
 	}
+	for _, port := range r.TunnelPorts {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("tunnelPorts contains invalid port %d", port)
+		}
+	}
+	if err := ValidateLabels(r.Labels); err != nil {
+		return nil, err
+	}
 
 	m = &model.Device{
-		Namespace:      r.Namespace,
-		DeviceID:       r.DeviceID,
-		DeviceURI:      r.DeviceURI,
-		SessionTimeout: r.SessionTimeout,
-		PingInterval:   r.PingInterval,
-		PongTimeout:    r.PongTimeout,
-		EventsTopic:    r.EventsTopic,
+		Namespace:                 r.Namespace,
+		DeviceID:                  r.DeviceID,
+		DeviceURI:                 r.DeviceURI,
+		SessionTimeout:            r.SessionTimeout,
+		PingInterval:              r.PingInterval,
+		PongTimeout:               r.PongTimeout,
+		EventsTopic:               r.EventsTopic,
+		TunnelPorts:               r.TunnelPorts,
+		DeviceType:                r.DeviceType,
+		Name:                      r.Name,
+		Location:                  r.Location,
+		AssetTag:                  r.AssetTag,
+		Group:                     r.Group,
+		HardwareModel:             r.HardwareModel,
+		HardwareRevision:          r.HardwareRevision,
+		HardwareSerialNumber:      r.HardwareSerialNumber,
+		FirmwareVersion:           r.FirmwareVersion,
+		NetworkHostname:           r.NetworkHostname,
+		NetworkDomainname:         r.NetworkDomainname,
+		NetworkPrimaryIPv4Address: r.NetworkPrimaryIPv4Address,
+		Labels:                    r.Labels,
 	}
 
 	return m, nil
 }
+
+// ValidateLabels checks if the labels can be used in selectors
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if err := selector.ValidateKey(k); err != nil {
+			return err
+		}
+		if err := selector.ValidateValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
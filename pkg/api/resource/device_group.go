@@ -0,0 +1,98 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/selector"
+)
+
+type DeviceGroupResource struct {
+	ID          int32      `json:"id"`
+	Namespace   string     `json:"namespace"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Selector    string     `json:"selector"`
+	Members     []string   `json:"members"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+
+type DeviceGroupListResource struct {
+	Members []*DeviceGroupResource `json:"members"`
+}
+
+func NewDeviceGroup(m *model.DeviceGroup) (out *DeviceGroupResource) {
+	out = &DeviceGroupResource{
+		ID:          m.ID,
+		Namespace:   m.Namespace,
+		Name:        m.Name,
+		Description: m.Description,
+		Selector:    m.Selector,
+		Members:     m.Members,
+	}
+	if out.Members == nil {
+		out.Members = make([]string, 0)
+	}
+
+	if !m.CreatedAt.IsZero() {
+		out.CreatedAt = &time.Time{}
+		*out.CreatedAt = m.CreatedAt.Round(time.Second)
+	}
+	if !m.UpdatedAt.IsZero() {
+		out.UpdatedAt = &time.Time{}
+		*out.UpdatedAt = m.UpdatedAt.Round(time.Second)
+	}
+
+	return // out
+}
+
+func NewDeviceGroupList(m map[int32]model.DeviceGroup) (out *DeviceGroupListResource) {
+	out = &DeviceGroupListResource{
+		Members: make([]*DeviceGroupResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewDeviceGroup(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+func ValidateDeviceGroup(r *DeviceGroupResource) (m *model.DeviceGroup, err error) {
+	if r.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	if r.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	// The selector is stored in its normalized form
+	sel, err := selector.Parse(r.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("selector is invalid: %s", err)
+	}
+	for _, id := range r.Members {
+		if id == "" || strings.Contains(id, ",") {
+			return nil, fmt.Errorf("members contains invalid device ID '%s'", id)
+		}
+	}
+
+	m = &model.DeviceGroup{
+		Namespace:   r.Namespace,
+		Name:        r.Name,
+		Description: r.Description,
+		Selector:    sel.String(),
+		Members:     r.Members,
+	}
+
+	return m, nil
+}
@@ -0,0 +1,69 @@
+package resource
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+// FileTransferRequestResource is the request body for retrieving a file
+// from a device
+type FileTransferRequestResource struct {
+	Path string `json:"path"`
+}
+
+type FileTransferResource struct {
+	ID        int32     `json:"id"`
+	Namespace string    `json:"namespace"`
+	DeviceID  string    `json:"deviceId"`
+	Direction string    `json:"direction"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type FileTransferListResource struct {
+	Members []*FileTransferResource `json:"members"`
+}
+
+func NewFileTransfer(m *model.FileTransfer) (out *FileTransferResource) {
+	out = &FileTransferResource{
+		ID:        m.ID,
+		Namespace: m.Namespace,
+		DeviceID:  m.DeviceID,
+		Direction: m.Direction,
+		Path:      m.Path,
+		Size:      m.Size,
+		Offset:    m.Offset,
+		Checksum:  m.Checksum,
+		Status:    m.Status,
+		Error:     m.Error,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+
+	return // out
+}
+
+func NewFileTransferList(m map[int32]model.FileTransfer) (out *FileTransferListResource) {
+	out = &FileTransferListResource{
+		Members: make([]*FileTransferResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewFileTransfer(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
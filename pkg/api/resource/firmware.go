@@ -0,0 +1,164 @@
+package resource
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+type FirmwareImageResource struct {
+	ID             int32     `json:"id"`
+	Version        string    `json:"version"`
+	HardwareModels []string  `json:"hardwareModels"`
+	Filename       string    `json:"filename"`
+	Size           int64     `json:"size"`
+	Checksum       string    `json:"checksum"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type FirmwareImageListResource struct {
+	Members []*FirmwareImageResource `json:"members"`
+}
+
+// FirmwareCampaignRequestResource is the request body for starting a
+// campaign. All devices of the namespace are updated if no device IDs are
+// given.
+type FirmwareCampaignRequestResource struct {
+	Namespace      string   `json:"namespace"`
+	ImageID        int32    `json:"imageId"`
+	DeviceIDs      []string `json:"deviceIds"`
+	BatchSize      int      `json:"batchSize"`
+	MaxFailureRate float64  `json:"maxFailureRate"`
+}
+
+type FirmwareCampaignResource struct {
+	ID             int32                     `json:"id"`
+	Namespace      string                    `json:"namespace"`
+	ImageID        int32                     `json:"imageId"`
+	BatchSize      int                       `json:"batchSize"`
+	MaxFailureRate float64                   `json:"maxFailureRate"`
+	Status         string                    `json:"status"`
+	Error          string                    `json:"error,omitempty"`
+	Summary        map[string]int            `json:"summary,omitempty"`
+	Updates        []*FirmwareUpdateResource `json:"updates,omitempty"`
+	CreatedAt      time.Time                 `json:"createdAt"`
+	UpdatedAt      time.Time                 `json:"updatedAt"`
+}
+
+type FirmwareCampaignListResource struct {
+	Members []*FirmwareCampaignResource `json:"members"`
+}
+
+type FirmwareUpdateResource struct {
+	ID         int32     `json:"id"`
+	DeviceID   string    `json:"deviceId"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	TransferID int32     `json:"transferId,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func NewFirmwareImage(m *model.FirmwareImage) (out *FirmwareImageResource) {
+	out = &FirmwareImageResource{
+		ID:             m.ID,
+		Version:        m.Version,
+		HardwareModels: m.HardwareModels,
+		Filename:       m.Filename,
+		Size:           m.Size,
+		Checksum:       m.Checksum,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+	if out.HardwareModels == nil {
+		out.HardwareModels = make([]string, 0)
+	}
+
+	return // out
+}
+
+func NewFirmwareImageList(m map[int32]model.FirmwareImage) (out *FirmwareImageListResource) {
+	out = &FirmwareImageListResource{
+		Members: make([]*FirmwareImageResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewFirmwareImage(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+func NewFirmwareCampaign(m *model.FirmwareCampaign) (out *FirmwareCampaignResource) {
+	out = &FirmwareCampaignResource{
+		ID:             m.ID,
+		Namespace:      m.Namespace,
+		ImageID:        m.ImageID,
+		BatchSize:      m.BatchSize,
+		MaxFailureRate: m.MaxFailureRate,
+		Status:         m.Status,
+		Error:          m.Error,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+
+	return // out
+}
+
+// NewFirmwareCampaignWithUpdates returns the campaign with the updates of
+// the devices and the number of updates per state.
+func NewFirmwareCampaignWithUpdates(m *model.FirmwareCampaign, updates map[int32]model.FirmwareUpdate) (out *FirmwareCampaignResource) {
+	out = NewFirmwareCampaign(m)
+	out.Summary = make(map[string]int)
+	out.Updates = make([]*FirmwareUpdateResource, 0)
+
+	for _, elem := range updates {
+		out.Summary[elem.Status]++
+		out.Updates = append(out.Updates, NewFirmwareUpdate(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Updates, func(i, j int) bool {
+		return out.Updates[i].ID < out.Updates[j].ID
+	})
+
+	return // out
+}
+
+func NewFirmwareCampaignList(m map[int32]model.FirmwareCampaign) (out *FirmwareCampaignListResource) {
+	out = &FirmwareCampaignListResource{
+		Members: make([]*FirmwareCampaignResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewFirmwareCampaign(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+func NewFirmwareUpdate(m *model.FirmwareUpdate) (out *FirmwareUpdateResource) {
+	out = &FirmwareUpdateResource{
+		ID:         m.ID,
+		DeviceID:   m.DeviceID,
+		Status:     m.Status,
+		Error:      m.Error,
+		TransferID: m.TransferID,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+
+	return // out
+}
@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+type MaintenanceResource struct {
+	ID          int32      `json:"id"`
+	Namespace   string     `json:"namespace"`
+	DeviceID    string     `json:"deviceId,omitempty"`
+	GroupID     int32      `json:"groupId,omitempty"`
+	Reason      string     `json:"reason"`
+	RejectCalls bool       `json:"rejectCalls"`
+	SetBy       string     `json:"setBy"`
+	Until       time.Time  `json:"until"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+
+type MaintenanceListResource struct {
+	Members []*MaintenanceResource `json:"members"`
+}
+
+// MaintenanceRequestResource sets a maintenance window. The window ends at
+// 'until' or after 'duration' seconds.
+type MaintenanceRequestResource struct {
+	Reason      string     `json:"reason"`
+	RejectCalls bool       `json:"rejectCalls"`
+	Until       *time.Time `json:"until"`
+	Duration    int        `json:"duration"`
+}
+
+func NewMaintenance(m *model.Maintenance) (out *MaintenanceResource) {
+	out = &MaintenanceResource{
+		ID:          m.ID,
+		Namespace:   m.Namespace,
+		DeviceID:    m.DeviceID,
+		GroupID:     m.GroupID,
+		Reason:      m.Reason,
+		RejectCalls: m.RejectCalls,
+		SetBy:       m.SetBy,
+		Until:       m.Until,
+	}
+
+	if !m.CreatedAt.IsZero() {
+		out.CreatedAt = &time.Time{}
+		*out.CreatedAt = m.CreatedAt.Round(time.Second)
+	}
+	if !m.UpdatedAt.IsZero() {
+		out.UpdatedAt = &time.Time{}
+		*out.UpdatedAt = m.UpdatedAt.Round(time.Second)
+	}
+
+	return // out
+}
+
+func NewMaintenanceList(m map[int32]model.Maintenance) (out *MaintenanceListResource) {
+	out = &MaintenanceListResource{
+		Members: make([]*MaintenanceResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewMaintenance(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+// ValidateMaintenanceRequest returns the end of the requested window
+func ValidateMaintenanceRequest(r *MaintenanceRequestResource) (until time.Time, err error) {
+	if r.Until != nil && r.Duration != 0 {
+		return until, fmt.Errorf("either until or duration is allowed")
+	}
+	if r.Until != nil {
+		until = *r.Until
+	} else if r.Duration > 0 {
+		until = time.Now().Add(time.Duration(r.Duration) * time.Second)
+	} else {
+		return until, fmt.Errorf("until or a positive duration is required")
+	}
+
+	if !until.After(time.Now()) {
+		return until, fmt.Errorf("until must be in the future")
+	}
+
+	return until, nil
+}
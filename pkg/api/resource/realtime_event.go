@@ -1,15 +1,75 @@
 package resource
 
+import "time"
+
+// Types of the frames sent on the realtime events websocket
+const (
+	RealtimeFrameEvent     = "event"
+	RealtimeFrameAck       = "ack"
+	RealtimeFrameError     = "error"
+	RealtimeFrameHeartbeat = "heartbeat"
+)
+
+// Actions of the commands received on the realtime events websocket
+const (
+	RealtimeActionSubscribe   = "subscribe"
+	RealtimeActionUnsubscribe = "unsubscribe"
+)
+
 type RealtimeEventResource struct {
-	Namespace string      `json:"namespace"`
-	Topic     string      `json:"topic"`
-	Data      interface{} `json:"data"`
+	Type         string      `json:"type"`
+	Subscription string      `json:"subscription,omitempty"`
+	Namespace    string      `json:"namespace"`
+	Topic        string      `json:"topic"`
+	Data         interface{} `json:"data"`
+}
+
+// RealtimeCommandResource subscribes or unsubscribes events. Empty filters
+// match everything. A subscription replays the stored events after the
+// publication ID sinceId or stored since the time since before the live
+// events.
+type RealtimeCommandResource struct {
+	Action    string     `json:"action"`
+	ID        string     `json:"id"`
+	Namespace string     `json:"namespace,omitempty"`
+	Topic     string     `json:"topic,omitempty"`
+	DeviceID  string     `json:"deviceId,omitempty"`
+	SinceID   int32      `json:"sinceId,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+}
+
+// RealtimeReplyResource acknowledges a command or reports its error
+type RealtimeReplyResource struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
 }
 
-func NewRealtimeEvent(namespace, topic string, data interface{}) *RealtimeEventResource {
+type RealtimeHeartbeatResource struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func NewRealtimeEvent(subscription, namespace, topic string, data interface{}) *RealtimeEventResource {
 	return &RealtimeEventResource{
-		Namespace: namespace,
-		Topic:     topic,
-		Data:      data,
+		Type:         RealtimeFrameEvent,
+		Subscription: subscription,
+		Namespace:    namespace,
+		Topic:        topic,
+		Data:         data,
+	}
+}
+
+func NewRealtimeReply(id string, err error) *RealtimeReplyResource {
+	if err != nil {
+		return &RealtimeReplyResource{Type: RealtimeFrameError, ID: id, Error: err.Error()}
+	}
+	return &RealtimeReplyResource{Type: RealtimeFrameAck, ID: id}
+}
+
+func NewRealtimeHeartbeat() *RealtimeHeartbeatResource {
+	return &RealtimeHeartbeatResource{
+		Type:      RealtimeFrameHeartbeat,
+		Timestamp: time.Now().Round(time.Second).UTC(),
 	}
 }
@@ -0,0 +1,110 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/rules"
+)
+
+type RuleResource struct {
+	ID          int32                 `json:"id"`
+	Namespace   string                `json:"namespace"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Enabled     *bool                 `json:"enabled,omitempty"`
+	Topic       string                `json:"topic"`
+	SourceType  string                `json:"sourceType"`
+	SourceID    string                `json:"sourceId"`
+	Conditions  []model.RuleCondition `json:"conditions"`
+	Actions     []model.RuleAction    `json:"actions"`
+	CreatedAt   *time.Time            `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time            `json:"updatedAt,omitempty"`
+}
+
+type RuleListResource struct {
+	Members []*RuleResource `json:"members"`
+}
+
+func NewRule(m *model.Rule) (out *RuleResource) {
+	enabled := m.Enabled
+	out = &RuleResource{
+		ID:          m.ID,
+		Namespace:   m.Namespace,
+		Name:        m.Name,
+		Description: m.Description,
+		Enabled:     &enabled,
+		Topic:       m.Topic,
+		SourceType:  m.SourceType,
+		SourceID:    m.SourceID,
+		Conditions:  m.Conditions,
+		Actions:     m.Actions,
+	}
+	if out.Conditions == nil {
+		out.Conditions = make([]model.RuleCondition, 0)
+	}
+	if out.Actions == nil {
+		out.Actions = make([]model.RuleAction, 0)
+	}
+
+	if !m.CreatedAt.IsZero() {
+		out.CreatedAt = &time.Time{}
+		*out.CreatedAt = m.CreatedAt.Round(time.Second)
+	}
+	if !m.UpdatedAt.IsZero() {
+		out.UpdatedAt = &time.Time{}
+		*out.UpdatedAt = m.UpdatedAt.Round(time.Second)
+	}
+
+	return // out
+}
+
+func NewRuleList(m map[int32]model.Rule) (out *RuleListResource) {
+	out = &RuleListResource{
+		Members: make([]*RuleResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewRule(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+// ValidateRule converts the resource to a rule. Rules are enabled unless
+// enabled is false.
+func ValidateRule(r *RuleResource) (m *model.Rule, err error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	switch r.SourceType {
+	case "", "SYSTEM", "DEVICE":
+	default:
+		return nil, fmt.Errorf("sourceType must be SYSTEM or DEVICE")
+	}
+
+	m = &model.Rule{
+		Namespace:   r.Namespace,
+		Name:        r.Name,
+		Description: r.Description,
+		Enabled:     r.Enabled == nil || *r.Enabled,
+		Topic:       r.Topic,
+		SourceType:  r.SourceType,
+		SourceID:    r.SourceID,
+		Conditions:  r.Conditions,
+		Actions:     r.Actions,
+	}
+
+	if err := rules.Validate(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
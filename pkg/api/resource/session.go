@@ -8,12 +8,16 @@ import (
 )
 
 type SessionResource struct {
-	ID             int32     `json:"id"`
-	Namespace      string    `json:"namespace"`
-	DeviceID       string    `json:"deviceId"`
-	DeviceURI      string    `json:"deviceUri"`
-	SessionTimeout int       `json:"sessionTimeout"`
-	LastMessageAt  time.Time `json:"lastMessageAt"`
+	ID              int32     `json:"id"`
+	Namespace       string    `json:"namespace"`
+	DeviceID        string    `json:"deviceId"`
+	DeviceURI       string    `json:"deviceUri"`
+	SessionTimeout  int       `json:"sessionTimeout"`
+	LastMessageAt   time.Time `json:"lastMessageAt"`
+	ProtocolVersion int       `json:"protocolVersion"`
+	Features        []string  `json:"features"`
+	FirmwareVersion string    `json:"firmwareVersion,omitempty"`
+	HardwareModel   string    `json:"hardwareModel,omitempty"`
 }
 
 type SessionListResource struct {
@@ -22,12 +26,20 @@ type SessionListResource struct {
 
 func NewSession(m *model.Session) (out *SessionResource) {
 	out = &SessionResource{
-		ID:             m.ID,
-		Namespace:      m.Namespace,
-		DeviceID:       m.DeviceID,
-		DeviceURI:      m.DeviceURI,
-		SessionTimeout: m.SessionTimeout,
-		LastMessageAt:  m.LastMessageAt,
+		ID:              m.ID,
+		Namespace:       m.Namespace,
+		DeviceID:        m.DeviceID,
+		DeviceURI:       m.DeviceURI,
+		SessionTimeout:  m.SessionTimeout,
+		LastMessageAt:   m.LastMessageAt,
+		ProtocolVersion: m.ProtocolVersion,
+		Features:        m.Features,
+		FirmwareVersion: m.FirmwareVersion,
+		HardwareModel:   m.HardwareModel,
+	}
+
+	if out.Features == nil {
+		out.Features = make([]string, 0)
 	}
 
 	return // out
@@ -0,0 +1,34 @@
+package resource
+
+import "sort"
+
+// TargetReplyResource is the reply of a single device to a targeted call or
+// publish
+type TargetReplyResource struct {
+	DeviceID string      `json:"deviceId"`
+	Reply    interface{} `json:"reply"`
+}
+
+type TargetReplyListResource struct {
+	Members []*TargetReplyResource `json:"members"`
+}
+
+func NewTargetReplyList(replies map[string]interface{}) (out *TargetReplyListResource) {
+	out = &TargetReplyListResource{
+		Members: make([]*TargetReplyResource, 0),
+	}
+
+	for deviceID, reply := range replies {
+		out.Members = append(out.Members, &TargetReplyResource{
+			DeviceID: deviceID,
+			Reply:    reply,
+		})
+	}
+
+	// Default sort by device ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].DeviceID < out.Members[j].DeviceID
+	})
+
+	return // out
+}
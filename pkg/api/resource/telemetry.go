@@ -0,0 +1,131 @@
+package resource
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/telemetry"
+)
+
+type MetricMappingResource struct {
+	ID          int32      `json:"id"`
+	Namespace   string     `json:"namespace"`
+	Metric      string     `json:"metric"`
+	Topic       string     `json:"topic"`
+	Path        string     `json:"path"`
+	Unit        string     `json:"unit"`
+	Description string     `json:"description"`
+	Enabled     *bool      `json:"enabled,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+
+type MetricMappingListResource struct {
+	Members []*MetricMappingResource `json:"members"`
+}
+
+// TelemetrySeriesResource is the result of a telemetry query. The step and
+// the resolution are in seconds, the resolution is 0 if the points are
+// aggregated from the samples.
+type TelemetrySeriesResource struct {
+	Namespace   string                    `json:"namespace"`
+	DeviceID    string                    `json:"deviceId"`
+	Metric      string                    `json:"metric"`
+	From        time.Time                 `json:"from"`
+	To          time.Time                 `json:"to"`
+	Step        int                       `json:"step"`
+	Aggregation string                    `json:"aggregation"`
+	Resolution  int                       `json:"resolution"`
+	Points      []*TelemetryPointResource `json:"points"`
+}
+
+type TelemetryPointResource struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+func NewMetricMapping(m *model.MetricMapping) (out *MetricMappingResource) {
+	enabled := m.Enabled
+	out = &MetricMappingResource{
+		ID:          m.ID,
+		Namespace:   m.Namespace,
+		Metric:      m.Metric,
+		Topic:       m.Topic,
+		Path:        m.Path,
+		Unit:        m.Unit,
+		Description: m.Description,
+		Enabled:     &enabled,
+	}
+
+	if !m.CreatedAt.IsZero() {
+		out.CreatedAt = &time.Time{}
+		*out.CreatedAt = m.CreatedAt.Round(time.Second)
+	}
+	if !m.UpdatedAt.IsZero() {
+		out.UpdatedAt = &time.Time{}
+		*out.UpdatedAt = m.UpdatedAt.Round(time.Second)
+	}
+
+	return // out
+}
+
+func NewMetricMappingList(m map[int32]model.MetricMapping) (out *MetricMappingListResource) {
+	out = &MetricMappingListResource{
+		Members: make([]*MetricMappingResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewMetricMapping(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+func NewTelemetrySeries(s *telemetry.Series) (out *TelemetrySeriesResource) {
+	out = &TelemetrySeriesResource{
+		Namespace:   s.Query.Namespace,
+		DeviceID:    s.Query.DeviceID,
+		Metric:      s.Query.Metric,
+		From:        s.Query.From,
+		To:          s.Query.To,
+		Step:        int(s.Query.Step / time.Second),
+		Aggregation: s.Query.Aggregation,
+		Resolution:  int(s.Resolution / time.Second),
+		Points:      make([]*TelemetryPointResource, 0, len(s.Points)),
+	}
+
+	for _, p := range s.Points {
+		out.Points = append(out.Points, &TelemetryPointResource{
+			Timestamp: p.Timestamp,
+			Value:     p.Value,
+		})
+	}
+
+	return // out
+}
+
+// ValidateMetricMapping converts the resource to a metric mapping. Mappings
+// are enabled unless enabled is false.
+func ValidateMetricMapping(r *MetricMappingResource) (m *model.MetricMapping, err error) {
+	m = &model.MetricMapping{
+		Namespace:   r.Namespace,
+		Metric:      r.Metric,
+		Topic:       r.Topic,
+		Path:        r.Path,
+		Unit:        r.Unit,
+		Description: r.Description,
+		Enabled:     r.Enabled == nil || *r.Enabled,
+	}
+
+	if err := telemetry.Validate(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
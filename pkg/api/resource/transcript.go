@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+type TranscriptResource struct {
+	ID          int32                   `json:"id"`
+	Namespace   string                  `json:"namespace"`
+	DeviceID    string                  `json:"deviceId"`
+	Kind        string                  `json:"kind"`
+	Username    string                  `json:"username"`
+	StartedAt   time.Time               `json:"startedAt"`
+	EndedAt     *time.Time              `json:"endedAt,omitempty"`
+	CloseReason string                  `json:"closeReason,omitempty"`
+	Entries     []model.TranscriptEntry `json:"entries,omitempty"`
+}
+
+type TranscriptListResource struct {
+	Members []*TranscriptResource `json:"members"`
+}
+
+func NewTranscript(m *model.Transcript) (out *TranscriptResource) {
+	out = newTranscriptSummary(m)
+
+	stored := make([]storedTranscriptEntry, 0)
+	if err := json.Unmarshal([]byte(m.Content), &stored); err != nil {
+		return // out
+	}
+
+	out.Entries = make([]model.TranscriptEntry, 0, len(stored))
+	for _, elem := range stored {
+		data := []byte(elem.Data)
+		if elem.Encoding == model.TranscriptEncodingBase64 {
+			var err error
+			if data, err = base64.StdEncoding.DecodeString(elem.Data); err != nil {
+				continue
+			}
+		}
+		out.Entries = append(out.Entries, model.TranscriptEntry{
+			Time:      elem.Time,
+			Direction: elem.Direction,
+			Encoding:  model.TranscriptEncodingBase64,
+			Data:      data,
+		})
+	}
+
+	return // out
+}
+
+// storedTranscriptEntry is a transcript entry as stored. The data of entries
+// without encoding is a plain string.
+type storedTranscriptEntry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Encoding  string    `json:"encoding"`
+	Data      string    `json:"data"`
+}
+
+// newTranscriptSummary returns the transcript without the recorded entries
+func newTranscriptSummary(m *model.Transcript) (out *TranscriptResource) {
+	out = &TranscriptResource{
+		ID:          m.ID,
+		Namespace:   m.Namespace,
+		DeviceID:    m.DeviceID,
+		Kind:        m.Kind,
+		Username:    m.Username,
+		StartedAt:   m.StartedAt,
+		CloseReason: m.CloseReason,
+	}
+
+	if !m.EndedAt.IsZero() {
+		endedAt := m.EndedAt
+		out.EndedAt = &endedAt
+	}
+
+	return // out
+}
+
+func NewTranscriptList(m map[int32]model.Transcript) (out *TranscriptListResource) {
+	out = &TranscriptListResource{
+		Members: make([]*TranscriptResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, newTranscriptSummary(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
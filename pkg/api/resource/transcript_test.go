@@ -0,0 +1,32 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+func TestNewTranscriptEntries(t *testing.T) {
+	// Entries recorded before the base64 encoding contain plain strings
+	m := &model.Transcript{Content: `[
+		{"time":"2020-01-01T00:00:00Z","direction":"input","data":"show version\n"},
+		{"time":"2020-01-01T00:00:01Z","direction":"output","encoding":"base64","data":"G1ttiAo="},
+		{"time":"2020-01-01T00:00:02Z","direction":"output","encoding":"base64","data":"%%%"}
+	]`}
+
+	entries := NewTranscript(m).Entries
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if string(entries[0].Data) != "show version\n" {
+		t.Errorf("plain entry data = %q, want %q", entries[0].Data, "show version\n")
+	}
+	if want := "\x1b[m\x88\n"; string(entries[1].Data) != want {
+		t.Errorf("base64 entry data = %q, want %q", entries[1].Data, want)
+	}
+	for _, e := range entries {
+		if e.Encoding != model.TranscriptEncodingBase64 {
+			t.Errorf("entry encoding = %q, want %q", e.Encoding, model.TranscriptEncodingBase64)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package resource
+
+import (
+	"sort"
+	"time"
+)
+
+// TunnelRequestResource is the request body for opening a tunnel. The target
+// host defaults to the device itself.
+type TunnelRequestResource struct {
+	TargetHost string `json:"targetHost"`
+	TargetPort int    `json:"targetPort"`
+}
+
+// TunnelResource describes an open tunnel. BytesIn is the amount of data
+// sent to the device, BytesOut the amount of data received from the device.
+type TunnelResource struct {
+	ID                string    `json:"id"`
+	Namespace         string    `json:"namespace"`
+	DeviceID          string    `json:"deviceId"`
+	TargetHost        string    `json:"targetHost"`
+	TargetPort        int       `json:"targetPort"`
+	LocalAddress      string    `json:"localAddress"`
+	Username          string    `json:"username"`
+	ActiveConnections int64     `json:"activeConnections"`
+	TotalConnections  int64     `json:"totalConnections"`
+	BytesIn           int64     `json:"bytesIn"`
+	BytesOut          int64     `json:"bytesOut"`
+	CreatedAt         time.Time `json:"createdAt"`
+	LastActivityAt    time.Time `json:"lastActivityAt"`
+}
+
+type TunnelListResource struct {
+	Members []*TunnelResource `json:"members"`
+}
+
+// SortTunnels sorts the tunnels by creation date
+func SortTunnels(out *TunnelListResource) {
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].CreatedAt.Before(out.Members[j].CreatedAt)
+	})
+}
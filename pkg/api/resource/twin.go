@@ -0,0 +1,72 @@
+package resource
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/twin"
+)
+
+type TwinResource struct {
+	Namespace string        `json:"namespace"`
+	DeviceID  string        `json:"deviceId"`
+	Version   int           `json:"version"`
+	Desired   twin.Document `json:"desired"`
+	Reported  twin.Document `json:"reported"`
+	Delta     twin.Document `json:"delta"`
+	InSync    bool          `json:"inSync"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+type TwinListResource struct {
+	Members []*TwinResource `json:"members"`
+}
+
+func NewTwin(m *model.Twin) (out *TwinResource, err error) {
+	out = &TwinResource{
+		Namespace: m.Namespace,
+		DeviceID:  m.DeviceID,
+		Version:   m.Version,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+	}
+
+	if out.Desired, err = twin.ParseDocument(m.Desired); err != nil {
+		return nil, err
+	}
+	if out.Reported, err = twin.ParseDocument(m.Reported); err != nil {
+		return nil, err
+	}
+	out.Delta = twin.Delta(out.Desired, out.Reported)
+	out.InSync = len(out.Delta) == 0
+
+	return // out
+}
+
+// NewTwinList returns the twins, only the twins with drift if driftOnly is
+// true.
+func NewTwinList(m map[int32]model.Twin, driftOnly bool) (out *TwinListResource, err error) {
+	out = &TwinListResource{
+		Members: make([]*TwinResource, 0),
+	}
+
+	for _, elem := range m {
+		r, err := NewTwin(&elem)
+		if err != nil {
+			return nil, err
+		}
+		if driftOnly && r.InSync {
+			continue
+		}
+		out.Members = append(out.Members, r)
+	}
+
+	// Default sort by device ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].DeviceID < out.Members[j].DeviceID
+	})
+
+	return // out
+}
@@ -0,0 +1,173 @@
+package resource
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+// WebhookResource is the webhook. The secret can only be written, the output
+// tells whether a secret is set.
+type WebhookResource struct {
+	ID          int32      `json:"id"`
+	Namespace   string     `json:"namespace"`
+	URL         string     `json:"url"`
+	Secret      string     `json:"secret,omitempty"`
+	HasSecret   bool       `json:"hasSecret"`
+	Topics      []string   `json:"topics"`
+	Description string     `json:"description"`
+	Enabled     *bool      `json:"enabled,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
+}
+
+type WebhookListResource struct {
+	Members []*WebhookResource `json:"members"`
+}
+
+type WebhookDeliveryResource struct {
+	ID             int32      `json:"id"`
+	WebhookID      int32      `json:"webhookId"`
+	Namespace      string     `json:"namespace"`
+	Topic          string     `json:"topic"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt,omitempty"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"`
+}
+
+type WebhookDeliveryListResource struct {
+	Members []*WebhookDeliveryResource `json:"members"`
+}
+
+func NewWebhook(m *model.Webhook) (out *WebhookResource) {
+	enabled := m.Enabled
+	out = &WebhookResource{
+		ID:          m.ID,
+		Namespace:   m.Namespace,
+		URL:         m.URL,
+		HasSecret:   m.Secret != "",
+		Topics:      m.Topics,
+		Description: m.Description,
+		Enabled:     &enabled,
+	}
+	if out.Topics == nil {
+		out.Topics = make([]string, 0)
+	}
+
+	if !m.CreatedAt.IsZero() {
+		out.CreatedAt = &time.Time{}
+		*out.CreatedAt = m.CreatedAt.Round(time.Second)
+	}
+	if !m.UpdatedAt.IsZero() {
+		out.UpdatedAt = &time.Time{}
+		*out.UpdatedAt = m.UpdatedAt.Round(time.Second)
+	}
+
+	return // out
+}
+
+func NewWebhookList(m map[int32]model.Webhook) (out *WebhookListResource) {
+	out = &WebhookListResource{
+		Members: make([]*WebhookResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewWebhook(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+func NewWebhookDelivery(m *model.WebhookDelivery) (out *WebhookDeliveryResource) {
+	out = &WebhookDeliveryResource{
+		ID:             m.ID,
+		WebhookID:      m.WebhookID,
+		Namespace:      m.Namespace,
+		Topic:          m.Topic,
+		Payload:        m.Payload,
+		Status:         m.Status,
+		Attempts:       m.Attempts,
+		LastStatusCode: m.LastStatusCode,
+		LastError:      m.LastError,
+	}
+
+	// The next attempt is only meaningful for pending deliveries
+	if m.Status == model.WebhookDeliveryStatusPending && !m.NextAttemptAt.IsZero() {
+		out.NextAttemptAt = &time.Time{}
+		*out.NextAttemptAt = m.NextAttemptAt.Round(time.Second)
+	}
+	if !m.LastAttemptAt.IsZero() {
+		out.LastAttemptAt = &time.Time{}
+		*out.LastAttemptAt = m.LastAttemptAt.Round(time.Second)
+	}
+	if !m.CreatedAt.IsZero() {
+		out.CreatedAt = &time.Time{}
+		*out.CreatedAt = m.CreatedAt.Round(time.Second)
+	}
+	if !m.UpdatedAt.IsZero() {
+		out.UpdatedAt = &time.Time{}
+		*out.UpdatedAt = m.UpdatedAt.Round(time.Second)
+	}
+
+	return // out
+}
+
+func NewWebhookDeliveryList(m map[int32]model.WebhookDelivery) (out *WebhookDeliveryListResource) {
+	out = &WebhookDeliveryListResource{
+		Members: make([]*WebhookDeliveryResource, 0),
+	}
+
+	for _, elem := range m {
+		out.Members = append(out.Members, NewWebhookDelivery(&elem))
+	}
+
+	// Default sort by ID
+	sort.Slice(out.Members, func(i, j int) bool {
+		return out.Members[i].ID < out.Members[j].ID
+	})
+
+	return // out
+}
+
+// ValidateWebhook converts the resource to a webhook. Webhooks are enabled
+// unless enabled is false.
+func ValidateWebhook(r *WebhookResource) (m *model.Webhook, err error) {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, pattern := range r.Topics {
+		if pattern == "" {
+			return nil, fmt.Errorf("topics must not be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid topic pattern '%s'", pattern)
+		}
+	}
+
+	m = &model.Webhook{
+		Namespace:   r.Namespace,
+		URL:         r.URL,
+		Secret:      r.Secret,
+		Topics:      r.Topics,
+		Description: r.Description,
+		Enabled:     r.Enabled == nil || *r.Enabled,
+	}
+
+	return m, nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+func (h *Handler) handleFetchRules(c echo.Context) error {
+	m, err := h.store.Rules().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewRuleList(m))
+}
+
+func (h *Handler) handleGetRuleByID(c echo.Context) error {
+	m, status, err := h.findRule(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewRule(m))
+}
+
+func (h *Handler) handleCreateRule(c echo.Context) error {
+	r := &resource.RuleResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateRule(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.store.Rules().Create(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, resource.NewRule(m))
+}
+
+func (h *Handler) handleUpdateRule(c echo.Context) error {
+	existing, status, err := h.findRule(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	r := &resource.RuleResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateRule(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	m.ID = existing.ID
+	m.CreatedAt = existing.CreatedAt
+
+	if err := h.store.Rules().Update(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewRule(m))
+}
+
+func (h *Handler) handleDeleteRule(c echo.Context) error {
+	m, status, err := h.findRule(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	if err := h.store.Rules().Delete(m.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// findRule returns the rule of the path parameter 'rid' or the status code
+// of the error response.
+func (h *Handler) findRule(c echo.Context) (*model.Rule, int, error) {
+	id, err := strconv.Atoi(c.Param("rid"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.store.Rules().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// errDeviceNotConnected is returned if no control channel answers the
+// stream open request of a device.
+var errDeviceNotConnected = errors.New("device is not connected")
+
+// streamOpenError is returned if the control channel rejects a stream open
+// request.
+type streamOpenError struct {
+	Reason  string
+	Details interface{}
+}
+
+func (e *streamOpenError) Error() string {
+	if e.Details != nil {
+		return fmt.Sprintf("failed to open stream: %s (%v)", e.Reason, e.Details)
+	}
+	return fmt.Sprintf("failed to open stream: %s", e.Reason)
+}
+
+// errStreamClosed is returned when data is written to a closed stream
+var errStreamClosed = errors.New("stream is closed")
+
+// errStreamWriteTimeout is returned if the device doesn't grant credits for
+// the data within the write timeout
+var errStreamWriteTimeout = errors.New("stream write timed out")
+
+// streamWriteTimeout limits the time a write waits for credits
+const streamWriteTimeout = 30 * time.Second
+
+// deviceStream is a stream to a device opened through the control channel.
+// The frames sent by the device are received with Frames. The stream has to
+// be closed by calling Close.
+//
+// The data is flow controlled in both directions. The device sends at most
+// the window of data frames, further frames need the credits granted when
+// the frames are consumed. Write waits for the credits of the device, that
+// back-pressures the writer.
+type deviceStream struct {
+	nc           *nats.Conn
+	id           int32
+	inboxSubject string
+	sub          *nats.Subscription
+
+	// queueCh holds the data frames until they are consumed. The close
+	// frame isn't queued, it's never dropped nor blocked by a full queue.
+	// window is the number of data frames the device may send, it's
+	// accessed atomically.
+	queueCh       chan *message.StreamFrame
+	window        int64
+	frameCh       chan *message.StreamFrame
+	remoteCloseCh chan struct{}
+	remoteOnce    sync.Once
+	remoteReason  string
+
+	// credit is the number of data frames the device accepts. A grant is
+	// signaled on creditCh.
+	creditMu sync.Mutex
+	credit   int
+	creditCh chan struct{}
+
+	doneCh    chan struct{}
+	closeOnce sync.Once
+}
+
+// openDeviceStream asks the control channel of the given device to open a
+// stream of the given kind.
+func (h *Handler) openDeviceStream(namespace, deviceID, kind string, arguments interface{}) (*deviceStream, error) {
+	s := &deviceStream{
+		nc:            h.nc,
+		queueCh:       make(chan *message.StreamFrame, message.StreamWindow),
+		frameCh:       make(chan *message.StreamFrame),
+		window:        message.StreamWindow,
+		remoteCloseCh: make(chan struct{}),
+		credit:        message.StreamWindow,
+		creditCh:      make(chan struct{}, 1),
+		doneCh:        make(chan struct{}),
+	}
+
+	// The subscription has to exist before the device starts sending data
+	outboxSubject := nats.NewInbox()
+	sub, err := h.nc.Subscribe(outboxSubject, s.handleFrame)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe the stream outbox")
+	}
+	s.sub = sub
+
+	req := message.StreamOpenRequest{
+		Kind:          kind,
+		Arguments:     arguments,
+		OutboxSubject: outboxSubject,
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		sub.Unsubscribe()
+		return nil, errors.Wrap(err, "failed to marshal stream open request")
+	}
+
+	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.controlchannel.%s.stream.open", namespace, deviceID)
+	msg, err := h.nc.Request(subj, data, 5*time.Second)
+	if err != nil {
+		sub.Unsubscribe()
+		if err == nats.ErrTimeout || err == nats.ErrNoResponders {
+			return nil, errDeviceNotConnected
+		}
+		return nil, errors.Wrap(err, "failed to request stream open")
+	}
+
+	rep := message.StreamOpenReply{}
+	if err := json.Unmarshal(msg.Data, &rep); err != nil {
+		sub.Unsubscribe()
+		return nil, errors.Wrap(err, "failed to unmarshal stream open reply")
+	}
+	if rep.Status == message.ReplyStatusError {
+		sub.Unsubscribe()
+		return nil, &streamOpenError{Reason: rep.ErrorReason, Details: rep.ErrorDetails}
+	}
+
+	s.id = rep.StreamID
+	s.inboxSubject = rep.InboxSubject
+
+	go s.forward()
+
+	return s, nil
+}
+
+// handleFrame queues the frame of the device. It never blocks the
+// subscription, the queue holds the whole window.
+func (s *deviceStream) handleFrame(msg *nats.Msg) {
+	frame := &message.StreamFrame{}
+	if err := json.Unmarshal(msg.Data, frame); err != nil {
+		log.Error("api: failed to unmarshal stream frame: ", err)
+		return
+	}
+
+	switch {
+	case frame.Credit > 0:
+		s.grantCredit(frame.Credit)
+	case frame.Close:
+		s.closeRemote(frame.Reason)
+	case len(frame.Data) > 0:
+		if atomic.AddInt64(&s.window, -1) >= 0 {
+			s.queueCh <- frame
+			return
+		}
+
+		// The device sent more than its credits, we close the stream
+		// instead of dropping data silently.
+		select {
+		case <-s.remoteCloseCh:
+			return
+		default:
+		}
+		log.Warnf("api: stream %d exceeded its window", s.id)
+		reason := proto.ErrReasonTechnicalException.String()
+		if err := s.publish(message.StreamFrame{Close: true, Reason: reason}); err != nil {
+			log.Error("api: failed to close stream: ", err)
+		}
+		s.closeRemote(reason)
+	}
+}
+
+// forward passes the queued frames to the consumer and grants the device a
+// credit per consumed frame. The credits are granted in batches of half the
+// window. The close frame of the device follows the queued data.
+func (s *deviceStream) forward() {
+	consumed := 0
+	deliver := func(frame *message.StreamFrame) bool {
+		select {
+		case s.frameCh <- frame:
+		case <-s.doneCh:
+			return false
+		}
+
+		if consumed++; consumed >= message.StreamWindow/2 {
+			atomic.AddInt64(&s.window, int64(consumed))
+			if err := s.publish(message.StreamFrame{Credit: consumed}); err != nil {
+				log.Error("api: failed to grant stream credits: ", err)
+			}
+			consumed = 0
+		}
+		return true
+	}
+
+	for {
+		select {
+		case frame := <-s.queueCh:
+			if !deliver(frame) {
+				return
+			}
+		case <-s.remoteCloseCh:
+			for len(s.queueCh) > 0 {
+				if !deliver(<-s.queueCh) {
+					return
+				}
+			}
+			select {
+			case s.frameCh <- &message.StreamFrame{Close: true, Reason: s.remoteReason}:
+			case <-s.doneCh:
+			}
+			return
+		case <-s.doneCh:
+			return
+		}
+	}
+}
+
+// closeRemote marks the stream as closed by the device
+func (s *deviceStream) closeRemote(reason string) {
+	s.remoteOnce.Do(func() {
+		s.remoteReason = reason
+		close(s.remoteCloseCh)
+	})
+}
+
+func (s *deviceStream) grantCredit(n int) {
+	s.creditMu.Lock()
+	s.credit += n
+	s.creditMu.Unlock()
+
+	select {
+	case s.creditCh <- struct{}{}:
+	default:
+	}
+}
+
+// acquireCredit waits until the device accepts another data frame
+func (s *deviceStream) acquireCredit() error {
+	timer := time.NewTimer(streamWriteTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.remoteCloseCh:
+			return errStreamClosed
+		case <-s.doneCh:
+			return errStreamClosed
+		default:
+		}
+
+		s.creditMu.Lock()
+		if s.credit > 0 {
+			s.credit--
+			s.creditMu.Unlock()
+			return nil
+		}
+		s.creditMu.Unlock()
+
+		select {
+		case <-s.creditCh:
+		case <-s.remoteCloseCh:
+			return errStreamClosed
+		case <-s.doneCh:
+			return errStreamClosed
+		case <-timer.C:
+			return errStreamWriteTimeout
+		}
+	}
+}
+
+// Frames returns the channel receiving the frames of the device. The last
+// frame of a stream closed by the device has the close flag set.
+func (s *deviceStream) Frames() <-chan *message.StreamFrame {
+	return s.frameCh
+}
+
+// Write sends the given data to the device. It blocks while the device has
+// no credits left.
+func (s *deviceStream) Write(data []byte) error {
+	if err := s.acquireCredit(); err != nil {
+		return err
+	}
+	return s.publish(message.StreamFrame{Data: data})
+}
+
+// Close closes the stream. The device is notified with the given reason
+// unless the stream was closed by the device.
+func (s *deviceStream) Close(reason string, notify bool) {
+	s.closeOnce.Do(func() {
+		close(s.doneCh)
+		s.sub.Unsubscribe()
+
+		if notify {
+			if err := s.publish(message.StreamFrame{Close: true, Reason: reason}); err != nil {
+				log.Error("api: failed to close stream: ", err)
+			}
+		}
+	})
+}
+
+func (s *deviceStream) publish(frame message.StreamFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal stream frame")
+	}
+	if err := s.nc.Publish(s.inboxSubject, data); err != nil {
+		return errors.Wrap(err, "failed to publish stream frame")
+	}
+	return nil
+}
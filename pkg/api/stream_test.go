@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+)
+
+// fakeStreamDevice answers the stream open requests like the control
+// channel of the device. The frames for the device are received by the inbox
+// subscription.
+type fakeStreamDevice struct {
+	nc     *nats.Conn
+	inbox  *nats.Subscription
+	openCh chan string
+}
+
+func newFakeStreamDevice(t *testing.T, nc *nats.Conn, deviceID string) *fakeStreamDevice {
+	d := &fakeStreamDevice{nc: nc, openCh: make(chan string, 8)}
+
+	inboxSubject := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inboxSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.inbox = sub
+
+	_, err = nc.Subscribe("iotcore.devicecontrol.v1.default.controlchannel."+deviceID+".stream.open", func(msg *nats.Msg) {
+		req := message.StreamOpenRequest{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			return
+		}
+		d.openCh <- req.OutboxSubject
+
+		data, _ := json.Marshal(message.StreamOpenReply{
+			Status:       message.ReplyStatusSuccess,
+			StreamID:     1,
+			InboxSubject: inboxSubject,
+		})
+		msg.Respond(data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// opened returns the outbox subject of the next opened stream
+func (d *fakeStreamDevice) opened(t *testing.T) string {
+	select {
+	case outbox := <-d.openCh:
+		return outbox
+	case <-time.After(time.Second):
+		t.Fatal("no stream opened")
+	}
+	return ""
+}
+
+func (d *fakeStreamDevice) send(t *testing.T, outbox string, frame message.StreamFrame) {
+	data, _ := json.Marshal(frame)
+	if err := d.nc.Publish(outbox, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next returns the next frame sent to the device
+func (d *fakeStreamDevice) next(t *testing.T) message.StreamFrame {
+	msg, err := d.inbox.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("device received no frame: ", err)
+	}
+	frame := message.StreamFrame{}
+	if err := json.Unmarshal(msg.Data, &frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func nextStreamFrame(t *testing.T, s *deviceStream) *message.StreamFrame {
+	select {
+	case frame := <-s.Frames():
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("stream received no frame")
+	}
+	return nil
+}
+
+func TestDeviceStreamOpenClose(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	h := &Handler{nc: nc}
+	d := newFakeStreamDevice(t, nc, "dev1")
+
+	if _, err := h.openDeviceStream("default", "unknown", streamKindTunnel, nil); err != errDeviceNotConnected {
+		t.Errorf("open stream of disconnected device error = %v, want %v", err, errDeviceNotConnected)
+	}
+
+	s, err := h.openDeviceStream("default", "dev1", streamKindTunnel, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox := d.opened(t)
+
+	if err := s.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if frame := d.next(t); string(frame.Data) != "ping" {
+		t.Errorf("device received %q, want %q", frame.Data, "ping")
+	}
+
+	// The close frame follows the data sent before
+	d.send(t, outbox, message.StreamFrame{Data: []byte("pong")})
+	d.send(t, outbox, message.StreamFrame{Close: true, Reason: "bye"})
+	if frame := nextStreamFrame(t, s); string(frame.Data) != "pong" {
+		t.Errorf("stream received %q, want %q", frame.Data, "pong")
+	}
+	if frame := nextStreamFrame(t, s); !frame.Close || frame.Reason != "bye" {
+		t.Errorf("stream received %+v, want close frame", frame)
+	}
+	if err := s.Write([]byte("late")); err != errStreamClosed {
+		t.Errorf("write to closed stream error = %v, want %v", err, errStreamClosed)
+	}
+	s.Close("bye", false)
+
+	// A stream closed by the requestor notifies the device
+	s, err = h.openDeviceStream("default", "dev1", streamKindTunnel, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.opened(t)
+	s.Close("done", true)
+	if frame := d.next(t); !frame.Close || frame.Reason != "done" {
+		t.Errorf("device received %+v, want close frame", frame)
+	}
+}
+
+func TestDeviceStreamReceiveWindow(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	h := &Handler{nc: nc}
+	d := newFakeStreamDevice(t, nc, "dev1")
+
+	s, err := h.openDeviceStream("default", "dev1", streamKindTunnel, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close("done", true)
+	outbox := d.opened(t)
+
+	// The frames of the window are queued without blocking the
+	// subscription. The consumed frames are granted in batches.
+	for i := 0; i < message.StreamWindow; i++ {
+		d.send(t, outbox, message.StreamFrame{Data: []byte{byte(i)}})
+	}
+	for i := 0; i < message.StreamWindow/2; i++ {
+		if frame := nextStreamFrame(t, s); frame.Data[0] != byte(i) {
+			t.Fatalf("stream received frame %d, want %d", frame.Data[0], i)
+		}
+	}
+	if frame := d.next(t); frame.Credit != message.StreamWindow/2 {
+		t.Errorf("device received %+v, want credit %d", frame, message.StreamWindow/2)
+	}
+
+	// Frames beyond the window close the stream, the queued data is
+	// delivered before the close frame
+	for i := 0; i < message.StreamWindow/2+1; i++ {
+		d.send(t, outbox, message.StreamFrame{Data: []byte{byte(i)}})
+	}
+	if frame := d.next(t); !frame.Close {
+		t.Errorf("device received %+v, want close frame", frame)
+	}
+	for i := 0; i < message.StreamWindow; i++ {
+		if frame := nextStreamFrame(t, s); frame.Close {
+			t.Fatalf("stream received close frame after %d data frames", i)
+		}
+	}
+	if frame := nextStreamFrame(t, s); !frame.Close {
+		t.Errorf("stream received %+v, want close frame", frame)
+	}
+}
+
+func TestDeviceStreamSendWindow(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	h := &Handler{nc: nc}
+	d := newFakeStreamDevice(t, nc, "dev1")
+
+	s, err := h.openDeviceStream("default", "dev1", streamKindTunnel, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close("done", true)
+	outbox := d.opened(t)
+
+	for i := 0; i < message.StreamWindow; i++ {
+		if err := s.Write([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The writer waits for the credits of the device
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Write([]byte("more")) }()
+	select {
+	case err := <-errCh:
+		t.Fatalf("write without credits returned %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	d.send(t, outbox, message.StreamFrame{Credit: 1})
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write didn't continue after the credit")
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nats-io/nuid"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/targeting"
+	"github.com/nsyszr/lcm/pkg/tracing"
+)
+
+// maxParallelTargetRequests limits the requests running concurrently for
+// the devices of a target
+const maxParallelTargetRequests = 16
+
+// targetedCallRequest calls the command on all devices of the target
+type targetedCallRequest struct {
+	targeting.Target
+	Command   string      `json:"command"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// targetedPublishRequest delivers the event to all devices of the target
+type targetedPublishRequest struct {
+	targeting.Target
+	Topic     string      `json:"topic"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// handleTargetedCallRequest calls a command on all devices addressed by the
+// device IDs, the selector and the group of the request. The reply contains
+// the call reply of each device.
+func (h *Handler) handleTargetedCallRequest(c echo.Context) error {
+	namespace := c.Param("namespace")
+
+	req := &targetedCallRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if req.Command == "" {
+		return c.JSON(http.StatusBadRequest, "command is required")
+	}
+
+	devices, status, err := h.resolveTarget(namespace, req.Target)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	_, admin := h.adminUser(c)
+	replies := h.requestEachDevice(devices, func(d model.Device) interface{} {
+		rejected, err := h.rejectCall(c, namespace, d.DeviceID)
+		if err != nil {
+			return message.CallReply{Status: message.ReplyStatusError, ErrorReason: "ERR_TECHNICAL_EXCEPTION"}
+		} else if rejected != nil {
+			return *rejected
+		}
+
+		rep := message.CallReply{}
+		err = h.requestDevice(c.Request().Context(), fmt.Sprintf("iotcore.devicecontrol.v1.%s.call", namespace), message.CallRequest{
+			CallID:     nuid.Next(),
+			TargetType: message.TargetTypeDevice,
+			TargetID:   d.DeviceID,
+			Command:    req.Command,
+			Arguments:  req.Arguments,
+			Requestor:  h.requestUser(c),
+
+			BypassMaintenance: admin,
+		}, &rep)
+		if err != nil {
+			rep.Status = message.ReplyStatusError
+			rep.ErrorReason = requestErrorReason(err)
+		}
+		return rep
+	})
+
+	return c.JSON(http.StatusOK, resource.NewTargetReplyList(replies))
+}
+
+// handleTargetedPublishRequest delivers an event to all devices addressed by
+// the device IDs, the selector and the group of the request. The reply
+// contains the publish reply of each device.
+func (h *Handler) handleTargetedPublishRequest(c echo.Context) error {
+	namespace := c.Param("namespace")
+
+	req := &targetedPublishRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if req.Topic == "" {
+		return c.JSON(http.StatusBadRequest, "topic is required")
+	}
+
+	devices, status, err := h.resolveTarget(namespace, req.Target)
+	if err != nil {
+		return c.JSON(status, err.Error())
+	}
+
+	replies := h.requestEachDevice(devices, func(d model.Device) interface{} {
+		rep := message.PublishReply{}
+		err := h.requestDevice(c.Request().Context(), fmt.Sprintf("iotcore.devicecontrol.v1.%s.publish", namespace), message.PublishRequest{
+			SourceType: message.SourceTypeSystem,
+			TargetType: message.TargetTypeDevice,
+			TargetID:   d.DeviceID,
+			Topic:      req.Topic,
+			Arguments:  req.Arguments,
+		}, &rep)
+		if err != nil {
+			rep.Status = message.ReplyStatusError
+			rep.ErrorReason = requestErrorReason(err)
+		}
+		return rep
+	})
+
+	return c.JSON(http.StatusOK, resource.NewTargetReplyList(replies))
+}
+
+// resolveTarget returns the devices of the target or the status code of the
+// error response.
+func (h *Handler) resolveTarget(namespace string, t targeting.Target) ([]model.Device, int, error) {
+	devices, err := targeting.Resolve(h.store, namespace, t)
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		// The target is empty or the selector is invalid
+		return nil, http.StatusBadRequest, err
+	}
+
+	return devices, http.StatusOK, nil
+}
+
+// requestEachDevice runs the request function for all devices concurrently
+// and returns the replies by device ID.
+func (h *Handler) requestEachDevice(devices []model.Device, fn func(d model.Device) interface{}) map[string]interface{} {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxParallelTargetRequests)
+	replies := make(map[string]interface{}, len(devices))
+
+	for _, d := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d model.Device) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rep := fn(d)
+
+			mu.Lock()
+			replies[d.DeviceID] = rep
+			mu.Unlock()
+		}(d)
+	}
+	wg.Wait()
+
+	return replies
+}
+
+// requestDevice sends the request to the controller and decodes the reply.
+// It fails with errNATSUnavailable while the NATS connection is reconnecting.
+func (h *Handler) requestDevice(ctx context.Context, subj string, req, rep interface{}) error {
+	if !h.nc.IsConnected() {
+		return errNATSUnavailable
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	msg, err := h.nc.RequestMsg(tracing.NewMsg(ctx, h.nc, subj, data), 16*time.Second)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(msg.Data, rep)
+}
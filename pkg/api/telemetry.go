@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/telemetry"
+)
+
+func (h *Handler) handleFetchMetricMappings(c echo.Context) error {
+	m, err := h.store.MetricMappings().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewMetricMappingList(m))
+}
+
+func (h *Handler) handleGetMetricMappingByID(c echo.Context) error {
+	m, status, err := h.findMetricMapping(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewMetricMapping(m))
+}
+
+func (h *Handler) handleCreateMetricMapping(c echo.Context) error {
+	r := &resource.MetricMappingResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateMetricMapping(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.store.MetricMappings().Create(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, resource.NewMetricMapping(m))
+}
+
+func (h *Handler) handleUpdateMetricMapping(c echo.Context) error {
+	existing, status, err := h.findMetricMapping(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	r := &resource.MetricMappingResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateMetricMapping(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	m.ID = existing.ID
+	m.CreatedAt = existing.CreatedAt
+
+	if err := h.store.MetricMappings().Update(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewMetricMapping(m))
+}
+
+func (h *Handler) handleDeleteMetricMapping(c echo.Context) error {
+	m, status, err := h.findMetricMapping(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	if err := h.store.MetricMappings().Delete(m.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// findMetricMapping returns the metric mapping of the path parameter 'mid'
+// or the status code of the error response.
+func (h *Handler) findMetricMapping(c echo.Context) (*model.MetricMapping, int, error) {
+	id, err := strconv.Atoi(c.Param("mid"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.store.MetricMappings().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
+
+// handleQueryTelemetry returns the samples of the metric of the device
+// aggregated by the query parameters 'from' and 'to' (RFC 3339, default the
+// last hour), 'step' (seconds, default 60) and 'aggregation' (avg, min, max,
+// sum or count, default avg).
+func (h *Handler) handleQueryTelemetry(c echo.Context) error {
+	q := telemetry.Query{
+		Namespace:   c.Param("namespace"),
+		DeviceID:    c.Param("id"),
+		Metric:      c.Param("metric"),
+		To:          time.Now().UTC(),
+		Step:        time.Minute,
+		Aggregation: telemetry.AggregationAvg,
+	}
+
+	if s := c.QueryParam("to"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid to, expected RFC 3339 time")
+		}
+		q.To = t.UTC()
+	}
+	q.From = q.To.Add(-time.Hour)
+	if s := c.QueryParam("from"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid from, expected RFC 3339 time")
+		}
+		q.From = t.UTC()
+	}
+	if s := c.QueryParam("step"); s != "" {
+		step, err := strconv.Atoi(s)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, "invalid step, expected seconds")
+		}
+		q.Step = time.Duration(step) * time.Second
+	}
+	if s := c.QueryParam("aggregation"); s != "" {
+		q.Aggregation = s
+	}
+
+	if err := q.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	series, err := h.telemetry.Query(q)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewTelemetrySeries(series))
+}
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nats-io/nuid"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamKindTunnel is the stream kind of a TCP connection tunneled through
+// the device
+const streamKindTunnel = "tunnel"
+
+// tunnelBufferSize is the maximum size of the data sent to the device in a
+// single stream frame
+const tunnelBufferSize = 32 * 1024
+
+// eventTopicTunnelClosed is the topic of the event stored when a tunnel is
+// closed
+const eventTopicTunnelClosed = "tunnelclosed"
+
+// tunnelArguments are the arguments of a tunnel stream open request. The
+// device connects to the given host and port.
+type tunnelArguments struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// tunnel is a local TCP listener. Every accepted connection is forwarded
+// through a stream of the control channel to the target reachable from the
+// device.
+type tunnel struct {
+	id         string
+	namespace  string
+	deviceID   string
+	targetHost string
+	targetPort int
+	user       string
+	createdAt  time.Time
+	listener   net.Listener
+
+	// Counters are accessed atomically. BytesIn is the data sent to the
+	// device, BytesOut the data received from the device.
+	bytesIn           int64
+	bytesOut          int64
+	activeConnections int64
+	totalConnections  int64
+	lastActivityAt    int64
+
+	doneCh    chan struct{}
+	closeOnce sync.Once
+
+	// closeReason is set once by close before doneCh is closed
+	closeReason string
+}
+
+// tunnelClosedDetails are the details of the event stored when a tunnel is
+// closed. They contain the totals of the tunnel.
+type tunnelClosedDetails struct {
+	TunnelID         string    `json:"tunnel_id"`
+	TargetHost       string    `json:"target_host"`
+	TargetPort       int       `json:"target_port"`
+	Username         string    `json:"username"`
+	Reason           string    `json:"reason"`
+	BytesIn          int64     `json:"bytes_in"`
+	BytesOut         int64     `json:"bytes_out"`
+	TotalConnections int64     `json:"total_connections"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (t *tunnel) touch() {
+	atomic.StoreInt64(&t.lastActivityAt, time.Now().UnixNano())
+}
+
+func (t *tunnel) lastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&t.lastActivityAt)).UTC()
+}
+
+func (t *tunnel) close(reason string) {
+	t.closeOnce.Do(func() {
+		t.closeReason = reason
+		log.Infof("api: tunnel '%s' to %s:%d on device '%s' closed after %d connections, %d bytes in, %d bytes out: %s",
+			t.id, t.targetHost, t.targetPort, t.deviceID, atomic.LoadInt64(&t.totalConnections),
+			atomic.LoadInt64(&t.bytesIn), atomic.LoadInt64(&t.bytesOut), reason)
+		close(t.doneCh)
+		t.listener.Close()
+	})
+}
+
+func (t *tunnel) resource() *resource.TunnelResource {
+	return &resource.TunnelResource{
+		ID:                t.id,
+		Namespace:         t.namespace,
+		DeviceID:          t.deviceID,
+		TargetHost:        t.targetHost,
+		TargetPort:        t.targetPort,
+		LocalAddress:      t.listener.Addr().String(),
+		Username:          t.user,
+		ActiveConnections: atomic.LoadInt64(&t.activeConnections),
+		TotalConnections:  atomic.LoadInt64(&t.totalConnections),
+		BytesIn:           atomic.LoadInt64(&t.bytesIn),
+		BytesOut:          atomic.LoadInt64(&t.bytesOut),
+		CreatedAt:         t.createdAt,
+		LastActivityAt:    t.lastActivity(),
+	}
+}
+
+// tunnelRegistry contains the open tunnels by ID
+type tunnelRegistry struct {
+	sync.RWMutex
+	tunnels map[string]*tunnel
+}
+
+func newTunnelRegistry() *tunnelRegistry {
+	return &tunnelRegistry{
+		tunnels: make(map[string]*tunnel),
+	}
+}
+
+func (r *tunnelRegistry) add(t *tunnel) {
+	r.Lock()
+	r.tunnels[t.id] = t
+	r.Unlock()
+}
+
+func (r *tunnelRegistry) remove(id string) {
+	r.Lock()
+	delete(r.tunnels, id)
+	r.Unlock()
+}
+
+func (r *tunnelRegistry) get(id string) *tunnel {
+	r.RLock()
+	defer r.RUnlock()
+	return r.tunnels[id]
+}
+
+func (r *tunnelRegistry) list() []*tunnel {
+	r.RLock()
+	defer r.RUnlock()
+	out := make([]*tunnel, 0, len(r.tunnels))
+	for _, t := range r.tunnels {
+		out = append(out, t)
+	}
+	return out
+}
+
+func (h *Handler) handleCreateTunnel(c echo.Context) error {
+	namespace := c.Param("namespace")
+	deviceID := c.Param("id")
+
+	r := &resource.TunnelRequestResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+	if r.TargetHost == "" {
+		r.TargetHost = "127.0.0.1"
+	}
+	if r.TargetPort < 1 || r.TargetPort > 65535 {
+		return c.JSON(http.StatusBadRequest, fmt.Sprintf("invalid target port %d", r.TargetPort))
+	}
+
+	m, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if !containsPort(m.TunnelPorts, r.TargetPort) {
+		return c.JSON(http.StatusForbidden,
+			fmt.Sprintf("target port %d is not allowed for device '%s'", r.TargetPort, deviceID))
+	}
+
+	sess, err := h.store.Sessions().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusServiceUnavailable, errDeviceNotConnected.Error())
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	if !containsString(sess.Features, string(proto.FeatureStreams)) {
+		return c.JSON(http.StatusConflict,
+			fmt.Sprintf("device does not support feature '%s'", proto.FeatureStreams))
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(h.cfg.TunnelBindHost, "0"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	t := &tunnel{
+		id:         nuid.Next(),
+		namespace:  namespace,
+		deviceID:   deviceID,
+		targetHost: r.TargetHost,
+		targetPort: r.TargetPort,
+		user:       h.requestUser(c),
+		createdAt:  time.Now().UTC(),
+		listener:   listener,
+		doneCh:     make(chan struct{}),
+	}
+	t.touch()
+	h.tunnels.add(t)
+
+	go h.acceptTunnelConnections(t)
+	go h.closeIdleTunnel(t)
+
+	log.Infof("api: user '%s' opened tunnel '%s' on %s to %s:%d on device '%s'",
+		t.user, t.id, listener.Addr().String(), t.targetHost, t.targetPort, deviceID)
+
+	return c.JSON(http.StatusCreated, t.resource())
+}
+
+func (h *Handler) handleFetchTunnels(c echo.Context) error {
+	out := &resource.TunnelListResource{
+		Members: make([]*resource.TunnelResource, 0),
+	}
+	for _, t := range h.tunnels.list() {
+		out.Members = append(out.Members, t.resource())
+	}
+	resource.SortTunnels(out)
+
+	return c.JSON(http.StatusOK, out)
+}
+
+func (h *Handler) handleDeleteTunnel(c echo.Context) error {
+	t := h.tunnels.get(c.Param("tid"))
+	if t == nil {
+		return c.JSON(http.StatusNotFound, storage.ErrNotFound)
+	}
+
+	t.close("closed by user")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) acceptTunnelConnections(t *tunnel) {
+	defer h.storeTunnelClosedEvent(t)
+	defer h.tunnels.remove(t.id)
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.doneCh:
+			default:
+				log.Error("api: tunnel failed to accept connection: ", err)
+				t.close(err.Error())
+			}
+			return
+		}
+
+		go h.serveTunnelConnection(t, conn)
+	}
+}
+
+// storeTunnelClosedEvent stores the totals of the closed tunnel as event of
+// the device. The event is published by the outbox relay.
+func (h *Handler) storeTunnelClosedEvent(t *tunnel) {
+	details, err := json.Marshal(&tunnelClosedDetails{
+		TunnelID:         t.id,
+		TargetHost:       t.targetHost,
+		TargetPort:       t.targetPort,
+		Username:         t.user,
+		Reason:           t.closeReason,
+		BytesIn:          atomic.LoadInt64(&t.bytesIn),
+		BytesOut:         atomic.LoadInt64(&t.bytesOut),
+		TotalConnections: atomic.LoadInt64(&t.totalConnections),
+		CreatedAt:        t.createdAt,
+	})
+	if err != nil {
+		log.Errorf("api: failed to marshal details of tunnel '%s': %s", t.id, err)
+		return
+	}
+
+	m := &model.Event{
+		Namespace:  t.namespace,
+		SourceType: message.SourceType(message.SourceTypeDevice).String(),
+		SourceID:   t.deviceID,
+		Topic:      eventTopicTunnelClosed,
+		Timestamp:  time.Now().Round(time.Second).UTC(),
+		Details:    string(details),
+	}
+	// The event is stored together with its outbox entry like the events
+	// published by the devices
+	if err := h.store.Events().CreateWithOutbox(m); err != nil {
+		log.Errorf("api: failed to store event of tunnel '%s': %s", t.id, err)
+		return
+	}
+	if h.outbox != nil {
+		h.outbox.Notify()
+	}
+	if h.rules != nil {
+		go h.rules.Evaluate(m)
+	}
+}
+
+// closeIdleTunnel closes the tunnel if there's no traffic within the idle
+// timeout.
+func (h *Handler) closeIdleTunnel(t *tunnel) {
+	idleTimeout := time.Duration(h.cfg.TunnelIdleTimeout) * time.Second
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if time.Since(t.lastActivity()) > idleTimeout {
+				t.close(proto.ErrReasonIdleTimeout.String())
+				return
+			}
+		case <-t.doneCh:
+			return
+		}
+	}
+}
+
+func (h *Handler) serveTunnelConnection(t *tunnel, conn net.Conn) {
+	defer conn.Close()
+
+	atomic.AddInt64(&t.totalConnections, 1)
+	atomic.AddInt64(&t.activeConnections, 1)
+	defer atomic.AddInt64(&t.activeConnections, -1)
+	t.touch()
+
+	stream, err := h.openDeviceStream(t.namespace, t.deviceID, streamKindTunnel, tunnelArguments{
+		Host: t.targetHost,
+		Port: t.targetPort,
+	})
+	if err != nil {
+		log.Errorf("api: tunnel '%s' failed to open stream: %s", t.id, err)
+		return
+	}
+
+	// Forward the data of the local connection to the device
+	readErrCh := make(chan error, 1)
+	go func() {
+		buf := make([]byte, tunnelBufferSize)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if err := stream.Write(buf[:n]); err != nil {
+					readErrCh <- err
+					return
+				}
+				atomic.AddInt64(&t.bytesIn, int64(n))
+				t.touch()
+			}
+			if err != nil {
+				readErrCh <- err
+				return
+			}
+		}
+	}()
+
+	// Forward the data of the device to the local connection
+	for {
+		select {
+		case frame := <-stream.Frames():
+			if frame.Close {
+				stream.Close(frame.Reason, false)
+				return
+			}
+			if _, err := conn.Write(frame.Data); err != nil {
+				stream.Close("connection closed", true)
+				return
+			}
+			atomic.AddInt64(&t.bytesOut, int64(len(frame.Data)))
+			t.touch()
+		case <-readErrCh:
+			stream.Close("connection closed", true)
+			return
+		case <-t.doneCh:
+			stream.Close("tunnel closed", true)
+			return
+		}
+	}
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
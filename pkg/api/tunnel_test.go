@@ -0,0 +1,184 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/config"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+func newTunnelTestHandler(t *testing.T) (*Handler, func()) {
+	nc, shutdown := runServer(t)
+
+	store := memory.NewStore()
+	for _, m := range []*model.Device{
+		{Namespace: "default", DeviceID: "dev1", TunnelPorts: []int{22}},
+		{Namespace: "default", DeviceID: "dev2", TunnelPorts: []int{22}},
+		{Namespace: "default", DeviceID: "dev3", TunnelPorts: []int{22}},
+	} {
+		if err := store.Devices().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range []*model.Session{
+		{Namespace: "default", DeviceID: "dev1", Features: []string{string(proto.FeatureStreams)}},
+		{Namespace: "default", DeviceID: "dev2"},
+	} {
+		if err := store.Sessions().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &Handler{
+		cfg:     &config.Config{TunnelBindHost: "127.0.0.1", TunnelIdleTimeout: 60},
+		nc:      nc,
+		store:   store,
+		tunnels: newTunnelRegistry(),
+	}
+	return h, func() {
+		for _, tun := range h.tunnels.list() {
+			tun.close("test finished")
+		}
+		shutdown()
+	}
+}
+
+func createTunnel(h *Handler, deviceID, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("namespace", "id")
+	c.SetParamValues("default", deviceID)
+	h.handleCreateTunnel(c)
+	return rec
+}
+
+func TestCreateTunnel(t *testing.T) {
+	h, shutdown := newTunnelTestHandler(t)
+	defer shutdown()
+
+	tests := []struct {
+		name     string
+		deviceID string
+		body     string
+		want     int
+	}{
+		{"invalid port", "dev1", `{"targetPort":0}`, http.StatusBadRequest},
+		{"unknown device", "unknown", `{"targetPort":22}`, http.StatusNotFound},
+		{"port not allowed", "dev1", `{"targetPort":80}`, http.StatusForbidden},
+		{"no streams feature", "dev2", `{"targetPort":22}`, http.StatusConflict},
+		{"not connected", "dev3", `{"targetPort":22}`, http.StatusServiceUnavailable},
+		{"allowed port", "dev1", `{"targetPort":22}`, http.StatusCreated},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := createTunnel(h, tc.deviceID, tc.body); rec.Code != tc.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tc.want, rec.Body.String())
+			}
+		})
+	}
+
+	if n := len(h.tunnels.list()); n != 1 {
+		t.Errorf("%d tunnels open, want 1", n)
+	}
+}
+
+func TestTunnelForwarding(t *testing.T) {
+	h, shutdown := newTunnelTestHandler(t)
+	defer shutdown()
+	d := newFakeStreamDevice(t, h.nc, "dev1")
+
+	if rec := createTunnel(h, "dev1", `{"targetPort":22}`); rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	tun := h.tunnels.list()[0]
+
+	conn, err := net.Dial("tcp", tun.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	outbox := d.opened(t)
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if frame := d.next(t); string(frame.Data) != "hello" {
+		t.Errorf("device received %q, want %q", frame.Data, "hello")
+	}
+
+	d.send(t, outbox, message.StreamFrame{Data: []byte("world")})
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "world" {
+		t.Errorf("connection received %q, want %q", buf[:n], "world")
+	}
+
+	// The connection is closed with the stream
+	d.send(t, outbox, message.StreamFrame{Close: true, Reason: "bye"})
+	if _, err := conn.Read(buf); err == nil {
+		t.Error("connection is still open after the stream closed")
+	}
+}
+
+func TestTunnelIdleClose(t *testing.T) {
+	h, shutdown := newTunnelTestHandler(t)
+	defer shutdown()
+	h.cfg.TunnelIdleTimeout = 1
+
+	if rec := createTunnel(h, "dev1", `{"targetPort":22}`); rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	tun := h.tunnels.list()[0]
+
+	select {
+	case <-tun.doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle tunnel isn't closed")
+	}
+	if tun.closeReason != proto.ErrReasonIdleTimeout.String() {
+		t.Errorf("close reason = %s, want %s", tun.closeReason, proto.ErrReasonIdleTimeout)
+	}
+
+	// The closed event is stored with its outbox entry
+	for i := 0; i < 100; i++ {
+		if n, _ := h.store.Outbox().Count(); n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	events, err := h.store.Events().FetchAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events stored, want 1", len(events))
+	}
+	for _, ev := range events {
+		if ev.Topic != eventTopicTunnelClosed || ev.SourceID != "dev1" {
+			t.Errorf("stored event %s of %s, want %s of dev1", ev.Topic, ev.SourceID, eventTopicTunnelClosed)
+		}
+	}
+	if n, _ := h.store.Outbox().Count(); n != 1 {
+		t.Errorf("%d outbox entries, want 1", n)
+	}
+	if h.tunnels.get(tun.id) != nil {
+		t.Error("closed tunnel is still registered")
+	}
+}
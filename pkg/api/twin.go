@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/twin"
+)
+
+// handleFetchTwins returns all twins. The query parameter 'drift=true'
+// returns only the twins whose reported state differs from the desired
+// state.
+func (h *Handler) handleFetchTwins(c echo.Context) error {
+	m, err := h.store.Twins().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	r, err := resource.NewTwinList(m, c.QueryParam("drift") == "true")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, r)
+}
+
+func (h *Handler) handleGetTwin(c echo.Context) error {
+	namespace := c.Param("namespace")
+	deviceID := c.Param("id")
+
+	_, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	m, err := h.twins.Twin(namespace, deviceID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return h.replyTwin(c, m)
+}
+
+// handleReplaceDesiredState replaces the desired state by the request body
+func (h *Handler) handleReplaceDesiredState(c echo.Context) error {
+	return h.setDesiredState(c, false)
+}
+
+// handleMergeDesiredState merges the request body into the desired state
+// like a JSON merge patch
+func (h *Handler) handleMergeDesiredState(c echo.Context) error {
+	return h.setDesiredState(c, true)
+}
+
+// setDesiredState updates the desired state. The update is rejected if the
+// If-Match header doesn't match the current ETag of the twin.
+func (h *Handler) setDesiredState(c echo.Context, merge bool) error {
+	namespace := c.Param("namespace")
+	deviceID := c.Param("id")
+
+	ifMatch := 0
+	if v := c.Request().Header.Get("If-Match"); v != "" {
+		n, err := strconv.Atoi(strings.Trim(v, `W/"`))
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, "invalid If-Match header")
+		}
+		ifMatch = n
+	}
+
+	state := twin.Document{}
+	if err := c.Bind(&state); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	_, err := h.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	m, err := h.twins.SetDesired(namespace, deviceID, state, merge, ifMatch)
+	if err != nil && err == storage.ErrConflict {
+		return c.JSON(http.StatusPreconditionFailed, "twin was modified, fetch the current version")
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return h.replyTwin(c, m)
+}
+
+func (h *Handler) replyTwin(c echo.Context, m *model.Twin) error {
+	r, err := resource.NewTwin(m)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	c.Response().Header().Set("ETag", strconv.Quote(strconv.Itoa(m.Version)))
+	return c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo"
+	log "github.com/sirupsen/logrus"
+)
+
+// headerForwardedUser contains the name of the user authenticated by the
+// reverse proxy in front of the API.
+const headerForwardedUser = "X-Forwarded-User"
+
+// requestUser returns the user of the request. The user authenticated by a
+// trusted proxy is taken from the forwarded user header. Other requests are
+// identified by their remote IP.
+func (h *Handler) requestUser(c echo.Context) string {
+	if user, ok := h.forwardedUser(c); ok {
+		return user
+	}
+	if h.isTrustedProxy(c.Request()) {
+		return c.RealIP()
+	}
+	return remoteIP(c.Request())
+}
+
+// forwardedUser returns the user authenticated by the reverse proxy. The
+// header is ignored unless the request comes from a trusted proxy, otherwise
+// any client could claim to be any user.
+func (h *Handler) forwardedUser(c echo.Context) (string, bool) {
+	if !h.isTrustedProxy(c.Request()) {
+		return "", false
+	}
+	user := c.Request().Header.Get(headerForwardedUser)
+	return user, user != ""
+}
+
+// isTrustedProxy returns true if the request is sent by a trusted proxy
+func (h *Handler) isTrustedProxy(req *http.Request) bool {
+	ip := net.ParseIP(remoteIP(req))
+	if ip == nil {
+		return false
+	}
+	for _, n := range h.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of the peer of the request
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// parseTrustedProxies parses the comma separated list of IP addresses and
+// networks. Invalid entries are skipped.
+func parseTrustedProxies(s string) []*net.IPNet {
+	out := make([]*net.IPNet, 0)
+	for _, elem := range strings.Split(s, ",") {
+		elem = strings.TrimSpace(elem)
+		if elem == "" {
+			continue
+		}
+
+		if !strings.Contains(elem, "/") {
+			if ip := net.ParseIP(elem); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+
+		_, n, err := net.ParseCIDR(elem)
+		if err != nil {
+			log.Warnf("api: ignoring invalid trusted proxy '%s'", elem)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// adminUser returns the user authenticated by a trusted proxy if it's an
+// admin user. The address of a client never makes it an admin, since it can
+// be claimed by the X-Real-IP header.
+func (h *Handler) adminUser(c echo.Context) (string, bool) {
+	user, ok := h.forwardedUser(c)
+	return user, ok && h.isAdmin(user)
+}
+
+// isAdmin returns true if the user is listed in the admin users
+func (h *Handler) isAdmin(user string) bool {
+	for _, admin := range strings.Split(h.cfg.AdminUsers, ",") {
+		if admin = strings.TrimSpace(admin); admin != "" && admin == user {
+			return true
+		}
+	}
+	return false
+}
+
+// userLimiter limits the number of concurrent sessions per user. A limit
+// less or equal zero disables the limiter.
+type userLimiter struct {
+	sync.Mutex
+	limit    int
+	sessions map[string]int
+}
+
+func newUserLimiter(limit int) *userLimiter {
+	return &userLimiter{
+		limit:    limit,
+		sessions: make(map[string]int),
+	}
+}
+
+// acquire returns false if the user reached the limit of sessions
+func (l *userLimiter) acquire(user string) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.limit > 0 && l.sessions[user] >= l.limit {
+		return false
+	}
+	l.sessions[user]++
+	return true
+}
+
+func (l *userLimiter) release(user string) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.sessions[user]--
+	if l.sessions[user] <= 0 {
+		delete(l.sessions, user)
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/config"
+)
+
+func TestRequestUser(t *testing.T) {
+	h := &Handler{
+		cfg:            &config.Config{},
+		trustedProxies: parseTrustedProxies("10.0.0.1, 192.168.0.0/16, invalid, fd00::/8"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       string
+	}{
+		{"untrusted peer", "203.0.113.7:4711", nil, "203.0.113.7"},
+		{"untrusted peer claims a user", "203.0.113.7:4711",
+			map[string]string{headerForwardedUser: "admin"}, "203.0.113.7"},
+		{"untrusted peer claims an IP", "203.0.113.7:4711",
+			map[string]string{echo.HeaderXRealIP: "10.1.1.1"}, "203.0.113.7"},
+		{"trusted proxy forwards a user", "10.0.0.1:4711",
+			map[string]string{headerForwardedUser: "alice"}, "alice"},
+		{"trusted network forwards a user", "192.168.3.4:4711",
+			map[string]string{headerForwardedUser: "bob"}, "bob"},
+		{"trusted IPv6 network forwards a user", "[fd00::1]:4711",
+			map[string]string{headerForwardedUser: "carol"}, "carol"},
+		{"trusted proxy without user", "10.0.0.1:4711",
+			map[string]string{echo.HeaderXRealIP: "198.51.100.1"}, "198.51.100.1"},
+	}
+
+	e := echo.New()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			if got := h.requestUser(c); got != tc.want {
+				t.Errorf("requestUser = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	h := &Handler{cfg: &config.Config{AdminUsers: " alice, ,bob "}}
+
+	for user, want := range map[string]bool{"alice": true, "bob": true, "carol": false, "": false} {
+		if got := h.isAdmin(user); got != want {
+			t.Errorf("isAdmin(%q) = %v, want %v", user, got, want)
+		}
+	}
+}
+
+func TestAdminUser(t *testing.T) {
+	h := &Handler{
+		cfg:            &config.Config{AdminUsers: "alice,203.0.113.7,198.51.100.1"},
+		trustedProxies: parseTrustedProxies("10.0.0.1"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       bool
+	}{
+		{"trusted proxy forwards an admin", "10.0.0.1:4711",
+			map[string]string{headerForwardedUser: "alice"}, true},
+		{"trusted proxy forwards a user", "10.0.0.1:4711",
+			map[string]string{headerForwardedUser: "bob"}, false},
+		{"untrusted peer claims an admin", "203.0.113.8:4711",
+			map[string]string{headerForwardedUser: "alice"}, false},
+		{"address of an untrusted peer", "203.0.113.7:4711", nil, false},
+		{"address forwarded by a trusted proxy", "10.0.0.1:4711",
+			map[string]string{echo.HeaderXRealIP: "198.51.100.1"}, false},
+	}
+
+	e := echo.New()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			if _, got := h.adminUser(c); got != tc.want {
+				t.Errorf("adminUser = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUserLimiter(t *testing.T) {
+	l := newUserLimiter(2)
+
+	if !l.acquire("alice") || !l.acquire("alice") {
+		t.Fatal("acquire within the limit failed")
+	}
+	if l.acquire("alice") {
+		t.Error("acquire beyond the limit succeeded")
+	}
+	if !l.acquire("bob") {
+		t.Error("limit of another user applied")
+	}
+
+	l.release("alice")
+	if !l.acquire("alice") {
+		t.Error("acquire after release failed")
+	}
+
+	unlimited := newUserLimiter(0)
+	for i := 0; i < 10; i++ {
+		if !unlimited.acquire("alice") {
+			t.Fatal("disabled limiter rejected a session")
+		}
+	}
+}
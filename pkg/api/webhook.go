@@ -0,0 +1,183 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+	"github.com/nsyszr/lcm/pkg/api/resource"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+func (h *Handler) handleFetchWebhooks(c echo.Context) error {
+	m, err := h.store.Webhooks().FetchAll()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if namespace := c.QueryParam("namespace"); namespace != "" {
+		for id, elem := range m {
+			if elem.Namespace != namespace {
+				delete(m, id)
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, resource.NewWebhookList(m))
+}
+
+func (h *Handler) handleGetWebhookByID(c echo.Context) error {
+	m, status, err := h.findWebhook(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewWebhook(m))
+}
+
+func (h *Handler) handleCreateWebhook(c echo.Context) error {
+	r := &resource.WebhookResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateWebhook(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.store.Webhooks().Create(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, resource.NewWebhook(m))
+}
+
+// handleUpdateWebhook replaces the webhook. The secret is kept if the
+// request doesn't contain a new one.
+func (h *Handler) handleUpdateWebhook(c echo.Context) error {
+	existing, status, err := h.findWebhook(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	r := &resource.WebhookResource{}
+	if err := c.Bind(r); err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := resource.ValidateWebhook(r)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	m.ID = existing.ID
+	m.CreatedAt = existing.CreatedAt
+	if m.Secret == "" {
+		m.Secret = existing.Secret
+	}
+
+	if err := h.store.Webhooks().Update(m); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewWebhook(m))
+}
+
+// handleDeleteWebhook deletes the webhook and its deliveries
+func (h *Handler) handleDeleteWebhook(c echo.Context) error {
+	m, status, err := h.findWebhook(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	if err := h.store.Webhooks().Delete(m.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+	if err := h.store.WebhookDeliveries().DeleteByWebhookID(m.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusNoContent, nil)
+}
+
+// handleFetchWebhookDeliveries returns the delivery log of the webhook
+// filtered by the query parameter 'status'
+func (h *Handler) handleFetchWebhookDeliveries(c echo.Context) error {
+	w, status, err := h.findWebhook(c)
+	if err != nil {
+		return c.JSON(status, err)
+	}
+
+	m, err := h.store.WebhookDeliveries().FindByWebhookID(w.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if status := c.QueryParam("status"); status != "" {
+		for id, elem := range m {
+			if elem.Status != status {
+				delete(m, id)
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, resource.NewWebhookDeliveryList(m))
+}
+
+// handleFetchWebhookDeadLetters returns the deliveries of all webhooks which
+// failed after the maximum attempts
+func (h *Handler) handleFetchWebhookDeadLetters(c echo.Context) error {
+	m, err := h.store.WebhookDeliveries().FindByStatus(model.WebhookDeliveryStatusDead)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	if namespace := c.QueryParam("namespace"); namespace != "" {
+		for id, elem := range m {
+			if elem.Namespace != namespace {
+				delete(m, id)
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, resource.NewWebhookDeliveryList(m))
+}
+
+// handleRedeliverWebhookDelivery schedules a finished delivery again, e.g. a
+// dead letter after the endpoint was fixed
+func (h *Handler) handleRedeliverWebhookDelivery(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("did"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err)
+	}
+
+	m, err := h.webhooks.Redeliver(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return c.JSON(http.StatusNotFound, err)
+	} else if err != nil && err == storage.ErrConflict {
+		return c.JSON(http.StatusConflict, "delivery is pending")
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, resource.NewWebhookDelivery(m))
+}
+
+// findWebhook returns the webhook of the path parameter 'wid' or the status
+// code of the error response.
+func (h *Handler) findWebhook(c echo.Context) (*model.Webhook, int, error) {
+	id, err := strconv.Atoi(c.Param("wid"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	m, err := h.store.Webhooks().FindByID(int32(id))
+	if err != nil && err == storage.ErrNotFound {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return m, http.StatusOK, nil
+}
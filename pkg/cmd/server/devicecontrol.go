@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"syscall"
@@ -17,9 +18,22 @@ import (
 	nats "github.com/nats-io/nats.go"
 	"github.com/nsyszr/lcm/config"
 	"github.com/nsyszr/lcm/pkg/api"
+	"github.com/nsyszr/lcm/pkg/configarchive"
 	"github.com/nsyszr/lcm/pkg/devicecontrol"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel"
+	"github.com/nsyszr/lcm/pkg/eventstream"
+	"github.com/nsyszr/lcm/pkg/filetransfer"
+	"github.com/nsyszr/lcm/pkg/firmware"
+	"github.com/nsyszr/lcm/pkg/health"
+	"github.com/nsyszr/lcm/pkg/maintenance"
+	"github.com/nsyszr/lcm/pkg/metrics"
+	"github.com/nsyszr/lcm/pkg/outbox"
+	"github.com/nsyszr/lcm/pkg/rules"
 	"github.com/nsyszr/lcm/pkg/storage/postgres"
+	"github.com/nsyszr/lcm/pkg/telemetry"
+	"github.com/nsyszr/lcm/pkg/tracing"
+	"github.com/nsyszr/lcm/pkg/twin"
+	"github.com/nsyszr/lcm/pkg/webhook"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -32,7 +46,16 @@ type deviceControlServer struct {
 	quitCh chan bool
 	doneCh chan bool
 	errCh  chan error
-	wg     sync.WaitGroup
+
+	// drainCh starts the drain mode, drainedCh is closed after the control
+	// channels are drained
+	drainCh   chan struct{}
+	drainOnce sync.Once
+	drainedCh chan struct{}
+
+	// outageTimer drains the server if NATS doesn't reconnect in time
+	outageMutex sync.Mutex
+	outageTimer *time.Timer
 }
 
 func init() {
@@ -65,27 +88,41 @@ func newDeviceControlServer(c *config.Config) (*deviceControlServer, error) {
 		quitCh: make(chan bool),
 		doneCh: make(chan bool),
 		errCh:  make(chan error, 1),
-		wg:     sync.WaitGroup{},
+
+		drainCh:   make(chan struct{}),
+		drainedCh: make(chan struct{}),
 	}
 
+	// The client reconnects forever, the subscriptions are restored after
+	// a reconnect and publishes are buffered meanwhile. The server drains
+	// itself if the outage exceeds the threshold.
 	nc, err := nats.Connect(c.NATSServerURL,
 		nats.DrainTimeout(10*time.Second),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
 		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
-			fmt.Printf("\n\nerror handler: %s\n\n", err)
-			s.errCh <- err
+			log.Error("NATS error: ", err)
+			// Nobody may wait for the error, the handler must not block
+			select {
+			case s.errCh <- err:
+			default:
+			}
 		}),
 		nats.ClosedHandler(func(_ *nats.Conn) {
-			fmt.Printf("\n\nclosed handler\n\n")
-			s.wg.Done()
+			log.Info("NATS connection closed")
+		}),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			// The handler is called by the shutdown as well
+			if nc.IsClosed() || nc.IsDraining() {
+				return
+			}
+			log.Warn("NATS disconnected, reconnecting: ", err)
+			s.startOutage()
 		}),
-		nats.DisconnectHandler(func(_ *nats.Conn) {
-			// TODO(DGL) this method is called twice when NATS server is going
-			// offline. 1st when server gone and 2nd when the shutdown/drain is
-			// initiated.
-			fmt.Printf("\n\ndisconnect handler\n\n")
-			// s.wg.Done()
-			syscall.Kill(syscall.Getpid(), syscall.SIGINT)
-			//s.quitCh <- os.Interrupt
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Infof("NATS reconnected to %s, restored %d subscriptions",
+				nc.ConnectedUrl(), nc.NumSubscriptions())
+			s.stopOutage()
 		}))
 	if err != nil {
 		return nil, err
@@ -99,7 +136,7 @@ func newDeviceControlServer(c *config.Config) (*deviceControlServer, error) {
 func initDB(c *config.Config) (db *sqlx.DB, err error) {
 	// Connect to PostgreSQL database
 	// TODO(DGL) remove hardcoded database URL
-	db, err = sqlx.Open("postgres", c.DatabaseURL)
+	db, err = postgres.Open(c.DatabaseURL)
 	if err != nil {
 		log.Error("Failed to connect database: ", err)
 		return
@@ -121,19 +158,134 @@ func (s *deviceControlServer) Serve() {
 
 	e.Use(middleware.Recover())
 	e.Use(logger())
+	e.Use(tracing.Middleware())
 	// e.HTTPErrorHandler = errorx.JSONErrorHandler
 
-	// Create the controller
-	ctrl := controlchannel.NewController(s.nc, postgres.NewStore(s.db))
+	// Install the tracer provider, the spans are flushed on shutdown
+	shutdownTracing, err := tracing.Init(s.cfg.TracingExporter, s.cfg.TracingOTLPEndpoint, s.cfg.TracingSampleRatio)
+	if err != nil {
+		log.Error("failed to initialize tracing: ", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error("failed to shut down tracing: ", err)
+		}
+	}()
+
+	store := postgres.NewStore(s.db)
+
+	// Create the event publisher, in durable mode the events are captured by
+	// a JetStream stream
+	events := eventstream.NewPublisher(s.nc)
+	if s.cfg.JetStreamEnabled {
+		var err error
+		events, err = eventstream.NewDurablePublisher(s.nc, s.cfg.JetStreamStream,
+			time.Duration(s.cfg.JetStreamMaxAge)*time.Second)
+		if err != nil {
+			log.Error("failed to create event stream: ", err)
+			os.Exit(1)
+		}
+	}
+
+	// Start the outbox relay, events stored before are published first
+	relay := outbox.NewRelay(events, store)
+	relay.Start()
+	defer relay.Stop()
+	metrics.RegisterOutboxDepth(store.Outbox().Count)
+
+	// Create the controller, the stored events are evaluated by the rules
+	engine := rules.NewEngine(s.nc, events, store)
+	ctrl := controlchannel.NewController(s.nc, store, engine, events, relay)
 	ctrl.Subscribe()
 
+	// Drain the control channels on request, the server is shut down
+	// afterwards
+	go func() {
+		<-s.drainCh
+		log.Info("Drain signal received")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.DrainTimeout)*time.Second)
+		defer cancel()
+		if err := ctrl.Drain(ctx, s.cfg.DrainWaveSize, time.Duration(s.cfg.DrainWaveInterval)*time.Second); err != nil {
+			log.Error("failed to drain control channels: ", err)
+		}
+		close(s.drainedCh)
+	}()
+
+	// Start the file transfers, unfinished transfers are resumed
+	transfers := filetransfer.NewManager(s.nc, store, s.cfg.BlobDir,
+		s.cfg.FileTransferMaxConcurrent, s.cfg.FileTransferMaxPerDevice, s.cfg.FileTransferMaxUploadSize)
+	if err := transfers.Start(); err != nil {
+		log.Error("failed to start file transfers: ", err)
+	}
+	defer transfers.Stop()
+
+	// Start the firmware campaigns, running campaigns are continued
+	fw := firmware.NewOrchestrator(s.nc, store,
+		firmware.NewRepository(store.FirmwareImages(), filepath.Join(s.cfg.BlobDir, "firmware")),
+		transfers, time.Duration(s.cfg.FirmwareRebootTimeout)*time.Second)
+	if err := fw.Start(); err != nil {
+		log.Error("failed to start firmware campaigns: ", err)
+	}
+	defer fw.Stop()
+
+	// Start the periodic configuration backups of the devices connected to
+	// this server
+	configs := configarchive.NewArchive(s.nc, store, time.Duration(s.cfg.ConfigBackupInterval)*time.Second,
+		s.cfg.ConfigBackupConcurrency, ctrl.SessionIDs)
+	configs.Start()
+	defer configs.Stop()
+
+	// Start the device twins, deltas are pushed to reconnecting devices
+	twins := twin.NewService(s.nc, store)
+	if err := twins.Start(); err != nil {
+		log.Error("failed to start device twins: ", err)
+	}
+	defer twins.Stop()
+
+	// Start the maintenance windows, expired windows are ended
+	maint := maintenance.NewManager(events, store)
+	maint.Start()
+	defer maint.Stop()
+
+	// Start the webhooks, pending deliveries are retried
+	webhooks := webhook.NewDispatcher(s.nc, store, s.cfg.WebhookMaxAttempts,
+		time.Duration(s.cfg.WebhookBackoff)*time.Second, time.Duration(s.cfg.WebhookTimeout)*time.Second)
+	if err := webhooks.Start(); err != nil {
+		log.Error("failed to start webhooks: ", err)
+	}
+	defer webhooks.Stop()
+
+	// Start the device telemetry, the rollups are caught up
+	telem := telemetry.NewService(s.nc, store, telemetry.Retention{
+		Raw: time.Duration(s.cfg.TelemetryRawRetention) * time.Second,
+		Rollups: map[time.Duration]time.Duration{
+			5 * time.Minute: time.Duration(s.cfg.Telemetry5mRetention) * time.Second,
+			time.Hour:       time.Duration(s.cfg.Telemetry1hRetention) * time.Second,
+		},
+	})
+	if err := telem.Start(); err != nil {
+		log.Error("failed to start telemetry: ", err)
+	}
+	defer telem.Stop()
+
 	// Register API endpoints
 	deviceControlHandler := devicecontrol.NewHandler(ctrl)
 	deviceControlHandler.RegisterRoutes(e)
 
-	apiHandler := api.NewHandler(s.nc, postgres.NewStore(s.db))
+	apiHandler := api.NewHandler(s.cfg, s.nc, store, transfers, fw, configs, twins, maint, engine, relay, webhooks, telem, s.Drain)
 	apiHandler.RegisterRoutes(e)
 
+	// Register the liveness and readiness probes
+	healthChecker := health.NewChecker(s.db, s.nc, ctrl.Draining)
+	healthChecker.RegisterRoutes(e)
+
+	// Register the Prometheus metrics endpoint
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+
 	// Register devicecontrol endpoint
 	// e.Any("/devicecontrol/v1", devicecontrol.Handler())
 
@@ -221,6 +373,45 @@ func logger() echo.MiddlewareFunc {
 	}
 }
 
+// Drain starts the drain mode of the server. It's safe to call Drain more
+// than once.
+func (s *deviceControlServer) Drain() {
+	s.drainOnce.Do(func() {
+		close(s.drainCh)
+	})
+}
+
+// startOutage starts the outage timer. If NATS doesn't reconnect within the
+// threshold the server drains itself and shuts down.
+func (s *deviceControlServer) startOutage() {
+	if s.cfg.NATSOutageThreshold <= 0 {
+		return
+	}
+
+	s.outageMutex.Lock()
+	defer s.outageMutex.Unlock()
+
+	if s.outageTimer != nil {
+		return
+	}
+	threshold := time.Duration(s.cfg.NATSOutageThreshold) * time.Second
+	s.outageTimer = time.AfterFunc(threshold, func() {
+		log.Errorf("NATS outage exceeded %s, draining server", threshold)
+		s.Drain()
+	})
+}
+
+// stopOutage stops the outage timer after NATS reconnected
+func (s *deviceControlServer) stopOutage() {
+	s.outageMutex.Lock()
+	defer s.outageMutex.Unlock()
+
+	if s.outageTimer != nil {
+		s.outageTimer.Stop()
+		s.outageTimer = nil
+	}
+}
+
 func (s *deviceControlServer) Shutdown() {
 	if s.nc != nil {
 		s.nc.Drain()
@@ -248,10 +439,23 @@ func RunServeDeviceControl(c *config.Config) func(cmd *cobra.Command, args []str
 
 		go s.Serve()
 
-		// Wait for interrupt signal to gracefully shutdown the server
-		quitCh := make(chan os.Signal)
-		signal.Notify(quitCh, os.Interrupt)
-		<-quitCh
+		// Wait for interrupt signal to gracefully shutdown the server. The
+		// terminate signal drains the control channels first, a second
+		// signal skips the rest of the drain. A drain requested by the
+		// admin endpoint or a NATS outage shuts down the server as well.
+		quitCh := make(chan os.Signal, 1)
+		signal.Notify(quitCh, os.Interrupt, syscall.SIGTERM)
+		select {
+		case sig := <-quitCh:
+			if sig == syscall.SIGTERM {
+				s.Drain()
+				select {
+				case <-s.drainedCh:
+				case <-quitCh:
+				}
+			}
+		case <-s.drainedCh:
+		}
 
 		// Shutdown the server
 		s.Shutdown()
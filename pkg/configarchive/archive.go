@@ -0,0 +1,198 @@
+// Package configarchive retrieves the running configuration of the devices
+// and stores every change as a new version.
+package configarchive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/client"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Device commands for retrieving and replacing the running configuration
+const (
+	CommandGet = "config.get"
+	CommandSet = "config.set"
+)
+
+// configResults are the results of the get command and the arguments of the
+// set command
+type configResults struct {
+	Config string `json:"config"`
+}
+
+// Archive stores the configuration versions of the devices. The
+// configuration of the devices connected to this server is retrieved
+// periodically if an interval is given. Every server backs up its own
+// devices, at most concurrency at a time.
+type Archive struct {
+	store       storage.Interface
+	client      *client.Client
+	interval    time.Duration
+	concurrency int
+	sessionIDs  func() map[int32]bool
+
+	// mu serializes the numbering of new versions
+	mu     sync.Mutex
+	stopCh chan bool
+}
+
+// NewArchive creates a new configuration archive. The sessionIDs function
+// returns the IDs of the sessions connected to this server.
+func NewArchive(nc *nats.Conn, store storage.Interface, interval time.Duration, concurrency int, sessionIDs func() map[int32]bool) *Archive {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Archive{
+		store:       store,
+		client:      client.New(nc),
+		interval:    interval,
+		concurrency: concurrency,
+		sessionIDs:  sessionIDs,
+		stopCh:      make(chan bool),
+	}
+}
+
+// Start starts the periodic backups
+func (a *Archive) Start() {
+	if a.interval <= 0 {
+		log.Info("configarchive periodic backups are disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				a.backupAll()
+			case <-a.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic backups
+func (a *Archive) Stop() {
+	close(a.stopCh)
+}
+
+func (a *Archive) backupAll() {
+	sessions, err := a.store.Sessions().FetchAll()
+	if err != nil {
+		log.Error("configarchive failed to fetch sessions: ", err)
+		return
+	}
+	local := a.sessionIDs()
+
+	sem := make(chan struct{}, a.concurrency)
+	wg := sync.WaitGroup{}
+	for id, elem := range sessions {
+		if !local[id] {
+			continue
+		}
+
+		sess := elem
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if _, _, err := a.Backup(sess.Namespace, sess.DeviceID, model.ConfigVersionSourcePeriodic); err != nil {
+				log.Errorf("configarchive failed to backup config of device '%s': %s", sess.DeviceID, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Backup retrieves the running configuration of the device. A new version is
+// created if the configuration differs from the latest version, otherwise
+// the latest version is returned and created is false.
+func (a *Archive) Backup(namespace, deviceID, source string) (v *model.ConfigVersion, created bool, err error) {
+	res := configResults{}
+	if err := a.client.Call(namespace, deviceID, CommandGet, nil, &res); err != nil {
+		return nil, false, err
+	}
+
+	sum := sha256.Sum256([]byte(res.Config))
+	checksum := hex.EncodeToString(sum[:])
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	latest, err := a.Latest(namespace, deviceID)
+	if err != nil && err != storage.ErrNotFound {
+		return nil, false, err
+	}
+	if latest != nil && latest.Checksum == checksum {
+		return latest, false, nil
+	}
+
+	v = &model.ConfigVersion{
+		Namespace: namespace,
+		DeviceID:  deviceID,
+		Version:   1,
+		Checksum:  checksum,
+		Content:   res.Config,
+		Source:    source,
+	}
+	if latest != nil {
+		v.Version = latest.Version + 1
+	}
+	if err := a.store.ConfigVersions().Create(v); err != nil {
+		return nil, false, errors.Wrap(err, "failed to create config version")
+	}
+
+	log.Infof("configarchive stored version %d of device '%s'", v.Version, deviceID)
+
+	return v, true, nil
+}
+
+// Restore pushes the configuration of the given version to the device. The
+// configuration running afterwards is archived.
+func (a *Archive) Restore(v *model.ConfigVersion) (*model.ConfigVersion, error) {
+	if err := a.client.Call(v.Namespace, v.DeviceID, CommandSet, configResults{Config: v.Content}, nil); err != nil {
+		return nil, err
+	}
+
+	log.Infof("configarchive restored version %d of device '%s'", v.Version, v.DeviceID)
+
+	current, _, err := a.Backup(v.Namespace, v.DeviceID, model.ConfigVersionSourceRestore)
+	return current, err
+}
+
+// Latest returns the latest version of the device
+func (a *Archive) Latest(namespace, deviceID string) (*model.ConfigVersion, error) {
+	return a.store.ConfigVersions().FindLatestByNamespaceAndDeviceID(namespace, deviceID)
+}
+
+// FindVersion returns the given version of the device
+func (a *Archive) FindVersion(namespace, deviceID string, version int) (*model.ConfigVersion, error) {
+	versions, err := a.store.ConfigVersions().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, elem := range versions {
+		if elem.Version == version {
+			return &elem, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
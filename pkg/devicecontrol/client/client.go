@@ -0,0 +1,188 @@
+// Package client calls device commands through the devicecontrol controller.
+// It's used by server side components, e.g. the file transfer, which talk
+// to devices without a HTTP request.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/metrics"
+	"github.com/nsyszr/lcm/pkg/tracing"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultTimeout is a bit longer than the time the controller waits for the
+// next reply of the device. That ensures we receive the error reply of the
+// controller instead of running into a timeout.
+const defaultTimeout = 20 * time.Second
+
+// cancelTimeout limits the time to wait for the reply of a cancel request
+const cancelTimeout = 5 * time.Second
+
+// CallError is returned if the device or the controller replies with an
+// error.
+type CallError struct {
+	Reason  string
+	Details interface{}
+}
+
+func (e *CallError) Error() string {
+	if e.Details != nil {
+		return fmt.Sprintf("call failed: %s (%v)", e.Reason, e.Details)
+	}
+	return fmt.Sprintf("call failed: %s", e.Reason)
+}
+
+// IsUnavailable returns true if the call failed because the device isn't
+// connected or didn't answer in time. The call can be repeated after the
+// device reconnected.
+func IsUnavailable(err error) bool {
+	if err == nats.ErrTimeout {
+		return true
+	}
+	e, ok := err.(*CallError)
+	if !ok {
+		return false
+	}
+	switch e.Reason {
+	case proto.ErrReasonInvalidSession.String(),
+		proto.ErrReasonTechnicalException.String(),
+		proto.ErrReasonResultTimeout.String():
+		return true
+	}
+	return false
+}
+
+// Client calls device commands
+type Client struct {
+	nc      *nats.Conn
+	timeout time.Duration
+}
+
+// New creates a new client
+func New(nc *nats.Conn) *Client {
+	return &Client{
+		nc:      nc,
+		timeout: defaultTimeout,
+	}
+}
+
+// Call runs the command on the given device and decodes the results into the
+// given value. The results are ignored if results is nil. The call runs as
+// long as the device reports its progress, the timeout applies to each reply.
+// A call which timed out is cancelled.
+func (c *Client) Call(namespace, deviceID, command string, arguments, results interface{}) error {
+	req := message.CallRequest{
+		CallID:     nuid.Next(),
+		TargetType: message.TargetTypeDevice,
+		TargetID:   deviceID,
+		Command:    command,
+		Arguments:  arguments,
+		Stream:     true,
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal call request")
+	}
+
+	// The calls of the server side components start their own traces
+	ctx, span := tracing.Start(context.Background(), "client call",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("device.id", deviceID),
+			attribute.String("call.id", req.CallID),
+			attribute.String("call.command", command),
+		))
+	defer span.End()
+
+	start := time.Now()
+	rep, err := c.request(ctx, namespace, req.CallID, data)
+	metrics.ObserveCall(metrics.HopClient, start)
+	if err == nats.ErrTimeout {
+		metrics.CallTimeouts.WithLabelValues(metrics.HopClient).Inc()
+		metrics.NATSRequestErrors.WithLabelValues("call").Inc()
+		tracing.RecordError(span, err)
+		go c.cancel(namespace, req.CallID)
+		return err
+	} else if err != nil {
+		metrics.NATSRequestErrors.WithLabelValues("call").Inc()
+		tracing.RecordError(span, err)
+		return err
+	}
+
+	if rep.Status == message.ReplyStatusError {
+		tracing.Fail(span, rep.ErrorReason)
+		return &CallError{Reason: rep.ErrorReason, Details: rep.ErrorDetails}
+	}
+
+	if results == nil {
+		return nil
+	}
+
+	// The results are generic JSON values, we convert them by a round trip
+	out, err := json.Marshal(rep.Results)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal call results")
+	}
+	if err := json.Unmarshal(out, results); err != nil {
+		return errors.Wrap(err, "failed to unmarshal call results")
+	}
+
+	return nil
+}
+
+// request sends the call request and returns the final reply. The
+// progressive replies reset the timeout.
+func (c *Client) request(ctx context.Context, namespace, callID string, data []byte) (*message.CallReply, error) {
+	inbox := nats.NewInbox()
+	sub, err := c.nc.SubscribeSync(inbox)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe call replies")
+	}
+	defer sub.Unsubscribe()
+
+	req := tracing.NewMsg(ctx, c.nc, fmt.Sprintf("iotcore.devicecontrol.v1.%s.call", namespace), data)
+	req.Reply = inbox
+	if err := c.nc.PublishMsg(req); err != nil {
+		return nil, errors.Wrap(err, "failed to request call")
+	}
+
+	for {
+		msg, err := sub.NextMsg(c.timeout)
+		if err != nil {
+			return nil, err
+		}
+
+		rep := &message.CallReply{}
+		if err := json.Unmarshal(msg.Data, rep); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal call reply")
+		}
+		if !rep.Partial {
+			return rep, nil
+		}
+	}
+}
+
+// cancel cancels a call which timed out
+func (c *Client) cancel(namespace, callID string) {
+	data, err := json.Marshal(message.CancelRequest{CallID: callID})
+	if err != nil {
+		return
+	}
+
+	_, err = c.nc.Request(fmt.Sprintf("iotcore.devicecontrol.v1.%s.cancel", namespace), data, cancelTimeout)
+	if err != nil && err != nats.ErrTimeout {
+		log.Errorf("client failed to cancel call '%s': %s", callID, err)
+	}
+}
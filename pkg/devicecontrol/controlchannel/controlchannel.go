@@ -11,6 +11,7 @@ import (
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/wsio"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -26,6 +27,7 @@ type sessionDetails struct {
 	timeout       int
 	realm         string
 	lastMessageAt time.Time
+	capabilities  *proto.Capabilities
 }
 
 type ControlChannel struct {
@@ -47,6 +49,9 @@ type ControlChannel struct {
 	// wsTerminateCh  chan<- struct{}
 	// wsCloseCh      chan struct{}
 	target *wsio.Driver
+	// serializer encodes and decodes the messages in the format negotiated
+	// during the websocket upgrade.
+	serializer proto.Serializer
 	// wsOutboxCh     chan *OutboxMessage
 	// inboxCh        chan *InboxMessage
 
@@ -54,11 +59,55 @@ type ControlChannel struct {
 	nextRequestID      int32
 
 	callResultsMutex sync.RWMutex
-	callResults      map[int32]chan<- interface{}
+	callResults      map[int32]*pendingCall
+	// cancelledCalls contains the request IDs of timed out or cancelled
+	// calls. A result or error message which arrives late for one of these
+	// calls is dropped instead of aborting the session.
+	cancelledCalls map[int32]time.Time
+
+	// streams contains the open streams of the session by stream ID
+	streamsMutex sync.RWMutex
+	streams      map[int32]*deviceStream
+	nextStreamID int32
+
+	subCall       *nats.Subscription
+	subStreamOpen *nats.Subscription
+	subPublish    *nats.Subscription
+}
+
+// pendingCall is a call message sent to the device that waits for its
+// result or error message.
+type pendingCall struct {
+	requestID  int32
+	callID     string
+	requestor  string
+	progressCh chan *proto.ResultMessage
+	finalCh    chan interface{}
+	cancelCh   chan proto.ErrorReason
+}
+
+// progress passes a progressive result to the call handler. The result is
+// dropped if the handler falls behind, e.g. because the requestor consumes
+// the stream slowly, since the inbox of the session must not block.
+func (call *pendingCall) progress(result *proto.ResultMessage) bool {
+	select {
+	case call.progressCh <- result:
+		return true
+	default:
+		return false
+	}
+}
 
-	subCall *nats.Subscription
+// finish passes the final result or error message to the call handler. It's
+// called once, after the call was removed from the pending calls.
+func (call *pendingCall) finish(result interface{}) {
+	call.finalCh <- result
 }
 
+// cancelledCallsRetention defines how long the request ID of a cancelled
+// call is remembered for dropping late results.
+const cancelledCallsRetention = 10 * time.Minute
+
 // Close is called when the websocket handler method is exiting, e.g. the
 // connection is closed.
 func (cc *ControlChannel) Close() {
@@ -66,10 +115,27 @@ func (cc *ControlChannel) Close() {
 
 	// Unregister the control channel from the controller
 	cc.ctrl.UnregisterSession(cc.sessionDetails.id)
+	cc.ctrl.removeChannel(cc)
+	if cc.status == StatusRegistered {
+		// TODO(DGL) Fix hardcoded namespace
+		metrics.SessionsConnected.WithLabelValues("default").Dec()
+	}
 
 	if cc.subCall != nil {
 		cc.subCall.Unsubscribe()
 	}
+	if cc.subStreamOpen != nil {
+		cc.subStreamOpen.Unsubscribe()
+	}
+	if cc.subPublish != nil {
+		cc.subPublish.Unsubscribe()
+	}
+
+	// The requestors of open streams have to know that the device is gone
+	cc.closeAllStreams(proto.ErrReasonStreamClosed)
+
+	// The pending calls fail right away instead of waiting for the timeout
+	cc.failPendingCalls(proto.ErrReasonInvalidSession)
 
 	// Tell our go waitForPingOrClose routines to stop listening for a signal
 	cc.stopCh <- true
@@ -81,15 +147,26 @@ func (cc *ControlChannel) inboxHandler() {
 		select {
 		case msg := <-cc.target.Inbox:
 			{
-				log.Debugf("controlchannel reveived message: '%s'", string(msg.Data))
+				log.Debugf("controlchannel received message of %d bytes", len(msg.Data))
 
 				// Unmarshal the message to get the message type for further processing.
-				msgType, msg, err := proto.UnmarshalMessage(msg.Data)
+				msgType, msg, err := proto.UnmarshalMessageWith(cc.serializer, msg.Data)
 				if err != nil {
 					log.Errorf("controlchannel received invalid message: %s", err.Error())
 					cc.sendTerminate()
 					return // We stop handling new inbox messages
 				}
+				metrics.Messages.WithLabelValues(metrics.DirectionIn, msgType.String()).Inc()
+
+				// Message types beyond the base protocol are only allowed if
+				// the required feature was negotiated for this session.
+				if f, ok := proto.RequiredFeature(msgType); ok && !cc.hasFeature(f) {
+					log.Warnf("controlchannel received message of type %s but feature '%s' is not negotiated",
+						msgType.String(), f)
+					cc.sendAbortMessageAndClose(proto.ErrReasonProtocolViolation,
+						fmt.Sprintf("message of type '%s' requires feature '%s'", msgType.String(), f))
+					return // We stop handling new inbox messages
+				}
 
 				unhandled := false
 				switch msgType {
@@ -101,8 +178,16 @@ func (cc *ControlChannel) inboxHandler() {
 					err = cc.handleMessage(msg, cc.ensureRegistered(cc.keepAliveHandler()))
 				case proto.MessageTypePublish:
 					err = cc.handleMessage(msg, cc.ensureRegistered(cc.eventHandler()))
+				case proto.MessageTypePublished:
+					err = cc.handleMessage(msg, cc.ensureRegistered(cc.publishedHandler()))
 				case proto.MessageTypeResult:
 					err = cc.handleMessage(msg, cc.ensureRegistered(cc.resultHandler()))
+				case proto.MessageTypeError:
+					err = cc.handleMessage(msg, cc.ensureRegistered(cc.errorHandler()))
+				case proto.MessageTypeStreamData:
+					err = cc.handleMessage(msg, cc.ensureRegistered(cc.streamDataHandler()))
+				case proto.MessageTypeStreamClose:
+					err = cc.handleMessage(msg, cc.ensureRegistered(cc.streamCloseHandler()))
 				default:
 					unhandled = true
 				}
@@ -129,31 +214,46 @@ func (cc *ControlChannel) inboxHandler() {
 // AdmitRegistration is called by the controller after successful registration
 // (authorization) of the client. This method sets neccessary values for
 // running the control channel and starts the keep alive handling in the
-// background (waitForPingOrClose).
-func (cc *ControlChannel) AdmitRegistration(sessionID int32, timeout int, realm string) {
+// background (waitForPingOrClose). The requests of the device are subscribed
+// after the WELCOME message is sent.
+func (cc *ControlChannel) AdmitRegistration(sessionID int32, timeout int, realm string, caps *proto.Capabilities) {
 	cc.status = StatusRegistered
-	cc.updateSessionDetails(sessionID, timeout, realm)
+	cc.updateSessionDetails(sessionID, timeout, realm, caps)
+	// TODO(DGL) Fix hardcoded namespace
+	metrics.SessionsConnected.WithLabelValues("default").Inc()
 
 	// Start the session timeout timer. If client doesn't send a ping withing
 	// given timeout the connection will be closed.
 	go cc.waitForPingOrClose()
 
-	// Listen for call requests
-	// TODO(DGL) Working with relam is shit !
-	deviceIDAndURI := strings.SplitN(realm, "@", 2)
-	go cc.subscribe(deviceIDAndURI[0])
-
 	log.Infof("controlchannel registered for device '%s'", realm)
 }
 
-func (cc *ControlChannel) updateSessionDetails(id int32, timeout int, realm string) {
+func (cc *ControlChannel) updateSessionDetails(id int32, timeout int, realm string, caps *proto.Capabilities) {
 	cc.sessionDetailsMutex.Lock()
 	cc.sessionDetails.id = id
 	cc.sessionDetails.timeout = timeout
 	cc.sessionDetails.realm = realm
+	cc.sessionDetails.capabilities = caps
 	cc.sessionDetailsMutex.Unlock()
 }
 
+// deviceID returns the device ID of the registered realm
+func (cc *ControlChannel) deviceID() string {
+	cc.sessionDetailsMutex.RLock()
+	defer cc.sessionDetailsMutex.RUnlock()
+	// TODO(DGL) Working with relam is shit !
+	return strings.SplitN(cc.sessionDetails.realm, "@", 2)[0]
+}
+
+// hasFeature returns true if the given feature was negotiated during
+// registration.
+func (cc *ControlChannel) hasFeature(f proto.Feature) bool {
+	cc.sessionDetailsMutex.RLock()
+	defer cc.sessionDetailsMutex.RUnlock()
+	return cc.sessionDetails.capabilities.HasFeature(f)
+}
+
 func (cc *ControlChannel) waitForReqistrationOrClose() {
 	log.Debug("controlchannel wait for reqistration routine started")
 	for {
@@ -166,7 +266,7 @@ func (cc *ControlChannel) waitForReqistrationOrClose() {
 			return
 		case <-time.After(10 * time.Second): // TODO: get timeout from config
 			log.Warn("controlchannel wait for reqistration routine time out")
-			cc.target.Stop() // Stop the client connection
+			cc.target.Stop(wsio.CauseRegistrationTimeout) // Stop the client connection
 			return
 		}
 	}
@@ -214,24 +314,41 @@ func (cc *ControlChannel) helloHandler() messageHandlerFunc {
 			return cc.sendTerminate()
 		}
 
+		helloDetails := proto.NewHelloDetails(helloMsg.Details)
+
 		// Notify the waitForReqistrationOrClose go routine that we're about to
 		// register the connection, otherwise the connection can be closed
 		// during registration.
 		cc.registeredCh <- true
 
-		sessID, details, err := cc.ctrl.RegisterSession(cc, helloMsg.Realm)
+		sessID, details, err := cc.ctrl.RegisterSession(cc, helloMsg.Realm, helloDetails)
 		if err != nil && proto.IsRegistrationError(err) {
 			e := err.(*proto.RegistrationError)
 			log.Warnf("controlchannel registration rejected for device '%s' with reason: %s",
 				helloMsg.Realm, e.Reason.String())
+			metrics.Hellos.WithLabelValues("rejected", e.Reason.String()).Inc()
 			return cc.sendAbortMessageAndClose(e.Reason, e.Message)
 		} else if err != nil {
 			log.Errorf("controlchannel registration failed for device '%s' with error: %s",
 				helloMsg.Realm, err.Error())
+			metrics.Hellos.WithLabelValues("rejected", proto.ErrReasonTechnicalException.String()).Inc()
 			return cc.sendTerminate()
 		}
 
-		return cc.sendWelcomeMessage(sessID, details)
+		metrics.Hellos.WithLabelValues("accepted", "").Inc()
+		if err := cc.sendWelcomeMessage(sessID, details); err != nil {
+			return err
+		}
+
+		// Listen for call requests, the other services call the device
+		// as soon as the session is established
+		if err := cc.subscribe(cc.deviceID()); err != nil {
+			log.Errorf("controlchannel failed to subscribe requests of device '%s': %s", helloMsg.Realm, err)
+			return cc.sendTerminate()
+		}
+		cc.ctrl.EstablishSession(sessID, helloDetails)
+
+		return nil
 	})
 }
 
@@ -247,7 +364,7 @@ func (cc *ControlChannel) waitForPingOrClose() {
 			return
 		case <-time.After(time.Duration(cc.getSessionTimeout()) * time.Second):
 			log.Warn("controlchannel wait for ping routine time out")
-			cc.target.Stop() // Stop the client connection
+			cc.target.Stop(wsio.CauseSessionTimeout) // Stop the client connection
 			return
 		}
 	}
@@ -299,7 +416,7 @@ func (cc *ControlChannel) eventHandler() messageHandlerFunc {
 
 		req := message.PublishRequest{
 			SourceType: message.SourceTypeDevice,
-			SourceID:   "test",
+			SourceID:   cc.deviceID(),
 			TargetType: message.TargetTypeSystem,
 			Topic:      publishMsg.Topic,
 			Arguments:  publishMsg.Arguments,
@@ -311,10 +428,22 @@ func (cc *ControlChannel) eventHandler() messageHandlerFunc {
 			return cc.sendTerminate()
 		}
 
+		// While NATS is reconnecting the device has to publish the event
+		// again later, but the session is kept.
+		if !cc.nc.IsConnected() {
+			return cc.sendErrorMessage(proto.MessageTypePublish, publishMsg.RequestID,
+				proto.ErrReasonTemporarilyUnavailable.String(), nil)
+		}
+
 		// TODO(DGL) remove hardcoded namespace 'default'
 		replyMsg, err := cc.nc.Request("iotcore.devicecontrol.v1.default.publish", requestData, 16*time.Second)
 		if err != nil {
 			log.Errorf("controlchannel failed to request publish: %s", err)
+			metrics.NATSRequestErrors.WithLabelValues("publish").Inc()
+			if !cc.nc.IsConnected() {
+				return cc.sendErrorMessage(proto.MessageTypePublish, publishMsg.RequestID,
+					proto.ErrReasonTemporarilyUnavailable.String(), nil)
+			}
 			return cc.sendTerminate()
 		}
 
@@ -341,14 +470,36 @@ func (cc *ControlChannel) resultHandler() messageHandlerFunc {
 			return cc.sendTerminate()
 		}
 
-		resultCh := cc.popCallResultCh(resultMsg.RequestID)
-		if resultCh == nil {
-			// TODO(DGL) should we terminate the control channel here?
-			log.Warn("controlchannel received error message but cannot find correlated call message.")
+		if resultMsg.Progress && !cc.hasFeature(proto.FeatureProgressiveResults) {
+			log.Warn("controlchannel received progressive result but feature is not negotiated.")
+			return cc.sendAbortMessageAndClose(proto.ErrReasonProtocolViolation,
+				fmt.Sprintf("progressive results require feature '%s'", proto.FeatureProgressiveResults))
+		}
+
+		// A progressive result keeps the call pending until the final result
+		// arrives.
+		var call *pendingCall
+		if resultMsg.Progress {
+			call = cc.getPendingCall(resultMsg.RequestID)
+		} else {
+			call = cc.popPendingCall(resultMsg.RequestID)
+		}
+		if call == nil {
+			if cc.isCancelledCall(resultMsg.RequestID) {
+				log.Warnf("controlchannel dropped late result for cancelled call with request ID %d",
+					resultMsg.RequestID)
+				return nil
+			}
+			log.Warn("controlchannel received result message but cannot find correlated call message.")
 			return cc.sendAbortMessageAndClose(proto.ErrReasonProtocolViolation,
 				"Could not handle result for given request id. Time out happend or protocol violation.")
 		}
-		resultCh <- resultMsg
+		if !resultMsg.Progress {
+			call.finish(resultMsg)
+		} else if !call.progress(resultMsg) {
+			log.Warnf("controlchannel dropped progressive result for call with request ID %d",
+				resultMsg.RequestID)
+		}
 
 		return nil
 		// We do not respond to a result message bectause it's the response
@@ -367,14 +518,20 @@ func (cc *ControlChannel) errorHandler() messageHandlerFunc {
 		switch errorMsg.MessageType {
 		case proto.MessageTypeCall:
 			{
-				resultCh := cc.popCallResultCh(errorMsg.RequestID)
-				if resultCh == nil {
-					// TODO(DGL) should we terminate the control channel here?
+				call := cc.popPendingCall(errorMsg.RequestID)
+				if call == nil {
+					// The device may acknowledge a cancel message with an
+					// error message. We drop it like a late result.
+					if cc.isCancelledCall(errorMsg.RequestID) {
+						log.Warnf("controlchannel dropped late error for cancelled call with request ID %d",
+							errorMsg.RequestID)
+						return nil
+					}
 					log.Warn("controlchannel received error message but cannot find correlated call or publish message.")
 					return cc.sendAbortMessageAndClose(proto.ErrReasonProtocolViolation,
 						"Could not handle result for given request id. Time out happend or protocol violation.")
 				}
-				resultCh <- errorMsg
+				call.finish(errorMsg)
 			}
 		default:
 			log.Errorf("controlchannel received error message with invalid message type: %d", errorMsg.MessageType)
@@ -389,11 +546,11 @@ func (cc *ControlChannel) errorHandler() messageHandlerFunc {
 }
 
 func (cc *ControlChannel) sendTerminate() error {
-	return cc.sendMessage(wsio.FlagTerminate, nil)
+	return cc.sendMessage(wsio.FlagTerminate, 0, nil)
 }
 
 func (cc *ControlChannel) sendAbortMessageAndClose(reason proto.ErrorReason, message string) error {
-	out, err := proto.MarshalNewAbortMessage(reason.String(),
+	out, err := proto.MarshalNewAbortMessage(cc.serializer, reason.String(),
 		proto.NewAbortMessageDetails(message))
 	// This error should happen never! If it happens log an urgent error
 	// and terminate the websocket session for safety.
@@ -402,11 +559,11 @@ func (cc *ControlChannel) sendAbortMessageAndClose(reason proto.ErrorReason, mes
 		return cc.sendTerminate()
 	}
 
-	return cc.sendMessageAndCloseGraceful(out)
+	return cc.sendMessageAndCloseGraceful(proto.MessageTypeAbort, out)
 }
 
 func (cc *ControlChannel) sendWelcomeMessage(sessionID int32, details interface{}) error {
-	out, err := proto.MarshalNewWelcomeMessage(sessionID, details)
+	out, err := proto.MarshalNewWelcomeMessage(cc.serializer, sessionID, details)
 	// This error should happen never! If it happens log an urgent error
 	// and terminate the websocket session for safety.
 	if err != nil {
@@ -414,11 +571,11 @@ func (cc *ControlChannel) sendWelcomeMessage(sessionID int32, details interface{
 		return cc.sendTerminate()
 	}
 
-	return cc.sendMessageAndContinue(out)
+	return cc.sendMessageAndContinue(proto.MessageTypeWelcome, out)
 }
 
 func (cc *ControlChannel) sendPongMessage() error {
-	out, err := proto.MarshalNewPongMessage()
+	out, err := proto.MarshalNewPongMessage(cc.serializer)
 	// This error should happen never! If it happens log an urgent error
 	// and terminate the websocket session for safety.
 	if err != nil {
@@ -426,11 +583,11 @@ func (cc *ControlChannel) sendPongMessage() error {
 		return cc.sendTerminate()
 	}
 
-	return cc.sendMessageAndContinue(out)
+	return cc.sendMessageAndContinue(proto.MessageTypePong, out)
 }
 
 func (cc *ControlChannel) sendErrorMessage(msgType proto.MessageType, requestID int32, reason string, details interface{}) error {
-	out, err := proto.MarshalNewErrorMessage(msgType, requestID, reason, details)
+	out, err := proto.MarshalNewErrorMessage(cc.serializer, msgType, requestID, reason, details)
 	// This error should happen never! If it happens log an urgent error
 	// and terminate the websocket session for safety.
 	if err != nil {
@@ -438,11 +595,11 @@ func (cc *ControlChannel) sendErrorMessage(msgType proto.MessageType, requestID
 		return cc.sendTerminate()
 	}
 
-	return cc.sendMessageAndContinue(out)
+	return cc.sendMessageAndContinue(proto.MessageTypeError, out)
 }
 
 func (cc *ControlChannel) sendPublishedMessage(requestID, publicationID int32) error {
-	out, err := proto.MarshalNewPublishedMessage(requestID, publicationID)
+	out, err := proto.MarshalNewPublishedMessage(cc.serializer, requestID, publicationID)
 	// This error should happen never! If it happens log an urgent error
 	// and terminate the websocket session for safety.
 	if err != nil {
@@ -450,11 +607,20 @@ func (cc *ControlChannel) sendPublishedMessage(requestID, publicationID int32) e
 		return cc.sendTerminate()
 	}
 
-	return cc.sendMessageAndContinue(out)
+	return cc.sendMessageAndContinue(proto.MessageTypePublished, out)
 }
 
-func (cc *ControlChannel) sendCallMessage(requestID int32, operation string, arguments interface{}) error {
-	out, err := proto.MarshalNewCallMessage(requestID, operation, arguments)
+// sendCallMessage sends a call to the device. The ID of the trace, if any,
+// is sent with the details of the call.
+func (cc *ControlChannel) sendCallMessage(requestID int32, operation string, arguments interface{}, traceID string) error {
+	// The details are an additional element of the message, only devices
+	// which negotiated the feature accept them
+	var details interface{}
+	if traceID != "" && cc.hasFeature(proto.FeatureCallTrace) {
+		details = proto.NewCallMessageDetails(traceID)
+	}
+
+	out, err := proto.MarshalNewCallMessage(cc.serializer, requestID, operation, arguments, details)
 	// This error should happen never! If it happens log an urgent error
 	// and terminate the websocket session for safety.
 	if err != nil {
@@ -463,20 +629,38 @@ func (cc *ControlChannel) sendCallMessage(requestID int32, operation string, arg
 	}
 
 	// TODO(DGL) handle full chan buffer
-	return cc.sendMessageAndContinue(out)
+	return cc.sendMessageAndContinue(proto.MessageTypeCall, out)
 }
 
-func (cc *ControlChannel) sendMessageAndContinue(data []byte) error {
-	return cc.sendMessage(wsio.FlagContinue, data)
+func (cc *ControlChannel) sendCancelMessage(requestID int32, reason proto.ErrorReason) error {
+	out, err := proto.MarshalNewCancelMessage(cc.serializer, requestID,
+		proto.NewCancelMessageDetails(reason))
+	// This error should happen never! If it happens log an urgent error
+	// and terminate the websocket session for safety.
+	if err != nil {
+		log.Errorf("could not marshal cancel message: %s", err)
+		return err
+	}
+
+	return cc.sendMessageAndContinue(proto.MessageTypeCancel, out)
 }
 
-func (cc *ControlChannel) sendMessageAndCloseGraceful(data []byte) error {
-	return cc.sendMessage(wsio.FlagCloseGracefully, data)
+func (cc *ControlChannel) sendMessageAndContinue(msgType proto.MessageType, data []byte) error {
+	return cc.sendMessage(wsio.FlagContinue, msgType, data)
 }
 
-func (cc *ControlChannel) sendMessage(flag wsio.Flag, data []byte) error {
+func (cc *ControlChannel) sendMessageAndCloseGraceful(msgType proto.MessageType, data []byte) error {
+	return cc.sendMessage(wsio.FlagCloseGracefully, msgType, data)
+}
+
+// sendMessage enqueues the message of the given type. A terminate flag
+// without data doesn't send a message.
+func (cc *ControlChannel) sendMessage(flag wsio.Flag, msgType proto.MessageType, data []byte) error {
 	select {
 	case cc.target.Outbox <- wsio.NewOutboxMessage(flag, data):
+		if data != nil {
+			metrics.Messages.WithLabelValues(metrics.DirectionOut, msgType.String()).Inc()
+		}
 		return nil
 	default:
 		// TODO(DGL) Define better errors
@@ -492,25 +676,118 @@ func (cc *ControlChannel) getNextRequestID() int32 {
 	return requestID
 }
 
-func (cc *ControlChannel) pushCallResultCh(resultCh chan<- interface{}) int32 {
-	requestID := cc.getNextRequestID()
+// pushPendingCall adds a pending call. It returns nil if another call with
+// the call ID is running.
+func (cc *ControlChannel) pushPendingCall(callID, requestor string) *pendingCall {
+	if !cc.ctrl.registerCall(callID, cc) {
+		return nil
+	}
+
+	call := &pendingCall{
+		requestID: cc.getNextRequestID(),
+		callID:    callID,
+		requestor: requestor,
+		// The channels are buffered because the receiver may have stopped
+		// waiting in the meantime, e.g. on timeout. The progress channel
+		// takes a couple of progressive results, too.
+		progressCh: make(chan *proto.ResultMessage, 16),
+		finalCh:    make(chan interface{}, 1),
+		cancelCh:   make(chan proto.ErrorReason, 1),
+	}
 
 	cc.callResultsMutex.Lock()
+	cc.callResults[call.requestID] = call
 	cc.callResultsMutex.Unlock()
-	cc.callResults[requestID] = resultCh
 
-	return requestID
+	return call
 }
 
-func (cc *ControlChannel) popCallResultCh(requestID int32) chan<- interface{} {
+func (cc *ControlChannel) popPendingCall(requestID int32) *pendingCall {
 	cc.callResultsMutex.Lock()
 	defer cc.callResultsMutex.Unlock()
 
-	resultCh, ok := cc.callResults[requestID]
+	call, ok := cc.callResults[requestID]
 	if !ok {
 		return nil
 	}
 
 	delete(cc.callResults, requestID)
-	return resultCh
+	cc.ctrl.unregisterCall(call.callID, cc)
+	return call
+}
+
+func (cc *ControlChannel) getPendingCall(requestID int32) *pendingCall {
+	cc.callResultsMutex.RLock()
+	defer cc.callResultsMutex.RUnlock()
+
+	return cc.callResults[requestID]
+}
+
+func (cc *ControlChannel) findPendingCallByCallID(callID string) *pendingCall {
+	cc.callResultsMutex.RLock()
+	defer cc.callResultsMutex.RUnlock()
+
+	for _, call := range cc.callResults {
+		if call.callID != "" && call.callID == callID {
+			return call
+		}
+	}
+
+	return nil
+}
+
+// failPendingCalls stops waiting for the results of all pending calls, e.g.
+// because the session is closed. The device isn't told, it's gone.
+func (cc *ControlChannel) failPendingCalls(reason proto.ErrorReason) {
+	cc.callResultsMutex.Lock()
+	calls := make([]*pendingCall, 0, len(cc.callResults))
+	for requestID, call := range cc.callResults {
+		delete(cc.callResults, requestID)
+		cc.ctrl.unregisterCall(call.callID, cc)
+		calls = append(calls, call)
+	}
+	cc.callResultsMutex.Unlock()
+
+	for _, call := range calls {
+		call.cancelCh <- reason
+	}
+}
+
+// cancelPendingCall stops waiting for the result of the given call. The
+// device is told to stop processing the call if it supports cancellation.
+// It returns false if the call isn't pending anymore, e.g. the result
+// arrived in the meantime.
+func (cc *ControlChannel) cancelPendingCall(requestID int32, reason proto.ErrorReason) bool {
+	call := cc.popPendingCall(requestID)
+	if call == nil {
+		return false
+	}
+
+	now := time.Now()
+	cc.callResultsMutex.Lock()
+	for id, cancelledAt := range cc.cancelledCalls {
+		if now.Sub(cancelledAt) > cancelledCallsRetention {
+			delete(cc.cancelledCalls, id)
+		}
+	}
+	cc.cancelledCalls[requestID] = now
+	cc.callResultsMutex.Unlock()
+
+	call.cancelCh <- reason
+
+	if cc.hasFeature(proto.FeatureCallCancel) {
+		if err := cc.sendCancelMessage(requestID, reason); err != nil {
+			log.Errorf("controlchannel failed to send cancel message: %s", err)
+		}
+	}
+
+	return true
+}
+
+func (cc *ControlChannel) isCancelledCall(requestID int32) bool {
+	cc.callResultsMutex.RLock()
+	defer cc.callResultsMutex.RUnlock()
+
+	_, ok := cc.cancelledCalls[requestID]
+	return ok
 }
@@ -1,6 +1,7 @@
 package controlchannel
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -8,8 +9,12 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/metrics"
+	"github.com/nsyszr/lcm/pkg/tracing"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (cc *ControlChannel) subscribe(deviceID string) error {
@@ -37,9 +42,17 @@ func (cc *ControlChannel) subscribe(deviceID string) error {
 
 	cc.subCall = sub
 
-	return nil
+	if err := cc.subscribeStreams(deviceID); err != nil {
+		return err
+	}
+
+	return cc.subscribePublish(deviceID)
 }
 
+// finishedCallGuard limits the time to wait for the outcome of a call which
+// isn't pending anymore
+const finishedCallGuard = time.Second
+
 func (cc *ControlChannel) handleCallRequestOrTimeout(msg *nats.Msg) error {
 	log.Debug("controlchannel started handel call request routine")
 	// Extract the publish request
@@ -49,49 +62,140 @@ func (cc *ControlChannel) handleCallRequestOrTimeout(msg *nats.Msg) error {
 		return errors.Wrap(err, "failed to unmarshal controlchannel call request")
 	}
 
-	resultCh := make(chan interface{})
-	requestID := cc.pushCallResultCh(resultCh)
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), msg), "controlchannel call",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("device.id", cc.deviceID()),
+			attribute.String("call.id", req.CallID),
+			attribute.String("call.command", req.Command),
+		))
+	defer span.End()
 
-	if err := cc.sendCallMessage(requestID, req.Command, req.Arguments); err != nil {
+	call := cc.pushPendingCall(req.CallID, req.Requestor)
+	if call == nil {
+		tracing.Fail(span, proto.ErrReasonTechnicalException.String())
+		return cc.replyCallFailed(msg, proto.ErrReasonTechnicalException.String(),
+			fmt.Sprintf("call ID '%s' is in use", req.CallID))
+	}
+
+	// The device span lasts until the final result of the device
+	_, deviceSpan := tracing.Start(ctx, "device call",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("call.request_id", int(call.requestID))))
+	defer deviceSpan.End()
+
+	start := time.Now()
+	if err := cc.sendCallMessage(call.requestID, req.Command, req.Arguments, tracing.TraceID(ctx)); err != nil {
+		cc.popPendingCall(call.requestID)
+		tracing.Fail(deviceSpan, proto.ErrReasonTechnicalException.String())
 		return errors.Wrap(err, "failed to send call message")
 	}
+	defer metrics.ObserveCall(metrics.HopDevice, start)
+
+	// TODO(DGL) If we set the same timeout of 16 seconds here, we run into
+	// problems with the requestor. NATS responds with timeout before this
+	// message arrives to the requestor. But in this case the device result
+	// response is timed out. We need properly defined settings!
+	timeout := time.NewTimer(16 * time.Second)
+	defer timeout.Stop()
 
 	for {
 		log.Debug("controlchannel wait for call result")
 		select {
-		// TODO(DGL) If we set the same timeout of 16 seconds here, we run into
-		// problems with the requestor. NATS responds with timeout before this
-		// message arrives to the requestor. But in this case the device result
-		// response is timed out. We need properly defined settings!
-		// TODO(DGL) I think it doesn't make sense for a timeout reply since
-		// the request will by timed out by the queue. If we didn't receive
-		// a reply from websocket we should terminate the session!
-		case <-time.After(16 * time.Second):
+		case <-timeout.C:
 			log.Error("controlchannel call request timed out")
-			// return cc.replyCallFailed(msg.Reply, "ERR_TIMEOUT", nil)
-
-			// TODO: try to remove resultCh from map. If client sends message
-			// later the result handler will response with an error and quits
-			// the exisiting session.
-			/* return cc.sendAbortMessageAndClose("ERR_PROTOCOL_VIOLATION",
-			proto.NewAbortMessageDetails("result message timeout"))*/
-			cc.popCallResultCh(requestID)
-			return cc.replyCallFailed(msg, "ERR_RESULT_TIMEOUT", nil)
-		case result := <-resultCh:
+			// Tell the device to stop processing the call. A result which
+			// arrives later is dropped by the result handler.
+			if !cc.cancelPendingCall(call.requestID, proto.ErrReasonResultTimeout) {
+				// The final result arrived or the call was cancelled in
+				// the meantime
+				result, reason := cc.finishedCallOutcome(call)
+				if result == nil {
+					tracing.Fail(deviceSpan, reason.String())
+					return cc.replyCallFailed(msg, reason.String(), nil)
+				}
+				return cc.replyCallResult(msg, result)
+			}
+			metrics.CallTimeouts.WithLabelValues(metrics.HopDevice).Inc()
+			tracing.Fail(deviceSpan, proto.ErrReasonResultTimeout.String())
+			return cc.replyCallFailed(msg, proto.ErrReasonResultTimeout.String(), nil)
+		case reason := <-call.cancelCh:
+			log.Infof("controlchannel call request with ID '%s' cancelled", req.CallID)
+			tracing.Fail(deviceSpan, reason.String())
+			return cc.replyCallFailed(msg, reason.String(), nil)
+		case result := <-call.finalCh:
 			log.Debug("controlchannel handle call request routine reveived a result")
-			resultMsg, ok := result.(*proto.ResultMessage)
-			if ok {
-				return cc.replyCalledSuccesfully(msg, resultMsg.Results)
+			if errorMsg, ok := result.(*proto.ErrorMessage); ok {
+				tracing.Fail(deviceSpan, errorMsg.Error)
+			}
+			return cc.replyCallResult(msg, result)
+		case resultMsg := <-call.progressCh:
+			deviceSpan.AddEvent("progressive result")
+
+			// The device is still working on the call. We relay the
+			// progressive result if the requestor wants a stream and wait
+			// for further results.
+			if req.Stream {
+				if err := cc.replyCallProgress(msg, resultMsg.Results); err != nil {
+					log.Errorf("controlchannel failed to reply progressive result: %s", err)
+				}
 			}
-			errorMsg, ok := result.(*proto.ErrorMessage)
-			if ok {
-				return cc.replyCallFailed(msg, errorMsg.Error, errorMsg.Details)
+			if !timeout.Stop() {
+				<-timeout.C
 			}
-			return cc.replyCallFailed(msg, "ERR_TECHNICAL_EXCEPTION", nil)
+			timeout.Reset(16 * time.Second)
 		}
 	}
 }
 
+// finishedCallOutcome returns the final result of a call which isn't
+// pending anymore or the reason of its cancellation. The result handler
+// delivers the result right after it finished the call, the guard timeout
+// only prevents waiting forever.
+func (cc *ControlChannel) finishedCallOutcome(call *pendingCall) (interface{}, proto.ErrorReason) {
+	guard := time.NewTimer(finishedCallGuard)
+	defer guard.Stop()
+
+	select {
+	case result := <-call.finalCh:
+		return result, ""
+	case reason := <-call.cancelCh:
+		return nil, reason
+	case <-guard.C:
+		return nil, proto.ErrReasonResultTimeout
+	}
+}
+
+// cancelCall cancels the running call of the cancel request
+func (cc *ControlChannel) cancelCall(msg *nats.Msg, callID, requestor string) error {
+	// The calls of other requestors don't exist for the requestor
+	call := cc.findPendingCallByCallID(callID)
+	if call == nil || call.requestor != requestor || !cc.cancelPendingCall(call.requestID, proto.ErrReasonCancelled) {
+		return cc.replyMessage(msg, message.CancelReply{
+			Status:      message.ReplyStatusError,
+			ErrorReason: proto.ErrReasonNoSuchCall.String(),
+		})
+	}
+
+	log.Infof("controlchannel cancelled call request with ID '%s'", callID)
+
+	return cc.replyMessage(msg, message.CancelReply{
+		Status: message.ReplyStatusSuccess,
+	})
+}
+
+func (cc *ControlChannel) replyCallResult(msg *nats.Msg, result interface{}) error {
+	resultMsg, ok := result.(*proto.ResultMessage)
+	if ok {
+		return cc.replyCalledSuccesfully(msg, resultMsg.Results)
+	}
+	errorMsg, ok := result.(*proto.ErrorMessage)
+	if ok {
+		return cc.replyCallFailed(msg, errorMsg.Error, errorMsg.Details)
+	}
+	return cc.replyCallFailed(msg, proto.ErrReasonTechnicalException.String(), nil)
+}
+
 func (cc *ControlChannel) replyCallFailed(msg *nats.Msg, reason string, details interface{}) error {
 	return cc.replyMessage(msg, message.ControlChannelCallReply{
 		Status:       message.ReplyStatusError,
@@ -100,6 +204,14 @@ func (cc *ControlChannel) replyCallFailed(msg *nats.Msg, reason string, details
 	})
 }
 
+func (cc *ControlChannel) replyCallProgress(msg *nats.Msg, results interface{}) error {
+	return cc.replyMessage(msg, message.ControlChannelCallReply{
+		Partial: true,
+		Status:  message.ReplyStatusSuccess,
+		Results: results,
+	})
+}
+
 func (cc *ControlChannel) replyCalledSuccesfully(msg *nats.Msg, results interface{}) error {
 	return cc.replyMessage(msg, message.ControlChannelCallReply{
 		Status:  message.ReplyStatusSuccess,
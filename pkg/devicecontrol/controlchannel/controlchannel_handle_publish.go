@@ -0,0 +1,79 @@
+package controlchannel
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func (cc *ControlChannel) subscribePublish(deviceID string) error {
+	// TODO(DGL) Replace hardcoded namespace
+	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.controlchannel.%s.publish", "default", deviceID)
+	sub, err := cc.nc.Subscribe(subj, func(msg *nats.Msg) {
+		if err := cc.handlePublishRequest(msg); err != nil {
+			log.Error("controlchannel failed to handle publish request: ", err.Error())
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe the controlchannel publish queue")
+	}
+
+	cc.subPublish = sub
+
+	return nil
+}
+
+// handlePublishRequest delivers an event to the device. The publication ID
+// is used as request ID, the device acknowledges it with a PUBLISHED message.
+func (cc *ControlChannel) handlePublishRequest(msg *nats.Msg) error {
+	req := message.ControlChannelPublishRequest{}
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return errors.Wrap(err, "failed to unmarshal controlchannel publish request")
+	}
+
+	if !cc.hasFeature(proto.FeatureEventDelivery) {
+		return cc.replyMessage(msg, message.ControlChannelPublishReply{
+			Status:       message.ReplyStatusError,
+			ErrorReason:  proto.ErrReasonFeatureNotSupported.String(),
+			ErrorDetails: fmt.Sprintf("device does not support feature '%s'", proto.FeatureEventDelivery),
+		})
+	}
+
+	out, err := proto.MarshalNewPublishMessage(cc.serializer, req.PublicationID, req.Topic, req.Arguments)
+	if err != nil {
+		log.Errorf("could not marshal publish message: %s", err)
+		return err
+	}
+
+	if err := cc.sendMessageAndContinue(proto.MessageTypePublish, out); err != nil {
+		return cc.replyMessage(msg, message.ControlChannelPublishReply{
+			Status:      message.ReplyStatusError,
+			ErrorReason: proto.ErrReasonTechnicalException.String(),
+		})
+	}
+
+	return cc.replyMessage(msg, message.ControlChannelPublishReply{
+		Status:        message.ReplyStatusSuccess,
+		PublicationID: req.PublicationID,
+	})
+}
+
+// publishedHandler accepts the acknowledgements of delivered events
+func (cc *ControlChannel) publishedHandler() messageHandlerFunc {
+	return messageHandlerFunc(func(msg interface{}) error {
+		publishedMsg, err := proto.MustPublishedMessage(msg)
+		if err != nil {
+			log.Errorf("controlchannel expected a published message but error: %s", err)
+			return cc.sendTerminate()
+		}
+
+		log.Debugf("controlchannel event %d acknowledged by device", publishedMsg.RequestID)
+
+		return nil
+	})
+}
@@ -0,0 +1,394 @@
+package controlchannel
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamPendingLimit limits the data frames of the device queued while the
+// requestor has no credits left. The stream is closed if it's exceeded.
+const streamPendingLimit = 4 * message.StreamWindow
+
+// deviceStream is a stream opened on the session, e.g. an interactive CLI.
+// The data of the device is published to the outbox subject, the data for
+// the device is received by the inbox subscription.
+//
+// The data of the device is published as long as the requestor has credits,
+// the rest is queued. The session reader never waits for a stream, the
+// control messages of the session aren't delayed by a slow requestor.
+type deviceStream struct {
+	id            int32
+	kind          string
+	outboxSubject string
+	sub           *nats.Subscription
+
+	mu      sync.Mutex
+	credit  int
+	pending [][]byte
+	// closing is the close frame of the device, it's published after the
+	// pending data
+	closing *message.StreamFrame
+
+	// received counts the data frames of the requestor sent to the device
+	// since the last credit grant. It's used by the inbox subscription only.
+	received int
+}
+
+func streamInboxSubject(deviceID string, streamID int32) string {
+	// TODO(DGL) Replace hardcoded namespace
+	return fmt.Sprintf("iotcore.devicecontrol.v1.%s.controlchannel.%s.stream.%d.in", "default", deviceID, streamID)
+}
+
+func (cc *ControlChannel) subscribeStreams(deviceID string) error {
+	// TODO(DGL) Replace hardcoded namespace
+	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.controlchannel.%s.stream.open", "default", deviceID)
+	sub, err := cc.nc.Subscribe(subj, func(msg *nats.Msg) {
+		if err := cc.handleStreamOpenRequest(deviceID, msg); err != nil {
+			log.Error("controlchannel failed to handle stream open request: ", err.Error())
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe the controlchannel stream queue")
+	}
+
+	cc.subStreamOpen = sub
+
+	return nil
+}
+
+func (cc *ControlChannel) handleStreamOpenRequest(deviceID string, msg *nats.Msg) error {
+	req := message.StreamOpenRequest{}
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return errors.Wrap(err, "failed to unmarshal controlchannel stream open request")
+	}
+
+	if !cc.hasFeature(proto.FeatureStreams) {
+		return cc.replyMessage(msg, message.StreamOpenReply{
+			Status:       message.ReplyStatusError,
+			ErrorReason:  proto.ErrReasonFeatureNotSupported.String(),
+			ErrorDetails: fmt.Sprintf("device does not support feature '%s'", proto.FeatureStreams),
+		})
+	}
+
+	if req.OutboxSubject == "" {
+		return cc.replyMessage(msg, message.StreamOpenReply{
+			Status:       message.ReplyStatusError,
+			ErrorReason:  proto.ErrReasonTechnicalException.String(),
+			ErrorDetails: "stream open request contains no outbox subject",
+		})
+	}
+
+	stream := &deviceStream{
+		id:            cc.getNextStreamID(),
+		kind:          req.Kind,
+		outboxSubject: req.OutboxSubject,
+		credit:        message.StreamWindow,
+	}
+
+	inboxSubject := streamInboxSubject(deviceID, stream.id)
+	sub, err := cc.nc.Subscribe(inboxSubject, func(m *nats.Msg) {
+		if err := cc.handleStreamFrame(stream, m); err != nil {
+			log.Error("controlchannel failed to handle stream frame: ", err.Error())
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe the controlchannel stream inbox")
+	}
+	stream.sub = sub
+	cc.pushStream(stream)
+
+	if err := cc.sendStreamOpenMessage(stream.id, req.Kind, req.Arguments); err != nil {
+		cc.popStream(stream.id)
+		sub.Unsubscribe()
+		return cc.replyMessage(msg, message.StreamOpenReply{
+			Status:      message.ReplyStatusError,
+			ErrorReason: proto.ErrReasonTechnicalException.String(),
+		})
+	}
+
+	log.Infof("controlchannel opened stream %d of kind '%s' for device '%s'", stream.id, req.Kind, deviceID)
+
+	return cc.replyMessage(msg, message.StreamOpenReply{
+		Status:       message.ReplyStatusSuccess,
+		StreamID:     stream.id,
+		InboxSubject: inboxSubject,
+	})
+}
+
+// handleStreamFrame forwards a frame of the requestor to the device. The
+// requestor is granted a credit per data frame sent to the device.
+func (cc *ControlChannel) handleStreamFrame(stream *deviceStream, msg *nats.Msg) error {
+	frame := message.StreamFrame{}
+	if err := json.Unmarshal(msg.Data, &frame); err != nil {
+		return errors.Wrap(err, "failed to unmarshal controlchannel stream frame")
+	}
+
+	if frame.Credit > 0 {
+		return cc.grantStreamCredit(stream, frame.Credit)
+	}
+
+	if frame.Close {
+		if cc.popStream(stream.id) == nil {
+			// The device closed the stream in the meantime, its pending
+			// data is dropped
+			stream.sub.Unsubscribe()
+			return nil
+		}
+		stream.sub.Unsubscribe()
+		log.Infof("controlchannel closes stream %d: %s", stream.id, frame.Reason)
+		return cc.sendStreamCloseMessage(stream.id, proto.ErrReasonStreamClosed, frame.Reason)
+	}
+
+	if len(frame.Data) == 0 {
+		return nil
+	}
+
+	if err := cc.sendStreamDataMessage(stream.id, frame.Data); err != nil {
+		// We close the stream instead of dropping data silently. A terminal
+		// with missing data is worse than no terminal.
+		cc.closeStream(stream, proto.ErrReasonTechnicalException, err.Error())
+		return err
+	}
+
+	// The credits are granted in batches of half the window
+	if stream.received++; stream.received >= message.StreamWindow/2 {
+		n := stream.received
+		stream.received = 0
+		return cc.publishStreamFrame(stream, message.StreamFrame{Credit: n})
+	}
+
+	return nil
+}
+
+// forwardStreamData publishes the data of the device if the requestor has
+// credits left, otherwise it's queued.
+func (cc *ControlChannel) forwardStreamData(stream *deviceStream, data []byte) error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.credit > 0 && len(stream.pending) == 0 {
+		stream.credit--
+		return cc.publishStreamFrame(stream, message.StreamFrame{Data: data})
+	}
+
+	if len(stream.pending) >= streamPendingLimit {
+		return errors.New("requestor doesn't keep up with the stream")
+	}
+	stream.pending = append(stream.pending, data)
+
+	return nil
+}
+
+// grantStreamCredit publishes the pending data the requestor has credits
+// for. The close frame of the device follows the pending data.
+func (cc *ControlChannel) grantStreamCredit(stream *deviceStream, n int) error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.credit += n
+	for stream.credit > 0 && len(stream.pending) > 0 {
+		if err := cc.publishStreamFrame(stream, message.StreamFrame{Data: stream.pending[0]}); err != nil {
+			return err
+		}
+		stream.pending[0] = nil
+		stream.pending = stream.pending[1:]
+		stream.credit--
+	}
+
+	if stream.closing != nil && len(stream.pending) == 0 {
+		stream.sub.Unsubscribe()
+		frame := *stream.closing
+		stream.closing = nil
+		return cc.publishStreamFrame(stream, frame)
+	}
+
+	return nil
+}
+
+func (cc *ControlChannel) streamDataHandler() messageHandlerFunc {
+	return messageHandlerFunc(func(msg interface{}) error {
+		dataMsg, err := proto.MustStreamDataMessage(msg)
+		if err != nil {
+			log.Errorf("controlchannel expected a stream data message but error: %s", err)
+			return cc.sendTerminate()
+		}
+
+		stream := cc.getStream(dataMsg.StreamID)
+		if stream == nil {
+			// The stream may be closed by the requestor while the device was
+			// still sending data.
+			log.Warnf("controlchannel dropped data for unknown stream %d", dataMsg.StreamID)
+			return nil
+		}
+
+		if err := cc.forwardStreamData(stream, dataMsg.Data); err != nil {
+			// We close the stream instead of dropping data silently
+			log.Errorf("controlchannel failed to forward data of stream %d: %s", stream.id, err)
+			cc.closeStream(stream, proto.ErrReasonTechnicalException, err.Error())
+		}
+
+		return nil
+	})
+}
+
+func (cc *ControlChannel) streamCloseHandler() messageHandlerFunc {
+	return messageHandlerFunc(func(msg interface{}) error {
+		closeMsg, err := proto.MustStreamCloseMessage(msg)
+		if err != nil {
+			log.Errorf("controlchannel expected a stream close message but error: %s", err)
+			return cc.sendTerminate()
+		}
+
+		stream := cc.popStream(closeMsg.StreamID)
+		if stream == nil {
+			// Both sides closed the stream at the same time
+			return nil
+		}
+
+		reason := proto.ErrReasonStreamClosed.String()
+		if details, ok := closeMsg.Details.(map[string]interface{}); ok {
+			if v, ok := details["reason"].(string); ok && v != "" {
+				reason = v
+			}
+		}
+
+		log.Infof("controlchannel stream %d closed by device: %s", stream.id, reason)
+
+		// The requestor receives the pending data before the close frame.
+		// The subscription stays until the requestor granted the credits
+		// for it.
+		frame := message.StreamFrame{Close: true, Reason: reason}
+		stream.mu.Lock()
+		if len(stream.pending) > 0 {
+			stream.closing = &frame
+			stream.mu.Unlock()
+			return nil
+		}
+		stream.mu.Unlock()
+
+		stream.sub.Unsubscribe()
+		if err := cc.publishStreamFrame(stream, frame); err != nil {
+			log.Errorf("controlchannel failed to publish stream close: %s", err)
+		}
+
+		return nil
+	})
+}
+
+// closeStream closes the stream on both sides.
+func (cc *ControlChannel) closeStream(stream *deviceStream, reason proto.ErrorReason, message string) {
+	if cc.popStream(stream.id) == nil {
+		return
+	}
+	stream.sub.Unsubscribe()
+
+	if err := cc.sendStreamCloseMessage(stream.id, reason, message); err != nil {
+		log.Errorf("controlchannel failed to send stream close message: %s", err)
+	}
+	cc.notifyStreamClosed(stream, reason)
+}
+
+// closeAllStreams tells the requestors of all open streams that the session
+// is closed.
+func (cc *ControlChannel) closeAllStreams(reason proto.ErrorReason) {
+	cc.streamsMutex.Lock()
+	streams := cc.streams
+	cc.streams = make(map[int32]*deviceStream)
+	cc.streamsMutex.Unlock()
+
+	for _, stream := range streams {
+		stream.sub.Unsubscribe()
+		cc.notifyStreamClosed(stream, reason)
+	}
+}
+
+func (cc *ControlChannel) notifyStreamClosed(stream *deviceStream, reason proto.ErrorReason) {
+	if err := cc.publishStreamFrame(stream, message.StreamFrame{Close: true, Reason: reason.String()}); err != nil {
+		log.Errorf("controlchannel failed to publish stream close: %s", err)
+	}
+}
+
+func (cc *ControlChannel) publishStreamFrame(stream *deviceStream, frame message.StreamFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal stream frame")
+	}
+	if err := cc.nc.Publish(stream.outboxSubject, data); err != nil {
+		return errors.Wrap(err, "failed to publish stream frame")
+	}
+	return nil
+}
+
+func (cc *ControlChannel) sendStreamOpenMessage(streamID int32, kind string, arguments interface{}) error {
+	out, err := proto.MarshalNewStreamOpenMessage(cc.serializer, streamID, kind, arguments)
+	// This error should happen never! If it happens log an urgent error
+	// and terminate the websocket session for safety.
+	if err != nil {
+		log.Errorf("could not marshal stream open message: %s", err)
+		return err
+	}
+
+	return cc.sendMessageAndContinue(proto.MessageTypeStreamOpen, out)
+}
+
+func (cc *ControlChannel) sendStreamDataMessage(streamID int32, data []byte) error {
+	out, err := proto.MarshalNewStreamDataMessage(cc.serializer, streamID, data)
+	if err != nil {
+		log.Errorf("could not marshal stream data message: %s", err)
+		return err
+	}
+
+	return cc.sendMessageAndContinue(proto.MessageTypeStreamData, out)
+}
+
+func (cc *ControlChannel) sendStreamCloseMessage(streamID int32, reason proto.ErrorReason, message string) error {
+	out, err := proto.MarshalNewStreamCloseMessage(cc.serializer, streamID,
+		proto.NewStreamCloseMessageDetails(reason, message))
+	if err != nil {
+		log.Errorf("could not marshal stream close message: %s", err)
+		return err
+	}
+
+	return cc.sendMessageAndContinue(proto.MessageTypeStreamClose, out)
+}
+
+func (cc *ControlChannel) getNextStreamID() int32 {
+	cc.streamsMutex.Lock()
+	streamID := cc.nextStreamID
+	cc.nextStreamID++
+	cc.streamsMutex.Unlock()
+	return streamID
+}
+
+func (cc *ControlChannel) pushStream(stream *deviceStream) {
+	cc.streamsMutex.Lock()
+	cc.streams[stream.id] = stream
+	cc.streamsMutex.Unlock()
+}
+
+func (cc *ControlChannel) popStream(streamID int32) *deviceStream {
+	cc.streamsMutex.Lock()
+	defer cc.streamsMutex.Unlock()
+
+	stream, ok := cc.streams[streamID]
+	if !ok {
+		return nil
+	}
+
+	delete(cc.streams, streamID)
+	return stream
+}
+
+func (cc *ControlChannel) getStream(streamID int32) *deviceStream {
+	cc.streamsMutex.RLock()
+	defer cc.streamsMutex.RUnlock()
+
+	return cc.streams[streamID]
+}
@@ -0,0 +1,81 @@
+package controlchannel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/wsio"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// disconnectedConn returns a NATS connection which is reconnecting to its
+// stopped server
+func disconnectedConn(t *testing.T) *nats.Conn {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	disconnectedCh := make(chan struct{})
+	nc, err := nats.Connect(s.ClientURL(),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Hour),
+		nats.DisconnectErrHandler(func(*nats.Conn, error) { close(disconnectedCh) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Shutdown()
+	select {
+	case <-disconnectedCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NATS connection wasn't disconnected")
+	}
+	if !nc.IsReconnecting() {
+		t.Fatalf("NATS connection is %v, want reconnecting", nc.Status())
+	}
+
+	return nc
+}
+
+func TestPublishWhileDisconnected(t *testing.T) {
+	nc := disconnectedConn(t)
+	defer nc.Close()
+
+	ctrl := NewController(nc, memory.NewStore(), nil, nil, nil)
+	cc := addTestChannel(ctrl)
+	cc.nc = nc
+	cc.sessionDetails.realm = "dev1@default"
+
+	if err := cc.eventHandler().Handle(proto.PublishMessage{RequestID: 7, Topic: "alert"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The device receives an error and the session is kept
+	select {
+	case out := <-cc.target.Outbox:
+		if out.Flag != wsio.FlagContinue {
+			t.Errorf("outbox message flag = %d, want %d", out.Flag, wsio.FlagContinue)
+		}
+		_, msg, err := proto.UnmarshalMessageWith(cc.serializer, out.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, ok := msg.(proto.ErrorMessage)
+		if !ok {
+			t.Fatalf("message = %T, want error message", msg)
+		}
+		if e.RequestID != 7 || e.Error != proto.ErrReasonTemporarilyUnavailable.String() {
+			t.Errorf("error message = %+v, want request 7 and %s", e, proto.ErrReasonTemporarilyUnavailable)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error message queued")
+	}
+}
@@ -3,9 +3,16 @@ package controlchannel
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/client"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/wsio"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/eventstream"
+	"github.com/nsyszr/lcm/pkg/outbox"
+	"github.com/nsyszr/lcm/pkg/rules"
 	"github.com/nsyszr/lcm/pkg/storage"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -14,15 +21,45 @@ import (
 type Controller struct {
 	nc             *nats.Conn
 	store          storage.Interface
+	client         *client.Client
+	rules          *rules.Engine
+	events         *eventstream.Publisher
+	outbox         *outbox.Relay
 	messageTimeout int
+
+	// channels contains the control channels connected to this server
+	channelsMutex sync.Mutex
+	channels      map[*ControlChannel]struct{}
+	draining      bool
+
+	// calls contains the control channel of each running call by call ID
+	callsMutex sync.RWMutex
+	calls      map[string]*ControlChannel
+
+	// statusCh queues the device status events in the order of the session
+	// changes
+	statusCh chan statusEvent
 }
 
-func NewController(nc *nats.Conn, store storage.Interface) *Controller {
-	return &Controller{
+// NewController creates a new controller. The stored events are evaluated
+// by the rules engine and published by the outbox relay, the other events are
+// published by the event publisher.
+func NewController(nc *nats.Conn, store storage.Interface, engine *rules.Engine, events *eventstream.Publisher, relay *outbox.Relay) *Controller {
+	ctrl := &Controller{
 		nc:             nc,
 		store:          store,
+		client:         client.New(nc),
+		rules:          engine,
+		events:         events,
+		outbox:         relay,
 		messageTimeout: 16,
+		channels:       make(map[*ControlChannel]struct{}),
+		calls:          make(map[string]*ControlChannel),
+		statusCh:       make(chan statusEvent, statusQueueSize),
 	}
+	go ctrl.publishStatusEvents()
+
+	return ctrl
 }
 
 func (ctrl *Controller) Subscribe() error {
@@ -38,9 +75,24 @@ func (ctrl *Controller) Subscribe() error {
 		return err
 	}
 
+	// Calls run as long as the device reports its progress. NATS runs the
+	// callbacks of a subscription one after another, hence every call is
+	// relayed by its own go routine.
 	if _, err := ctrl.nc.QueueSubscribe("iotcore.devicecontrol.v1.*.call", "iotcore.devicecontrol.v1.queue.call", func(msg *nats.Msg) {
-		if err := ctrl.handleCallRequest(msg); err != nil {
-			log.Error("controller failed to handle call request: ", err.Error())
+		go func() {
+			if err := ctrl.handleCallRequest(msg); err != nil {
+				log.Error("controller failed to handle call request: ", err.Error())
+			}
+		}()
+	}); err != nil {
+		return err
+	}
+
+	// Cancel requests contain the call ID only, therefore every server
+	// receives them. Only the server which runs the call replies.
+	if _, err := ctrl.nc.Subscribe("iotcore.devicecontrol.v1.*.cancel", func(msg *nats.Msg) {
+		if err := ctrl.handleCancelRequest(msg); err != nil {
+			log.Error("controller failed to handle cancel request: ", err.Error())
 		}
 	}); err != nil {
 		return err
@@ -49,8 +101,9 @@ func (ctrl *Controller) Subscribe() error {
 	return nil
 }
 
-// NewControlChannel creates a control channel handler
-func (ctrl *Controller) NewControlChannel(driver *wsio.Driver /*conn net.Conn, terminateCh chan<- struct{}*/) *ControlChannel {
+// NewControlChannel creates a control channel handler. The serializer is
+// used to encode and decode the messages sent over the given driver.
+func (ctrl *Controller) NewControlChannel(driver *wsio.Driver, serializer proto.Serializer) *ControlChannel {
 	cc := &ControlChannel{
 		ctrl: ctrl,
 		nc:   ctrl.nc,
@@ -62,12 +115,21 @@ func (ctrl *Controller) NewControlChannel(driver *wsio.Driver /*conn net.Conn, t
 		registeredCh: make(chan bool),
 		pingCh:       make(chan bool),
 
-		target: driver,
+		target:     driver,
+		serializer: serializer,
+
+		nextRequestID:  1,
+		callResults:    make(map[int32]*pendingCall),
+		cancelledCalls: make(map[int32]time.Time),
 
-		nextRequestID: 1,
-		callResults:   make(map[int32]chan<- interface{}),
+		streams:      make(map[int32]*deviceStream),
+		nextStreamID: 1,
 	}
 
+	ctrl.channelsMutex.Lock()
+	ctrl.channels[cc] = struct{}{}
+	ctrl.channelsMutex.Unlock()
+
 	go cc.inboxHandler()
 	// go cc.target.Run()
 	// go webSocketInboxHandler(conn, cc.inboxCh, cc.wsTerminateCh)
@@ -80,6 +142,56 @@ func (ctrl *Controller) NewControlChannel(driver *wsio.Driver /*conn net.Conn, t
 	return cc
 }
 
+// SessionIDs returns the IDs of the sessions held by the control channels
+// connected to this server
+func (ctrl *Controller) SessionIDs() map[int32]bool {
+	ctrl.channelsMutex.Lock()
+	defer ctrl.channelsMutex.Unlock()
+
+	ids := make(map[int32]bool, len(ctrl.channels))
+	for cc := range ctrl.channels {
+		cc.sessionDetailsMutex.RLock()
+		if cc.sessionDetails.id != 0 {
+			ids[cc.sessionDetails.id] = true
+		}
+		cc.sessionDetailsMutex.RUnlock()
+	}
+
+	return ids
+}
+
+// registerCall remembers the control channel running the call. It returns
+// false if another call with the ID is running.
+func (ctrl *Controller) registerCall(callID string, cc *ControlChannel) bool {
+	if callID == "" {
+		return true
+	}
+	ctrl.callsMutex.Lock()
+	defer ctrl.callsMutex.Unlock()
+	if _, ok := ctrl.calls[callID]; ok {
+		return false
+	}
+	ctrl.calls[callID] = cc
+	return true
+}
+
+// unregisterCall forgets the call if it's run by the control channel
+func (ctrl *Controller) unregisterCall(callID string, cc *ControlChannel) {
+	ctrl.callsMutex.Lock()
+	if ctrl.calls[callID] == cc {
+		delete(ctrl.calls, callID)
+	}
+	ctrl.callsMutex.Unlock()
+}
+
+// findCall returns the control channel running the call, nil if the call
+// doesn't run on this server
+func (ctrl *Controller) findCall(callID string) *ControlChannel {
+	ctrl.callsMutex.RLock()
+	defer ctrl.callsMutex.RUnlock()
+	return ctrl.calls[callID]
+}
+
 func (ctrl *Controller) replyMessage(replyTo string, rep interface{}) error {
 	data, err := json.Marshal(rep)
 	if err != nil {
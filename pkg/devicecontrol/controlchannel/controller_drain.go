@@ -0,0 +1,95 @@
+package controlchannel
+
+import (
+	"context"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/wsio"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	log "github.com/sirupsen/logrus"
+)
+
+// drainMessage tells the devices of a draining server to reconnect
+const drainMessage = "server is shutting down, reconnect to another server"
+
+// Draining returns true if the controller is draining. A draining
+// controller rejects new sessions.
+func (ctrl *Controller) Draining() bool {
+	ctrl.channelsMutex.Lock()
+	defer ctrl.channelsMutex.Unlock()
+	return ctrl.draining
+}
+
+// Drain rejects new sessions and closes the control channels of this server
+// in waves of the given size. The devices receive an ABORT message telling
+// them to reconnect to another server. The waves are started every interval
+// to spread the reconnects. Drain returns after all control channels are
+// closed or with the error of the context.
+func (ctrl *Controller) Drain(ctx context.Context, waveSize int, interval time.Duration) error {
+	ctrl.channelsMutex.Lock()
+	ctrl.draining = true
+	ctrl.channelsMutex.Unlock()
+
+	if waveSize <= 0 {
+		waveSize = 1
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	aborted := make(map[*ControlChannel]struct{})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		wave := make([]*ControlChannel, 0, waveSize)
+		remaining := 0
+
+		ctrl.channelsMutex.Lock()
+		for cc := range ctrl.channels {
+			remaining++
+			if _, ok := aborted[cc]; ok || len(wave) == waveSize {
+				continue
+			}
+			wave = append(wave, cc)
+		}
+		ctrl.channelsMutex.Unlock()
+
+		if remaining == 0 {
+			log.Info("controller drained all control channels")
+			return nil
+		}
+
+		if len(wave) > 0 {
+			log.Infof("controller drains %d of %d control channels", len(wave), remaining)
+		}
+		for _, cc := range wave {
+			aborted[cc] = struct{}{}
+			if err := cc.sendAbortMessageAndClose(proto.ErrReasonServerDraining, drainMessage); err != nil {
+				log.Errorf("controller failed to abort control channel: %s", err)
+				cc.target.Stop(wsio.CauseServerClose)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ctrl *Controller) removeChannel(cc *ControlChannel) {
+	ctrl.channelsMutex.Lock()
+	delete(ctrl.channels, cc)
+	ctrl.channelsMutex.Unlock()
+
+	// Forget the calls which were still running on the control channel
+	ctrl.callsMutex.Lock()
+	for callID, elem := range ctrl.calls {
+		if elem == cc {
+			delete(ctrl.calls, callID)
+		}
+	}
+	ctrl.callsMutex.Unlock()
+}
@@ -0,0 +1,125 @@
+package controlchannel
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/wsio"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// addTestChannel adds a control channel without connection to the
+// controller. The messages for the device are queued in the outbox of its
+// driver.
+func addTestChannel(ctrl *Controller) *ControlChannel {
+	cc := &ControlChannel{
+		ctrl:           ctrl,
+		sessionDetails: &sessionDetails{},
+		target:         wsio.NewDriver(nil, make(chan struct{})),
+		serializer:     proto.JSONSerializer,
+	}
+
+	ctrl.channelsMutex.Lock()
+	ctrl.channels[cc] = struct{}{}
+	ctrl.channelsMutex.Unlock()
+
+	return cc
+}
+
+// expectAbort returns the reason of the abort message queued for the
+// device. It's called by the goroutines of the devices, therefore it
+// reports errors without stopping the test.
+func expectAbort(t *testing.T, cc *ControlChannel) string {
+	select {
+	case out := <-cc.target.Outbox:
+		if out.Flag != wsio.FlagCloseGracefully {
+			t.Errorf("outbox message flag = %d, want %d", out.Flag, wsio.FlagCloseGracefully)
+		}
+		_, msg, err := proto.UnmarshalMessageWith(cc.serializer, out.Data)
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		abort, ok := msg.(proto.AbortMessage)
+		if !ok {
+			t.Errorf("message = %T, want abort message", msg)
+			return ""
+		}
+		return abort.Reason
+	case <-time.After(time.Second):
+		t.Error("no abort message queued")
+	}
+	return ""
+}
+
+func TestDrainWaves(t *testing.T) {
+	ctrl := NewController(nil, memory.NewStore(), nil, nil, nil)
+
+	const interval = 100 * time.Millisecond
+	channels := make([]*ControlChannel, 0, 5)
+	for i := 0; i < 5; i++ {
+		channels = append(channels, addTestChannel(ctrl))
+	}
+
+	// The devices close their sessions after the abort message
+	var mu sync.Mutex
+	abortedAt := make([]time.Time, 0, len(channels))
+	for _, cc := range channels {
+		go func(cc *ControlChannel) {
+			if reason := expectAbort(t, cc); reason != proto.ErrReasonServerDraining.String() {
+				t.Errorf("abort reason = %s, want %s", reason, proto.ErrReasonServerDraining)
+			}
+			mu.Lock()
+			abortedAt = append(abortedAt, time.Now())
+			mu.Unlock()
+			ctrl.removeChannel(cc)
+		}(cc)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ctrl.Drain(ctx, 2, interval); err != nil {
+		t.Fatal(err)
+	}
+	if !ctrl.Draining() {
+		t.Error("controller isn't draining after the drain")
+	}
+
+	// The channels are aborted in waves of two, a wave per interval
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Slice(abortedAt, func(i, j int) bool { return abortedAt[i].Before(abortedAt[j]) })
+	waves := []int{1}
+	for i := 1; i < len(abortedAt); i++ {
+		if abortedAt[i].Sub(abortedAt[i-1]) > interval/2 {
+			waves = append(waves, 0)
+		}
+		waves[len(waves)-1]++
+	}
+	if len(waves) != 3 || waves[0] != 2 || waves[1] != 2 || waves[2] != 1 {
+		t.Errorf("waves = %v, want [2 2 1]", waves)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	ctrl := NewController(nil, memory.NewStore(), nil, nil, nil)
+
+	// The device ignores the abort message
+	cc := addTestChannel(ctrl)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := ctrl.Drain(ctx, 1, 20*time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("drain error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The channel is aborted once only
+	expectAbort(t, cc)
+	if n := len(cc.target.Outbox); n != 0 {
+		t.Errorf("%d more messages queued, want none", n)
+	}
+}
@@ -6,16 +6,41 @@ import (
 	"time"
 
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/maintenance"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
+// statusQueueSize is the number of device status events queued for
+// publishing. In durable mode every event waits for the acknowledgement of the
+// stream, the sessions don't wait for it.
+const statusQueueSize = 1024
+
+// statusEvent is a device status event queued for publishing
+type statusEvent struct {
+	subj string
+	data []byte
+}
+
+// deviceStatusDetails are the details of the device status events.
+// Maintenance is set if the device is in a maintenance window, consumers
+// shouldn't alert or count the status against the availability then.
 type deviceStatusDetails struct {
 	Status        string    `json:"status"`
 	SessionID     int32     `json:"session_id"`
 	LastMessageAt time.Time `json:"last_message_at"`
+	Maintenance   bool      `json:"maintenance,omitempty"`
 }
 
+// publishDeviceStatus queues the device status event. The events are
+// published one after another, hence CONNECTED and DISCONNECTED of a device
+// keep their order.
 func (ctrl *Controller) publishDeviceStatus(namespace, deviceID, status string, sessionID int32, lastMessageAt time.Time) error {
+	window, err := maintenance.Active(ctrl.store, namespace, deviceID)
+	if err != nil {
+		log.Errorf("controller failed to find maintenance window: %v", err)
+	}
+
 	msg := message.EventMessage{
 		SourceType: message.SourceTypeDevice,
 		SourceID:   deviceID,
@@ -24,6 +49,7 @@ func (ctrl *Controller) publishDeviceStatus(namespace, deviceID, status string,
 			Status:        status,
 			SessionID:     sessionID,
 			LastMessageAt: lastMessageAt,
+			Maintenance:   window != nil,
 		},
 	}
 
@@ -33,8 +59,10 @@ func (ctrl *Controller) publishDeviceStatus(namespace, deviceID, status string,
 	}
 
 	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.events.devicestatus", namespace)
-	if err := ctrl.nc.Publish(subj, data); err != nil {
-		return errors.Wrap(err, "failed to publish event message")
+	select {
+	case ctrl.statusCh <- statusEvent{subj: subj, data: data}:
+	default:
+		return errors.New("device status queue is full")
 	}
 
 	// ctrl.createDeviceStatusEvent(namespace, deviceID, msg.Details)
@@ -42,6 +70,15 @@ func (ctrl *Controller) publishDeviceStatus(namespace, deviceID, status string,
 	return nil
 }
 
+// publishStatusEvents publishes the queued device status events
+func (ctrl *Controller) publishStatusEvents() {
+	for ev := range ctrl.statusCh {
+		if err := ctrl.events.Publish(ev.subj, ev.data); err != nil {
+			log.Errorf("controller failed to publish device status: %v", err)
+		}
+	}
+}
+
 /*func (ctrl *Controller) createDeviceStatusEvent(namespace, deviceID string, details interface{}) (*model.Event, error) {
 	// Marshall the given request arguments to a string
 	detailsJSON, err := json.Marshal(details)
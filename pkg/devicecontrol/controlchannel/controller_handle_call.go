@@ -1,15 +1,31 @@
 package controlchannel
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/maintenance"
+	"github.com/nsyszr/lcm/pkg/metrics"
+	"github.com/nsyszr/lcm/pkg/tracing"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// maintenanceDetails are the error details of calls rejected because of a
+// maintenance window
+type maintenanceDetails struct {
+	Reason string    `json:"reason,omitempty"`
+	SetBy  string    `json:"set_by,omitempty"`
+	Until  time.Time `json:"until"`
+}
+
 func (ctrl *Controller) handleCallRequest(msg *nats.Msg) error {
 	// Extract the namespace
 	// TODO(DGL) Replace hardcoded namespace with namespace from subject
@@ -22,63 +38,182 @@ func (ctrl *Controller) handleCallRequest(msg *nats.Msg) error {
 		return errors.Wrap(err, "failed to unmarshal call request")
 	}
 
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), msg), "controller call",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("device.id", req.TargetID),
+			attribute.String("call.id", req.CallID),
+			attribute.String("call.command", req.Command),
+		))
+	defer span.End()
+
 	if req.TargetType == message.TargetTypeDevice {
 		if req.TargetID == "" {
 			// TODO(DGL) Add details for the bad request
-			return ctrl.replyCallFailed(msg.Reply, "ERR_BAD_REQUEST", nil)
+			tracing.Fail(span, "ERR_BAD_REQUEST")
+			return ctrl.replyCallFailed(msg.Reply, req.CallID, "ERR_BAD_REQUEST", nil)
 		}
 
 		// Find a device session for device ID equals target ID
+		_, storeSpan := tracing.StartStore(ctx, "Sessions.FindByNamespaceAndDeviceID")
 		_, err := ctrl.store.Sessions().FindByNamespaceAndDeviceID(namespace, req.TargetID)
+		tracing.End(storeSpan, err)
 		if err != nil {
 			// TODO(DGL) Handle session not found differently
-			return ctrl.replyCallFailed(msg.Reply, "ERR_INVALID_SESSION", nil)
+			tracing.Fail(span, "ERR_INVALID_SESSION")
+			return ctrl.replyCallFailed(msg.Reply, req.CallID, "ERR_INVALID_SESSION", nil)
+		}
+
+		// Every call of a device in a maintenance window which rejects
+		// calls is rejected here, the calls of the server side components
+		// as well. Only the API bypasses the window for admins.
+		window, err := maintenance.Active(ctrl.store, namespace, req.TargetID)
+		if err != nil {
+			log.Errorf("controller failed to find maintenance window: %v", err)
+			tracing.Fail(span, proto.ErrReasonTechnicalException.String())
+			return ctrl.replyCallFailed(msg.Reply, req.CallID, proto.ErrReasonTechnicalException.String(), nil)
+		}
+		if window != nil && window.RejectCalls && !req.BypassMaintenance {
+			tracing.Fail(span, proto.ErrReasonDeviceInMaintenance.String())
+			return ctrl.replyCallFailed(msg.Reply, req.CallID, proto.ErrReasonDeviceInMaintenance.String(),
+				&maintenanceDetails{Reason: window.Reason, SetBy: window.SetBy, Until: window.Until})
 		}
 
+		// The control channel relays every progressive result, even if the
+		// requestor doesn't want a stream. Each result resets the timeout,
+		// therefore long running calls don't time out as long as the device
+		// reports its progress.
 		callRequest := message.ControlChannelCallRequest{
+			CallID:    req.CallID,
 			Command:   req.Command,
 			Arguments: req.Arguments,
+			Stream:    true,
+			Requestor: req.Requestor,
 		}
 
 		callRequestData, err := json.Marshal(callRequest)
 		if err != nil {
 			// TODO(DGL) Add details to error reply
-			return ctrl.replyCallFailed(msg.Reply, "ERR_TECHNICAL_EXCEPTION", nil)
+			return ctrl.replyCallFailed(msg.Reply, req.CallID, "ERR_TECHNICAL_EXCEPTION", nil)
 		}
 
 		subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.controlchannel.%s.call", namespace, req.TargetID)
-		callReplyMsg, err := ctrl.nc.Request(subj, callRequestData, 16*time.Second)
+		return ctrl.relayCallStream(ctx, msg.Reply, req.CallID, subj, callRequestData, req.Stream)
+	}
+
+	return nil
+}
+
+// handleCancelRequest cancels the call of the request if it runs on a
+// control channel of this server
+func (ctrl *Controller) handleCancelRequest(msg *nats.Msg) error {
+	req := message.CancelRequest{}
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return errors.Wrap(err, "failed to unmarshal cancel request")
+	}
+
+	cc := ctrl.findCall(req.CallID)
+	if cc == nil {
+		// The call runs on another server. We don't reply, otherwise the
+		// requestor receives a reply from every server.
+		return nil
+	}
+
+	return cc.cancelCall(msg, req.CallID, req.Requestor)
+}
+
+// relayCallStream forwards the final result of a streamed call to the
+// requestor, the progressive results only if progress is true. Every reply
+// of the control channel resets the timeout.
+func (ctrl *Controller) relayCallStream(ctx context.Context, replyTo, callID, subj string, data []byte, progress bool) error {
+	inbox := nats.NewInbox()
+	sub, err := ctrl.nc.SubscribeSync(inbox)
+	if err != nil {
+		return ctrl.replyCallFailed(replyTo, callID, "ERR_TECHNICAL_EXCEPTION", nil)
+	}
+	defer sub.Unsubscribe()
+
+	req := tracing.NewMsg(ctx, ctrl.nc, subj, data)
+	req.Reply = inbox
+	if err := ctrl.nc.PublishMsg(req); err != nil {
+		metrics.NATSRequestErrors.WithLabelValues("controlchannel_call").Inc()
+		return ctrl.replyCallFailed(replyTo, callID, "ERR_TECHNICAL_EXCEPTION", nil)
+	}
+	defer metrics.ObserveCall(metrics.HopController, time.Now())
+
+	for {
+		callReplyMsg, err := sub.NextMsg(16 * time.Second)
 		if err != nil {
+			observeCallRequestError(err)
+			tracing.RecordError(trace.SpanFromContext(ctx), err)
 			// TODO(DGL) Add details to error reply
-			return ctrl.replyCallFailed(msg.Reply, "ERR_TECHNICAL_EXCEPTION", nil)
+			return ctrl.replyCallFailed(replyTo, callID, "ERR_TECHNICAL_EXCEPTION", nil)
 		}
 
 		callReply := message.ControlChannelCallReply{}
 		if err := json.Unmarshal(callReplyMsg.Data, &callReply); err != nil {
 			// TODO(DGL) Add details to error reply
-			return ctrl.replyCallFailed(msg.Reply, "ERR_TECHNICAL_EXCEPTION", nil)
+			return ctrl.replyCallFailed(replyTo, callID, "ERR_TECHNICAL_EXCEPTION", nil)
+		}
+
+		if !callReply.Partial {
+			return ctrl.relayCallReply(replyTo, callID, callReplyMsg.Data)
 		}
 
-		if callReply.Status == message.ReplyStatusError {
-			return ctrl.replyCallFailed(msg.Reply, callReply.ErrorReason, callReply.ErrorDetails)
+		if !progress {
+			continue
 		}
+		if err := ctrl.replyCallProgress(replyTo, callID, callReply.Results); err != nil {
+			return err
+		}
+	}
+}
 
-		return ctrl.replyCalledSuccesfully(msg.Reply, callReply.Results)
+// observeCallRequestError counts a failed call request to a control channel
+func observeCallRequestError(err error) {
+	metrics.NATSRequestErrors.WithLabelValues("controlchannel_call").Inc()
+	if err == nats.ErrTimeout {
+		metrics.CallTimeouts.WithLabelValues(metrics.HopController).Inc()
 	}
+}
 
-	return nil
+// relayCallReply converts the final reply of a control channel and sends it
+// to the requestor.
+func (ctrl *Controller) relayCallReply(replyTo, callID string, data []byte) error {
+	callReply := message.ControlChannelCallReply{}
+	if err := json.Unmarshal(data, &callReply); err != nil {
+		// TODO(DGL) Add details to error reply
+		return ctrl.replyCallFailed(replyTo, callID, "ERR_TECHNICAL_EXCEPTION", nil)
+	}
+
+	if callReply.Status == message.ReplyStatusError {
+		return ctrl.replyCallFailed(replyTo, callID, callReply.ErrorReason, callReply.ErrorDetails)
+	}
+
+	return ctrl.replyCalledSuccesfully(replyTo, callID, callReply.Results)
+}
+
+func (ctrl *Controller) replyCallProgress(replyTo, callID string, results interface{}) error {
+	return ctrl.replyMessage(replyTo, message.CallReply{
+		CallID:  callID,
+		Partial: true,
+		Status:  message.ReplyStatusSuccess,
+		Results: results,
+	})
 }
 
-func (ctrl *Controller) replyCallFailed(replyTo, reason string, details interface{}) error {
+func (ctrl *Controller) replyCallFailed(replyTo, callID, reason string, details interface{}) error {
 	return ctrl.replyMessage(replyTo, message.CallReply{
+		CallID:       callID,
 		Status:       message.ReplyStatusError,
 		ErrorReason:  reason,
 		ErrorDetails: details,
 	})
 }
 
-func (ctrl *Controller) replyCalledSuccesfully(replyTo string, results interface{}) error {
+func (ctrl *Controller) replyCalledSuccesfully(replyTo, callID string, results interface{}) error {
 	return ctrl.replyMessage(replyTo, message.CallReply{
+		CallID:  callID,
 		Status:  message.ReplyStatusSuccess,
 		Results: results,
 	})
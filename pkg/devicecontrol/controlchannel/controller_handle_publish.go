@@ -7,6 +7,7 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/metrics"
 	"github.com/nsyszr/lcm/pkg/model"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -34,22 +35,19 @@ func (ctrl *Controller) handlePublishRequest(msg *nats.Msg) error {
 			Message string `json:"message"`
 		}
 
-		m, err := ctrl.createEventFromPublishRequest(namespace, req)
+		// The event is stored together with its outbox entry, the outbox
+		// relay publishes it even if NATS is unavailable right now.
+		m, err := ctrl.createEventFromPublishRequest(namespace, req, true)
 		if err != nil {
 			if err := ctrl.replyPublishFailed(msg.Reply, "ERR_TECHNICAL_EXCEPTION", &errorDetails{Message: err.Error()}); err != nil {
 				log.Debugf("controller failed to reply publish request: %v", err)
 				return errors.Wrap(err, "failed to reply publish request")
 			}
+			return nil
 		}
 
-		if err := ctrl.publishCreatedEvent(m); err != nil {
-			// TODO(DGL) Add error details to response
-			if err := ctrl.replyPublishFailed(msg.Reply, "ERR_TECHNICAL_EXCEPTION", &errorDetails{Message: err.Error()}); err != nil {
-				log.Debugf("controller failed to reply publish request: %v", err)
-				return errors.Wrap(err, "failed to reply publish request")
-			}
-			log.Debugf("controller failed to reply publish request: %v", err)
-			return errors.Wrap(err, "failed to publish created event")
+		if ctrl.outbox != nil {
+			ctrl.outbox.Notify()
 		}
 
 		if err := ctrl.replyPublishedSuccessfully(msg.Reply, m.ID); err != nil {
@@ -60,12 +58,64 @@ func (ctrl *Controller) handlePublishRequest(msg *nats.Msg) error {
 		return nil
 	}
 
-	// TODO(DGL) handle if TargetType == message.TargetTypeDevice
+	// We received an event which targets a device. The event is stored like
+	// any other event and delivered to the connected device.
+	if req.TargetType == message.TargetTypeDevice {
+		if req.TargetID == "" {
+			// TODO(DGL) Add details for the bad request
+			return ctrl.replyPublishFailed(msg.Reply, "ERR_BAD_REQUEST", nil)
+		}
+
+		if _, err := ctrl.store.Sessions().FindByNamespaceAndDeviceID(namespace, req.TargetID); err != nil {
+			return ctrl.replyPublishFailed(msg.Reply, "ERR_INVALID_SESSION", nil)
+		}
+
+		m, err := ctrl.createEventFromPublishRequest(namespace, req, false)
+		if err != nil {
+			return ctrl.replyPublishFailed(msg.Reply, "ERR_TECHNICAL_EXCEPTION", nil)
+		}
+
+		return ctrl.deliverEvent(msg.Reply, namespace, req, m.ID)
+	}
 
 	return nil
 }
 
-func (ctrl *Controller) createEventFromPublishRequest(namespace string, req message.PublishRequest) (*model.Event, error) {
+// deliverEvent sends the event to the control channel of the target device
+// and relays the reply to the requestor.
+func (ctrl *Controller) deliverEvent(replyTo, namespace string, req message.PublishRequest, publicationID int32) error {
+	data, err := json.Marshal(message.ControlChannelPublishRequest{
+		PublicationID: publicationID,
+		Topic:         req.Topic,
+		Arguments:     req.Arguments,
+	})
+	if err != nil {
+		return ctrl.replyPublishFailed(replyTo, "ERR_TECHNICAL_EXCEPTION", nil)
+	}
+
+	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.controlchannel.%s.publish", namespace, req.TargetID)
+	replyMsg, err := ctrl.nc.Request(subj, data, 5*time.Second)
+	if err != nil {
+		metrics.NATSRequestErrors.WithLabelValues("controlchannel_publish").Inc()
+		// TODO(DGL) Add details to error reply
+		return ctrl.replyPublishFailed(replyTo, "ERR_TECHNICAL_EXCEPTION", nil)
+	}
+
+	reply := message.ControlChannelPublishReply{}
+	if err := json.Unmarshal(replyMsg.Data, &reply); err != nil {
+		return ctrl.replyPublishFailed(replyTo, "ERR_TECHNICAL_EXCEPTION", nil)
+	}
+
+	if reply.Status == message.ReplyStatusError {
+		return ctrl.replyPublishFailed(replyTo, reply.ErrorReason, reply.ErrorDetails)
+	}
+
+	return ctrl.replyPublishedSuccessfully(replyTo, publicationID)
+}
+
+// createEventFromPublishRequest stores the event of the request. Events which
+// are published are stored with an outbox entry.
+func (ctrl *Controller) createEventFromPublishRequest(namespace string, req message.PublishRequest, publish bool) (*model.Event, error) {
 	// Marshall the given request arguments to a string
 	details, err := json.Marshal(req.Arguments)
 	if err != nil {
@@ -81,10 +131,19 @@ func (ctrl *Controller) createEventFromPublishRequest(namespace string, req mess
 		Details:    string(details),
 	}
 
-	if err := ctrl.store.Events().Create(m); err != nil {
+	create := ctrl.store.Events().Create
+	if publish {
+		create = ctrl.store.Events().CreateWithOutbox
+	}
+	if err := create(m); err != nil {
 		return nil, errors.Wrap(err, "failed to store new event")
 	}
 
+	// The actions of the rules don't delay the reply
+	if ctrl.rules != nil {
+		go ctrl.rules.Evaluate(m)
+	}
+
 	return m, nil
 }
 
@@ -102,39 +161,3 @@ func (ctrl *Controller) replyPublishFailed(replyTo, reason string, details inter
 		ErrorDetails: details,
 	})
 }
-
-func (ctrl *Controller) publishCreatedEvent(m *model.Event) error {
-	// Unmarshal the details string back to an interface. Since we're marshalling
-	// the events message to the queue, we subscribers receives a proper JSON.
-	// Otherwise the details are marshalled as an escaped string.
-	var details interface{}
-	if err := json.Unmarshal([]byte(m.Details), &details); err != nil {
-		// TODO(DGL) This error should not happen! But what should we do?
-		return errors.Wrap(err, "failed to unmarshal event details")
-	}
-
-	srcType, err := message.SourceTypeFromString(m.SourceType)
-	if err != nil {
-		return errors.Wrap(err, "invalid event source type")
-	}
-
-	msg := message.EventMessage{
-		SourceType:    srcType,
-		SourceID:      m.SourceID,
-		PublicationID: m.ID,
-		Timestamp:     m.Timestamp,
-		Details:       details,
-	}
-
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return errors.Wrap(err, "failed to marshal event message")
-	}
-
-	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.events.%s", m.Namespace, m.Topic)
-	if err := ctrl.nc.Publish(subj, data); err != nil {
-		return errors.Wrap(err, "failed to publish event message")
-	}
-
-	return nil
-}
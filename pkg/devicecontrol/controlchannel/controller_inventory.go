@@ -0,0 +1,73 @@
+package controlchannel
+
+import (
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// CommandDeviceInfo is the device command which returns the firmware and
+// device info, if the device didn't declare it in the HELLO message.
+const CommandDeviceInfo = "device.info"
+
+// deviceInfoResults are the results of the device info command
+type deviceInfoResults struct {
+	Firmware *proto.FirmwareInfo `json:"firmware,omitempty"`
+	Device   *proto.DeviceInfo   `json:"device,omitempty"`
+}
+
+// updateInventory stores the firmware and device info reported by the device.
+// Empty values don't overwrite the inventory.
+func (ctrl *Controller) updateInventory(device *model.Device, firmware *proto.FirmwareInfo, info *proto.DeviceInfo) error {
+	m := *device
+
+	if firmware != nil {
+		setIfNotEmpty(&m.FirmwareVersion, firmware.Version)
+		setIfNotEmpty(&m.HardwareModel, firmware.HardwareModel)
+	}
+	if info != nil {
+		setIfNotEmpty(&m.HardwareRevision, info.HardwareRevision)
+		setIfNotEmpty(&m.HardwareSerialNumber, info.SerialNumber)
+		setIfNotEmpty(&m.NetworkHostname, info.Hostname)
+		setIfNotEmpty(&m.NetworkDomainname, info.Domainname)
+		setIfNotEmpty(&m.NetworkPrimaryIPv4Address, info.PrimaryIPv4Address)
+	}
+
+	if m.FirmwareVersion == device.FirmwareVersion &&
+		m.HardwareModel == device.HardwareModel &&
+		m.HardwareRevision == device.HardwareRevision &&
+		m.HardwareSerialNumber == device.HardwareSerialNumber &&
+		m.NetworkHostname == device.NetworkHostname &&
+		m.NetworkDomainname == device.NetworkDomainname &&
+		m.NetworkPrimaryIPv4Address == device.NetworkPrimaryIPv4Address {
+		return nil
+	}
+
+	return ctrl.store.Devices().Update(&m)
+}
+
+// requestDeviceInfo calls the device info command and stores the results.
+// Devices which don't implement the command are left as they are.
+func (ctrl *Controller) requestDeviceInfo(namespace, deviceID string) {
+	res := deviceInfoResults{}
+	if err := ctrl.client.Call(namespace, deviceID, CommandDeviceInfo, nil, &res); err != nil {
+		log.Debugf("controller could not retrieve device info of '%s': %s", deviceID, err)
+		return
+	}
+
+	device, err := ctrl.store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil {
+		log.Errorf("controller failed to find device: %v", err)
+		return
+	}
+
+	if err := ctrl.updateInventory(device, res.Firmware, res.Device); err != nil {
+		log.Errorf("controller failed to update inventory of device '%s': %v", deviceID, err)
+	}
+}
+
+func setIfNotEmpty(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
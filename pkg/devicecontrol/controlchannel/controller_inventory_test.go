@@ -0,0 +1,115 @@
+package controlchannel
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// runServer starts an embedded NATS server and returns a connection to it
+func runServer(t *testing.T) (*nats.Conn, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nc, func() {
+		nc.Close()
+		s.Shutdown()
+	}
+}
+
+func TestUpdateInventory(t *testing.T) {
+	store := memory.NewStore()
+	device := &model.Device{
+		Namespace:       "default",
+		DeviceID:        "dev1",
+		Name:            "Gateway",
+		FirmwareVersion: "1.0",
+		HardwareModel:   "m1",
+		NetworkHostname: "gw1",
+	}
+	if err := store.Devices().Create(device); err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := NewController(nil, store, nil, nil, nil)
+	firmware := &proto.FirmwareInfo{Version: "2.0"}
+	info := &proto.DeviceInfo{SerialNumber: "SN-1", PrimaryIPv4Address: "10.0.0.1"}
+	if err := ctrl.updateInventory(device, firmware, info); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := store.Devices().FindByID(device.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty values don't overwrite the inventory
+	want := model.Device{
+		Name:                      "Gateway",
+		FirmwareVersion:           "2.0",
+		HardwareModel:             "m1",
+		HardwareSerialNumber:      "SN-1",
+		NetworkHostname:           "gw1",
+		NetworkPrimaryIPv4Address: "10.0.0.1",
+	}
+	if m.Name != want.Name || m.FirmwareVersion != want.FirmwareVersion || m.HardwareModel != want.HardwareModel ||
+		m.HardwareSerialNumber != want.HardwareSerialNumber || m.NetworkHostname != want.NetworkHostname ||
+		m.NetworkPrimaryIPv4Address != want.NetworkPrimaryIPv4Address {
+		t.Errorf("inventory = %+v, want %+v", m, want)
+	}
+}
+
+func TestRequestDeviceInfo(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	store := memory.NewStore()
+	if err := store.Devices().Create(&model.Device{Namespace: "default", DeviceID: "dev1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The device answers the device info command
+	if _, err := nc.Subscribe("iotcore.devicecontrol.v1.default.call", func(msg *nats.Msg) {
+		req := message.CallRequest{}
+		json.Unmarshal(msg.Data, &req)
+		rep := message.CallReply{CallID: req.CallID, Status: message.ReplyStatusError, ErrorReason: "ERR_UNKNOWN_COMMAND"}
+		if req.Command == CommandDeviceInfo && req.TargetID == "dev1" {
+			rep = message.CallReply{CallID: req.CallID, Results: deviceInfoResults{
+				Firmware: &proto.FirmwareInfo{Version: "2.0", HardwareModel: "m1"},
+				Device:   &proto.DeviceInfo{HardwareRevision: "B", Hostname: "gw1"},
+			}}
+		}
+		data, _ := json.Marshal(rep)
+		msg.Respond(data)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := NewController(nc, store, nil, nil, nil)
+	ctrl.requestDeviceInfo("default", "dev1")
+
+	m, err := store.Devices().FindByNamespaceAndDeviceID("default", "dev1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.FirmwareVersion != "2.0" || m.HardwareModel != "m1" || m.HardwareRevision != "B" || m.NetworkHostname != "gw1" {
+		t.Errorf("inventory = %+v", m)
+	}
+}
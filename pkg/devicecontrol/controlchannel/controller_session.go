@@ -13,7 +13,13 @@ import (
 
 // RegisterSession checks first for existence of realm and on success it's starts a
 // new session, returns the session ID and details that are sent to the client.
-func (ctrl *Controller) RegisterSession(cc *ControlChannel, realm string) (int32, interface{}, error) {
+// The protocol version and features declared in the hello details are
+// negotiated and stored with the session.
+func (ctrl *Controller) RegisterSession(cc *ControlChannel, realm string, helloDetails *proto.HelloDetails) (int32, interface{}, error) {
+	if ctrl.Draining() {
+		return 0, nil, proto.NewRegistrationError(proto.ErrReasonServerDraining, drainMessage)
+	}
+
 	deviceIDAndURI := strings.SplitN(realm, "@", 2)
 	if len(deviceIDAndURI) != 2 {
 		return 0, nil, proto.NewRegistrationError(proto.ErrReasonNoSuchRelam,
@@ -53,47 +59,78 @@ func (ctrl *Controller) RegisterSession(cc *ControlChannel, realm string) (int32
 		}
 	}
 
+	caps := proto.NegotiateCapabilities(helloDetails)
+
 	// Create a new session in the store
 	// TODO(DGL) Fix hardcoded namespace
 	sess := model.Session{
-		Namespace:      "default",
-		DeviceID:       device.DeviceID,
-		DeviceURI:      device.DeviceURI,
-		SessionTimeout: device.SessionTimeout,
-		LastMessageAt:  time.Now().Round(time.Second).UTC(),
+		Namespace:       "default",
+		DeviceID:        device.DeviceID,
+		DeviceURI:       device.DeviceURI,
+		SessionTimeout:  device.SessionTimeout,
+		LastMessageAt:   time.Now().Round(time.Second).UTC(),
+		ProtocolVersion: caps.ProtocolVersion,
+		Features:        caps.FeatureStrings(),
+		FirmwareVersion: helloDetails.Firmware.Version,
+		HardwareModel:   helloDetails.Firmware.HardwareModel,
 	}
 	if err := ctrl.store.Sessions().Create(&sess); err != nil {
 		log.Errorf("controller failed to create new session: %v", err)
 		return 0, nil, proto.NewTechnicalExceptionError(err.Error())
 	}
 
-	// TODO(DGL) Fix hardcoded namespace
-	if err := ctrl.publishDeviceStatus("default", sess.DeviceID, "CONNECTED", sess.ID, sess.LastMessageAt); err != nil {
-		log.Errorf("controller could not publish device status: %v", err)
+	// Update the inventory with the details declared by the device
+	if err := ctrl.updateInventory(device, helloDetails.Firmware, helloDetails.Device); err != nil {
+		log.Errorf("controller failed to update inventory: %v", err)
 	}
 
-	log.Infof("controller added successfully a new control channel session with ID: %d", sess.ID)
+	log.Infof("controller added successfully a new control channel session with ID: %d (protocol version %d, features %v)",
+		sess.ID, caps.ProtocolVersion, caps.Features)
 
 	// Tell control channel that the registration is admitted
-	cc.AdmitRegistration(sess.ID, device.SessionTimeout, realm)
+	cc.AdmitRegistration(sess.ID, device.SessionTimeout, realm, caps)
 
 	// Return the results of the registration to the control channel
 	type registrationDetails struct {
-		SessionTimeout int    `json:"session_timeout,omitempty"`
-		PingInterval   int    `json:"ping_interval,omitempty"`
-		PongTimeout    int    `json:"pong_max_wait_time,omitempty"`
-		EventsTopic    string `json:"events_topic,omitempty"`
+		SessionTimeout  int             `json:"session_timeout,omitempty"`
+		PingInterval    int             `json:"ping_interval,omitempty"`
+		PongTimeout     int             `json:"pong_max_wait_time,omitempty"`
+		EventsTopic     string          `json:"events_topic,omitempty"`
+		ProtocolVersion int             `json:"protocol_version"`
+		Features        []proto.Feature `json:"features"`
 	}
 
 	details := &registrationDetails{
-		SessionTimeout: device.SessionTimeout,
-		PingInterval:   device.PingInterval,
-		PongTimeout:    device.PongTimeout,
-		EventsTopic:    device.EventsTopic,
+		SessionTimeout:  device.SessionTimeout,
+		PingInterval:    device.PingInterval,
+		PongTimeout:     device.PongTimeout,
+		EventsTopic:     device.EventsTopic,
+		ProtocolVersion: caps.ProtocolVersion,
+		Features:        caps.Features,
 	}
 	return sess.ID, details, nil
 }
 
+// EstablishSession is called by the control channel after it subscribed the
+// requests of the device. It publishes the status CONNECTED, the device can
+// be called from now on. Devices which didn't declare their device info are
+// asked for it.
+func (ctrl *Controller) EstablishSession(sessionID int32, helloDetails *proto.HelloDetails) {
+	sess, err := ctrl.store.Sessions().FindByID(sessionID)
+	if err != nil {
+		log.Errorf("controller could not find existing session: %v", err)
+		return
+	}
+
+	if err := ctrl.publishDeviceStatus(sess.Namespace, sess.DeviceID, "CONNECTED", sess.ID, sess.LastMessageAt); err != nil {
+		log.Errorf("controller could not publish device status: %v", err)
+	}
+
+	if helloDetails.Device == nil {
+		go ctrl.requestDeviceInfo(sess.Namespace, sess.DeviceID)
+	}
+}
+
 // UnregisterSession removes a session from the connection and session list.
 func (ctrl *Controller) UnregisterSession(sessionID int32) {
 	sess, err := ctrl.store.Sessions().FindByID(sessionID)
@@ -162,14 +162,28 @@ type PublishReply struct {
 	ErrorDetails  interface{} `json:"error_details,omitempty"`
 }
 
+// CallRequest is sent to the controller for calling a device command. If
+// Stream is true the requestor receives a reply for each progressive result
+// of the device followed by the final reply. Devices in a maintenance window
+// which rejects calls are only called if BypassMaintenance is true, the API
+// sets it for admins. Only the requestor may cancel the call.
 type CallRequest struct {
+	CallID     string      `json:"call_id,omitempty"`
 	TargetType TargetType  `json:"target_type"`
 	TargetID   string      `json:"target_id,omitempty"`
 	Command    string      `json:"command"`
 	Arguments  interface{} `json:"arguments,omitempty"`
+	Stream     bool        `json:"stream,omitempty"`
+	Requestor  string      `json:"requestor,omitempty"`
+
+	BypassMaintenance bool `json:"bypass_maintenance,omitempty"`
 }
 
+// CallReply contains the results of a call. Partial is true for replies of
+// progressive results.
 type CallReply struct {
+	CallID       string      `json:"call_id,omitempty"`
+	Partial      bool        `json:"partial,omitempty"`
 	Status       ReplyStatus `json:"status"`
 	Results      interface{} `json:"results"`
 	ErrorReason  string      `json:"error_reason,omitempty"`
@@ -177,20 +191,74 @@ type CallReply struct {
 }
 
 type ControlChannelCallRequest struct {
+	CallID    string      `json:"call_id,omitempty"`
 	Command   string      `json:"command"`
 	Arguments interface{} `json:"arguments,omitempty"`
+	Stream    bool        `json:"stream,omitempty"`
+	Requestor string      `json:"requestor,omitempty"`
 }
 
 type ControlChannelCallReply struct {
+	Partial      bool        `json:"partial,omitempty"`
 	Status       ReplyStatus `json:"status"`
 	Results      interface{} `json:"results"`
 	ErrorReason  string      `json:"error_reason,omitempty"`
 	ErrorDetails interface{} `json:"error_details,omitempty"`
 }
 
+// CancelRequest asks the control channel which runs the call with the given
+// ID to cancel it. Only the control channel running the call replies. The
+// requestor has to be the requestor of the call.
+type CancelRequest struct {
+	CallID    string `json:"call_id"`
+	Requestor string `json:"requestor,omitempty"`
+}
+
+type CancelReply struct {
+	Status       ReplyStatus `json:"status"`
+	ErrorReason  string      `json:"error_reason,omitempty"`
+	ErrorDetails interface{} `json:"error_details,omitempty"`
+}
+
+// StreamOpenRequest asks the control channel of a device to open a stream of
+// the given kind, e.g. an interactive CLI. The control channel publishes the
+// data sent by the device as StreamFrame to the OutboxSubject.
+type StreamOpenRequest struct {
+	Kind          string      `json:"kind"`
+	Arguments     interface{} `json:"arguments,omitempty"`
+	OutboxSubject string      `json:"outbox_subject"`
+}
+
+// StreamOpenReply contains the subject the requestor publishes the data for
+// the device to.
+type StreamOpenReply struct {
+	Status       ReplyStatus `json:"status"`
+	StreamID     int32       `json:"stream_id,omitempty"`
+	InboxSubject string      `json:"inbox_subject,omitempty"`
+	ErrorReason  string      `json:"error_reason,omitempty"`
+	ErrorDetails interface{} `json:"error_details,omitempty"`
+}
+
+// StreamWindow is the number of data frames a side of a stream may send
+// before the receiver grants new credits
+const StreamWindow = 64
+
+// StreamFrame carries the data of a stream in both directions. The last
+// frame of a stream has Close set and contains the reason. The receiver of
+// the data grants the sender a credit per consumed data frame.
+type StreamFrame struct {
+	Data   []byte `json:"data,omitempty"`
+	Close  bool   `json:"close,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Credit int    `json:"credit,omitempty"`
+}
+
+// ControlChannelPublishRequest asks the control channel to deliver the
+// event with the given publication ID to the device.
 type ControlChannelPublishRequest struct {
-	Topic     string      `json:"topic"`
-	Arguments interface{} `json:"arguments,omitempty"`
+	PublicationID int32       `json:"publication_id"`
+	Topic         string      `json:"topic"`
+	Arguments     interface{} `json:"arguments,omitempty"`
 }
 
 type ControlChannelPublishReply struct {
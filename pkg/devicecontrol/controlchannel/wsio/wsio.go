@@ -7,6 +7,7 @@ import (
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
+	"github.com/nsyszr/lcm/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -18,6 +19,18 @@ const (
 	FlagTerminate
 )
 
+// Causes of a disconnect
+const (
+	CauseReadError           = "read_error"
+	CauseClientClose         = "client_close"
+	CauseControlFrameError   = "control_frame_error"
+	CauseWriteError          = "write_error"
+	CauseServerClose         = "server_close"
+	CauseTerminate           = "terminate"
+	CauseSessionTimeout      = "session_timeout"
+	CauseRegistrationTimeout = "registration_timeout"
+)
+
 type OutboxMessage struct {
 	Flag Flag
 	Data []byte
@@ -29,6 +42,7 @@ type InboxMessage struct {
 
 type Driver struct {
 	conn   net.Conn
+	opCode ws.OpCode
 	Inbox  chan *InboxMessage
 	Outbox chan *OutboxMessage
 	// closeGracefulCh <-chan struct{}
@@ -36,6 +50,9 @@ type Driver struct {
 	terminateCh    chan<- struct{}
 	terminatedOnce sync.Once
 
+	// disconnectOnce counts the cause which closes the connection first
+	disconnectOnce sync.Once
+
 	stopCh <-chan struct{}
 	// stopOnce sync.Once
 
@@ -45,6 +62,7 @@ type Driver struct {
 func NewDriver(conn net.Conn, terminateCh chan<- struct{}) *Driver {
 	return &Driver{
 		conn:        conn,
+		opCode:      ws.OpText,
 		Inbox:       make(chan *InboxMessage, 100),
 		Outbox:      make(chan *OutboxMessage, 100),
 		terminateCh: terminateCh,
@@ -52,6 +70,12 @@ func NewDriver(conn net.Conn, terminateCh chan<- struct{}) *Driver {
 	}
 }
 
+// UseBinaryFrames tells the driver to send outbox messages as binary frames
+// instead of text frames. It has to be called before the driver is started.
+func (driver *Driver) UseBinaryFrames() {
+	driver.opCode = ws.OpBinary
+}
+
 func (driver *Driver) Start(stopCh <-chan struct{}) {
 	driver.stopCh = stopCh
 	driver.wg.Add(1)
@@ -66,11 +90,19 @@ func (driver *Driver) Close() {
 	log.Debug("websocketdriver closed")
 }
 
-func (driver *Driver) Stop() {
+// Stop terminates the connection for the given cause
+func (driver *Driver) Stop(cause string) {
 	log.Debug("websocketdriver stop called")
+	driver.disconnect(cause)
 	driver.safeCloseTerminateChannel()
 }
 
+func (driver *Driver) disconnect(cause string) {
+	driver.disconnectOnce.Do(func() {
+		metrics.WebsocketDisconnects.WithLabelValues(cause).Inc()
+	})
+}
+
 func (driver *Driver) closeHandler() {
 	log.Debug("websocketdriver closeHandler called")
 	defer driver.wg.Done()
@@ -103,6 +135,7 @@ func (driver *Driver) inboxHandler() {
 		if err != nil {
 			// TODO We should attach this information to the device perhaps.
 			log.Errorf("websocket read message error: %v", err)
+			driver.disconnect(CauseReadError)
 
 			// We should not return the error because echo framework
 			// doesn't expect an error at this stage. If you return an
@@ -122,6 +155,7 @@ func (driver *Driver) inboxHandler() {
 				// TODO we should attach this information to the device
 				// log with a timestamp and modify the discconnectedAt date.
 				log.Info("websocket connection closed gracefully")
+				driver.disconnect(CauseClientClose)
 				return
 			}
 
@@ -129,6 +163,7 @@ func (driver *Driver) inboxHandler() {
 			if err = ch(h, r); err != nil {
 				// TODO We should attach this information to the device log perhaps.
 				log.Errorf("websocket handles control frame error: %v", err)
+				driver.disconnect(CauseControlFrameError)
 				return
 			}
 			continue
@@ -139,6 +174,7 @@ func (driver *Driver) inboxHandler() {
 		req, err := ioutil.ReadAll(r)
 		if err != nil {
 			log.Errorf("websocket read error: %v", err)
+			driver.disconnect(CauseReadError)
 			return
 		}
 
@@ -167,10 +203,13 @@ func (driver *Driver) outboxHandler() {
 		select {
 		case res := <-driver.Outbox:
 			{
-				log.Infof("websocket received an outbox message with flag %d: %s", res.Flag, string(res.Data))
-				if err := webSocketWriteText(driver.conn, w, state, res.Data); err != nil {
+				// The data is binary for sessions with a binary serializer,
+				// therefore we log its size only
+				log.Debugf("websocket received an outbox message with flag %d: %d bytes (opcode %d)", res.Flag, len(res.Data), driver.opCode)
+				if err := webSocketWrite(driver.conn, w, state, driver.opCode, res.Data); err != nil {
 					// TODO We should attach this information to the device log perhaps.
 					log.Errorf("websocket terminates because of write error: %s", err.Error())
+					driver.disconnect(CauseWriteError)
 					return // stop reading outbox if return value is false, this signals the websocket is about to close!
 				}
 
@@ -178,12 +217,14 @@ func (driver *Driver) outboxHandler() {
 				case FlagCloseGracefully:
 					{
 						log.Info("websocket handled outbox message but closes gracefully")
+						driver.disconnect(CauseServerClose)
 						webSocketCloseGraceful(driver.conn, w, state)
 						return
 					}
 				case FlagTerminate:
 					{
 						log.Info("websocket handled outbox message but terminates")
+						driver.disconnect(CauseTerminate)
 						return
 					}
 				}
@@ -191,6 +232,7 @@ func (driver *Driver) outboxHandler() {
 		case <-driver.stopCh:
 			{
 				log.Info("websocket received stop signal")
+				driver.disconnect(CauseServerClose)
 				webSocketCloseGraceful(driver.conn, w, state)
 				return
 			}
@@ -198,14 +240,14 @@ func (driver *Driver) outboxHandler() {
 	}
 }
 
-func webSocketWriteText(conn net.Conn, w *wsutil.Writer, state ws.State, data []byte) error {
+func webSocketWrite(conn net.Conn, w *wsutil.Writer, state ws.State, op ws.OpCode, data []byte) error {
 	var err error
 
 	// Setup the writer with proper websocket frame settings.
 	// TODO if we start supporting fragmented message we should rethink
 	// this step very well. Maybe it's wrong.
 	// log.Debug("websocket sending frame to client")
-	w.Reset(conn, state, ws.OpText)
+	w.Reset(conn, state, op)
 	if _, err = w.Write(data); err == nil {
 		err = w.Flush()
 		// log.Debug("websocket send frame to client finished")
@@ -1,10 +1,13 @@
 package devicecontrol
 
 import (
+	"net/http"
+
 	"github.com/gobwas/ws"
 	"github.com/labstack/echo"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel"
 	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/wsio"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -29,19 +32,41 @@ func (h *Handler) RegisterRoutes(e *echo.Echo) {
 
 func (h *Handler) controlChannelHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		conn, _, _, err := ws.UpgradeHTTP(c.Request(), c.Response())
+		// A draining server doesn't accept new control channels, the
+		// device has to connect to another server.
+		if h.ctrl.Draining() {
+			return c.JSON(http.StatusServiceUnavailable, proto.ErrReasonServerDraining.String())
+		}
+
+		// The client selects the message encoding by the websocket
+		// subprotocol. Without a subprotocol the client speaks JSON.
+		upgrader := ws.HTTPUpgrader{
+			Protocol: proto.IsSupportedSubprotocol,
+		}
+		conn, _, hs, err := upgrader.Upgrade(c.Request(), c.Response())
 		if err != nil {
 			return err
 		}
 		defer conn.Close()
 
+		serializer, ok := proto.SerializerBySubprotocol(hs.Protocol)
+		if !ok {
+			// This should never happen because the upgrader selects supported
+			// subprotocols only.
+			log.Errorf("handler cannot find serializer for subprotocol '%s'", hs.Protocol)
+			return nil
+		}
+
 		terminateCh := make(chan struct{})
 		stopDriverCh := make(chan struct{})
 		driver := wsio.NewDriver(conn, terminateCh)
+		if serializer.Binary() {
+			driver.UseBinaryFrames()
+		}
 		driver.Start(stopDriverCh)
 		defer driver.Close()
 
-		cc := h.ctrl.NewControlChannel(driver)
+		cc := h.ctrl.NewControlChannel(driver, serializer)
 		defer cc.Close()
 
 		<-terminateCh
@@ -9,3 +9,47 @@ func NewAbortMessageDetails(message string) *AbortMessageDetails {
 		Message: message,
 	}
 }
+
+type CancelMessageDetails struct {
+	Reason string `json:"reason"`
+}
+
+func NewCancelMessageDetails(reason ErrorReason) *CancelMessageDetails {
+	return &CancelMessageDetails{
+		Reason: reason.String(),
+	}
+}
+
+// CallMessageDetails contains the ID of the trace the call belongs to. The
+// device may log it to correlate its processing with the trace.
+type CallMessageDetails struct {
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+func NewCallMessageDetails(traceID string) *CallMessageDetails {
+	return &CallMessageDetails{
+		TraceID: traceID,
+	}
+}
+
+type ResultMessageDetails struct {
+	Progress bool `json:"progress,omitempty"`
+}
+
+func NewResultMessageDetails(progress bool) *ResultMessageDetails {
+	return &ResultMessageDetails{
+		Progress: progress,
+	}
+}
+
+type StreamCloseMessageDetails struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+func NewStreamCloseMessageDetails(reason ErrorReason, message string) *StreamCloseMessageDetails {
+	return &StreamCloseMessageDetails{
+		Reason:  reason.String(),
+		Message: message,
+	}
+}
@@ -0,0 +1,205 @@
+package proto
+
+import "encoding/json"
+
+// Protocol versions spoken by the server. A client that doesn't declare a
+// protocol version in the HELLO details is treated as version 1 client.
+const (
+	ProtocolVersion1 = 1
+	ProtocolVersion2 = 2
+
+	// ProtocolVersion is the highest protocol version of the server.
+	ProtocolVersion = ProtocolVersion2
+)
+
+// Feature is an optional protocol capability which is negotiated during the
+// HELLO/WELCOME handshake. Message types that aren't part of the base
+// protocol require a negotiated feature.
+type Feature string
+
+// FeatureCallCancel allows the server to send CANCEL messages for running
+// calls, e.g. after a call timed out.
+const FeatureCallCancel Feature = "call_cancel"
+
+// FeatureProgressiveResults allows the device to send RESULT messages with
+// the progress flag before the final result of a call.
+const FeatureProgressiveResults Feature = "progressive_results"
+
+// FeatureStreams allows the server to open bidirectional byte streams on the
+// session with the STREAM_OPEN, STREAM_DATA and STREAM_CLOSE messages.
+const FeatureStreams Feature = "streams"
+
+// FeatureEventDelivery allows the server to send PUBLISH messages to the
+// device, e.g. events published for a group of devices. The device
+// acknowledges them with PUBLISHED messages.
+const FeatureEventDelivery Feature = "event_delivery"
+
+// FeatureCallTrace allows the server to add the trace ID of a call to the
+// details of the CALL message. Clients without it expect four elements.
+const FeatureCallTrace Feature = "call_trace"
+
+// SupportedFeatures contains all features supported by the server.
+var SupportedFeatures = []Feature{
+	FeatureCallCancel,
+	FeatureProgressiveResults,
+	FeatureStreams,
+	FeatureEventDelivery,
+	FeatureCallTrace,
+}
+
+// requiredFeatures maps message types to the feature which has to be
+// negotiated before the message type can be used on a session.
+var requiredFeatures = map[MessageType]Feature{
+	MessageTypeCancel:      FeatureCallCancel,
+	MessageTypePublished:   FeatureEventDelivery,
+	MessageTypeStreamOpen:  FeatureStreams,
+	MessageTypeStreamData:  FeatureStreams,
+	MessageTypeStreamClose: FeatureStreams,
+}
+
+// RequiredFeature returns the feature which is required for sending or
+// receiving messages of the given type. Base protocol messages don't require
+// a feature.
+func RequiredFeature(msgType MessageType) (Feature, bool) {
+	f, ok := requiredFeatures[msgType]
+	return f, ok
+}
+
+// FirmwareInfo describes the firmware running on a device.
+type FirmwareInfo struct {
+	Version       string `json:"version,omitempty"`
+	HardwareModel string `json:"hardware_model,omitempty"`
+}
+
+// DeviceInfo describes the hardware and the network of a device.
+type DeviceInfo struct {
+	HardwareRevision   string `json:"hardware_revision,omitempty"`
+	SerialNumber       string `json:"serial_number,omitempty"`
+	Hostname           string `json:"hostname,omitempty"`
+	Domainname         string `json:"domainname,omitempty"`
+	PrimaryIPv4Address string `json:"primary_ipv4_address,omitempty"`
+}
+
+// HelloDetails contains the details of a HELLO message. The device info is
+// optional, it's nil if the device didn't declare it.
+type HelloDetails struct {
+	ProtocolVersion int           `json:"protocol_version,omitempty"`
+	Features        []Feature     `json:"features,omitempty"`
+	Firmware        *FirmwareInfo `json:"firmware,omitempty"`
+	Device          *DeviceInfo   `json:"device,omitempty"`
+}
+
+// NewHelloDetails converts the generic details of a HELLO message. Details
+// of older clients, which are empty or free-form, result in a version 1
+// HELLO without features. The known fields are decoded one by one, a field
+// whose value doesn't fit is ignored, e.g. a free-form 'firmware' string.
+func NewHelloDetails(v interface{}) *HelloDetails {
+	d := &HelloDetails{
+		Firmware: &FirmwareInfo{},
+	}
+
+	m, _ := v.(map[string]interface{})
+	decodeField(m["protocol_version"], &d.ProtocolVersion)
+	if features, ok := m["features"].([]interface{}); ok {
+		for _, f := range features {
+			if s, ok := f.(string); ok {
+				d.Features = append(d.Features, Feature(s))
+			}
+		}
+	}
+	if fw, ok := m["firmware"].(map[string]interface{}); ok {
+		decodeField(fw["version"], &d.Firmware.Version)
+		decodeField(fw["hardware_model"], &d.Firmware.HardwareModel)
+	}
+	if dev, ok := m["device"].(map[string]interface{}); ok {
+		d.Device = &DeviceInfo{}
+		decodeField(dev["hardware_revision"], &d.Device.HardwareRevision)
+		decodeField(dev["serial_number"], &d.Device.SerialNumber)
+		decodeField(dev["hostname"], &d.Device.Hostname)
+		decodeField(dev["domainname"], &d.Device.Domainname)
+		decodeField(dev["primary_ipv4_address"], &d.Device.PrimaryIPv4Address)
+	}
+
+	if d.ProtocolVersion < ProtocolVersion1 {
+		d.ProtocolVersion = ProtocolVersion1
+	}
+
+	return d
+}
+
+// decodeField decodes the value of a HELLO details field into ptr. The field
+// is left unchanged if the value is missing or doesn't fit its type.
+func decodeField(value interface{}, ptr interface{}) {
+	if value == nil {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, ptr)
+}
+
+// Capabilities are the protocol version and features negotiated for a
+// session.
+type Capabilities struct {
+	ProtocolVersion int
+	Features        []Feature
+}
+
+// NegotiateCapabilities returns the highest protocol version and the
+// features supported by both the client and the server.
+func NegotiateCapabilities(d *HelloDetails) *Capabilities {
+	c := &Capabilities{
+		ProtocolVersion: d.ProtocolVersion,
+		Features:        make([]Feature, 0),
+	}
+	if c.ProtocolVersion > ProtocolVersion {
+		c.ProtocolVersion = ProtocolVersion
+	}
+
+	// Version 1 clients do not know anything about features
+	if c.ProtocolVersion == ProtocolVersion1 {
+		return c
+	}
+
+	for _, f := range d.Features {
+		if isSupportedFeature(f) && !c.HasFeature(f) {
+			c.Features = append(c.Features, f)
+		}
+	}
+
+	return c
+}
+
+// HasFeature returns true if the given feature is negotiated.
+func (c *Capabilities) HasFeature(f Feature) bool {
+	if c == nil {
+		return false
+	}
+	for _, elem := range c.Features {
+		if elem == f {
+			return true
+		}
+	}
+	return false
+}
+
+// FeatureStrings returns the negotiated features as strings, e.g. for
+// storing them in the session.
+func (c *Capabilities) FeatureStrings() []string {
+	out := make([]string, 0, len(c.Features))
+	for _, f := range c.Features {
+		out = append(out, string(f))
+	}
+	return out
+}
+
+func isSupportedFeature(f Feature) bool {
+	for _, elem := range SupportedFeatures {
+		if elem == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewHelloDetails(t *testing.T) {
+	tests := []struct {
+		name    string
+		details interface{}
+		want    *HelloDetails
+	}{
+		{
+			name:    "no details",
+			details: nil,
+			want:    &HelloDetails{ProtocolVersion: ProtocolVersion1, Firmware: &FirmwareInfo{}},
+		},
+		{
+			name:    "empty details",
+			details: map[string]interface{}{},
+			want:    &HelloDetails{ProtocolVersion: ProtocolVersion1, Firmware: &FirmwareInfo{}},
+		},
+		{
+			name:    "details of another type",
+			details: "firmware 1.2",
+			want:    &HelloDetails{ProtocolVersion: ProtocolVersion1, Firmware: &FirmwareInfo{}},
+		},
+		{
+			name: "version 2 details",
+			details: map[string]interface{}{
+				"protocol_version": float64(2),
+				"features":         []interface{}{"call_cancel", "streams"},
+				"firmware":         map[string]interface{}{"version": "2.1.0", "hardware_model": "M3"},
+				"device":           map[string]interface{}{"serial_number": "S123", "hostname": "router"},
+			},
+			want: &HelloDetails{
+				ProtocolVersion: ProtocolVersion2,
+				Features:        []Feature{FeatureCallCancel, FeatureStreams},
+				Firmware:        &FirmwareInfo{Version: "2.1.0", HardwareModel: "M3"},
+				Device:          &DeviceInfo{SerialNumber: "S123", Hostname: "router"},
+			},
+		},
+		{
+			name: "free-form details of an old firmware",
+			details: map[string]interface{}{
+				"firmware": "1.2",
+				"device":   float64(42),
+				"uptime":   float64(3600),
+			},
+			want: &HelloDetails{ProtocolVersion: ProtocolVersion1, Firmware: &FirmwareInfo{}},
+		},
+		{
+			name: "fields of the wrong type are ignored",
+			details: map[string]interface{}{
+				"protocol_version": "2",
+				"features":         []interface{}{"streams", float64(1), nil},
+				"firmware":         map[string]interface{}{"version": float64(1.2), "hardware_model": "M3"},
+			},
+			want: &HelloDetails{
+				ProtocolVersion: ProtocolVersion1,
+				Features:        []Feature{FeatureStreams},
+				Firmware:        &FirmwareInfo{HardwareModel: "M3"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NewHelloDetails(tc.details); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("NewHelloDetails = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		details *HelloDetails
+		want    *Capabilities
+	}{
+		{
+			name:    "version 1 client gets no features",
+			details: &HelloDetails{ProtocolVersion: ProtocolVersion1, Features: []Feature{FeatureStreams}},
+			want:    &Capabilities{ProtocolVersion: ProtocolVersion1, Features: []Feature{}},
+		},
+		{
+			name:    "newer client is downgraded",
+			details: &HelloDetails{ProtocolVersion: 7, Features: []Feature{FeatureStreams}},
+			want:    &Capabilities{ProtocolVersion: ProtocolVersion, Features: []Feature{FeatureStreams}},
+		},
+		{
+			name: "unknown and duplicate features are dropped",
+			details: &HelloDetails{ProtocolVersion: ProtocolVersion2,
+				Features: []Feature{"teleport", FeatureCallCancel, FeatureCallCancel, FeatureEventDelivery, FeatureCallTrace}},
+			want: &Capabilities{ProtocolVersion: ProtocolVersion2,
+				Features: []Feature{FeatureCallCancel, FeatureEventDelivery, FeatureCallTrace}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NegotiateCapabilities(tc.details); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("NegotiateCapabilities = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesHasFeature(t *testing.T) {
+	var none *Capabilities
+	if none.HasFeature(FeatureStreams) {
+		t.Error("nil capabilities must not have features")
+	}
+
+	c := &Capabilities{ProtocolVersion: ProtocolVersion2, Features: []Feature{FeatureStreams}}
+	if !c.HasFeature(FeatureStreams) || c.HasFeature(FeatureCallCancel) {
+		t.Errorf("HasFeature of %v is wrong", c.Features)
+	}
+}
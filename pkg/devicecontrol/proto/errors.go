@@ -10,6 +10,15 @@ const ErrReasonTechnicalException ErrorReason = "ERR_TECHNICAL_EXCEPTION"
 const ErrReasonNoSuchRelam ErrorReason = "ERR_NO_SUCH_REALM"
 const ErrReasonPublishFailed ErrorReason = "ERR_PUBLISH_FAILED"
 const ErrReasonSessionExists ErrorReason = "ERR_SESSION_EXISTS"
+const ErrReasonResultTimeout ErrorReason = "ERR_RESULT_TIMEOUT"
+const ErrReasonCancelled ErrorReason = "ERR_CANCELLED"
+const ErrReasonNoSuchCall ErrorReason = "ERR_NO_SUCH_CALL"
+const ErrReasonFeatureNotSupported ErrorReason = "ERR_FEATURE_NOT_SUPPORTED"
+const ErrReasonStreamClosed ErrorReason = "ERR_STREAM_CLOSED"
+const ErrReasonIdleTimeout ErrorReason = "ERR_IDLE_TIMEOUT"
+const ErrReasonDeviceInMaintenance ErrorReason = "ERR_DEVICE_IN_MAINTENANCE"
+const ErrReasonServerDraining ErrorReason = "ERR_SERVER_DRAINING"
+const ErrReasonTemporarilyUnavailable ErrorReason = "ERR_TEMPORARILY_UNAVAILABLE"
 
 func (e ErrorReason) String() string {
 	return string(e)
@@ -1,73 +1,131 @@
 package proto
 
-import (
-	"encoding/json"
-	"fmt"
-)
+import "fmt"
 
-func (m HelloMessage) Marshal() ([]byte, error) {
+func (m HelloMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 3)
 	envelope[0] = int(MessageTypeHello)
 	envelope[1] = m.Realm
 	envelope[2] = ensureEmptyDictIfNil(m.Details)
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m WelcomeMessage) Marshal() ([]byte, error) {
+func (m HelloMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m WelcomeMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 3)
 	envelope[0] = int(MessageTypeWelcome)
 	envelope[1] = m.SessionID
 	envelope[2] = ensureEmptyDictIfNil(m.Details)
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m AbortMessage) Marshal() ([]byte, error) {
+func (m WelcomeMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m AbortMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 3)
 	envelope[0] = int(MessageTypeAbort)
 	envelope[1] = m.Reason
 	envelope[2] = ensureEmptyDictIfNil(m.Details)
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m PingMessage) Marshal() ([]byte, error) {
+func (m AbortMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m PingMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 2)
 	envelope[0] = int(MessageTypePing)
 	envelope[1] = ensureEmptyDictIfNil(m.Details)
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m PongMessage) Marshal() ([]byte, error) {
+func (m PingMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m PongMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 2)
 	envelope[0] = int(MessageTypePong)
 	envelope[1] = ensureEmptyDictIfNil(m.Details)
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m CallMessage) Marshal() ([]byte, error) {
-	envelope := make([]interface{}, 4)
+func (m PongMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m CallMessage) envelope() []interface{} {
+	// The details are omitted if there are none to stay compatible with
+	// clients that expect four elements.
+	size := 4
+	if m.Details != nil {
+		size = 5
+	}
+
+	envelope := make([]interface{}, size)
 	envelope[0] = int(MessageTypeCall)
 	envelope[1] = m.RequestID
 	envelope[2] = m.Operation
 	envelope[3] = ensureEmptyDictIfNil(m.Arguments)
+	if m.Details != nil {
+		envelope[4] = m.Details
+	}
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m ResultMessage) Marshal() ([]byte, error) {
-	envelope := make([]interface{}, 3)
+func (m CallMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m ResultMessage) envelope() []interface{} {
+	// The details are omitted for final results to stay compatible with
+	// clients that don't support progressive results.
+	size := 3
+	if m.Progress {
+		size = 4
+	}
+
+	envelope := make([]interface{}, size)
 	envelope[0] = int(MessageTypeResult)
 	envelope[1] = m.RequestID
 	envelope[2] = ensureEmptyDictIfNil(m.Results)
+	if m.Progress {
+		envelope[3] = NewResultMessageDetails(m.Progress)
+	}
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m ErrorMessage) Marshal() ([]byte, error) {
+func (m ResultMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m CancelMessage) envelope() []interface{} {
+	envelope := make([]interface{}, 3)
+	envelope[0] = int(MessageTypeCancel)
+	envelope[1] = m.RequestID
+	envelope[2] = ensureEmptyDictIfNil(m.Details)
+
+	return envelope
+}
+
+func (m CancelMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m ErrorMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 5)
 	envelope[0] = int(MessageTypeError)
 	envelope[1] = int(m.MessageType)
@@ -75,63 +133,100 @@ func (m ErrorMessage) Marshal() ([]byte, error) {
 	envelope[3] = m.Error
 	envelope[4] = ensureEmptyDictIfNil(m.Details)
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m PublishMessage) Marshal() ([]byte, error) {
+func (m ErrorMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m PublishMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 4)
 	envelope[0] = int(MessageTypePublish)
 	envelope[1] = m.RequestID
 	envelope[2] = m.Topic
 	envelope[3] = ensureEmptyDictIfNil(m.Arguments)
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
-func (m PublishedMessage) Marshal() ([]byte, error) {
+func (m PublishMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m PublishedMessage) envelope() []interface{} {
 	envelope := make([]interface{}, 3)
 	envelope[0] = int(MessageTypePublished)
 	envelope[1] = m.RequestID
 	envelope[2] = m.PublicationID
 
-	return json.Marshal(envelope)
+	return envelope
 }
 
+func (m PublishedMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m StreamOpenMessage) envelope() []interface{} {
+	envelope := make([]interface{}, 4)
+	envelope[0] = int(MessageTypeStreamOpen)
+	envelope[1] = m.StreamID
+	envelope[2] = m.Kind
+	envelope[3] = ensureEmptyDictIfNil(m.Arguments)
+
+	return envelope
+}
+
+func (m StreamOpenMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m StreamDataMessage) envelope() []interface{} {
+	// The data is encoded as base64 string by the JSON serializer and as
+	// byte string by the binary serializers.
+	envelope := make([]interface{}, 3)
+	envelope[0] = int(MessageTypeStreamData)
+	envelope[1] = m.StreamID
+	envelope[2] = m.Data
+
+	return envelope
+}
+
+func (m StreamDataMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+func (m StreamCloseMessage) envelope() []interface{} {
+	envelope := make([]interface{}, 3)
+	envelope[0] = int(MessageTypeStreamClose)
+	envelope[1] = m.StreamID
+	envelope[2] = ensureEmptyDictIfNil(m.Details)
+
+	return envelope
+}
+
+func (m StreamCloseMessage) Marshal() ([]byte, error) {
+	return JSONSerializer.Marshal(m.envelope())
+}
+
+// envelopeMarshaler is implemented by all messages. It returns the fields of
+// the message in the order they're sent over the wire.
+type envelopeMarshaler interface {
+	envelope() []interface{}
+}
+
+// MarshalMessage encodes the given message as JSON.
 func MarshalMessage(v interface{}) ([]byte, error) {
-	if msg, ok := v.(HelloMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(HelloMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(WelcomeMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(AbortMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(PingMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(PongMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(CallMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(ResultMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(ErrorMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(PublishMessage); ok {
-		return msg.Marshal()
-	}
-	if msg, ok := v.(PublishedMessage); ok {
-		return msg.Marshal()
+	return MarshalMessageWith(JSONSerializer, v)
+}
+
+// MarshalMessageWith encodes the given message with the given serializer.
+func MarshalMessageWith(s Serializer, v interface{}) ([]byte, error) {
+	msg, ok := v.(envelopeMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal an invalid message")
 	}
-	return nil, fmt.Errorf("cannot marshal an invalid message")
+	return s.Marshal(msg.envelope())
 }
 
 func ensureEmptyDictIfNil(v interface{}) interface{} {
@@ -142,39 +237,82 @@ func ensureEmptyDictIfNil(v interface{}) interface{} {
 	return v
 }
 
-func MarshalNewAbortMessage(reason string, details interface{}) ([]byte, error) {
+func MarshalNewAbortMessage(s Serializer, reason string, details interface{}) ([]byte, error) {
 	msg := AbortMessage{Reason: reason, Details: details}
-	return MarshalMessage(msg)
+	return MarshalMessageWith(s, msg)
 }
 
-func MarshalNewErrorMessage(msgType MessageType, requestID int32, reason string, details interface{}) ([]byte, error) {
+func MarshalNewErrorMessage(s Serializer, msgType MessageType, requestID int32, reason string, details interface{}) ([]byte, error) {
 	msg := ErrorMessage{MessageType: msgType, RequestID: requestID, Error: reason, Details: details}
-	return MarshalMessage(msg)
+	return MarshalMessageWith(s, msg)
 }
 
-func MarshalNewWelcomeMessage(sessionID int32, details interface{}) ([]byte, error) {
+func MarshalNewWelcomeMessage(s Serializer, sessionID int32, details interface{}) ([]byte, error) {
 	msg := WelcomeMessage{SessionID: sessionID, Details: details}
-	return MarshalMessage(msg)
+	return MarshalMessageWith(s, msg)
 }
 
-func MarshalNewPongMessage() ([]byte, error) {
+func MarshalNewPongMessage(s Serializer) ([]byte, error) {
 	msg := PongMessage{}
-	return MarshalMessage(msg)
+	return MarshalMessageWith(s, msg)
 }
 
-func MarshalNewPublishedMessage(requestID, publicationID int32) ([]byte, error) {
+func MarshalNewPublishMessage(s Serializer, requestID int32, topic string, arguments interface{}) ([]byte, error) {
+	msg := PublishMessage{
+		RequestID: requestID,
+		Topic:     topic,
+		Arguments: arguments,
+	}
+	return MarshalMessageWith(s, msg)
+}
+
+func MarshalNewPublishedMessage(s Serializer, requestID, publicationID int32) ([]byte, error) {
 	msg := PublishedMessage{
 		RequestID:     requestID,
 		PublicationID: publicationID,
 	}
-	return MarshalMessage(msg)
+	return MarshalMessageWith(s, msg)
 }
 
-func MarshalNewCallMessage(requestID int32, operation string, arguments interface{}) ([]byte, error) {
+func MarshalNewCallMessage(s Serializer, requestID int32, operation string, arguments, details interface{}) ([]byte, error) {
 	msg := CallMessage{
 		RequestID: requestID,
 		Operation: operation,
 		Arguments: arguments,
+		Details:   details,
+	}
+	return MarshalMessageWith(s, msg)
+}
+
+func MarshalNewCancelMessage(s Serializer, requestID int32, details interface{}) ([]byte, error) {
+	msg := CancelMessage{
+		RequestID: requestID,
+		Details:   details,
+	}
+	return MarshalMessageWith(s, msg)
+}
+
+func MarshalNewStreamOpenMessage(s Serializer, streamID int32, kind string, arguments interface{}) ([]byte, error) {
+	msg := StreamOpenMessage{
+		StreamID:  streamID,
+		Kind:      kind,
+		Arguments: arguments,
+	}
+	return MarshalMessageWith(s, msg)
+}
+
+func MarshalNewStreamDataMessage(s Serializer, streamID int32, data []byte) ([]byte, error) {
+	msg := StreamDataMessage{
+		StreamID: streamID,
+		Data:     data,
+	}
+	return MarshalMessageWith(s, msg)
+}
+
+func MarshalNewStreamCloseMessage(s Serializer, streamID int32, details interface{}) ([]byte, error) {
+	msg := StreamCloseMessage{
+		StreamID: streamID,
+		Details:  details,
 	}
-	return MarshalMessage(msg)
+	return MarshalMessageWith(s, msg)
 }
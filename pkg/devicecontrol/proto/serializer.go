@@ -0,0 +1,190 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Websocket subprotocols which are used by a client to select the encoding
+// of the control channel messages during the upgrade. A client that doesn't
+// request a subprotocol speaks JSON.
+const (
+	SubprotocolJSON        = "devicecontrol.v1.json"
+	SubprotocolMessagePack = "devicecontrol.v1.msgpack"
+	SubprotocolCBOR        = "devicecontrol.v1.cbor"
+)
+
+// Serializer encodes and decodes a message envelope, i.e. the array of
+// message fields, to and from the wire format.
+type Serializer interface {
+	// Marshal encodes the given envelope.
+	Marshal(envelope []interface{}) ([]byte, error)
+	// Unmarshal decodes the given data into an envelope. The decoded values
+	// follow the JSON data model (float64 numbers, string keyed maps)
+	// regardless of the wire format.
+	Unmarshal(data []byte) ([]interface{}, error)
+	// Binary returns true if the encoded data has to be sent in binary
+	// websocket frames.
+	Binary() bool
+	// Subprotocol returns the websocket subprotocol of the serializer.
+	Subprotocol() string
+}
+
+var (
+	JSONSerializer        Serializer = jsonSerializer{}
+	MessagePackSerializer Serializer = msgpackSerializer{}
+	CBORSerializer        Serializer = cborSerializer{}
+)
+
+var serializers = map[string]Serializer{
+	SubprotocolJSON:        JSONSerializer,
+	SubprotocolMessagePack: MessagePackSerializer,
+	SubprotocolCBOR:        CBORSerializer,
+}
+
+// SerializerBySubprotocol returns the serializer for the given websocket
+// subprotocol. An empty subprotocol selects the JSON serializer.
+func SerializerBySubprotocol(subprotocol string) (Serializer, bool) {
+	if subprotocol == "" {
+		return JSONSerializer, true
+	}
+	s, ok := serializers[subprotocol]
+	return s, ok
+}
+
+// IsSupportedSubprotocol returns true if there's a serializer for the given
+// websocket subprotocol.
+func IsSupportedSubprotocol(subprotocol string) bool {
+	_, ok := serializers[subprotocol]
+	return ok
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(envelope []interface{}) ([]byte, error) {
+	return json.Marshal(envelope)
+}
+
+func (jsonSerializer) Unmarshal(data []byte) ([]interface{}, error) {
+	var envelope []interface{}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+func (jsonSerializer) Binary() bool {
+	return false
+}
+
+func (jsonSerializer) Subprotocol() string {
+	return SubprotocolJSON
+}
+
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Marshal(envelope []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf).UseJSONTag(true).UseCompactEncoding(true)
+	if err := enc.Encode(envelope); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackSerializer) Unmarshal(data []byte) ([]interface{}, error) {
+	var envelope []interface{}
+	dec := msgpack.NewDecoder(bytes.NewReader(data)).UseJSONTag(true)
+	if err := dec.Decode(&envelope); err != nil {
+		return nil, err
+	}
+	return normalizeEnvelope(envelope), nil
+}
+
+func (msgpackSerializer) Binary() bool {
+	return true
+}
+
+func (msgpackSerializer) Subprotocol() string {
+	return SubprotocolMessagePack
+}
+
+type cborSerializer struct{}
+
+func (cborSerializer) Marshal(envelope []interface{}) ([]byte, error) {
+	return cbor.Marshal(envelope, cbor.EncOptions{})
+}
+
+func (cborSerializer) Unmarshal(data []byte) ([]interface{}, error) {
+	var envelope []interface{}
+	if err := cbor.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	return normalizeEnvelope(envelope), nil
+}
+
+func (cborSerializer) Binary() bool {
+	return true
+}
+
+func (cborSerializer) Subprotocol() string {
+	return SubprotocolCBOR
+}
+
+func normalizeEnvelope(envelope []interface{}) []interface{} {
+	for i, v := range envelope {
+		envelope[i] = normalize(v)
+	}
+	return envelope
+}
+
+// normalize converts values decoded by a binary serializer to the types
+// encoding/json produces. The unmarshal functions and everything behind the
+// control channel, e.g. the NATS messages, rely on the JSON data model.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case int8:
+		return float64(t)
+	case int16:
+		return float64(t)
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case int:
+		return float64(t)
+	case uint8:
+		return float64(t)
+	case uint16:
+		return float64(t)
+	case uint32:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case uint:
+		return float64(t)
+	case float32:
+		return float64(t)
+	case []interface{}:
+		for i, elem := range t {
+			t[i] = normalize(elem)
+		}
+		return t
+	case map[string]interface{}:
+		for k, elem := range t {
+			t[k] = normalize(elem)
+		}
+		return t
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, elem := range t {
+			m[fmt.Sprint(k)] = normalize(elem)
+		}
+		return m
+	}
+	return v
+}
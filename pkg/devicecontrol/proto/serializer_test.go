@@ -0,0 +1,94 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSerializerRoundTrip(t *testing.T) {
+	arguments := map[string]interface{}{
+		"count":   float64(3),
+		"ratio":   1.5,
+		"name":    "eth0",
+		"enabled": true,
+		"tags":    []interface{}{"a", float64(-1)},
+		"nested":  map[string]interface{}{"depth": float64(2)},
+	}
+
+	messages := []struct {
+		name    string
+		msgType MessageType
+		msg     interface{}
+	}{
+		{"call", MessageTypeCall, CallMessage{RequestID: 7, Operation: "reboot", Arguments: arguments}},
+		{"call with details", MessageTypeCall, CallMessage{RequestID: 7, Operation: "reboot", Arguments: arguments,
+			Details: map[string]interface{}{"trace_id": "0af7651916cd43dd8448eb211c80319c"}}},
+		{"result", MessageTypeResult, ResultMessage{RequestID: 7, Results: arguments}},
+		{"progressive result", MessageTypeResult, ResultMessage{RequestID: 7, Results: arguments, Progress: true}},
+		{"publish", MessageTypePublish, PublishMessage{RequestID: 9, Topic: "status", Arguments: arguments}},
+		{"published", MessageTypePublished, PublishedMessage{RequestID: 9, PublicationID: 1234}},
+		{"stream data", MessageTypeStreamData, StreamDataMessage{StreamID: 3, Data: []byte{0x00, 0xff, 0x10, 'a'}}},
+	}
+
+	for _, s := range []Serializer{JSONSerializer, MessagePackSerializer, CBORSerializer} {
+		for _, tc := range messages {
+			t.Run(s.Subprotocol()+"/"+tc.name, func(t *testing.T) {
+				data, err := MarshalMessageWith(s, tc.msg)
+				if err != nil {
+					t.Fatalf("marshal failed: %s", err)
+				}
+
+				msgType, msg, err := UnmarshalMessageWith(s, data)
+				if err != nil {
+					t.Fatalf("unmarshal failed: %s", err)
+				}
+				if msgType != tc.msgType {
+					t.Errorf("message type = %v, want %v", msgType, tc.msgType)
+				}
+				if !reflect.DeepEqual(msg, tc.msg) {
+					t.Errorf("message = %#v, want %#v", msg, tc.msg)
+				}
+			})
+		}
+	}
+}
+
+func TestSerializerBySubprotocol(t *testing.T) {
+	tests := []struct {
+		subprotocol string
+		want        Serializer
+		ok          bool
+	}{
+		{"", JSONSerializer, true},
+		{SubprotocolJSON, JSONSerializer, true},
+		{SubprotocolMessagePack, MessagePackSerializer, true},
+		{SubprotocolCBOR, CBORSerializer, true},
+		{"devicecontrol.v2.json", nil, false},
+	}
+
+	for _, tc := range tests {
+		s, ok := SerializerBySubprotocol(tc.subprotocol)
+		if ok != tc.ok || s != tc.want {
+			t.Errorf("SerializerBySubprotocol(%q) = %v, %v, want %v, %v", tc.subprotocol, s, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	in := map[interface{}]interface{}{
+		"a":     int8(1),
+		"b":     uint64(2),
+		"c":     float32(0.5),
+		int8(3): []interface{}{int32(4), map[interface{}]interface{}{"d": uint16(5)}},
+	}
+	want := map[string]interface{}{
+		"a": float64(1),
+		"b": float64(2),
+		"c": float64(0.5),
+		"3": []interface{}{float64(4), map[string]interface{}{"d": float64(5)}},
+	}
+
+	if got := normalize(in); !reflect.DeepEqual(got, want) {
+		t.Errorf("normalize = %#v, want %#v", got, want)
+	}
+}
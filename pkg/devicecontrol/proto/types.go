@@ -3,31 +3,39 @@ package proto
 type MessageType int
 
 const (
-	MessageTypeInvalid   MessageType = 0
-	MessageTypeHello     MessageType = 1
-	MessageTypeWelcome   MessageType = 2
-	MessageTypeAbort     MessageType = 3
-	MessageTypePing      MessageType = 4
-	MessageTypePong      MessageType = 5
-	MessageTypeError     MessageType = 9
-	MessageTypeCall      MessageType = 10
-	MessageTypeResult    MessageType = 11
-	MessageTypePublish   MessageType = 20
-	MessageTypePublished MessageType = 21
+	MessageTypeInvalid     MessageType = 0
+	MessageTypeHello       MessageType = 1
+	MessageTypeWelcome     MessageType = 2
+	MessageTypeAbort       MessageType = 3
+	MessageTypePing        MessageType = 4
+	MessageTypePong        MessageType = 5
+	MessageTypeError       MessageType = 9
+	MessageTypeCall        MessageType = 10
+	MessageTypeResult      MessageType = 11
+	MessageTypeCancel      MessageType = 12
+	MessageTypePublish     MessageType = 20
+	MessageTypePublished   MessageType = 21
+	MessageTypeStreamOpen  MessageType = 30
+	MessageTypeStreamData  MessageType = 31
+	MessageTypeStreamClose MessageType = 32
 )
 
 func (msgType MessageType) String() string {
 	names := map[MessageType]string{
-		MessageTypeHello:     "HELLO",
-		MessageTypeWelcome:   "WELCOME",
-		MessageTypeAbort:     "ABORT",
-		MessageTypePing:      "PING",
-		MessageTypePong:      "PONG",
-		MessageTypeError:     "ERROR",
-		MessageTypeCall:      "CALL",
-		MessageTypeResult:    "RESULT",
-		MessageTypePublish:   "PUBLISH",
-		MessageTypePublished: "PUBLISHED"}
+		MessageTypeHello:       "HELLO",
+		MessageTypeWelcome:     "WELCOME",
+		MessageTypeAbort:       "ABORT",
+		MessageTypePing:        "PING",
+		MessageTypePong:        "PONG",
+		MessageTypeError:       "ERROR",
+		MessageTypeCall:        "CALL",
+		MessageTypeResult:      "RESULT",
+		MessageTypeCancel:      "CANCEL",
+		MessageTypePublish:     "PUBLISH",
+		MessageTypePublished:   "PUBLISHED",
+		MessageTypeStreamOpen:  "STREAM_OPEN",
+		MessageTypeStreamData:  "STREAM_DATA",
+		MessageTypeStreamClose: "STREAM_CLOSE"}
 
 	msgTypeName, ok := names[msgType]
 	if !ok {
@@ -64,11 +72,21 @@ type CallMessage struct {
 	RequestID int32
 	Operation string
 	Arguments interface{}
+	Details   interface{}
 }
 
 type ResultMessage struct {
 	RequestID int32
 	Results   interface{}
+	// Progress is true for a progressive result. The device sends further
+	// results for the same request until it sends a result without the
+	// progress flag.
+	Progress bool
+}
+
+type CancelMessage struct {
+	RequestID int32
+	Details   interface{}
 }
 
 type ErrorMessage struct {
@@ -88,3 +106,21 @@ type PublishedMessage struct {
 	RequestID     int32
 	PublicationID int32
 }
+
+// StreamOpenMessage opens a bidirectional byte stream on the session, e.g.
+// an interactive CLI. Streams are multiplexed by their ID.
+type StreamOpenMessage struct {
+	StreamID  int32
+	Kind      string
+	Arguments interface{}
+}
+
+type StreamDataMessage struct {
+	StreamID int32
+	Data     []byte
+}
+
+type StreamCloseMessage struct {
+	StreamID int32
+	Details  interface{}
+}
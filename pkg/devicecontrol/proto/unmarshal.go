@@ -1,7 +1,7 @@
 package proto
 
 import (
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
 )
 
@@ -15,8 +15,12 @@ func unmarshalMessageType(v interface{}) (MessageType, error) {
 		9:  MessageTypeError,
 		10: MessageTypeCall,
 		11: MessageTypeResult,
+		12: MessageTypeCancel,
 		20: MessageTypePublish,
-		21: MessageTypePublished}
+		21: MessageTypePublished,
+		30: MessageTypeStreamOpen,
+		31: MessageTypeStreamData,
+		32: MessageTypeStreamClose}
 
 	i, ok := v.(float64)
 	if !ok {
@@ -31,10 +35,15 @@ func unmarshalMessageType(v interface{}) (MessageType, error) {
 	return msgType, nil
 }
 
+// UnmarshalMessage decodes the given JSON encoded message.
 func UnmarshalMessage(data []byte) (MessageType, interface{}, error) {
-	var envelope []interface{}
+	return UnmarshalMessageWith(JSONSerializer, data)
+}
 
-	if err := json.Unmarshal(data, &envelope); err != nil {
+// UnmarshalMessageWith decodes the given message with the given serializer.
+func UnmarshalMessageWith(s Serializer, data []byte) (MessageType, interface{}, error) {
+	envelope, err := s.Unmarshal(data)
+	if err != nil {
 		return MessageTypeInvalid, nil, fmt.Errorf("devicecontrol: invalid message data: %s", err.Error())
 	}
 
@@ -64,10 +73,18 @@ func UnmarshalMessage(data []byte) (MessageType, interface{}, error) {
 		return unmarshalCallMessage(envelope)
 	case MessageTypeResult:
 		return unmarshalResultMessage(envelope)
+	case MessageTypeCancel:
+		return unmarshalCancelMessage(envelope)
 	case MessageTypePublish:
 		return unmarshalPublishMessage(envelope)
 	case MessageTypePublished:
 		return unmarshalPublishedMessage(envelope)
+	case MessageTypeStreamOpen:
+		return unmarshalStreamOpenMessage(envelope)
+	case MessageTypeStreamData:
+		return unmarshalStreamDataMessage(envelope)
+	case MessageTypeStreamClose:
+		return unmarshalStreamCloseMessage(envelope)
 	}
 
 	// This return should never be reached
@@ -182,20 +199,24 @@ func unmarshalCallMessage(envelope []interface{}) (MessageType, interface{}, err
 		return MessageTypeInvalid, nil, fmt.Errorf("call message contains invalid operation type")
 	}
 
-	var args interface{}
-	if len(envelope) == 4 {
+	var args, details interface{}
+	if len(envelope) >= 4 {
 		args = envelope[3]
 	}
+	if len(envelope) == 5 {
+		details = envelope[4]
+	}
 
 	return MessageTypeCall, CallMessage{
 		RequestID: int32(reqID),
 		Operation: op,
 		Arguments: args,
+		Details:   details,
 	}, nil
 }
 
 func unmarshalResultMessage(envelope []interface{}) (MessageType, interface{}, error) {
-	if len(envelope) != 3 {
+	if len(envelope) != 3 && len(envelope) != 4 {
 		return MessageTypeInvalid, nil, fmt.Errorf("incomplete result message")
 	}
 
@@ -204,9 +225,45 @@ func unmarshalResultMessage(envelope []interface{}) (MessageType, interface{}, e
 		return MessageTypeInvalid, nil, fmt.Errorf("result message contains invalid request ID type")
 	}
 
+	var progress bool
+	if len(envelope) == 4 {
+		details, ok := envelope[3].(map[string]interface{})
+		if !ok {
+			return MessageTypeInvalid, nil, fmt.Errorf("result message contains invalid details type")
+		}
+		if v, ok := details["progress"]; ok {
+			progress, ok = v.(bool)
+			if !ok {
+				return MessageTypeInvalid, nil, fmt.Errorf("result message contains invalid progress type")
+			}
+		}
+	}
+
 	return MessageTypeResult, ResultMessage{
 		RequestID: int32(reqID),
 		Results:   envelope[2],
+		Progress:  progress,
+	}, nil
+}
+
+func unmarshalCancelMessage(envelope []interface{}) (MessageType, interface{}, error) {
+	if len(envelope) < 2 {
+		return MessageTypeInvalid, nil, fmt.Errorf("incomplete cancel message")
+	}
+
+	reqID, ok := envelope[1].(float64)
+	if !ok {
+		return MessageTypeInvalid, nil, fmt.Errorf("cancel message contains invalid request ID type")
+	}
+
+	var details interface{}
+	if len(envelope) == 3 {
+		details = envelope[2]
+	}
+
+	return MessageTypeCancel, CancelMessage{
+		RequestID: int32(reqID),
+		Details:   details,
 	}, nil
 }
 
@@ -285,3 +342,82 @@ func unmarshalPublishedMessage(envelope []interface{}) (MessageType, interface{}
 		PublicationID: int32(pubID),
 	}, nil
 }
+
+func unmarshalStreamOpenMessage(envelope []interface{}) (MessageType, interface{}, error) {
+	if len(envelope) < 3 {
+		return MessageTypeInvalid, nil, fmt.Errorf("incomplete stream open message")
+	}
+
+	streamID, ok := envelope[1].(float64)
+	if !ok {
+		return MessageTypeInvalid, nil, fmt.Errorf("stream open message contains invalid stream ID type")
+	}
+
+	kind, ok := envelope[2].(string)
+	if !ok {
+		return MessageTypeInvalid, nil, fmt.Errorf("stream open message contains invalid kind type")
+	}
+
+	var args interface{}
+	if len(envelope) == 4 {
+		args = envelope[3]
+	}
+
+	return MessageTypeStreamOpen, StreamOpenMessage{
+		StreamID:  int32(streamID),
+		Kind:      kind,
+		Arguments: args,
+	}, nil
+}
+
+func unmarshalStreamDataMessage(envelope []interface{}) (MessageType, interface{}, error) {
+	if len(envelope) != 3 {
+		return MessageTypeInvalid, nil, fmt.Errorf("incomplete stream data message")
+	}
+
+	streamID, ok := envelope[1].(float64)
+	if !ok {
+		return MessageTypeInvalid, nil, fmt.Errorf("stream data message contains invalid stream ID type")
+	}
+
+	var data []byte
+	switch v := envelope[2].(type) {
+	case []byte:
+		data = v
+	case string:
+		// JSON encodes the data as base64 string
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return MessageTypeInvalid, nil, fmt.Errorf("stream data message contains invalid base64 data")
+		}
+		data = b
+	default:
+		return MessageTypeInvalid, nil, fmt.Errorf("stream data message contains invalid data type")
+	}
+
+	return MessageTypeStreamData, StreamDataMessage{
+		StreamID: int32(streamID),
+		Data:     data,
+	}, nil
+}
+
+func unmarshalStreamCloseMessage(envelope []interface{}) (MessageType, interface{}, error) {
+	if len(envelope) < 2 {
+		return MessageTypeInvalid, nil, fmt.Errorf("incomplete stream close message")
+	}
+
+	streamID, ok := envelope[1].(float64)
+	if !ok {
+		return MessageTypeInvalid, nil, fmt.Errorf("stream close message contains invalid stream ID type")
+	}
+
+	var details interface{}
+	if len(envelope) == 3 {
+		details = envelope[2]
+	}
+
+	return MessageTypeStreamClose, StreamCloseMessage{
+		StreamID: int32(streamID),
+		Details:  details,
+	}, nil
+}
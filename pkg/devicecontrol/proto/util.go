@@ -20,6 +20,15 @@ func MustPublishMessage(v interface{}) (*PublishMessage, error) {
 	return &msg, nil
 }
 
+func MustPublishedMessage(v interface{}) (*PublishedMessage, error) {
+	msg, ok := v.(PublishedMessage)
+	if !ok {
+		return nil, fmt.Errorf("not a published message")
+	}
+
+	return &msg, nil
+}
+
 func MustResultMessage(v interface{}) (*ResultMessage, error) {
 	msg, ok := v.(ResultMessage)
 	if !ok {
@@ -37,3 +46,21 @@ func MustErrorMessage(v interface{}) (*ErrorMessage, error) {
 
 	return &msg, nil
 }
+
+func MustStreamDataMessage(v interface{}) (*StreamDataMessage, error) {
+	msg, ok := v.(StreamDataMessage)
+	if !ok {
+		return nil, fmt.Errorf("not a stream data message")
+	}
+
+	return &msg, nil
+}
+
+func MustStreamCloseMessage(v interface{}) (*StreamCloseMessage, error) {
+	msg, ok := v.(StreamCloseMessage)
+	if !ok {
+		return nil, fmt.Errorf("not a stream close message")
+	}
+
+	return &msg, nil
+}
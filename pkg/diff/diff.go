@@ -0,0 +1,205 @@
+// Package diff creates line based differences of texts in the unified
+// format.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines around the changes
+const DefaultContext = 3
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+// op is a line of the edit script. aPos and bPos are the number of lines of
+// both texts before the line.
+type op struct {
+	kind opKind
+	text string
+	aPos int
+	bPos int
+}
+
+// Unified returns the unified diff of the texts a and b. The result is empty
+// if both texts are equal.
+func Unified(fromName, toName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+
+	ops := editScript(splitLines(a), splitLines(b))
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(ops); {
+		// Find the next change
+		for i < len(ops) && ops[i].kind == opEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while the gap to the next change is covered by
+		// the context of both changes.
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != opEqual {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == opEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+		end += context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		writeHunk(sb, ops[start:end])
+		i = end
+	}
+
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []op) {
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			aLen++
+		}
+		if o.kind != opDelete {
+			bLen++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(ops[0].aPos, aLen), hunkRange(ops[0].bPos, bLen))
+	for _, o := range ops {
+		sb.WriteByte(byte(o.kind))
+		sb.WriteString(o.text)
+		sb.WriteByte('\n')
+	}
+}
+
+// hunkRange formats the range like GNU diff. An empty range refers to the
+// line before.
+func hunkRange(pos, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", pos)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", pos+1)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, n)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// editScript returns the shortest edit script by the algorithm of Myers, "An
+// O(ND) Difference Algorithm and Its Variations".
+func editScript(a, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// trace contains the furthest reaching x of the diagonals -d..d before
+	// round d, it's needed to walk the path back.
+	trace := make([][]int, 0)
+
+	var x, y int
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		done := false
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// Walk back from the end to the start
+	reversed := make([]op, 0, max)
+	x, y = n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, op{kind: opEqual, text: a[x], aPos: x, bPos: y})
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, op{kind: opInsert, text: b[y], aPos: x, bPos: y})
+		} else {
+			x--
+			reversed = append(reversed, op{kind: opDelete, text: a[x], aPos: x, bPos: y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, op{kind: opEqual, text: a[x], aPos: x, bPos: y})
+	}
+
+	ops := make([]op, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		ops = append(ops, reversed[i])
+	}
+
+	return ops
+}
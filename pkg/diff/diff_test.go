@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", DefaultContext, ""},
+		{"both empty", "", "", DefaultContext, ""},
+		{"from empty", "", "a\nb\n", DefaultContext,
+			"--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"to empty", "a\nb\n", "", DefaultContext,
+			"--- a\n+++ b\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n", DefaultContext,
+			"--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"appended line", "a\nb\n", "a\nb\nc\n", 1,
+			"--- a\n+++ b\n@@ -2 +2,2 @@\n b\n+c\n"},
+		{"inserted line without context", "a\nc\n", "a\nb\nc\n", 0,
+			"--- a\n+++ b\n@@ -1,0 +2 @@\n+b\n"},
+		{"missing trailing newline", "a\nb", "a\nc", DefaultContext,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n"},
+		{"distant changes", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "X\n2\n3\n4\n5\n6\n7\n8\nY\n", 1,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n-1\n+X\n 2\n@@ -8,2 +8,2 @@\n 8\n-9\n+Y\n"},
+		{"close changes share a hunk", "1\n2\n3\n4\n5\n", "X\n2\n3\n4\nY\n", 2,
+			"--- a\n+++ b\n@@ -1,5 +1,5 @@\n-1\n+X\n 2\n 3\n 4\n-5\n+Y\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Unified("a", "b", tc.a, tc.b, tc.context); got != tc.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEditScript(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "c", "d"}
+	random := func() []string {
+		lines := make([]string, r.Intn(12))
+		for i := range lines {
+			lines[i] = words[r.Intn(len(words))]
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		ops := editScript(a, b)
+
+		// The script has to turn a into b with the minimum of changes
+		var gotA, gotB []string
+		changes := 0
+		for _, o := range ops {
+			if o.kind != opInsert {
+				gotA = append(gotA, o.text)
+			}
+			if o.kind != opDelete {
+				gotB = append(gotB, o.text)
+			}
+			if o.kind != opEqual {
+				changes++
+			}
+		}
+		if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+			t.Fatalf("edit script of %q and %q is %v", a, b, ops)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); changes != want {
+			t.Fatalf("edit script of %q and %q has %d changes, want %d", a, b, changes, want)
+		}
+	}
+}
+
+// lcsLength returns the length of the longest common subsequence
+func lcsLength(a, b []string) int {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				l[i][j] = l[i+1][j+1] + 1
+			} else if l[i+1][j] > l[i][j+1] {
+				l[i][j] = l[i+1][j]
+			} else {
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+	return l[0][0]
+}
@@ -0,0 +1,109 @@
+// Package eventstream publishes the events of the devicecontrol server. By
+// default the events are published on core NATS. In durable mode they are
+// captured by a JetStream stream and every publish waits for the
+// acknowledgement of the stream, so downstream services can consume the
+// events with durable consumers.
+package eventstream
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Subjects are the subjects captured by the stream
+const Subjects = "iotcore.devicecontrol.v1.*.events.>"
+
+// publishTimeout limits the time to wait for the acknowledgement
+const publishTimeout = 5 * time.Second
+
+// Publisher publishes the events
+type Publisher struct {
+	nc *nats.Conn
+	js nats.JetStreamContext
+}
+
+// NewPublisher creates a publisher for core NATS
+func NewPublisher(nc *nats.Conn) *Publisher {
+	return &Publisher{nc: nc}
+}
+
+// NewDurablePublisher creates or updates the stream and returns a publisher
+// waiting for the acknowledgements of the stream. The stream keeps the events
+// for maxAge, forever if it's 0.
+func NewDurablePublisher(nc *nats.Conn, stream string, maxAge time.Duration) (*Publisher, error) {
+	js, err := nc.JetStream(nats.MaxWait(publishTimeout))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create JetStream context")
+	}
+
+	cfg := &nats.StreamConfig{
+		Name:      stream,
+		Subjects:  []string{Subjects},
+		Retention: nats.LimitsPolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    maxAge,
+	}
+
+	_, err = js.StreamInfo(stream)
+	if err == nats.ErrStreamNotFound {
+		if _, err := js.AddStream(cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to create stream '%s'", stream)
+		}
+		log.Infof("eventstream created stream '%s'", stream)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch stream '%s'", stream)
+	} else if _, err := js.UpdateStream(cfg); err != nil {
+		return nil, errors.Wrapf(err, "failed to update stream '%s'", stream)
+	}
+
+	return &Publisher{nc: nc, js: js}, nil
+}
+
+// Durable returns true if the events are published to the stream
+func (p *Publisher) Durable() bool {
+	return p.js != nil
+}
+
+// Publish publishes the event. In durable mode it blocks until the stream
+// acknowledged the event.
+func (p *Publisher) Publish(subj string, data []byte) error {
+	if p.js == nil {
+		return p.nc.Publish(subj, data)
+	}
+
+	if _, err := p.js.Publish(subj, data); err != nil {
+		return errors.Wrap(err, "stream didn't acknowledge event")
+	}
+	return nil
+}
+
+// Flush waits until the server received the events published on core NATS,
+// they are buffered by the connection otherwise. Events published to the
+// stream are acknowledged already.
+func (p *Publisher) Flush() error {
+	if p.js != nil {
+		return nil
+	}
+
+	if err := p.nc.FlushTimeout(publishTimeout); err != nil {
+		return errors.Wrap(err, "server didn't receive events")
+	}
+	return nil
+}
+
+// PublishWithID publishes the event like Publish. The stream drops events
+// whose ID it has seen within its duplicate window, so an event published
+// again after a failed acknowledgement is stored once.
+func (p *Publisher) PublishWithID(subj string, data []byte, id string) error {
+	if p.js == nil {
+		return p.nc.Publish(subj, data)
+	}
+
+	if _, err := p.js.Publish(subj, data, nats.MsgId(id)); err != nil {
+		return errors.Wrap(err, "stream didn't acknowledge event")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package eventstream
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+const testStream = "DEVICECONTROL_EVENTS"
+
+// runServer starts an embedded NATS server with JetStream and returns a
+// connection to it
+func runServer(t *testing.T) (*nats.Conn, func()) {
+	dir, err := ioutil.TempDir("", "eventstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  dir,
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nc, func() {
+		nc.Close()
+		s.Shutdown()
+		s.WaitForShutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func streamInfo(t *testing.T, nc *nats.Conn) *nats.StreamInfo {
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := js.StreamInfo(testStream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestNewDurablePublisher(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	p, err := NewDurablePublisher(nc, testStream, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Durable() {
+		t.Error("publisher isn't durable")
+	}
+
+	info := streamInfo(t, nc)
+	if len(info.Config.Subjects) != 1 || info.Config.Subjects[0] != Subjects {
+		t.Errorf("stream subjects = %v, want %s", info.Config.Subjects, Subjects)
+	}
+	if info.Config.MaxAge != time.Hour {
+		t.Errorf("stream max age = %s, want 1h", info.Config.MaxAge)
+	}
+
+	// The existing stream is updated
+	if _, err := NewDurablePublisher(nc, testStream, 0); err != nil {
+		t.Fatal(err)
+	}
+	if info := streamInfo(t, nc); info.Config.MaxAge != 0 {
+		t.Errorf("updated stream max age = %s, want 0", info.Config.MaxAge)
+	}
+
+	if NewPublisher(nc).Durable() {
+		t.Error("core NATS publisher is durable")
+	}
+}
+
+func TestPublish(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	p, err := NewDurablePublisher(nc, testStream, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Publish("iotcore.devicecontrol.v1.default.events.devicestatus", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if info := streamInfo(t, nc); info.State.Msgs != 1 {
+		t.Errorf("stream has %d events, want 1", info.State.Msgs)
+	}
+
+	// Events outside of the stream subjects aren't acknowledged
+	if err := p.Publish("iotcore.devicecontrol.v1.default.call", []byte(`{}`)); err == nil {
+		t.Error("publish outside of the stream subjects succeeded")
+	}
+}
+
+func TestPublishWithID(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	p, err := NewDurablePublisher(nc, testStream, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subj := "iotcore.devicecontrol.v1.default.events.alert"
+	for _, id := range []string{"1", "1", "2", "1"} {
+		if err := p.PublishWithID(subj, []byte(`{}`), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Events published again with the same ID are stored once
+	if info := streamInfo(t, nc); info.State.Msgs != 2 {
+		t.Errorf("stream has %d events, want 2", info.State.Msgs)
+	}
+}
@@ -0,0 +1,666 @@
+// Package filetransfer transfers files to and from devices in chunks. Every
+// chunk is sent by a device call which contains the offset and the checksum
+// of the chunk. Interrupted transfers are resumed from the last acknowledged
+// offset on server start and after the device reconnected. A manager claims
+// a transfer with a lease while running it, therefore only one of multiple
+// servers runs a transfer.
+package filetransfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/client"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Device commands for transferring a file in chunks
+const (
+	CommandWrite = "file.write"
+	CommandRead  = "file.read"
+)
+
+// ChunkSize is the maximum size of the data of a single call. The data is
+// base64 encoded for JSON sessions, therefore we stay well below the
+// websocket frame limits of the devices.
+const ChunkSize = 48 * 1024
+
+// writeArguments are the arguments of the file.write command. The device
+// writes the data at the given offset and truncates the file behind. The
+// last chunk has the final flag and the checksum of the whole file.
+type writeArguments struct {
+	Path         string `json:"path"`
+	Offset       int64  `json:"offset"`
+	Data         []byte `json:"data"`
+	Checksum     string `json:"checksum"`
+	Size         int64  `json:"size"`
+	Final        bool   `json:"final,omitempty"`
+	FileChecksum string `json:"file_checksum,omitempty"`
+}
+
+// transferLease is the time a manager owns a transfer without renewing the
+// claim. The transfers of a manager which has gone are resumed after the
+// lease expired.
+const transferLease = 2 * time.Minute
+
+// queueGroup is the queue group of the device status subscription, only one
+// manager resumes the transfers of a reconnected device
+const queueGroup = "iotcore.devicecontrol.v1.queue.filetransfer"
+
+// errLeaseLost is returned if another manager took over the transfer
+var errLeaseLost = errors.New("lease of the transfer lost")
+
+// ErrFileTooLarge is returned if an upload exceeds the maximum upload size
+var ErrFileTooLarge = errors.New("file exceeds the maximum upload size")
+
+// writeResults contain the offset the device expects next. The offset is nil
+// if the device didn't declare it.
+type writeResults struct {
+	Offset *int64 `json:"offset"`
+}
+
+// readArguments are the arguments of the file.read command
+type readArguments struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// readResults contain a chunk of the file read at the requested offset. The
+// device sets the EOF flag and the checksum of the whole file for the last
+// chunk.
+type readResults struct {
+	Data         []byte `json:"data"`
+	Checksum     string `json:"checksum"`
+	Size         int64  `json:"size"`
+	EOF          bool   `json:"eof"`
+	FileChecksum string `json:"file_checksum,omitempty"`
+}
+
+// Manager runs the file transfers and limits the number of concurrent
+// transfers globally and per device.
+type Manager struct {
+	id           string
+	nc           *nats.Conn
+	store        storage.FileTransferStore
+	sessions     storage.SessionStore
+	client       *client.Client
+	blobDir      string
+	sem          chan struct{}
+	maxPerDevice int
+
+	// maxUploadSize limits the size of uploaded files, 0 disables the limit
+	maxUploadSize int64
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	scheduled map[int32]bool
+	perDevice map[string]int
+
+	sub    *nats.Subscription
+	stopCh chan struct{}
+}
+
+// NewManager creates a new file transfer manager. The files are stored in
+// the given blob directory.
+func NewManager(nc *nats.Conn, store storage.Interface, blobDir string, maxConcurrent, maxPerDevice int, maxUploadSize int64) *Manager {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxPerDevice < 1 {
+		maxPerDevice = 1
+	}
+
+	m := &Manager{
+		id:           nuid.Next(),
+		nc:           nc,
+		store:        store.FileTransfers(),
+		sessions:     store.Sessions(),
+		client:       client.New(nc),
+		blobDir:      blobDir,
+		sem:          make(chan struct{}, maxConcurrent),
+		maxPerDevice: maxPerDevice,
+		scheduled:    make(map[int32]bool),
+		perDevice:    make(map[string]int),
+		stopCh:       make(chan struct{}),
+
+		maxUploadSize: maxUploadSize,
+	}
+	m.cond = sync.NewCond(&m.mu)
+
+	return m
+}
+
+// Start resumes the unfinished transfers and listens for reconnecting
+// devices. The transfers of connected devices whose manager has gone are
+// resumed periodically.
+func (m *Manager) Start() error {
+	if err := os.MkdirAll(m.blobDir, 0750); err != nil {
+		return errors.Wrap(err, "failed to create blob directory")
+	}
+
+	sub, err := m.nc.QueueSubscribe("iotcore.devicecontrol.v1.*.events.devicestatus", queueGroup, m.handleDeviceStatus)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe device status events")
+	}
+	m.sub = sub
+
+	// Transfers which were pending, running or interrupted during shutdown
+	// are resumed now for the connected devices. The transfers of the other
+	// devices are resumed after they reconnected.
+	if err := m.resumeConnected(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(transferLease)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+				if err := m.resumeConnected(); err != nil {
+					log.Error("filetransfer failed to resume transfers: ", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// resumeConnected resumes the unfinished transfers of the connected devices
+func (m *Manager) resumeConnected() error {
+	for _, status := range []string{
+		model.FileTransferStatusPending,
+		model.FileTransferStatusRunning,
+		model.FileTransferStatusInterrupted,
+	} {
+		transfers, err := m.store.FindByStatus(status)
+		if err != nil {
+			return errors.Wrap(err, "failed to find file transfers")
+		}
+		m.resume(transfers, m.isConnected)
+	}
+
+	return nil
+}
+
+// isConnected returns true if the device of the transfer has a session
+func (m *Manager) isConnected(t *model.FileTransfer) bool {
+	_, err := m.sessions.FindByNamespaceAndDeviceID(t.Namespace, t.DeviceID)
+	if err != nil && err != storage.ErrNotFound {
+		log.Error("filetransfer failed to find session: ", err)
+	}
+	return err == nil
+}
+
+// MaxUploadSize returns the maximum size of uploaded files, 0 if the size
+// isn't limited
+func (m *Manager) MaxUploadSize() int64 {
+	return m.maxUploadSize
+}
+
+// Stop stops listening for reconnecting devices
+func (m *Manager) Stop() {
+	close(m.stopCh)
+	if m.sub != nil {
+		m.sub.Unsubscribe()
+	}
+}
+
+// BlobPath returns the path of the file content of the given transfer
+func (m *Manager) BlobPath(t *model.FileTransfer) string {
+	if t.Blob != "" {
+		return t.Blob
+	}
+	return filepath.Join(m.blobDir, fmt.Sprintf("transfer-%d", t.ID))
+}
+
+// Upload stores the content of the given reader in the blob directory and
+// starts transferring it to the given path on the device. ErrFileTooLarge is
+// returned if the content exceeds the maximum upload size.
+func (m *Manager) Upload(namespace, deviceID, path string, r io.Reader) (*model.FileTransfer, error) {
+	tmp, err := ioutil.TempFile(m.blobDir, "upload-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create blob")
+	}
+	defer os.Remove(tmp.Name()) // No-op after successful rename
+
+	if m.maxUploadSize > 0 {
+		r = io.LimitReader(r, m.maxUploadSize+1)
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	tmp.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to write blob")
+	}
+	if m.maxUploadSize > 0 && size > m.maxUploadSize {
+		return nil, ErrFileTooLarge
+	}
+
+	t := &model.FileTransfer{
+		Namespace: namespace,
+		DeviceID:  deviceID,
+		Direction: model.FileTransferDirectionUpload,
+		Path:      path,
+		Size:      size,
+		Checksum:  hex.EncodeToString(h.Sum(nil)),
+		Status:    model.FileTransferStatusPending,
+	}
+	if err := m.store.Create(t); err != nil {
+		return nil, errors.Wrap(err, "failed to create file transfer")
+	}
+
+	if err := os.Rename(tmp.Name(), m.BlobPath(t)); err != nil {
+		m.fail(t, err)
+		return nil, errors.Wrap(err, "failed to store blob")
+	}
+
+	m.schedule(t)
+
+	return t, nil
+}
+
+// UploadBlob starts transferring the content of an existing blob to the
+// given path on the device. The blob is shared by multiple transfers and
+// must not be changed until the transfers are finished.
+func (m *Manager) UploadBlob(namespace, deviceID, path, blob string, size int64, checksum string) (*model.FileTransfer, error) {
+	t := &model.FileTransfer{
+		Namespace: namespace,
+		DeviceID:  deviceID,
+		Direction: model.FileTransferDirectionUpload,
+		Path:      path,
+		Size:      size,
+		Checksum:  checksum,
+		Status:    model.FileTransferStatusPending,
+		Blob:      blob,
+	}
+	if err := m.store.Create(t); err != nil {
+		return nil, errors.Wrap(err, "failed to create file transfer")
+	}
+
+	m.schedule(t)
+
+	return t, nil
+}
+
+// Download starts retrieving the file with the given path from the device
+func (m *Manager) Download(namespace, deviceID, path string) (*model.FileTransfer, error) {
+	t := &model.FileTransfer{
+		Namespace: namespace,
+		DeviceID:  deviceID,
+		Direction: model.FileTransferDirectionDownload,
+		Path:      path,
+		Status:    model.FileTransferStatusPending,
+	}
+	if err := m.store.Create(t); err != nil {
+		return nil, errors.Wrap(err, "failed to create file transfer")
+	}
+
+	m.schedule(t)
+
+	return t, nil
+}
+
+func (m *Manager) handleDeviceStatus(msg *nats.Msg) {
+	ev := struct {
+		SourceID string `json:"source_id"`
+		Details  struct {
+			Status string `json:"status"`
+		} `json:"details"`
+	}{}
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		log.Error("filetransfer failed to unmarshal device status: ", err)
+		return
+	}
+	if ev.Details.Status != "CONNECTED" {
+		return
+	}
+
+	namespace := strings.SplitN(strings.TrimPrefix(msg.Subject, "iotcore.devicecontrol.v1."), ".", 2)[0]
+
+	go func() {
+		transfers, err := m.store.FindByNamespaceAndDeviceID(namespace, ev.SourceID)
+		if err != nil {
+			log.Error("filetransfer failed to find file transfers: ", err)
+			return
+		}
+		m.resume(transfers, func(t *model.FileTransfer) bool { return true })
+	}()
+}
+
+// resume schedules the resumable transfers matching the given filter
+func (m *Manager) resume(transfers map[int32]model.FileTransfer, filter func(t *model.FileTransfer) bool) {
+	now := time.Now()
+	for _, elem := range transfers {
+		t := elem
+		if resumable(&t, now) && filter(&t) {
+			m.schedule(&t)
+		}
+	}
+}
+
+// resumable returns true if the transfer was interrupted or if it's pending
+// or running without a manager holding its lease
+func resumable(t *model.FileTransfer, now time.Time) bool {
+	switch t.Status {
+	case model.FileTransferStatusInterrupted:
+		return true
+	case model.FileTransferStatusPending, model.FileTransferStatusRunning:
+		return t.Owner == "" || !t.LeaseUntil.After(now)
+	default:
+		return false
+	}
+}
+
+// schedule runs the transfer in the background as soon as the concurrency
+// limits allow it. A transfer is scheduled only once at a time.
+func (m *Manager) schedule(t *model.FileTransfer) {
+	m.mu.Lock()
+	if m.scheduled[t.ID] {
+		m.mu.Unlock()
+		return
+	}
+	m.scheduled[t.ID] = true
+	m.mu.Unlock()
+
+	go func() {
+		m.acquire(t.DeviceID)
+		defer m.release(t)
+
+		claimed, err := m.store.Claim(t.ID, m.id, time.Now(), transferLease)
+		if err != nil {
+			log.Errorf("filetransfer failed to claim transfer %d: %s", t.ID, err)
+			return
+		} else if !claimed {
+			log.Debugf("filetransfer %d is run by another manager", t.ID)
+			return
+		}
+		defer func() {
+			if err := m.store.Release(t.ID, m.id); err != nil {
+				log.Errorf("filetransfer failed to release transfer %d: %s", t.ID, err)
+			}
+		}()
+
+		// The transfer may have changed since it was scheduled, e.g. the
+		// previous owner finished it
+		current, err := m.store.FindByID(t.ID)
+		if err != nil {
+			log.Errorf("filetransfer failed to find transfer %d: %s", t.ID, err)
+			return
+		}
+		if current.Status == model.FileTransferStatusCompleted || current.Status == model.FileTransferStatusFailed {
+			return
+		}
+
+		lostCh := make(chan struct{})
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+		go m.renewLease(t.ID, lostCh, doneCh)
+
+		m.run(current, lostCh)
+	}()
+}
+
+// renewLease renews the claim of the transfer until it's done. lostCh is
+// closed if another manager took over the transfer.
+func (m *Manager) renewLease(id int32, lostCh, doneCh chan struct{}) {
+	ticker := time.NewTicker(transferLease / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-doneCh:
+			return
+		case <-ticker.C:
+			claimed, err := m.store.Claim(id, m.id, time.Now(), transferLease)
+			if err != nil {
+				// The lease lasts for some more attempts
+				log.Errorf("filetransfer failed to renew the claim of transfer %d: %s", id, err)
+				continue
+			}
+			if !claimed {
+				close(lostCh)
+				return
+			}
+		}
+	}
+}
+
+func (m *Manager) acquire(deviceID string) {
+	m.mu.Lock()
+	for m.perDevice[deviceID] >= m.maxPerDevice {
+		m.cond.Wait()
+	}
+	m.perDevice[deviceID]++
+	m.mu.Unlock()
+
+	m.sem <- struct{}{}
+}
+
+func (m *Manager) release(t *model.FileTransfer) {
+	<-m.sem
+
+	m.mu.Lock()
+	m.perDevice[t.DeviceID]--
+	if m.perDevice[t.DeviceID] <= 0 {
+		delete(m.perDevice, t.DeviceID)
+	}
+	delete(m.scheduled, t.ID)
+	m.cond.Broadcast()
+	m.mu.Unlock()
+}
+
+func (m *Manager) run(t *model.FileTransfer, lostCh <-chan struct{}) {
+	log.Infof("filetransfer starts %s of '%s' on device '%s' at offset %d",
+		t.Direction, t.Path, t.DeviceID, t.Offset)
+
+	t.Status = model.FileTransferStatusRunning
+	t.Error = ""
+	if err := m.store.Update(t); err != nil {
+		log.Error("filetransfer failed to update transfer: ", err)
+		return
+	}
+
+	var err error
+	switch t.Direction {
+	case model.FileTransferDirectionUpload:
+		err = m.upload(t, lostCh)
+	case model.FileTransferDirectionDownload:
+		err = m.download(t, lostCh)
+	default:
+		err = fmt.Errorf("invalid direction '%s'", t.Direction)
+	}
+
+	if err == errLeaseLost {
+		// The state of the transfer belongs to the new owner now
+		log.Warnf("filetransfer of '%s' on device '%s' taken over by another manager", t.Path, t.DeviceID)
+		return
+	} else if err != nil && client.IsUnavailable(err) {
+		log.Warnf("filetransfer of '%s' on device '%s' interrupted at offset %d: %s",
+			t.Path, t.DeviceID, t.Offset, err)
+		t.Status = model.FileTransferStatusInterrupted
+		t.Error = err.Error()
+		if err := m.store.Update(t); err != nil {
+			log.Error("filetransfer failed to update transfer: ", err)
+		}
+		return
+	} else if err != nil {
+		log.Errorf("filetransfer of '%s' on device '%s' failed: %s", t.Path, t.DeviceID, err)
+		m.fail(t, err)
+		return
+	}
+
+	log.Infof("filetransfer of '%s' on device '%s' completed", t.Path, t.DeviceID)
+	t.Status = model.FileTransferStatusCompleted
+	if err := m.store.Update(t); err != nil {
+		log.Error("filetransfer failed to update transfer: ", err)
+	}
+}
+
+func (m *Manager) fail(t *model.FileTransfer, err error) {
+	t.Status = model.FileTransferStatusFailed
+	t.Error = err.Error()
+	if err := m.store.Update(t); err != nil {
+		log.Error("filetransfer failed to update transfer: ", err)
+	}
+}
+
+// leaseLost returns true if another manager took over the transfer
+func leaseLost(lostCh <-chan struct{}) bool {
+	select {
+	case <-lostCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *Manager) upload(t *model.FileTransfer, lostCh <-chan struct{}) error {
+	f, err := os.Open(m.BlobPath(t))
+	if err != nil {
+		return errors.Wrap(err, "failed to open blob")
+	}
+	defer f.Close()
+
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := f.ReadAt(buf, t.Offset)
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "failed to read blob")
+		}
+
+		if n == 0 && t.Offset < t.Size {
+			return fmt.Errorf("blob is smaller than %d bytes", t.Size)
+		}
+
+		chunk := buf[:n]
+		sum := sha256.Sum256(chunk)
+		args := writeArguments{
+			Path:     t.Path,
+			Offset:   t.Offset,
+			Data:     chunk,
+			Checksum: hex.EncodeToString(sum[:]),
+			Size:     t.Size,
+			Final:    t.Offset+int64(n) >= t.Size,
+		}
+		if args.Final {
+			args.FileChecksum = t.Checksum
+		}
+
+		res := writeResults{}
+		if err := m.client.Call(t.Namespace, t.DeviceID, CommandWrite, args, &res); err != nil {
+			return err
+		}
+		if leaseLost(lostCh) {
+			return errLeaseLost
+		}
+
+		// The device tells us which offset it expects next. That's usually
+		// the end of the chunk, but it may be less if the device lost data,
+		// down to 0 if the device has to start over.
+		next := t.Offset + int64(n)
+		if res.Offset != nil && *res.Offset >= 0 && *res.Offset < next {
+			next = *res.Offset
+		}
+		t.Offset = next
+		if err := m.store.Update(t); err != nil {
+			return errors.Wrap(err, "failed to update transfer")
+		}
+
+		if args.Final && t.Offset >= t.Size {
+			return nil
+		}
+	}
+}
+
+func (m *Manager) download(t *model.FileTransfer, lostCh <-chan struct{}) error {
+	f, err := os.OpenFile(m.BlobPath(t), os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return errors.Wrap(err, "failed to open blob")
+	}
+	defer f.Close()
+
+	// Drop data behind the last acknowledged offset of an interrupted
+	// transfer
+	if err := f.Truncate(t.Offset); err != nil {
+		return errors.Wrap(err, "failed to truncate blob")
+	}
+
+	for {
+		args := readArguments{
+			Path:   t.Path,
+			Offset: t.Offset,
+			Length: ChunkSize,
+		}
+
+		res := readResults{}
+		if err := m.client.Call(t.Namespace, t.DeviceID, CommandRead, args, &res); err != nil {
+			return err
+		}
+		if leaseLost(lostCh) {
+			return errLeaseLost
+		}
+
+		sum := sha256.Sum256(res.Data)
+		if res.Checksum != "" && res.Checksum != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("checksum mismatch of chunk at offset %d", t.Offset)
+		}
+
+		if _, err := f.WriteAt(res.Data, t.Offset); err != nil {
+			return errors.Wrap(err, "failed to write blob")
+		}
+
+		t.Offset += int64(len(res.Data))
+		t.Size = res.Size
+		if err := m.store.Update(t); err != nil {
+			return errors.Wrap(err, "failed to update transfer")
+		}
+
+		if res.EOF {
+			checksum, err := fileChecksum(f)
+			if err != nil {
+				return err
+			}
+			if res.FileChecksum != "" && res.FileChecksum != checksum {
+				return fmt.Errorf("checksum mismatch of file")
+			}
+			t.Checksum = checksum
+			return nil
+		}
+
+		if len(res.Data) == 0 {
+			return fmt.Errorf("device returned no data at offset %d", t.Offset)
+		}
+	}
+}
+
+func fileChecksum(f *os.File) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "failed to read blob")
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrap(err, "failed to read blob")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,353 @@
+package filetransfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/proto"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// runServer starts an embedded NATS server and returns a connection to it
+func runServer(t *testing.T) (*nats.Conn, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nc, func() {
+		nc.Close()
+		s.Shutdown()
+	}
+}
+
+// fakeDevice answers the file commands of the calls to device 'dev1'. The
+// write at rewindAt is answered with offset 0 and the call at failAt fails
+// with an invalid session, both once.
+type fakeDevice struct {
+	mu       sync.Mutex
+	file     []byte
+	offsets  []int64
+	rewindAt int64
+	failAt   int64
+}
+
+func newFakeDevice(t *testing.T, nc *nats.Conn, file []byte) *fakeDevice {
+	d := &fakeDevice{file: file, rewindAt: -1, failAt: -1}
+	if _, err := nc.Subscribe("iotcore.devicecontrol.v1.default.call", func(msg *nats.Msg) {
+		rep := d.handle(msg.Data)
+		data, _ := json.Marshal(rep)
+		nc.Publish(msg.Reply, data)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func (d *fakeDevice) handle(data []byte) *message.CallReply {
+	req := struct {
+		Command   string          `json:"command"`
+		Arguments json.RawMessage `json:"arguments"`
+	}{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &message.CallReply{Status: message.ReplyStatusError, ErrorReason: "ERR_INVALID_ARGUMENT"}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch req.Command {
+	case CommandWrite:
+		args := writeArguments{}
+		json.Unmarshal(req.Arguments, &args)
+		d.offsets = append(d.offsets, args.Offset)
+
+		if args.Offset == d.failAt {
+			d.failAt = -1
+			return &message.CallReply{Status: message.ReplyStatusError, ErrorReason: proto.ErrReasonInvalidSession.String()}
+		}
+		if args.Offset == d.rewindAt {
+			d.rewindAt = -1
+			d.file = nil
+			return &message.CallReply{Results: map[string]int64{"offset": 0}}
+		}
+
+		d.file = append(d.file[:args.Offset], args.Data...)
+		return &message.CallReply{Results: map[string]int64{"offset": int64(len(d.file))}}
+
+	case CommandRead:
+		args := readArguments{}
+		json.Unmarshal(req.Arguments, &args)
+		d.offsets = append(d.offsets, args.Offset)
+
+		if args.Offset == d.failAt {
+			d.failAt = -1
+			return &message.CallReply{Status: message.ReplyStatusError, ErrorReason: proto.ErrReasonInvalidSession.String()}
+		}
+
+		end := args.Offset + int64(args.Length)
+		if end > int64(len(d.file)) {
+			end = int64(len(d.file))
+		}
+		return &message.CallReply{Results: readResults{
+			Data: d.file[args.Offset:end],
+			Size: int64(len(d.file)),
+			EOF:  end == int64(len(d.file)),
+		}}
+	}
+
+	return &message.CallReply{Status: message.ReplyStatusError, ErrorReason: "ERR_UNKNOWN_COMMAND"}
+}
+
+func (d *fakeDevice) state() ([]byte, []int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]byte(nil), d.file...), append([]int64(nil), d.offsets...)
+}
+
+func randomContent(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+// waitForStatus waits until the transfer has one of the final states or
+// the given status
+func waitForStatus(t *testing.T, store storage.Interface, id int32, status string) *model.FileTransfer {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m, err := store.FileTransfers().FindByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Status == status || m.Status == model.FileTransferStatusFailed {
+			// The manager releases the transfer after the final update
+			time.Sleep(50 * time.Millisecond)
+			return m
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("transfer %d didn't become %s", id, status)
+	return nil
+}
+
+func equalOffsets(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestResumable(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		status     string
+		owner      string
+		leaseUntil time.Time
+		want       bool
+	}{
+		{model.FileTransferStatusInterrupted, "", time.Time{}, true},
+		{model.FileTransferStatusPending, "", time.Time{}, true},
+		{model.FileTransferStatusPending, "m1", now.Add(time.Minute), false},
+		{model.FileTransferStatusRunning, "m1", now.Add(time.Minute), false},
+		{model.FileTransferStatusRunning, "m1", now.Add(-time.Minute), true},
+		{model.FileTransferStatusCompleted, "", time.Time{}, false},
+		{model.FileTransferStatusFailed, "", time.Time{}, false},
+	}
+
+	for _, tc := range tests {
+		tr := &model.FileTransfer{Status: tc.status, Owner: tc.owner, LeaseUntil: tc.leaseUntil}
+		if got := resumable(tr, now); got != tc.want {
+			t.Errorf("resumable(%s, %q, %v) = %v, want %v", tc.status, tc.owner, tc.leaseUntil, got, tc.want)
+		}
+	}
+}
+
+func TestUploadRewind(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	content := randomContent(2*ChunkSize + 100)
+	d := newFakeDevice(t, nc, nil)
+	// The device lost the file while receiving the second chunk
+	d.rewindAt = ChunkSize
+
+	store := memory.NewStore()
+	m := NewManager(nc, store, t.TempDir(), 1, 1, 0)
+
+	tr, err := m.Upload("default", "dev1", "/tmp/file", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr = waitForStatus(t, store, tr.ID, model.FileTransferStatusCompleted)
+	if tr.Status != model.FileTransferStatusCompleted {
+		t.Fatalf("transfer is %s (%s), want %s", tr.Status, tr.Error, model.FileTransferStatusCompleted)
+	}
+	if tr.Offset != int64(len(content)) {
+		t.Errorf("offset = %d, want %d", tr.Offset, len(content))
+	}
+	if tr.Owner != "" {
+		t.Errorf("owner = %q after the transfer, want none", tr.Owner)
+	}
+
+	file, offsets := d.state()
+	if !bytes.Equal(file, content) {
+		t.Error("file on the device differs from the upload")
+	}
+	want := []int64{0, ChunkSize, 0, ChunkSize, 2 * ChunkSize}
+	if !equalOffsets(offsets, want) {
+		t.Errorf("write offsets = %v, want %v", offsets, want)
+	}
+}
+
+func TestResumeUpload(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	content := randomContent(2*ChunkSize + 100)
+	d := newFakeDevice(t, nc, nil)
+	d.failAt = ChunkSize
+
+	store := memory.NewStore()
+	m := NewManager(nc, store, t.TempDir(), 1, 1, 0)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	tr, err := m.Upload("default", "dev1", "/tmp/file", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr = waitForStatus(t, store, tr.ID, model.FileTransferStatusInterrupted)
+	if tr.Status != model.FileTransferStatusInterrupted {
+		t.Fatalf("transfer is %s (%s), want %s", tr.Status, tr.Error, model.FileTransferStatusInterrupted)
+	}
+	if tr.Offset != ChunkSize {
+		t.Errorf("offset of interrupted transfer = %d, want %d", tr.Offset, ChunkSize)
+	}
+
+	// The transfer is resumed at the acknowledged offset after the device
+	// reconnected
+	data := `{"source_type":"DEVICE","source_id":"dev1","details":{"status":"CONNECTED"}}`
+	if err := nc.Publish("iotcore.devicecontrol.v1.default.events.devicestatus", []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	tr = waitForStatus(t, store, tr.ID, model.FileTransferStatusCompleted)
+	if tr.Status != model.FileTransferStatusCompleted {
+		t.Fatalf("transfer is %s (%s), want %s", tr.Status, tr.Error, model.FileTransferStatusCompleted)
+	}
+
+	file, offsets := d.state()
+	if !bytes.Equal(file, content) {
+		t.Error("file on the device differs from the upload")
+	}
+	want := []int64{0, ChunkSize, ChunkSize, 2 * ChunkSize}
+	if !equalOffsets(offsets, want) {
+		t.Errorf("write offsets = %v, want %v", offsets, want)
+	}
+}
+
+func TestResumeDownload(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	content := randomContent(2*ChunkSize + 100)
+	d := newFakeDevice(t, nc, content)
+
+	store := memory.NewStore()
+	m := NewManager(nc, store, t.TempDir(), 1, 1, 0)
+
+	// The blob of the interrupted download contains data behind the
+	// acknowledged offset, it's dropped
+	tr := &model.FileTransfer{
+		Namespace: "default",
+		DeviceID:  "dev1",
+		Direction: model.FileTransferDirectionDownload,
+		Path:      "/tmp/file",
+		Offset:    ChunkSize,
+		Status:    model.FileTransferStatusInterrupted,
+	}
+	if err := store.FileTransfers().Create(tr); err != nil {
+		t.Fatal(err)
+	}
+	blob := append(append([]byte(nil), content[:ChunkSize]...), bytes.Repeat([]byte{0xff}, 100)...)
+	if err := ioutil.WriteFile(m.BlobPath(tr), blob, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	// A transfer run by another manager isn't resumed
+	other := &model.FileTransfer{
+		Namespace: "default",
+		DeviceID:  "dev1",
+		Direction: model.FileTransferDirectionDownload,
+		Path:      "/tmp/other",
+		Status:    model.FileTransferStatusRunning,
+	}
+	if err := store.FileTransfers().Create(other); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := store.FileTransfers().Claim(other.ID, "other", time.Now(), transferLease); err != nil || !ok {
+		t.Fatalf("claim of free transfer = %v, %v", ok, err)
+	}
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	data := `{"source_type":"DEVICE","source_id":"dev1","details":{"status":"CONNECTED"}}`
+	if err := nc.Publish("iotcore.devicecontrol.v1.default.events.devicestatus", []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	tr = waitForStatus(t, store, tr.ID, model.FileTransferStatusCompleted)
+	if tr.Status != model.FileTransferStatusCompleted {
+		t.Fatalf("transfer is %s (%s), want %s", tr.Status, tr.Error, model.FileTransferStatusCompleted)
+	}
+
+	got, err := ioutil.ReadFile(m.BlobPath(tr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded blob differs from the file on the device")
+	}
+	if _, offsets := d.state(); !equalOffsets(offsets, []int64{ChunkSize, 2 * ChunkSize}) {
+		t.Errorf("read offsets = %v, want %v", offsets, []int64{ChunkSize, 2 * ChunkSize})
+	}
+
+	if m, _ := store.FileTransfers().FindByID(other.ID); m.Status != model.FileTransferStatusRunning || m.Owner != "other" {
+		t.Errorf("transfer of another manager is %s by %q, want it untouched", m.Status, m.Owner)
+	}
+}
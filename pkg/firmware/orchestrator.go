@@ -0,0 +1,651 @@
+package firmware
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/client"
+	"github.com/nsyszr/lcm/pkg/filetransfer"
+	"github.com/nsyszr/lcm/pkg/maintenance"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Device commands for installing a firmware image which was transferred to
+// the device before
+const (
+	CommandVerify  = "firmware.verify"
+	CommandInstall = "firmware.install"
+)
+
+// ImageDevicePath is the path on the device the image is transferred to
+const ImageDevicePath = "/tmp/firmware.img"
+
+// downloadTimeout limits the time for transferring the image to a device.
+// An interrupted transfer is resumed if the device reconnects within.
+const downloadTimeout = time.Hour
+
+// pollInterval defines how often the state of a transfer or a rebooting
+// device is checked.
+const pollInterval = 2 * time.Second
+
+// campaignLease is the time an orchestrator owns a campaign without renewing
+// its claim. The running campaigns of an orchestrator which is gone are
+// taken over after the lease expired.
+const campaignLease = 2 * time.Minute
+
+// queueGroup is the queue group of the device status subscription
+const queueGroup = "iotcore.devicecontrol.v1.queue.firmware"
+
+// installArguments are the arguments of the verify and install commands
+type installArguments struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+}
+
+// Orchestrator runs the firmware campaigns. The devices of a campaign are
+// updated in batches. After every batch the failure rate of the finished
+// updates is checked and the campaign halts if it's exceeded. A campaign is
+// run by the orchestrator which claimed it, other instances skip it.
+type Orchestrator struct {
+	id            string
+	nc            *nats.Conn
+	store         storage.Interface
+	repo          *Repository
+	transfers     *filetransfer.Manager
+	client        *client.Client
+	rebootTimeout time.Duration
+
+	mu      sync.Mutex
+	running map[int32]bool
+
+	sub    *nats.Subscription
+	stopCh chan struct{}
+}
+
+// NewOrchestrator creates a new firmware campaign orchestrator
+func NewOrchestrator(nc *nats.Conn, store storage.Interface, repo *Repository, transfers *filetransfer.Manager, rebootTimeout time.Duration) *Orchestrator {
+	return &Orchestrator{
+		id:            nuid.Next(),
+		nc:            nc,
+		store:         store,
+		repo:          repo,
+		transfers:     transfers,
+		client:        client.New(nc),
+		rebootTimeout: rebootTimeout,
+		running:       make(map[int32]bool),
+		stopCh:        make(chan struct{}),
+	}
+}
+
+// Repository returns the firmware repository
+func (o *Orchestrator) Repository() *Repository {
+	return o.repo
+}
+
+// Start listens for reconnecting devices and continues the running
+// campaigns. The instances share the device status events through a queue
+// group. The running campaigns without owner are taken over periodically.
+func (o *Orchestrator) Start() error {
+	sub, err := o.nc.QueueSubscribe("iotcore.devicecontrol.v1.*.events.devicestatus", queueGroup, o.handleDeviceStatus)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe device status events")
+	}
+	o.sub = sub
+
+	if err := o.adoptCampaigns(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(campaignLease)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-o.stopCh:
+				return
+			case <-ticker.C:
+				if err := o.adoptCampaigns(); err != nil {
+					log.Error("firmware failed to continue campaigns: ", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops listening for reconnecting devices
+func (o *Orchestrator) Stop() {
+	close(o.stopCh)
+	if o.sub != nil {
+		o.sub.Unsubscribe()
+	}
+}
+
+// adoptCampaigns starts the runners of the running campaigns. The campaigns
+// owned by other orchestrators are skipped by the runners.
+func (o *Orchestrator) adoptCampaigns() error {
+	campaigns, err := o.store.FirmwareCampaigns().FetchAll()
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch firmware campaigns")
+	}
+	for _, c := range campaigns {
+		if c.Status == model.FirmwareCampaignStatusRunning {
+			o.startRunner(c.ID)
+		}
+	}
+
+	return nil
+}
+
+// CreateCampaign creates and starts a campaign for the given devices. All
+// devices of the namespace are updated if no device IDs are given.
+func (o *Orchestrator) CreateCampaign(namespace string, imageID int32, deviceIDs []string, batchSize int, maxFailureRate float64) (*model.FirmwareCampaign, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("batch size must be greater than zero")
+	}
+	if maxFailureRate < 0 || maxFailureRate > 1 {
+		return nil, fmt.Errorf("max failure rate must be between 0 and 1")
+	}
+
+	if _, err := o.store.FirmwareImages().FindByID(imageID); err != nil {
+		return nil, err
+	}
+
+	if len(deviceIDs) == 0 {
+		devices, err := o.store.Devices().FetchAll()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch devices")
+		}
+		for _, d := range devices {
+			if d.Namespace == namespace {
+				deviceIDs = append(deviceIDs, d.DeviceID)
+			}
+		}
+		sort.Strings(deviceIDs)
+	}
+
+	c := &model.FirmwareCampaign{
+		Namespace:      namespace,
+		ImageID:        imageID,
+		BatchSize:      batchSize,
+		MaxFailureRate: maxFailureRate,
+		Status:         model.FirmwareCampaignStatusRunning,
+	}
+	if err := o.store.FirmwareCampaigns().Create(c); err != nil {
+		return nil, errors.Wrap(err, "failed to create firmware campaign")
+	}
+
+	for _, deviceID := range deviceIDs {
+		u := &model.FirmwareUpdate{
+			CampaignID: c.ID,
+			Namespace:  namespace,
+			DeviceID:   deviceID,
+			Status:     model.FirmwareUpdateStatusPending,
+		}
+		if err := o.store.FirmwareUpdates().Create(u); err != nil {
+			return nil, errors.Wrap(err, "failed to create firmware update")
+		}
+	}
+
+	log.Infof("firmware campaign %d started for %d devices", c.ID, len(deviceIDs))
+
+	o.startRunner(c.ID)
+
+	return c, nil
+}
+
+// HaltCampaign stops the campaign after the running batch
+func (o *Orchestrator) HaltCampaign(id int32) (*model.FirmwareCampaign, error) {
+	c, err := o.store.FirmwareCampaigns().FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != model.FirmwareCampaignStatusRunning {
+		return nil, fmt.Errorf("campaign is %s", c.Status)
+	}
+
+	c.Status = model.FirmwareCampaignStatusHalted
+	c.Error = "halted by user"
+	if err := o.store.FirmwareCampaigns().Update(c); err != nil {
+		return nil, errors.Wrap(err, "failed to update firmware campaign")
+	}
+
+	return c, nil
+}
+
+// ResumeCampaign continues a halted campaign
+func (o *Orchestrator) ResumeCampaign(id int32) (*model.FirmwareCampaign, error) {
+	c, err := o.store.FirmwareCampaigns().FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != model.FirmwareCampaignStatusHalted {
+		return nil, fmt.Errorf("campaign is %s", c.Status)
+	}
+
+	c.Status = model.FirmwareCampaignStatusRunning
+	c.Error = ""
+	if err := o.store.FirmwareCampaigns().Update(c); err != nil {
+		return nil, errors.Wrap(err, "failed to update firmware campaign")
+	}
+
+	o.startRunner(c.ID)
+
+	return c, nil
+}
+
+func (o *Orchestrator) startRunner(campaignID int32) {
+	o.mu.Lock()
+	if o.running[campaignID] {
+		o.mu.Unlock()
+		return
+	}
+	o.running[campaignID] = true
+	o.mu.Unlock()
+
+	go func() {
+		defer func() {
+			o.mu.Lock()
+			delete(o.running, campaignID)
+			o.mu.Unlock()
+		}()
+
+		claimed, err := o.store.FirmwareCampaigns().Claim(campaignID, o.id, time.Now(), campaignLease)
+		if err != nil {
+			log.Errorf("firmware failed to claim campaign %d: %s", campaignID, err)
+			return
+		} else if !claimed {
+			log.Debugf("firmware campaign %d is run by another orchestrator", campaignID)
+			return
+		}
+		defer func() {
+			if err := o.store.FirmwareCampaigns().Release(campaignID, o.id); err != nil {
+				log.Errorf("firmware failed to release campaign %d: %s", campaignID, err)
+			}
+		}()
+
+		lostCh := make(chan struct{})
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+		go o.renewLease(campaignID, lostCh, doneCh)
+
+		if err := o.runCampaign(campaignID, lostCh); err != nil {
+			log.Errorf("firmware campaign %d failed: %s", campaignID, err)
+		}
+	}()
+}
+
+// renewLease extends the claim of the campaign until done is closed. The
+// lost channel is closed if the claim can't be renewed.
+func (o *Orchestrator) renewLease(campaignID int32, lostCh, doneCh chan struct{}) {
+	ticker := time.NewTicker(campaignLease / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-doneCh:
+			return
+		case <-ticker.C:
+			claimed, err := o.store.FirmwareCampaigns().Claim(campaignID, o.id, time.Now(), campaignLease)
+			if err != nil {
+				// The lease lasts for some more attempts
+				log.Errorf("firmware failed to renew the claim of campaign %d: %s", campaignID, err)
+				continue
+			}
+			if !claimed {
+				close(lostCh)
+				return
+			}
+		}
+	}
+}
+
+// runCampaign processes the batches of the campaign until it's completed,
+// halted or the claim is lost.
+func (o *Orchestrator) runCampaign(campaignID int32, lostCh <-chan struct{}) error {
+	for {
+		select {
+		case <-lostCh:
+			return errors.New("campaign was taken over by another orchestrator")
+		default:
+		}
+
+		c, err := o.store.FirmwareCampaigns().FindByID(campaignID)
+		if err != nil {
+			return err
+		}
+		if c.Status != model.FirmwareCampaignStatusRunning {
+			log.Infof("firmware campaign %d is %s", c.ID, c.Status)
+			return nil
+		}
+
+		image, err := o.store.FirmwareImages().FindByID(c.ImageID)
+		if err != nil {
+			return err
+		}
+
+		updatesByID, err := o.store.FirmwareUpdates().FindByCampaignID(c.ID)
+		if err != nil {
+			return err
+		}
+		updates := make([]model.FirmwareUpdate, 0, len(updatesByID))
+		for _, u := range updatesByID {
+			updates = append(updates, u)
+		}
+		sort.Slice(updates, func(i, j int) bool { return updates[i].ID < updates[j].ID })
+
+		// The failure rate of the finished updates decides whether the
+		// rollout continues
+		if rate, ok := failureRate(updates); ok && rate > c.MaxFailureRate {
+			log.Warnf("firmware campaign %d halted because of failure rate %.2f", c.ID, rate)
+			c.Status = model.FirmwareCampaignStatusHalted
+			c.Error = fmt.Sprintf("failure rate %.2f exceeds %.2f", rate, c.MaxFailureRate)
+			return o.store.FirmwareCampaigns().Update(c)
+		}
+
+		batch := nextBatch(updates, c.BatchSize)
+		if len(batch) == 0 {
+			log.Infof("firmware campaign %d completed", c.ID)
+			c.Status = model.FirmwareCampaignStatusCompleted
+			return o.store.FirmwareCampaigns().Update(c)
+		}
+
+		var wg sync.WaitGroup
+		for _, elem := range batch {
+			u := elem
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				o.processUpdate(image, &u)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// failureRate returns the rate of the failed updates among the finished
+// updates. Skipped devices don't count. It returns false if no update is
+// finished yet.
+func failureRate(updates []model.FirmwareUpdate) (float64, bool) {
+	finished, failed := 0, 0
+	for _, u := range updates {
+		switch u.Status {
+		case model.FirmwareUpdateStatusDone:
+			finished++
+		case model.FirmwareUpdateStatusFailed:
+			finished++
+			failed++
+		}
+	}
+	if finished == 0 {
+		return 0, false
+	}
+	return float64(failed) / float64(finished), true
+}
+
+// nextBatch returns the updates of the next batch. Updates which are in
+// progress, e.g. after a restart, are part of the next batch and may exceed
+// the batch size.
+func nextBatch(updates []model.FirmwareUpdate, size int) []model.FirmwareUpdate {
+	batch := make([]model.FirmwareUpdate, 0, size)
+	for _, u := range updates {
+		if isInProgress(u.Status) {
+			batch = append(batch, u)
+		}
+	}
+	for _, u := range updates {
+		if len(batch) >= size {
+			break
+		}
+		if u.Status == model.FirmwareUpdateStatusPending {
+			batch = append(batch, u)
+		}
+	}
+	return batch
+}
+
+func isInProgress(status string) bool {
+	switch status {
+	case model.FirmwareUpdateStatusDownloading,
+		model.FirmwareUpdateStatusVerifying,
+		model.FirmwareUpdateStatusInstalling,
+		model.FirmwareUpdateStatusRebooting:
+		return true
+	}
+	return false
+}
+
+// processUpdate moves the update of a device through the states until it's
+// done, failed or skipped.
+func (o *Orchestrator) processUpdate(image *model.FirmwareImage, u *model.FirmwareUpdate) {
+	for {
+		var err error
+		switch u.Status {
+		case model.FirmwareUpdateStatusPending:
+			err = o.startDownload(image, u)
+		case model.FirmwareUpdateStatusDownloading:
+			err = o.waitForDownload(u)
+		case model.FirmwareUpdateStatusVerifying:
+			err = o.callDevice(image, u, CommandVerify, model.FirmwareUpdateStatusInstalling)
+		case model.FirmwareUpdateStatusInstalling:
+			err = o.install(image, u)
+		case model.FirmwareUpdateStatusRebooting:
+			err = o.waitForReboot(u)
+		default:
+			return
+		}
+
+		if err != nil {
+			log.Errorf("firmware update of device '%s' failed in state %s: %s", u.DeviceID, u.Status, err)
+			o.setStatus(u, model.FirmwareUpdateStatusFailed, err.Error())
+			return
+		}
+	}
+}
+
+func (o *Orchestrator) setStatus(u *model.FirmwareUpdate, status, msg string) {
+	u.Status = status
+	u.Error = msg
+	if err := o.store.FirmwareUpdates().Update(u); err != nil {
+		log.Error("firmware failed to update firmware update: ", err)
+	}
+}
+
+func (o *Orchestrator) startDownload(image *model.FirmwareImage, u *model.FirmwareUpdate) error {
+	sess, err := o.store.Sessions().FindByNamespaceAndDeviceID(u.Namespace, u.DeviceID)
+	if err == storage.ErrNotFound {
+		o.setStatus(u, model.FirmwareUpdateStatusSkipped, "device is not connected")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !IsCompatible(image, sess.HardwareModel) {
+		o.setStatus(u, model.FirmwareUpdateStatusSkipped,
+			fmt.Sprintf("hardware model '%s' is not compatible", sess.HardwareModel))
+		return nil
+	}
+	if sess.FirmwareVersion == image.Version {
+		o.setStatus(u, model.FirmwareUpdateStatusDone, "firmware is up to date")
+		return nil
+	}
+
+	// The calls of devices in a maintenance window which rejects calls are
+	// rejected by the controller
+	window, err := maintenance.Active(o.store, u.Namespace, u.DeviceID)
+	if err != nil {
+		return err
+	}
+	if window != nil && window.RejectCalls {
+		o.setStatus(u, model.FirmwareUpdateStatusSkipped, "device is in maintenance")
+		return nil
+	}
+
+	t, err := o.transfers.UploadBlob(u.Namespace, u.DeviceID, ImageDevicePath,
+		o.repo.ImagePath(image.ID), image.Size, image.Checksum)
+	if err != nil {
+		return err
+	}
+
+	u.TransferID = t.ID
+	o.setStatus(u, model.FirmwareUpdateStatusDownloading, "")
+	return nil
+}
+
+func (o *Orchestrator) waitForDownload(u *model.FirmwareUpdate) error {
+	deadline := time.Now().Add(downloadTimeout)
+	for {
+		t, err := o.store.FileTransfers().FindByID(u.TransferID)
+		if err != nil {
+			return err
+		}
+
+		switch t.Status {
+		case model.FileTransferStatusCompleted:
+			o.setStatus(u, model.FirmwareUpdateStatusVerifying, "")
+			return nil
+		case model.FileTransferStatusFailed:
+			return fmt.Errorf("transfer failed: %s", t.Error)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("transfer timed out at offset %d of %d", t.Offset, t.Size)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func (o *Orchestrator) callDevice(image *model.FirmwareImage, u *model.FirmwareUpdate, command, next string) error {
+	if err := o.client.Call(u.Namespace, u.DeviceID, command, newInstallArguments(image), nil); err != nil {
+		return err
+	}
+
+	o.setStatus(u, next, "")
+	return nil
+}
+
+// install tells the device to install the image and reboot. The update is
+// set to REBOOTING before, because the device may reboot and reconnect
+// before its result arrives. The device may also reboot before it replies
+// at all, therefore the loss of the session is expected and the reboot is
+// awaited anyway.
+func (o *Orchestrator) install(image *model.FirmwareImage, u *model.FirmwareUpdate) error {
+	o.setStatus(u, model.FirmwareUpdateStatusRebooting, "")
+
+	err := o.client.Call(u.Namespace, u.DeviceID, CommandInstall, newInstallArguments(image), nil)
+	if err != nil && client.IsUnavailable(err) {
+		log.Infof("firmware update of device '%s' lost the session during install: %s", u.DeviceID, err)
+		return nil
+	}
+
+	return err
+}
+
+func newInstallArguments(image *model.FirmwareImage) installArguments {
+	return installArguments{
+		Path:     ImageDevicePath,
+		Version:  image.Version,
+		Checksum: image.Checksum,
+	}
+}
+
+// waitForReboot waits until the device status handler verified the firmware
+// version of the reconnected device.
+func (o *Orchestrator) waitForReboot(u *model.FirmwareUpdate) error {
+	deadline := u.UpdatedAt.Add(o.rebootTimeout)
+	if u.UpdatedAt.IsZero() {
+		deadline = time.Now().Add(o.rebootTimeout)
+	}
+
+	for {
+		m, err := o.store.FirmwareUpdates().FindByID(u.ID)
+		if err != nil {
+			return err
+		}
+		if m.Status != model.FirmwareUpdateStatusRebooting {
+			*u = *m
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("device did not reconnect within %s", o.rebootTimeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// handleDeviceStatus verifies the firmware version which a rebooted device
+// declared in its HELLO message.
+func (o *Orchestrator) handleDeviceStatus(msg *nats.Msg) {
+	ev := struct {
+		SourceID string `json:"source_id"`
+		Details  struct {
+			Status string `json:"status"`
+		} `json:"details"`
+	}{}
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		log.Error("firmware failed to unmarshal device status: ", err)
+		return
+	}
+	if ev.Details.Status != "CONNECTED" {
+		return
+	}
+
+	namespace := strings.SplitN(strings.TrimPrefix(msg.Subject, "iotcore.devicecontrol.v1."), ".", 2)[0]
+
+	updates, err := o.store.FirmwareUpdates().FetchAll()
+	if err != nil {
+		log.Error("firmware failed to fetch firmware updates: ", err)
+		return
+	}
+
+	for _, elem := range updates {
+		u := elem
+		if u.Namespace != namespace || u.DeviceID != ev.SourceID || u.Status != model.FirmwareUpdateStatusRebooting {
+			continue
+		}
+
+		if err := o.verifyVersion(&u); err != nil {
+			log.Error("firmware failed to verify firmware version: ", err)
+		}
+	}
+}
+
+func (o *Orchestrator) verifyVersion(u *model.FirmwareUpdate) error {
+	c, err := o.store.FirmwareCampaigns().FindByID(u.CampaignID)
+	if err != nil {
+		return err
+	}
+	image, err := o.store.FirmwareImages().FindByID(c.ImageID)
+	if err != nil {
+		return err
+	}
+	sess, err := o.store.Sessions().FindByNamespaceAndDeviceID(u.Namespace, u.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	if sess.FirmwareVersion != image.Version {
+		log.Warnf("firmware update of device '%s' failed: version %s, expected %s",
+			u.DeviceID, sess.FirmwareVersion, image.Version)
+		o.setStatus(u, model.FirmwareUpdateStatusFailed,
+			fmt.Sprintf("device runs version '%s' after reboot, expected '%s'", sess.FirmwareVersion, image.Version))
+		return nil
+	}
+
+	log.Infof("firmware update of device '%s' to version %s done", u.DeviceID, image.Version)
+	o.setStatus(u, model.FirmwareUpdateStatusDone, "")
+	return nil
+}
@@ -0,0 +1,328 @@
+package firmware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// runServer starts an embedded NATS server and returns a connection to it
+func runServer(t *testing.T) (*nats.Conn, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nc, func() {
+		nc.Close()
+		s.Shutdown()
+	}
+}
+
+func updatesWithStatus(statuses ...string) []model.FirmwareUpdate {
+	updates := make([]model.FirmwareUpdate, 0, len(statuses))
+	for i, status := range statuses {
+		updates = append(updates, model.FirmwareUpdate{ID: int32(i + 1), Status: status})
+	}
+	return updates
+}
+
+func TestFailureRate(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		rate     float64
+		finished bool
+	}{
+		{nil, 0, false},
+		{[]string{model.FirmwareUpdateStatusPending, model.FirmwareUpdateStatusSkipped}, 0, false},
+		{[]string{model.FirmwareUpdateStatusDone, model.FirmwareUpdateStatusSkipped}, 0, true},
+		{[]string{model.FirmwareUpdateStatusDone, model.FirmwareUpdateStatusFailed}, 0.5, true},
+		{[]string{model.FirmwareUpdateStatusFailed, model.FirmwareUpdateStatusRebooting}, 1, true},
+	}
+
+	for _, tc := range tests {
+		rate, finished := failureRate(updatesWithStatus(tc.statuses...))
+		if rate != tc.rate || finished != tc.finished {
+			t.Errorf("failureRate(%v) = %v, %v, want %v, %v", tc.statuses, rate, finished, tc.rate, tc.finished)
+		}
+	}
+}
+
+func TestNextBatch(t *testing.T) {
+	const (
+		pending   = model.FirmwareUpdateStatusPending
+		rebooting = model.FirmwareUpdateStatusRebooting
+		done      = model.FirmwareUpdateStatusDone
+	)
+
+	tests := []struct {
+		statuses []string
+		size     int
+		want     []int32
+	}{
+		{[]string{pending, pending, pending}, 2, []int32{1, 2}},
+		{[]string{done, pending, pending}, 2, []int32{2, 3}},
+		{[]string{done, done}, 2, []int32{}},
+		// Updates in progress are continued first
+		{[]string{pending, rebooting, pending}, 2, []int32{2, 1}},
+		{[]string{rebooting, rebooting, pending}, 1, []int32{1, 2}},
+	}
+
+	for _, tc := range tests {
+		batch := nextBatch(updatesWithStatus(tc.statuses...), tc.size)
+		got := make([]int32, 0, len(batch))
+		for _, u := range batch {
+			got = append(got, u.ID)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("nextBatch(%v, %d) = %v, want %v", tc.statuses, tc.size, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("nextBatch(%v, %d) = %v, want %v", tc.statuses, tc.size, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+// newCampaign stores a campaign of the image with an update per status
+func newCampaign(t *testing.T, store storage.Interface, image *model.FirmwareImage, maxFailureRate float64, statuses ...string) *model.FirmwareCampaign {
+	c := &model.FirmwareCampaign{
+		Namespace:      "default",
+		ImageID:        image.ID,
+		BatchSize:      2,
+		MaxFailureRate: maxFailureRate,
+		Status:         model.FirmwareCampaignStatusRunning,
+	}
+	if err := store.FirmwareCampaigns().Create(c); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, status := range statuses {
+		u := &model.FirmwareUpdate{
+			CampaignID: c.ID,
+			Namespace:  "default",
+			DeviceID:   string(rune('a' + i)),
+			Status:     status,
+		}
+		if err := store.FirmwareUpdates().Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return c
+}
+
+func newImage(t *testing.T, store storage.Interface) *model.FirmwareImage {
+	image := &model.FirmwareImage{Version: "2.0", HardwareModels: []string{"m1"}}
+	if err := store.FirmwareImages().Create(image); err != nil {
+		t.Fatal(err)
+	}
+	return image
+}
+
+func updateStatuses(t *testing.T, store storage.Interface, campaignID int32) map[string]string {
+	updates, err := store.FirmwareUpdates().FindByCampaignID(campaignID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]string)
+	for _, u := range updates {
+		statuses[u.DeviceID] = u.Status
+	}
+	return statuses
+}
+
+func TestRunCampaign(t *testing.T) {
+	store := memory.NewStore()
+	image := newImage(t, store)
+
+	// Device a runs the image already, b isn't connected and c isn't
+	// compatible
+	for _, sess := range []*model.Session{
+		{Namespace: "default", DeviceID: "a", HardwareModel: "m1", FirmwareVersion: "2.0"},
+		{Namespace: "default", DeviceID: "c", HardwareModel: "m2", FirmwareVersion: "1.0"},
+		{Namespace: "default", DeviceID: "d", HardwareModel: "m1", FirmwareVersion: "2.0"},
+	} {
+		if err := store.Sessions().Create(sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newCampaign(t, store, image, 0,
+		model.FirmwareUpdateStatusPending, model.FirmwareUpdateStatusPending,
+		model.FirmwareUpdateStatusPending, model.FirmwareUpdateStatusPending)
+
+	o := NewOrchestrator(nil, store, nil, nil, time.Minute)
+	if err := o.runCampaign(c.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := store.FirmwareCampaigns().FindByID(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != model.FirmwareCampaignStatusCompleted {
+		t.Errorf("campaign is %s, want %s", c.Status, model.FirmwareCampaignStatusCompleted)
+	}
+
+	want := map[string]string{
+		"a": model.FirmwareUpdateStatusDone,
+		"b": model.FirmwareUpdateStatusSkipped,
+		"c": model.FirmwareUpdateStatusSkipped,
+		"d": model.FirmwareUpdateStatusDone,
+	}
+	for deviceID, status := range updateStatuses(t, store, c.ID) {
+		if status != want[deviceID] {
+			t.Errorf("update of device %s is %s, want %s", deviceID, status, want[deviceID])
+		}
+	}
+}
+
+func TestRunCampaignHalts(t *testing.T) {
+	store := memory.NewStore()
+	image := newImage(t, store)
+
+	c := newCampaign(t, store, image, 0.4,
+		model.FirmwareUpdateStatusDone, model.FirmwareUpdateStatusFailed,
+		model.FirmwareUpdateStatusPending)
+
+	o := NewOrchestrator(nil, store, nil, nil, time.Minute)
+	if err := o.runCampaign(c.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := store.FirmwareCampaigns().FindByID(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != model.FirmwareCampaignStatusHalted {
+		t.Errorf("campaign is %s, want %s", c.Status, model.FirmwareCampaignStatusHalted)
+	}
+	if c.Error != "failure rate 0.50 exceeds 0.40" {
+		t.Errorf("campaign error = %q", c.Error)
+	}
+	if status := updateStatuses(t, store, c.ID)["c"]; status != model.FirmwareUpdateStatusPending {
+		t.Errorf("update of the halted campaign is %s, want %s", status, model.FirmwareUpdateStatusPending)
+	}
+}
+
+func TestCampaignClaim(t *testing.T) {
+	store := memory.NewStore()
+	image := newImage(t, store)
+	c := newCampaign(t, store, image, 0, model.FirmwareUpdateStatusPending)
+
+	o1 := NewOrchestrator(nil, store, nil, nil, time.Minute)
+	o2 := NewOrchestrator(nil, store, nil, nil, time.Minute)
+
+	now := time.Now()
+	if ok, err := store.FirmwareCampaigns().Claim(c.ID, o1.id, now, campaignLease); err != nil || !ok {
+		t.Fatalf("claim of free campaign = %v, %v", ok, err)
+	}
+
+	// The runner of another orchestrator skips the campaign
+	o2.startRunner(c.ID)
+	for i := 0; i < 100; i++ {
+		o2.mu.Lock()
+		running := o2.running[c.ID]
+		o2.mu.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := updateStatuses(t, store, c.ID)["a"]; status != model.FirmwareUpdateStatusPending {
+		t.Errorf("update of campaign owned by another orchestrator is %s, want %s", status, model.FirmwareUpdateStatusPending)
+	}
+
+	// The claim is taken over after the lease expired
+	if ok, _ := store.FirmwareCampaigns().Claim(c.ID, o2.id, now.Add(time.Second), campaignLease); ok {
+		t.Error("campaign with unexpired lease was claimed")
+	}
+	if ok, _ := store.FirmwareCampaigns().Claim(c.ID, o2.id, now.Add(campaignLease+time.Second), campaignLease); !ok {
+		t.Error("campaign with expired lease wasn't claimed")
+	}
+
+	// Updates don't change the owner
+	m, err := store.FirmwareCampaigns().FindByID(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Owner = ""
+	if err := store.FirmwareCampaigns().Update(m); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ = store.FirmwareCampaigns().FindByID(c.ID); m.Owner != o2.id {
+		t.Errorf("owner = %q after update, want %q", m.Owner, o2.id)
+	}
+
+	if err := store.FirmwareCampaigns().Release(c.ID, o1.id); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ = store.FirmwareCampaigns().FindByID(c.ID); m.Owner != o2.id {
+		t.Error("campaign was released by a former owner")
+	}
+}
+
+func TestDeviceStatusVerifiesVersion(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	store := memory.NewStore()
+	image := newImage(t, store)
+	c := newCampaign(t, store, image, 0, model.FirmwareUpdateStatusRebooting)
+	if err := store.Sessions().Create(&model.Session{Namespace: "default", DeviceID: "a", HardwareModel: "m1", FirmwareVersion: "2.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both orchestrators receive the status through the queue group, the
+	// rebooting update is continued by the one which claimed the campaign
+	o1 := NewOrchestrator(nc, store, nil, nil, time.Minute)
+	o2 := NewOrchestrator(nc, store, nil, nil, time.Minute)
+	for _, o := range []*Orchestrator{o1, o2} {
+		if err := o.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer o.Stop()
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := `{"source_type":"DEVICE","source_id":"a","details":{"status":"CONNECTED"}}`
+	if err := nc.Publish("iotcore.devicecontrol.v1.default.events.devicestatus", []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(3 * pollInterval)
+	for time.Now().Before(deadline) {
+		m, err := store.FirmwareCampaigns().FindByID(c.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Status == model.FirmwareCampaignStatusCompleted {
+			if status := updateStatuses(t, store, c.ID)["a"]; status != model.FirmwareUpdateStatusDone {
+				t.Errorf("update is %s, want %s", status, model.FirmwareUpdateStatusDone)
+			}
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("campaign didn't complete after the device reconnected")
+}
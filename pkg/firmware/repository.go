@@ -0,0 +1,105 @@
+// Package firmware manages the firmware images and rolls them out to the
+// devices in update campaigns.
+package firmware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// Repository stores the firmware images in a local directory
+type Repository struct {
+	store storage.FirmwareImageStore
+	dir   string
+}
+
+// NewRepository creates a new firmware repository which stores the images
+// in the given directory.
+func NewRepository(store storage.FirmwareImageStore, dir string) *Repository {
+	return &Repository{
+		store: store,
+		dir:   dir,
+	}
+}
+
+// Add stores the image read from the given reader. The image is compatible
+// with the given hardware models, an empty list means all hardware models.
+func (r *Repository) Add(version string, hardwareModels []string, filename string, rd io.Reader) (*model.FirmwareImage, error) {
+	if version == "" {
+		return nil, fmt.Errorf("version is required")
+	}
+
+	if err := os.MkdirAll(r.dir, 0750); err != nil {
+		return nil, errors.Wrap(err, "failed to create firmware directory")
+	}
+
+	tmp, err := ioutil.TempFile(r.dir, "upload-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create image file")
+	}
+	defer os.Remove(tmp.Name()) // No-op after successful rename
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), rd)
+	tmp.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to write image file")
+	}
+
+	m := &model.FirmwareImage{
+		Version:        version,
+		HardwareModels: hardwareModels,
+		Filename:       filename,
+		Size:           size,
+		Checksum:       hex.EncodeToString(h.Sum(nil)),
+	}
+	if err := r.store.Create(m); err != nil {
+		return nil, errors.Wrap(err, "failed to create firmware image")
+	}
+
+	if err := os.Rename(tmp.Name(), r.ImagePath(m.ID)); err != nil {
+		r.store.Delete(m.ID)
+		return nil, errors.Wrap(err, "failed to store image file")
+	}
+
+	return m, nil
+}
+
+// Delete removes the image and its file
+func (r *Repository) Delete(id int32) error {
+	if err := r.store.Delete(id); err != nil {
+		return err
+	}
+	if err := os.Remove(r.ImagePath(id)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove image file")
+	}
+	return nil
+}
+
+// ImagePath returns the path of the image file
+func (r *Repository) ImagePath(id int32) string {
+	return filepath.Join(r.dir, fmt.Sprintf("firmware-%d", id))
+}
+
+// IsCompatible returns true if the image can be installed on devices of the
+// given hardware model.
+func IsCompatible(image *model.FirmwareImage, hardwareModel string) bool {
+	if len(image.HardwareModels) == 0 {
+		return true
+	}
+	for _, m := range image.HardwareModels {
+		if m == hardwareModel {
+			return true
+		}
+	}
+	return false
+}
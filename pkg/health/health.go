@@ -0,0 +1,113 @@
+// Package health serves the liveness and readiness probes of the server.
+// The server is alive as long as the database answers and the NATS
+// connection isn't closed for good. It's ready for new devices and requests
+// if the NATS connection is established and the server isn't draining.
+package health
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo"
+	"github.com/nats-io/nats.go"
+)
+
+// checkTimeout limits the time of the database check
+const checkTimeout = 2 * time.Second
+
+// Status values of the probes and their checks
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Result is the response of a probe
+type Result struct {
+	Status   string            `json:"status"`
+	Checks   map[string]string `json:"checks"`
+	Draining bool              `json:"draining"`
+}
+
+// Checker checks the connections of the server
+type Checker struct {
+	db       *sqlx.DB
+	nc       *nats.Conn
+	draining func() bool
+}
+
+// NewChecker creates a new checker. The draining function reports if the
+// server is draining.
+func NewChecker(db *sqlx.DB, nc *nats.Conn, draining func() bool) *Checker {
+	return &Checker{
+		db:       db,
+		nc:       nc,
+		draining: draining,
+	}
+}
+
+// RegisterRoutes attaches the probes to the echo web server
+func (h *Checker) RegisterRoutes(e *echo.Echo) {
+	e.GET("/healthz", h.handleLiveness)
+	e.GET("/readyz", h.handleReadiness)
+}
+
+// handleLiveness fails if the database doesn't answer or the NATS connection
+// is closed. A NATS connection which is reconnecting is still alive.
+func (h *Checker) handleLiveness(c echo.Context) error {
+	r := h.check(c.Request().Context(), func() string {
+		if h.nc.IsClosed() {
+			return "connection closed"
+		}
+		return StatusOK
+	})
+	return h.respond(c, r)
+}
+
+// handleReadiness fails if the database doesn't answer, the NATS connection
+// isn't established or the server is draining.
+func (h *Checker) handleReadiness(c echo.Context) error {
+	r := h.check(c.Request().Context(), func() string {
+		if !h.nc.IsConnected() {
+			return "not connected"
+		}
+		return StatusOK
+	})
+	if r.Draining {
+		r.Status = StatusUnavailable
+	}
+	return h.respond(c, r)
+}
+
+// check runs the database check and the given NATS check
+func (h *Checker) check(ctx context.Context, checkNATS func() string) *Result {
+	r := &Result{
+		Status:   StatusOK,
+		Checks:   make(map[string]string),
+		Draining: h.draining(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	if err := h.db.PingContext(ctx); err != nil {
+		r.Checks["database"] = err.Error()
+	} else {
+		r.Checks["database"] = StatusOK
+	}
+	r.Checks["nats"] = checkNATS()
+
+	for _, v := range r.Checks {
+		if v != StatusOK {
+			r.Status = StatusUnavailable
+		}
+	}
+	return r
+}
+
+func (h *Checker) respond(c echo.Context, r *Result) error {
+	if r.Status != StatusOK {
+		return c.JSON(http.StatusServiceUnavailable, r)
+	}
+	return c.JSON(http.StatusOK, r)
+}
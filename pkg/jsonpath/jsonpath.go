@@ -0,0 +1,230 @@
+// Package jsonpath selects values of decoded JSON documents by JSONPath
+// expressions. The supported subset is:
+//
+//	$              the root of the document
+//	.name          the member of an object
+//	['name']       the member of an object, the name may contain any character
+//	[n]            the element of an array, negative indexes count from the end
+//	[*] and .*     all members of an object or elements of an array
+//	..name         the members with the name at any depth
+package jsonpath
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type stepKind int
+
+const (
+	stepMember stepKind = iota
+	stepIndex
+	stepWildcard
+	stepDescendant
+)
+
+type step struct {
+	kind  stepKind
+	name  string
+	index int
+}
+
+// Path is a compiled JSONPath expression
+type Path struct {
+	expr  string
+	steps []step
+}
+
+// Compile parses the expression. The leading '$' is optional.
+func Compile(expr string) (*Path, error) {
+	p := &Path{expr: expr}
+
+	s := strings.TrimSpace(expr)
+	s = strings.TrimPrefix(s, "$")
+	if s != "" && s[0] != '.' && s[0] != '[' {
+		s = "." + s
+	}
+
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			name, rest := readName(s[2:])
+			if name == "" {
+				return nil, errors.Errorf("jsonpath '%s': missing member name after '..'", expr)
+			}
+			p.steps = append(p.steps, step{kind: stepDescendant, name: name})
+			s = rest
+		case s[0] == '.':
+			name, rest := readName(s[1:])
+			if name == "" {
+				return nil, errors.Errorf("jsonpath '%s': missing member name after '.'", expr)
+			}
+			if name == "*" {
+				p.steps = append(p.steps, step{kind: stepWildcard})
+			} else {
+				p.steps = append(p.steps, step{kind: stepMember, name: name})
+			}
+			s = rest
+		case s[0] == '[':
+			end := closingBracket(s)
+			if end < 0 {
+				return nil, errors.Errorf("jsonpath '%s': missing ']'", expr)
+			}
+			st, err := parseBracket(strings.TrimSpace(s[1:end]))
+			if err != nil {
+				return nil, errors.Wrapf(err, "jsonpath '%s'", expr)
+			}
+			p.steps = append(p.steps, st)
+			s = s[end+1:]
+		default:
+			return nil, errors.Errorf("jsonpath '%s': unexpected '%c'", expr, s[0])
+		}
+	}
+
+	return p, nil
+}
+
+// MustCompile is like Compile but panics if the expression is invalid
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the expression
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Select returns all values of the document matching the path. The result
+// is empty if nothing matches.
+func (p *Path) Select(doc interface{}) []interface{} {
+	current := []interface{}{doc}
+
+	for _, st := range p.steps {
+		next := make([]interface{}, 0)
+		for _, v := range current {
+			next = append(next, apply(st, v)...)
+		}
+		current = next
+	}
+
+	return current
+}
+
+// Select compiles the expression and returns all matching values
+func Select(doc interface{}, expr string) ([]interface{}, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Select(doc), nil
+}
+
+func apply(st step, v interface{}) []interface{} {
+	switch st.kind {
+	case stepMember:
+		if obj, ok := v.(map[string]interface{}); ok {
+			if elem, ok := obj[st.name]; ok {
+				return []interface{}{elem}
+			}
+		}
+	case stepIndex:
+		if arr, ok := v.([]interface{}); ok {
+			i := st.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				return []interface{}{arr[i]}
+			}
+		}
+	case stepWildcard:
+		return children(v)
+	case stepDescendant:
+		out := make([]interface{}, 0)
+		if obj, ok := v.(map[string]interface{}); ok {
+			if elem, ok := obj[st.name]; ok {
+				out = append(out, elem)
+			}
+		}
+		for _, child := range children(v) {
+			out = append(out, apply(st, child)...)
+		}
+		return out
+	}
+
+	return nil
+}
+
+// children returns the members of an object sorted by name or the elements
+// of an array
+func children(v interface{}) []interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		out := make([]interface{}, 0, len(t))
+		for _, k := range keys {
+			out = append(out, t[k])
+		}
+		return out
+	case []interface{}:
+		return t
+	}
+	return nil
+}
+
+func readName(s string) (name, rest string) {
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// closingBracket returns the index of the bracket closing the bracket at
+// the start of s. Brackets within quotes are ignored.
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == '\\':
+			i++
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote == 0 && (s[i] == '\'' || s[i] == '"'):
+			quote = s[i]
+		case quote == 0 && s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseBracket(s string) (step, error) {
+	if s == "*" {
+		return step{kind: stepWildcard}, nil
+	}
+
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		name := s[1 : len(s)-1]
+		name = strings.Replace(name, `\`+string(s[0]), string(s[0]), -1)
+		return step{kind: stepMember, name: name}, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return step{}, errors.Errorf("invalid subscript '%s'", s)
+	}
+	return step{kind: stepIndex, index: i}, nil
+}
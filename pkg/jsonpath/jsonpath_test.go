@@ -0,0 +1,75 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testDocument = `{
+	"status": "ok",
+	"device": {
+		"id": "dev1",
+		"a.b": 1,
+		"it's": 2,
+		"interfaces": [{"name": "eth0", "rx": 10}, {"name": "eth1", "rx": 20}]
+	}
+}`
+
+func TestSelect(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(testDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$.status", `["ok"]`},
+		{"status", `["ok"]`},
+		{"$.device.interfaces[0].name", `["eth0"]`},
+		{"$.device.interfaces[-1].rx", `[20]`},
+		{"$.device.interfaces[2]", `[]`},
+		{"$.device.interfaces[-3]", `[]`},
+		{"$.device.interfaces[*].name", `["eth0","eth1"]`},
+		{"$.device.interfaces.*.rx", `[10,20]`},
+		{"$.device.interfaces[0].*", `["eth0",10]`},
+		{"$..name", `["eth0","eth1"]`},
+		{"$..interfaces[1].rx", `[20]`},
+		{"$['device']['a.b']", `[1]`},
+		{`$.device["it's"]`, `[2]`},
+		{`$.device['it\'s']`, `[2]`},
+		{"$.missing.id", `[]`},
+		{"$.status[0]", `[]`},
+		{"$.status.length", `[]`},
+	}
+
+	for _, tc := range tests {
+		values, err := Select(doc, tc.expr)
+		if err != nil {
+			t.Errorf("Select(%s) failed: %s", tc.expr, err)
+			continue
+		}
+		got, _ := json.Marshal(values)
+		if string(got) != tc.want {
+			t.Errorf("Select(%s) = %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		"$.",
+		"$..",
+		"$.device.",
+		"$.device[",
+		"$.device['id'",
+		"$.device[id]",
+		"$.device[1.5]",
+		"$[0]x",
+	} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%s) succeeded, want error", expr)
+		}
+	}
+}
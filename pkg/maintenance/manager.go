@@ -0,0 +1,329 @@
+// Package maintenance manages the maintenance windows of the devices.
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/eventstream"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/targeting"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The device status published when a maintenance window begins and ends
+const (
+	StatusMaintenance      = "MAINTENANCE"
+	StatusMaintenanceEnded = "MAINTENANCE_ENDED"
+)
+
+// expireInterval is the interval expired maintenance windows are ended
+const expireInterval = 30 * time.Second
+
+// statusDetails are the details of the device status events
+type statusDetails struct {
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason,omitempty"`
+	RejectCalls bool      `json:"reject_calls,omitempty"`
+	SetBy       string    `json:"set_by,omitempty"`
+	Until       time.Time `json:"until"`
+}
+
+// Active returns the maintenance window of the device or nil if the device
+// isn't in maintenance. The windows of the groups the device is currently a
+// member of apply, too. A window which rejects calls is preferred. Expired
+// windows which aren't ended yet are ignored.
+func Active(store storage.Interface, namespace, deviceID string) (*model.Maintenance, error) {
+	var active *model.Maintenance
+	now := time.Now()
+	choose := func(m *model.Maintenance) {
+		if !m.Until.After(now) {
+			return
+		}
+		if active == nil || (m.RejectCalls && !active.RejectCalls) {
+			active = m
+		}
+	}
+
+	m, err := store.Maintenances().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err != storage.ErrNotFound {
+		return nil, err
+	} else if err == nil {
+		choose(m)
+	}
+
+	windows, err := store.Maintenances().FindGroupWindowsByNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(windows) == 0 || (active != nil && active.RejectCalls) {
+		return active, nil
+	}
+
+	d, err := store.Devices().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err == storage.ErrNotFound {
+		return active, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, elem := range windows {
+		w := elem
+		g, err := store.DeviceGroups().FindByID(w.GroupID)
+		if err == storage.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if targeting.IsMember(g, d) {
+			choose(&w)
+		}
+	}
+
+	return active, nil
+}
+
+// Manager sets and ends the maintenance windows. Every change is published
+// as device status event.
+type Manager struct {
+	events *eventstream.Publisher
+	store  storage.Interface
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewManager creates a new maintenance manager
+func NewManager(events *eventstream.Publisher, store storage.Interface) *Manager {
+	return &Manager{
+		events: events,
+		store:  store,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start ends the expired maintenance windows periodically
+func (mgr *Manager) Start() {
+	mgr.wg.Add(1)
+	go func() {
+		defer mgr.wg.Done()
+
+		ticker := time.NewTicker(expireInterval)
+		defer ticker.Stop()
+
+		for {
+			mgr.expire()
+
+			select {
+			case <-mgr.stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the expiry
+func (mgr *Manager) Stop() {
+	close(mgr.stopCh)
+	mgr.wg.Wait()
+}
+
+// Set puts the device into maintenance until the given time. An existing
+// window of the device is replaced.
+func (mgr *Manager) Set(namespace, deviceID, reason string, rejectCalls bool, setBy string, until time.Time) (*model.Maintenance, error) {
+	if !until.After(time.Now()) {
+		return nil, errors.New("maintenance window ends in the past")
+	}
+
+	m, err := mgr.store.Maintenances().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil && err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	if err == storage.ErrNotFound {
+		m = &model.Maintenance{
+			Namespace: namespace,
+			DeviceID:  deviceID,
+		}
+	}
+	m.Reason = reason
+	m.RejectCalls = rejectCalls
+	m.SetBy = setBy
+	m.Until = until.Round(time.Second).UTC()
+
+	if m.ID == 0 {
+		err = mgr.store.Maintenances().Create(m)
+	} else {
+		err = mgr.store.Maintenances().Update(m)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store maintenance window")
+	}
+
+	log.Infof("maintenance of device '%s' set by '%s' until %s", deviceID, setBy, m.Until)
+
+	if err := mgr.publishStatus(m, StatusMaintenance); err != nil {
+		log.Error("maintenance failed to publish device status: ", err)
+	}
+
+	return m, nil
+}
+
+// SetGroup puts the device group into maintenance until the given time. The
+// window applies to the devices which are members of the group while it
+// lasts. An existing window of the group is replaced.
+func (mgr *Manager) SetGroup(g *model.DeviceGroup, reason string, rejectCalls bool, setBy string, until time.Time) (*model.Maintenance, error) {
+	if !until.After(time.Now()) {
+		return nil, errors.New("maintenance window ends in the past")
+	}
+
+	m, err := mgr.store.Maintenances().FindByGroupID(g.ID)
+	if err != nil && err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	if err == storage.ErrNotFound {
+		m = &model.Maintenance{
+			Namespace: g.Namespace,
+			GroupID:   g.ID,
+		}
+	}
+	m.Reason = reason
+	m.RejectCalls = rejectCalls
+	m.SetBy = setBy
+	m.Until = until.Round(time.Second).UTC()
+
+	if m.ID == 0 {
+		err = mgr.store.Maintenances().Create(m)
+	} else {
+		err = mgr.store.Maintenances().Update(m)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to store maintenance window")
+	}
+
+	log.Infof("maintenance of device group '%s' set by '%s' until %s", g.Name, setBy, m.Until)
+
+	if err := mgr.publishStatus(m, StatusMaintenance); err != nil {
+		log.Error("maintenance failed to publish device status: ", err)
+	}
+
+	return m, nil
+}
+
+// End ends the maintenance window of the device
+func (mgr *Manager) End(namespace, deviceID string) error {
+	m, err := mgr.store.Maintenances().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err != nil {
+		return err
+	}
+
+	return mgr.end(m)
+}
+
+// EndGroup ends the maintenance window of the device group
+func (mgr *Manager) EndGroup(g *model.DeviceGroup) error {
+	m, err := mgr.store.Maintenances().FindByGroupID(g.ID)
+	if err != nil {
+		return err
+	}
+
+	return mgr.end(m)
+}
+
+// end removes the window. The status is published only if the window wasn't
+// removed in the meantime.
+func (mgr *Manager) end(m *model.Maintenance) error {
+	if err := mgr.store.Maintenances().Delete(m.ID); err == storage.ErrNotFound {
+		return err
+	} else if err != nil {
+		return errors.Wrap(err, "failed to delete maintenance window")
+	}
+
+	mgr.ended(m)
+
+	return nil
+}
+
+// ended logs the end of the removed window and publishes the status
+func (mgr *Manager) ended(m *model.Maintenance) {
+	if m.GroupID != 0 {
+		log.Infof("maintenance of device group %d ended", m.GroupID)
+	} else {
+		log.Infof("maintenance of device '%s' ended", m.DeviceID)
+	}
+
+	if err := mgr.publishStatus(m, StatusMaintenanceEnded); err != nil {
+		log.Error("maintenance failed to publish device status: ", err)
+	}
+}
+
+// expire ends all windows which are expired. Every instance runs it, the
+// windows removed by another instance are skipped.
+func (mgr *Manager) expire() {
+	windows, err := mgr.store.Maintenances().DeleteExpired(time.Now())
+	if err != nil {
+		log.Error("maintenance failed to delete expired maintenance windows: ", err)
+		return
+	}
+
+	for i := range windows {
+		mgr.ended(&windows[i])
+	}
+}
+
+// publishStatus publishes the status of the device of the window, or of the
+// current members of the device group of the window.
+func (mgr *Manager) publishStatus(m *model.Maintenance, status string) error {
+	deviceIDs := []string{m.DeviceID}
+	if m.GroupID != 0 {
+		g, err := mgr.store.DeviceGroups().FindByID(m.GroupID)
+		if err == storage.ErrNotFound {
+			// The group is gone, there are no members to notify
+			return nil
+		} else if err != nil {
+			return err
+		}
+		devices, err := targeting.Members(mgr.store, g)
+		if err != nil {
+			return err
+		}
+		deviceIDs = make([]string, 0, len(devices))
+		for _, d := range devices {
+			deviceIDs = append(deviceIDs, d.DeviceID)
+		}
+	}
+
+	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.events.devicestatus", m.Namespace)
+	for _, deviceID := range deviceIDs {
+		msg := message.EventMessage{
+			SourceType: message.SourceTypeDevice,
+			SourceID:   deviceID,
+			Timestamp:  time.Now().Round(time.Second).UTC(),
+			Details: &statusDetails{
+				Status:      status,
+				Reason:      m.Reason,
+				RejectCalls: m.RejectCalls,
+				SetBy:       m.SetBy,
+				Until:       m.Until,
+			},
+		}
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal event message")
+		}
+
+		if err := mgr.events.Publish(subj, data); err != nil {
+			return errors.Wrap(err, "failed to publish event message")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/eventstream"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// runServer starts an embedded NATS server and returns a connection to it
+func runServer(t *testing.T) (*nats.Conn, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nc, func() {
+		nc.Close()
+		s.Shutdown()
+	}
+}
+
+func TestActive(t *testing.T) {
+	store := memory.NewStore()
+	for _, d := range []*model.Device{
+		{Namespace: "default", DeviceID: "dev1", Labels: map[string]string{"site": "a"}},
+		{Namespace: "default", DeviceID: "dev2", Labels: map[string]string{"site": "b"}},
+		{Namespace: "default", DeviceID: "dev3"},
+	} {
+		if err := store.Devices().Create(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := &model.DeviceGroup{Namespace: "default", Name: "site-a", Selector: "site=a"}
+	if err := store.DeviceGroups().Create(g); err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	for _, m := range []*model.Maintenance{
+		{Namespace: "default", GroupID: g.ID, RejectCalls: true, Reason: "group", Until: future},
+		{Namespace: "default", DeviceID: "dev1", Reason: "device", Until: future},
+		{Namespace: "default", DeviceID: "dev3", Reason: "expired", Until: time.Now().Add(-time.Minute)},
+	} {
+		if err := store.Maintenances().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		deviceID string
+		want     string
+	}{
+		// The window of the group rejects calls and is preferred
+		{"dev1", "group"},
+		{"dev2", ""},
+		{"dev3", ""},
+		{"unknown", ""},
+	}
+
+	check := func() {
+		for _, tc := range tests {
+			m, err := Active(store, "default", tc.deviceID)
+			if err != nil {
+				t.Fatalf("Active(%s) failed: %s", tc.deviceID, err)
+			}
+			got := ""
+			if m != nil {
+				got = m.Reason
+			}
+			if got != tc.want {
+				t.Errorf("Active(%s) = %q, want %q", tc.deviceID, got, tc.want)
+			}
+		}
+	}
+	check()
+
+	// The group window applies to devices joining the group later
+	d, err := store.Devices().FindByNamespaceAndDeviceID("default", "dev2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Labels = map[string]string{"site": "a"}
+	if err := store.Devices().Update(d); err != nil {
+		t.Fatal(err)
+	}
+	tests[1].want = "group"
+	check()
+}
+
+func TestExpire(t *testing.T) {
+	nc, shutdown := runServer(t)
+	defer shutdown()
+
+	sub, err := nc.SubscribeSync("iotcore.devicecontrol.v1.default.events.devicestatus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.NewStore()
+	expired := &model.Maintenance{Namespace: "default", DeviceID: "dev1", Until: time.Now().Add(-time.Minute)}
+	for _, m := range []*model.Maintenance{
+		expired,
+		{Namespace: "default", DeviceID: "dev2", Until: time.Now().Add(time.Hour)},
+	} {
+		if err := store.Maintenances().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Two instances expire the window, the end is published once
+	mgr1 := NewManager(eventstream.NewPublisher(nc), store)
+	mgr2 := NewManager(eventstream.NewPublisher(nc), store)
+	mgr1.expire()
+	mgr2.expire()
+	if err := nc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("status of expired window isn't published: ", err)
+	}
+	ev := struct {
+		SourceID string `json:"source_id"`
+		Details  struct {
+			Status string `json:"status"`
+		} `json:"details"`
+	}{}
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.SourceID != "dev1" || ev.Details.Status != StatusMaintenanceEnded {
+		t.Errorf("published %s of %s, want %s of dev1", ev.Details.Status, ev.SourceID, StatusMaintenanceEnded)
+	}
+	if msg, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+		t.Errorf("unexpected status published: %s", msg.Data)
+	}
+
+	if _, err := store.Maintenances().FindByID(expired.ID); err != storage.ErrNotFound {
+		t.Errorf("expired window isn't removed: %v", err)
+	}
+	if windows, _ := store.Maintenances().FetchAll(); len(windows) != 1 {
+		t.Errorf("%d windows left, want 1", len(windows))
+	}
+
+	// A window ended already isn't ended again
+	if err := mgr1.end(expired); err != storage.ErrNotFound {
+		t.Errorf("end of removed window error = %v, want %v", err, storage.ErrNotFound)
+	}
+}
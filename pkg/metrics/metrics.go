@@ -0,0 +1,144 @@
+// Package metrics contains the Prometheus metrics of the devicecontrol
+// server. The metrics are registered with the default registry, Handler
+// exposes them.
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	namespace = "iotcore"
+	subsystem = "devicecontrol"
+)
+
+// Hops of a call. The client requests the controller, the controller
+// requests the control channel and the control channel calls the device.
+const (
+	HopClient     = "client"
+	HopController = "controller"
+	HopDevice     = "device"
+)
+
+// Directions of the control channel messages
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+var (
+	// SessionsConnected is the number of registered control channels of this
+	// server instance
+	SessionsConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "sessions_connected",
+		Help:      "Number of connected device sessions.",
+	}, []string{"namespace"})
+
+	// Hellos counts the registrations by result and rejection reason
+	Hellos = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "hello_total",
+		Help:      "Number of HELLO messages by result and rejection reason.",
+	}, []string{"result", "reason"})
+
+	// Messages counts the control channel messages by direction and type
+	Messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "messages_total",
+		Help:      "Number of control channel messages by direction and type.",
+	}, []string{"direction", "type"})
+
+	// CallDuration observes the latency of the calls per hop
+	CallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "call_duration_seconds",
+		Help:      "Latency of device calls per hop.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20},
+	}, []string{"hop"})
+
+	// CallTimeouts counts the timed out calls per hop
+	CallTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "call_timeouts_total",
+		Help:      "Number of timed out device calls per hop.",
+	}, []string{"hop"})
+
+	// NATSRequestErrors counts the failed NATS requests by request type
+	NATSRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "nats_request_errors_total",
+		Help:      "Number of failed NATS requests by request type.",
+	}, []string{"request"})
+
+	// StoreQueryDuration observes the latency of the database queries by
+	// operation and table
+	StoreQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "store_query_duration_seconds",
+		Help:      "Latency of the store queries by operation and table.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation", "table"})
+
+	// WebsocketDisconnects counts the closed device websockets by cause
+	WebsocketDisconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "websocket_disconnects_total",
+		Help:      "Number of device websocket disconnects by cause.",
+	}, []string{"cause"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		SessionsConnected,
+		Hellos,
+		Messages,
+		CallDuration,
+		CallTimeouts,
+		NATSRequestErrors,
+		StoreQueryDuration,
+		WebsocketDisconnects,
+	)
+}
+
+// Handler returns the HTTP handler exposing the metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveCall observes the duration of a call since start at the hop
+func ObserveCall(hop string, start time.Time) {
+	CallDuration.WithLabelValues(hop).Observe(time.Since(start).Seconds())
+}
+
+// RegisterOutboxDepth exposes the number of unpublished events in the outbox.
+// The count is called on every scrape.
+func RegisterOutboxDepth(count func() (int, error)) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "outbox_depth",
+		Help:      "Number of events in the outbox waiting for publication.",
+	}, func() float64 {
+		n, err := count()
+		if err != nil {
+			log.Error("metrics failed to count outbox entries: ", err)
+			return math.NaN()
+		}
+		return float64(n)
+	}))
+}
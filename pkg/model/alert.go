@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// Alert is raised by a rule for a device. Further matching events of the
+// same rule and device increment the count until the alert is resolved.
+// AcknowledgedAt and ResolvedAt are zero until the alert is acknowledged
+// or resolved.
+type Alert struct {
+	ID             int32
+	Namespace      string
+	DeviceID       string
+	RuleID         int32
+	Severity       string
+	Message        string
+	Status         string
+	Count          int
+	LastEventID    int32
+	AcknowledgedBy string
+	AcknowledgedAt time.Time
+	ResolvedBy     string
+	ResolvedAt     time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// States of an alert
+const (
+	AlertStatusOpen         = "open"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+)
+
+// Severities of an alert
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// ConfigVersion is an archived running configuration of a device. Versions
+// are numbered per device, a configuration equal to the latest version is
+// not archived again.
+type ConfigVersion struct {
+	ID        int32
+	Namespace string
+	DeviceID  string
+	Version   int
+	Checksum  string
+	Content   string
+	Source    string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Sources of an archived configuration
+const (
+	ConfigVersionSourceManual   = "manual"
+	ConfigVersionSourcePeriodic = "periodic"
+	ConfigVersionSourceRestore  = "restore"
+)
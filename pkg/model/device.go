@@ -12,6 +12,28 @@ type Device struct {
 	PingInterval   int
 	PongTimeout    int
 	EventsTopic    string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	// TunnelPorts is the allowlist of target ports which can be reached
+	// through a tunnel of the device
+	TunnelPorts []int
+
+	// Inventory details, the hardware, firmware and network details are
+	// reported by the device on connect
+	DeviceType                string
+	Name                      string
+	Location                  string
+	AssetTag                  string
+	Group                     string
+	HardwareModel             string
+	HardwareRevision          string
+	HardwareSerialNumber      string
+	FirmwareVersion           string
+	NetworkHostname           string
+	NetworkDomainname         string
+	NetworkPrimaryIPv4Address string
+
+	// Labels are arbitrary key/value pairs for selecting devices
+	Labels map[string]string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// DeviceGroup is a named set of devices. The members are the static members,
+// the devices matching the label selector and the devices whose inventory
+// group equals the name of the group.
+type DeviceGroup struct {
+	ID          int32
+	Namespace   string
+	Name        string
+	Description string
+	Selector    string
+	Members     []string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
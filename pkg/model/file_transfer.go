@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// FileTransfer is a chunked transfer of a file to or from a device. The file
+// content is stored in the blob directory. Offset is the number of bytes
+// transferred so far, a transfer is resumed from there. Uploads of shared
+// content, e.g. firmware images, refer to an existing blob instead. Owner is
+// the manager running the transfer, its claim expires at LeaseUntil.
+type FileTransfer struct {
+	ID         int32
+	Namespace  string
+	DeviceID   string
+	Direction  string
+	Path       string
+	Size       int64
+	Offset     int64
+	Checksum   string
+	Status     string
+	Error      string
+	Blob       string
+	Owner      string
+	LeaseUntil time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Directions of a file transfer
+const (
+	FileTransferDirectionUpload   = "upload"
+	FileTransferDirectionDownload = "download"
+)
+
+// States of a file transfer
+const (
+	FileTransferStatusPending     = "pending"
+	FileTransferStatusRunning     = "running"
+	FileTransferStatusInterrupted = "interrupted"
+	FileTransferStatusCompleted   = "completed"
+	FileTransferStatusFailed      = "failed"
+)
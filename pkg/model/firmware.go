@@ -0,0 +1,70 @@
+package model
+
+import "time"
+
+// FirmwareImage is a firmware image of the firmware repository. The image
+// is compatible with the listed hardware models. The content is stored in
+// the blob directory.
+type FirmwareImage struct {
+	ID             int32
+	Version        string
+	HardwareModels []string
+	Filename       string
+	Size           int64
+	Checksum       string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FirmwareCampaign rolls out a firmware image to devices in batches. The
+// campaign halts if the failure rate of the finished updates exceeds
+// MaxFailureRate. Owner is the orchestrator running the campaign, its claim
+// expires at LeaseUntil.
+type FirmwareCampaign struct {
+	ID             int32
+	Namespace      string
+	ImageID        int32
+	BatchSize      int
+	MaxFailureRate float64
+	Status         string
+	Error          string
+	Owner          string
+	LeaseUntil     time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// States of a firmware campaign
+const (
+	FirmwareCampaignStatusRunning   = "running"
+	FirmwareCampaignStatusHalted    = "halted"
+	FirmwareCampaignStatusCompleted = "completed"
+)
+
+// FirmwareUpdate is the update of a single device within a campaign
+type FirmwareUpdate struct {
+	ID         int32
+	CampaignID int32
+	Namespace  string
+	DeviceID   string
+	Status     string
+	Error      string
+	TransferID int32
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// States of a firmware update
+const (
+	FirmwareUpdateStatusPending     = "pending"
+	FirmwareUpdateStatusDownloading = "downloading"
+	FirmwareUpdateStatusVerifying   = "verifying"
+	FirmwareUpdateStatusInstalling  = "installing"
+	FirmwareUpdateStatusRebooting   = "rebooting"
+	FirmwareUpdateStatusDone        = "done"
+	FirmwareUpdateStatusFailed      = "failed"
+	FirmwareUpdateStatusSkipped     = "skipped"
+)
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Maintenance is the maintenance window of a device. Alerting and
+// availability penalties are suppressed until the window expires. If
+// RejectCalls is true only admins may call the device. The window of a
+// device group has the GroupID and no DeviceID, it applies to the devices
+// which are members of the group at any time.
+type Maintenance struct {
+	ID          int32
+	Namespace   string
+	DeviceID    string
+	GroupID     int32
+	Reason      string
+	RejectCalls bool
+	SetBy       string
+	Until       time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// OutboxEntry is a stored event which isn't published yet. The entry is
+// written in the same transaction as the event and deleted once the event is
+// published. Failed publications are retried at NextAttemptAt.
+type OutboxEntry struct {
+	ID            int32
+	EventID       int32
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
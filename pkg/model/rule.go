@@ -0,0 +1,73 @@
+package model
+
+import "time"
+
+// Rule reacts to the events matching the namespace, the topic, the source
+// and all conditions by running the actions. Empty matchers match all
+// events, the topic and the source ID may contain glob patterns.
+type Rule struct {
+	ID          int32
+	Namespace   string
+	Name        string
+	Description string
+	Enabled     bool
+	Topic       string
+	SourceType  string
+	SourceID    string
+	Conditions  []RuleCondition
+	Actions     []RuleAction
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RuleCondition compares the values selected by the JSONPath expression
+// from the event details with the value. The condition is met if any
+// selected value matches.
+type RuleCondition struct {
+	Path     string      `json:"path"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// Operators of a rule condition
+const (
+	RuleOperatorEquals         = "eq"
+	RuleOperatorNotEquals      = "ne"
+	RuleOperatorGreater        = "gt"
+	RuleOperatorGreaterOrEqual = "gte"
+	RuleOperatorLess           = "lt"
+	RuleOperatorLessOrEqual    = "lte"
+	RuleOperatorExists         = "exists"
+	RuleOperatorContains       = "contains"
+	RuleOperatorMatches        = "matches"
+)
+
+// RuleAction is run for a matching event. The fields used depend on the type
+// of the action.
+type RuleAction struct {
+	Type string `json:"type"`
+
+	// Alert
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message,omitempty"`
+
+	// Publish
+	Subject string `json:"subject,omitempty"`
+
+	// Device call, the source of the event is called if DeviceID is empty
+	DeviceID  string      `json:"deviceId,omitempty"`
+	Command   string      `json:"command,omitempty"`
+	Arguments interface{} `json:"arguments,omitempty"`
+
+	// Webhook
+	URL string `json:"url,omitempty"`
+}
+
+// Types of a rule action
+const (
+	RuleActionAlert   = "alert"
+	RuleActionPublish = "publish"
+	RuleActionCall    = "call"
+	RuleActionWebhook = "webhook"
+)
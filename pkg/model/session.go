@@ -11,6 +11,13 @@ type Session struct {
 	SessionTimeout int
 	LastMessageAt  time.Time
 
+	// Negotiated capabilities and firmware details declared by the device
+	// during the HELLO/WELCOME handshake
+	ProtocolVersion int
+	Features        []string
+	FirmwareVersion string
+	HardwareModel   string
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
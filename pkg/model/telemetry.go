@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// MetricMapping extracts the values selected by the JSONPath expression from
+// the details of the events matching the namespace and the topic, the values
+// are stored as samples of the metric. Empty matchers match all events, the
+// topic may contain glob patterns.
+type MetricMapping struct {
+	ID          int32
+	Namespace   string
+	Metric      string
+	Topic       string
+	Path        string
+	Unit        string
+	Description string
+	Enabled     bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MetricSample is a value of a metric of a device. A sample is identified by
+// the event it was extracted from and the metric.
+type MetricSample struct {
+	EventID   int32
+	Namespace string
+	DeviceID  string
+	Metric    string
+	Timestamp time.Time
+	Value     float64
+}
+
+// MetricRollup aggregates the samples of a metric of a device within the
+// bucket, which starts at Bucket and lasts Resolution.
+type MetricRollup struct {
+	Namespace  string
+	DeviceID   string
+	Metric     string
+	Resolution time.Duration
+	Bucket     time.Time
+	Count      int
+	Sum        float64
+	Min        float64
+	Max        float64
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// Transcript is the recording of an interactive stream on a device, e.g. a
+// remote CLI session. EndedAt is zero as long as the stream is open.
+type Transcript struct {
+	ID          int32
+	Namespace   string
+	DeviceID    string
+	Kind        string
+	Username    string
+	StartedAt   time.Time
+	EndedAt     time.Time
+	CloseReason string
+	// Content contains the recorded input and output as JSON encoded list
+	// of TranscriptEntry
+	Content string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TranscriptEntry is a chunk of data sent to or received from the device.
+// The data is base64 encoded in JSON, since terminal output isn't
+// necessarily valid UTF-8. Entries recorded before contain the data as plain
+// string and no encoding.
+type TranscriptEntry struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Encoding  string    `json:"encoding,omitempty"`
+	Data      []byte    `json:"data"`
+}
+
+// TranscriptEncodingBase64 is the encoding of the data of a transcript entry
+const TranscriptEncodingBase64 = "base64"
+
+// Directions of a transcript entry
+const (
+	TranscriptDirectionInput  = "input"
+	TranscriptDirectionOutput = "output"
+)
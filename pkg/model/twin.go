@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Twin is the state document of a device. Desired is the state set by the
+// users, Reported is the state published by the device. Both are JSON
+// objects. The version is incremented on every change of the document.
+type Twin struct {
+	ID        int32
+	Namespace string
+	DeviceID  string
+	Desired   string
+	Reported  string
+	Version   int
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
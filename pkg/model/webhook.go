@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// Webhook is the subscription of an HTTP endpoint to the events. Empty
+// filters match all events, the topics may contain glob patterns. The
+// payloads are signed with the secret.
+type Webhook struct {
+	ID          int32
+	Namespace   string
+	URL         string
+	Secret      string
+	Topics      []string
+	Description string
+	Enabled     bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookDelivery is an event delivered to a webhook. Failed deliveries are
+// retried at NextAttemptAt until the maximum attempts are reached, then the
+// delivery is dead.
+type WebhookDelivery struct {
+	ID             int32
+	WebhookID      int32
+	Namespace      string
+	Topic          string
+	Payload        string
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// States of a webhook delivery
+const (
+	WebhookDeliveryStatusPending   = "pending"
+	WebhookDeliveryStatusDelivered = "delivered"
+	WebhookDeliveryStatusDead      = "dead"
+)
@@ -0,0 +1,228 @@
+// Package outbox publishes the stored events. The events are stored together
+// with an outbox entry in one transaction, the relay publishes the events of
+// the entries and deletes them. Failed publications are retried, so every
+// stored event is published at least once, always with its publication ID.
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/eventstream"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// pollInterval is the interval the due entries are checked
+	pollInterval = time.Second
+
+	// lease is the time a claimed entry is hidden from other relays
+	lease = 30 * time.Second
+
+	// batchSize is the number of entries claimed at once
+	batchSize = 100
+
+	// maxBackoff limits the delay between two attempts
+	maxBackoff = time.Minute
+)
+
+// Relay publishes the events of the outbox
+type Relay struct {
+	events *eventstream.Publisher
+	store  storage.Interface
+
+	wakeCh chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewRelay creates a new outbox relay
+func NewRelay(events *eventstream.Publisher, store storage.Interface) *Relay {
+	return &Relay{
+		events: events,
+		store:  store,
+		wakeCh: make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start publishes the outbox entries, including the entries left by a
+// previous run
+func (r *Relay) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			for r.relay() {
+			}
+
+			select {
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+			case <-r.wakeCh:
+			}
+		}
+	}()
+}
+
+// Stop stops the relay. Unpublished entries are published by the next run.
+func (r *Relay) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+}
+
+// Notify tells the relay that new entries are stored
+func (r *Relay) Notify() {
+	select {
+	case r.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// relay publishes a batch of due entries in the order of the events. It
+// returns true if the batch was full and all events were published.
+func (r *Relay) relay() bool {
+	entries, err := r.store.Outbox().ClaimDue(time.Now().UTC(), lease, batchSize)
+	if err != nil {
+		log.Error("outbox failed to claim entries: ", err)
+		return false
+	}
+
+	ids := make([]int32, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return entries[ids[i]].EventID < entries[ids[j]].EventID })
+
+	published := make([]int32, 0, len(ids))
+	complete := true
+	for i, id := range ids {
+		m := entries[id]
+		if err := r.publish(&m); err != nil {
+			// NATS is probably unavailable, the remaining entries are
+			// retried together with the failed one
+			r.fail(&m, err)
+			for _, rest := range ids[i+1:] {
+				other := entries[rest]
+				other.NextAttemptAt = m.NextAttemptAt
+				if err := r.store.Outbox().Update(&other); err != nil {
+					log.Errorf("outbox failed to update entry %d: %s", other.ID, err)
+				}
+			}
+			complete = false
+			break
+		}
+		published = append(published, id)
+	}
+
+	// Core NATS buffers the published events, the entries are deleted after
+	// the server received them. Otherwise they're published again after the
+	// lease.
+	if len(published) == 0 {
+		return false
+	}
+	if err := r.events.Flush(); err != nil {
+		log.Warnf("outbox failed to flush %d events: %s", len(published), err)
+		return false
+	}
+
+	for _, id := range published {
+		if err := r.store.Outbox().Delete(id); err != nil {
+			log.Errorf("outbox failed to delete entry %d: %s", id, err)
+		}
+	}
+
+	return complete && len(entries) == batchSize
+}
+
+// publish publishes the event of the entry. Entries of events which can't
+// be published ever are deleted.
+func (r *Relay) publish(m *model.OutboxEntry) error {
+	ev, err := r.store.Events().FindByID(m.EventID)
+	if err == storage.ErrNotFound {
+		log.Errorf("outbox dropped entry %d, event %d doesn't exist", m.ID, m.EventID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	msg, err := EventMessage(ev)
+	if err != nil {
+		log.Errorf("outbox dropped entry %d of invalid event %d: %s", m.ID, m.EventID, err)
+		return nil
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event message")
+	}
+
+	if err := r.events.PublishWithID(Subject(ev), data, strconv.Itoa(int(ev.ID))); err != nil {
+		return errors.Wrap(err, "failed to publish event message")
+	}
+
+	return nil
+}
+
+func (r *Relay) fail(m *model.OutboxEntry, err error) {
+	m.Attempts++
+	m.LastError = err.Error()
+
+	backoff := time.Second
+	for i := 1; i < m.Attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	m.NextAttemptAt = time.Now().UTC().Add(backoff)
+
+	log.Warnf("outbox failed to publish event %d, attempt %d: %s", m.EventID, m.Attempts, err)
+
+	if err := r.store.Outbox().Update(m); err != nil {
+		log.Errorf("outbox failed to update entry %d: %s", m.ID, err)
+	}
+}
+
+// Subject returns the NATS subject of the event
+func Subject(m *model.Event) string {
+	return fmt.Sprintf("iotcore.devicecontrol.v1.%s.events.%s", m.Namespace, m.Topic)
+}
+
+// EventMessage returns the event message published for the stored event.
+// The publication ID is the ID of the event.
+func EventMessage(m *model.Event) (*message.EventMessage, error) {
+	// Unmarshal the details string back to an interface. Since we're marshalling
+	// the events message to the queue, we subscribers receives a proper JSON.
+	// Otherwise the details are marshalled as an escaped string.
+	var details interface{}
+	if err := json.Unmarshal([]byte(m.Details), &details); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal event details")
+	}
+
+	srcType, err := message.SourceTypeFromString(m.SourceType)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid event source type")
+	}
+
+	return &message.EventMessage{
+		SourceType:    srcType,
+		SourceID:      m.SourceID,
+		PublicationID: m.ID,
+		Timestamp:     m.Timestamp,
+		Details:       details,
+	}, nil
+}
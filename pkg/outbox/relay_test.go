@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/eventstream"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// runServer starts an embedded NATS server and returns its URL
+func runServer(t *testing.T) (string, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+	return s.ClientURL(), s.Shutdown
+}
+
+func connect(t *testing.T, url string) *nats.Conn {
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nc
+}
+
+func createEvents(t *testing.T, store storage.Interface, n int) {
+	for i := 0; i < n; i++ {
+		m := &model.Event{
+			Namespace:  "default",
+			SourceType: "DEVICE",
+			SourceID:   "dev1",
+			Topic:      "alert",
+			Timestamp:  time.Now().UTC(),
+			Details:    `{}`,
+		}
+		if err := store.Events().CreateWithOutbox(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// expectPublications receives the events and checks their publication IDs
+func expectPublications(t *testing.T, sub *nats.Subscription, from, to int32) {
+	for want := from; want <= to; want++ {
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("event %d wasn't published: %s", want, err)
+		}
+		var ev struct {
+			PublicationID int32 `json:"publication_id"`
+		}
+		if err := json.Unmarshal(msg.Data, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.PublicationID != want {
+			t.Fatalf("published event %d, want %d", ev.PublicationID, want)
+		}
+	}
+}
+
+func expectOutbox(t *testing.T, store storage.Interface, want int) {
+	n, err := store.Outbox().Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != want {
+		t.Errorf("outbox has %d entries, want %d", n, want)
+	}
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	nc := connect(t, url)
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("iotcore.devicecontrol.v1.*.events.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.NewStore()
+	createEvents(t, store, batchSize+batchSize/2)
+	r := NewRelay(eventstream.NewPublisher(nc), store)
+
+	// A full batch tells the caller to continue with the next batch
+	if !r.relay() {
+		t.Error("relay of a full batch returned false")
+	}
+	if r.relay() {
+		t.Error("relay of the last batch returned true")
+	}
+
+	expectPublications(t, sub, 1, batchSize+batchSize/2)
+	expectOutbox(t, store, 0)
+}
+
+func TestRelayRetriesInOrder(t *testing.T) {
+	url, shutdown := runServer(t)
+	defer shutdown()
+
+	store := memory.NewStore()
+	createEvents(t, store, 3)
+
+	// The publish fails, all entries are retried together
+	closed := connect(t, url)
+	closed.Close()
+	r := NewRelay(eventstream.NewPublisher(closed), store)
+	if r.relay() {
+		t.Error("failed relay returned true")
+	}
+	expectOutbox(t, store, 3)
+
+	entries, err := store.Outbox().FetchAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := entries[1]
+	if first.Attempts != 1 || first.LastError == "" {
+		t.Errorf("failed entry has %d attempts and error %q", first.Attempts, first.LastError)
+	}
+	for _, m := range entries {
+		if !m.NextAttemptAt.Equal(first.NextAttemptAt) {
+			t.Errorf("entry %d is retried at %s, want %s", m.ID, m.NextAttemptAt, first.NextAttemptAt)
+		}
+	}
+
+	nc := connect(t, url)
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("iotcore.devicecontrol.v1.*.events.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.events = eventstream.NewPublisher(nc)
+
+	// The entries aren't due before the backoff
+	r.relay()
+	expectOutbox(t, store, 3)
+
+	// The entries are published in order after the backoff
+	for _, m := range entries {
+		m.NextAttemptAt = time.Now().UTC()
+		if err := store.Outbox().Update(&m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.relay()
+	expectPublications(t, sub, 1, 3)
+	expectOutbox(t, store, 0)
+}
@@ -0,0 +1,298 @@
+// Package rules evaluates the stored events against the rules and runs the
+// actions of the matching rules, e.g. raising alerts.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/client"
+	"github.com/nsyszr/lcm/pkg/eventstream"
+	"github.com/nsyszr/lcm/pkg/maintenance"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TopicAlert is the event topic the changes of alerts are published to
+const TopicAlert = "alert"
+
+// webhookTimeout limits the time a webhook may take
+const webhookTimeout = 10 * time.Second
+
+// eventData is passed to the actions. It's the payload of the publish and
+// webhook actions and the data of the alert message template.
+type eventData struct {
+	EventID    int32       `json:"event_id"`
+	RuleID     int32       `json:"rule_id"`
+	RuleName   string      `json:"rule_name"`
+	Namespace  string      `json:"namespace"`
+	SourceType string      `json:"source_type"`
+	SourceID   string      `json:"source_id"`
+	Topic      string      `json:"topic"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Details    interface{} `json:"details"`
+}
+
+// alertDetails are the details of the alert events
+type alertDetails struct {
+	AlertID  int32  `json:"alert_id"`
+	RuleID   int32  `json:"rule_id"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Status   string `json:"status"`
+	Count    int    `json:"count"`
+}
+
+// Engine evaluates events against the rules
+type Engine struct {
+	nc     *nats.Conn
+	events *eventstream.Publisher
+	store  storage.Interface
+	client *client.Client
+	http   *http.Client
+}
+
+// NewEngine creates a new rules engine. The alerts are published by the
+// event publisher.
+func NewEngine(nc *nats.Conn, events *eventstream.Publisher, store storage.Interface) *Engine {
+	return &Engine{
+		nc:     nc,
+		events: events,
+		store:  store,
+		client: client.New(nc),
+		http:   &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Evaluate runs the actions of all rules matching the event
+func (e *Engine) Evaluate(ev *model.Event) {
+	rules, err := e.store.Rules().FetchAll()
+	if err != nil {
+		log.Error("rules failed to fetch rules: ", err)
+		return
+	}
+
+	var details interface{}
+	if err := json.Unmarshal([]byte(ev.Details), &details); err != nil {
+		log.Errorf("rules failed to unmarshal details of event %d: %s", ev.ID, err)
+		return
+	}
+
+	for _, r := range rules {
+		if !Matches(&r, ev, details) {
+			continue
+		}
+
+		log.Debugf("rules event %d matches rule '%s'", ev.ID, r.Name)
+
+		data := &eventData{
+			EventID:    ev.ID,
+			RuleID:     r.ID,
+			RuleName:   r.Name,
+			Namespace:  ev.Namespace,
+			SourceType: ev.SourceType,
+			SourceID:   ev.SourceID,
+			Topic:      ev.Topic,
+			Timestamp:  ev.Timestamp,
+			Details:    details,
+		}
+		for _, a := range r.Actions {
+			if err := e.run(&r, a, data); err != nil {
+				log.Errorf("rules failed to run %s action of rule '%s': %s", a.Type, r.Name, err)
+			}
+		}
+	}
+}
+
+func (e *Engine) run(r *model.Rule, a model.RuleAction, data *eventData) error {
+	switch a.Type {
+	case model.RuleActionAlert:
+		return e.raiseAlert(r, a, data)
+	case model.RuleActionPublish:
+		// Rules stored before the subject was validated are skipped
+		if reservedSubject(a.Subject) {
+			return errors.Errorf("subject '%s' is reserved", a.Subject)
+		}
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal event")
+		}
+		return e.nc.Publish(a.Subject, payload)
+	case model.RuleActionCall:
+		deviceID := a.DeviceID
+		if deviceID == "" {
+			deviceID = data.SourceID
+		}
+		// Device calls may take a while, don't block the other actions
+		go func() {
+			if err := e.client.Call(data.Namespace, deviceID, a.Command, a.Arguments, nil); err != nil {
+				log.Errorf("rules failed to call '%s' on device '%s': %s", a.Command, deviceID, err)
+			}
+		}()
+		return nil
+	case model.RuleActionWebhook:
+		return e.callWebhook(a.URL, data)
+	}
+
+	return errors.Errorf("unknown action type '%s'", a.Type)
+}
+
+// raiseAlert opens an alert for the source device of the event. If the rule
+// has an unresolved alert for the device its count is incremented instead.
+// No alerts are raised for devices in maintenance.
+func (e *Engine) raiseAlert(r *model.Rule, a model.RuleAction, data *eventData) error {
+	window, err := maintenance.Active(e.store, data.Namespace, data.SourceID)
+	if err != nil {
+		return err
+	} else if window != nil {
+		log.Debugf("rules suppressed alert of rule '%s' for device '%s' in maintenance", r.Name, data.SourceID)
+		return nil
+	}
+
+	msg := renderMessage(a.Message, data)
+
+	alert, err := e.store.Alerts().FindUnresolved(r.ID, data.Namespace, data.SourceID)
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+
+	if err == storage.ErrNotFound {
+		alert = &model.Alert{
+			Namespace:   data.Namespace,
+			DeviceID:    data.SourceID,
+			RuleID:      r.ID,
+			Severity:    a.Severity,
+			Message:     msg,
+			Status:      model.AlertStatusOpen,
+			Count:       1,
+			LastEventID: data.EventID,
+		}
+		if err := e.store.Alerts().Create(alert); err != nil {
+			return errors.Wrap(err, "failed to create alert")
+		}
+	} else {
+		alert.Severity = a.Severity
+		alert.Message = msg
+		alert.Count++
+		alert.LastEventID = data.EventID
+		if err := e.store.Alerts().Update(alert); err != nil {
+			return errors.Wrap(err, "failed to update alert")
+		}
+	}
+
+	return e.publishAlert(alert)
+}
+
+// Acknowledge marks the alert as acknowledged by the user. Resolved alerts
+// can't be acknowledged.
+func (e *Engine) Acknowledge(id int32, user string) (*model.Alert, error) {
+	alert, err := e.store.Alerts().FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status == model.AlertStatusResolved {
+		return nil, storage.ErrConflict
+	}
+
+	alert.Status = model.AlertStatusAcknowledged
+	alert.AcknowledgedBy = user
+	alert.AcknowledgedAt = time.Now().Round(time.Second).UTC()
+	if err := e.store.Alerts().Update(alert); err != nil {
+		return nil, errors.Wrap(err, "failed to update alert")
+	}
+
+	return alert, e.publishAlert(alert)
+}
+
+// Resolve marks the alert as resolved by the user. The next matching event
+// opens a new alert.
+func (e *Engine) Resolve(id int32, user string) (*model.Alert, error) {
+	alert, err := e.store.Alerts().FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status == model.AlertStatusResolved {
+		return nil, storage.ErrConflict
+	}
+
+	alert.Status = model.AlertStatusResolved
+	alert.ResolvedBy = user
+	alert.ResolvedAt = time.Now().Round(time.Second).UTC()
+	if err := e.store.Alerts().Update(alert); err != nil {
+		return nil, errors.Wrap(err, "failed to update alert")
+	}
+
+	return alert, e.publishAlert(alert)
+}
+
+// publishAlert publishes the state of the alert as event of the device
+func (e *Engine) publishAlert(a *model.Alert) error {
+	data, err := json.Marshal(struct {
+		SourceType string       `json:"source_type"`
+		SourceID   string       `json:"source_id"`
+		Timestamp  time.Time    `json:"timestamp"`
+		Details    alertDetails `json:"details"`
+	}{
+		SourceType: "SYSTEM",
+		SourceID:   a.DeviceID,
+		Timestamp:  time.Now().Round(time.Second).UTC(),
+		Details: alertDetails{
+			AlertID:  a.ID,
+			RuleID:   a.RuleID,
+			Severity: a.Severity,
+			Message:  a.Message,
+			Status:   a.Status,
+			Count:    a.Count,
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal alert event")
+	}
+
+	subj := fmt.Sprintf("iotcore.devicecontrol.v1.%s.events.%s", a.Namespace, TopicAlert)
+	return e.events.Publish(subj, data)
+}
+
+func (e *Engine) callWebhook(url string, data *eventData) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	res, err := e.http.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "failed to call webhook")
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("webhook replied with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func parseTemplate(s string) (*template.Template, error) {
+	return template.New("message").Option("missingkey=zero").Parse(s)
+}
+
+// renderMessage renders the message template with the event. The template
+// is returned unchanged if it can't be rendered.
+func renderMessage(s string, data *eventData) string {
+	tmpl, err := parseTemplate(s)
+	if err != nil {
+		return s
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return s
+	}
+	return buf.String()
+}
@@ -0,0 +1,269 @@
+package rules
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/nsyszr/lcm/pkg/jsonpath"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/pkg/errors"
+)
+
+// reservedSubjectPrefix is the namespace of the control subjects of the
+// service. Rules must not publish to it, otherwise a rule could inject calls
+// or control messages.
+const reservedSubjectPrefix = "iotcore.devicecontrol."
+
+// Matches returns true if the event matches the rule. The details are the
+// decoded details of the event.
+func Matches(r *model.Rule, ev *model.Event, details interface{}) bool {
+	if !r.Enabled {
+		return false
+	}
+	if r.Namespace != "" && r.Namespace != ev.Namespace {
+		return false
+	}
+	if r.SourceType != "" && r.SourceType != ev.SourceType {
+		return false
+	}
+	if !matchesPattern(r.Topic, ev.Topic) || !matchesPattern(r.SourceID, ev.SourceID) {
+		return false
+	}
+
+	for _, c := range r.Conditions {
+		ok, err := evaluate(c, details)
+		if err != nil || !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Validate checks the matchers, the conditions and the actions of the rule
+func Validate(r *model.Rule) error {
+	for _, pattern := range []string{r.Topic, r.SourceID} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Errorf("invalid pattern '%s'", pattern)
+		}
+	}
+
+	for _, c := range r.Conditions {
+		if _, err := jsonpath.Compile(c.Path); err != nil {
+			return err
+		}
+		switch c.Operator {
+		case model.RuleOperatorEquals, model.RuleOperatorNotEquals,
+			model.RuleOperatorGreater, model.RuleOperatorGreaterOrEqual,
+			model.RuleOperatorLess, model.RuleOperatorLessOrEqual,
+			model.RuleOperatorContains:
+		case model.RuleOperatorExists:
+			if _, ok := c.Value.(bool); c.Value != nil && !ok {
+				return errors.Errorf("condition '%s': value of operator exists must be a boolean", c.Path)
+			}
+		case model.RuleOperatorMatches:
+			s, ok := c.Value.(string)
+			if !ok {
+				return errors.Errorf("condition '%s': value of operator matches must be a string", c.Path)
+			}
+			if _, err := regexp.Compile(s); err != nil {
+				return errors.Wrapf(err, "condition '%s'", c.Path)
+			}
+		default:
+			return errors.Errorf("condition '%s': unknown operator '%s'", c.Path, c.Operator)
+		}
+	}
+
+	if len(r.Actions) == 0 {
+		return errors.New("rule has no actions")
+	}
+	for _, a := range r.Actions {
+		if err := validateAction(a); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateAction(a model.RuleAction) error {
+	switch a.Type {
+	case model.RuleActionAlert:
+		switch a.Severity {
+		case model.AlertSeverityInfo, model.AlertSeverityWarning, model.AlertSeverityCritical:
+		default:
+			return errors.Errorf("alert action: unknown severity '%s'", a.Severity)
+		}
+		if _, err := parseTemplate(a.Message); err != nil {
+			return errors.Wrap(err, "alert action: invalid message")
+		}
+	case model.RuleActionPublish:
+		if a.Subject == "" || strings.ContainsAny(a.Subject, " *>") {
+			return errors.Errorf("publish action: invalid subject '%s'", a.Subject)
+		}
+		if reservedSubject(a.Subject) {
+			return errors.Errorf("publish action: subject '%s' is reserved", a.Subject)
+		}
+	case model.RuleActionCall:
+		if a.Command == "" {
+			return errors.New("call action: command is required")
+		}
+	case model.RuleActionWebhook:
+		if !strings.HasPrefix(a.URL, "http://") && !strings.HasPrefix(a.URL, "https://") {
+			return errors.Errorf("webhook action: invalid URL '%s'", a.URL)
+		}
+	default:
+		return errors.Errorf("unknown action type '%s'", a.Type)
+	}
+	return nil
+}
+
+// reservedSubject returns true if the subject is in the namespace of the
+// control subjects
+func reservedSubject(subject string) bool {
+	return strings.HasPrefix(subject+".", reservedSubjectPrefix)
+}
+
+// matchesPattern matches the value against the glob pattern. The empty
+// pattern matches everything.
+func matchesPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
+
+// evaluate returns true if any value selected by the path of the condition
+// matches. The operators ne and exists with value false are true if no
+// value matches.
+func evaluate(c model.RuleCondition, details interface{}) (bool, error) {
+	values, err := jsonpath.Select(details, c.Path)
+	if err != nil {
+		return false, err
+	}
+
+	switch c.Operator {
+	case model.RuleOperatorExists:
+		if want, ok := c.Value.(bool); ok && !want {
+			return len(values) == 0, nil
+		}
+		return len(values) > 0, nil
+	case model.RuleOperatorNotEquals:
+		for _, v := range values {
+			if equals(v, c.Value) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	for _, v := range values {
+		ok, err := compare(c.Operator, v, c.Value)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compare(op string, v, want interface{}) (bool, error) {
+	switch op {
+	case model.RuleOperatorEquals:
+		return equals(v, want), nil
+	case model.RuleOperatorGreater, model.RuleOperatorGreaterOrEqual,
+		model.RuleOperatorLess, model.RuleOperatorLessOrEqual:
+		cmp, ok := order(v, want)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case model.RuleOperatorGreater:
+			return cmp > 0, nil
+		case model.RuleOperatorGreaterOrEqual:
+			return cmp >= 0, nil
+		case model.RuleOperatorLess:
+			return cmp < 0, nil
+		}
+		return cmp <= 0, nil
+	case model.RuleOperatorContains:
+		switch t := v.(type) {
+		case string:
+			return strings.Contains(t, fmt.Sprint(want)), nil
+		case []interface{}:
+			for _, elem := range t {
+				if equals(elem, want) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case model.RuleOperatorMatches:
+		s, ok := v.(string)
+		if !ok {
+			return false, nil
+		}
+		return regexp.MatchString(fmt.Sprint(want), s)
+	}
+
+	return false, errors.Errorf("unknown operator '%s'", op)
+}
+
+// equals compares decoded JSON values, numbers are compared by value
+func equals(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// order compares numbers or strings. It returns false if the values can't be
+// ordered.
+func order(a, b interface{}) (int, bool) {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1, true
+			case fa > fb:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+
+	sa, ok := a.(string)
+	if !ok {
+		return 0, false
+	}
+	sb, ok := b.(string)
+	if !ok {
+		return 0, false
+	}
+	return strings.Compare(sa, sb), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	}
+	return 0, false
+}
@@ -0,0 +1,30 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+func TestValidatePublishAction(t *testing.T) {
+	tests := []struct {
+		subject string
+		valid   bool
+	}{
+		{"alerts.high-temperature", true},
+		{"iotcore.devicecontrolx.events", true},
+		{"", false},
+		{"alerts.*", false},
+		{"alerts.>", false},
+		{"iotcore.devicecontrol", false},
+		{"iotcore.devicecontrol.v1.default.call", false},
+		{"iotcore.devicecontrol.v1.default.cancel", false},
+	}
+
+	for _, tc := range tests {
+		err := validateAction(model.RuleAction{Type: model.RuleActionPublish, Subject: tc.subject})
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("validateAction(%q) valid = %v, want %v (%v)", tc.subject, valid, tc.valid, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package selector implements label selectors like 'site=regensburg,model=M3CPU'.
+//
+// A selector is a comma separated list of requirements which all must match:
+//
+//	key=value, key==value   the label equals the value
+//	key!=value              the label is missing or differs from the value
+//	key in (a,b)            the label equals one of the values
+//	key notin (a,b)         the label is missing or equals none of the values
+//	key                     the label exists
+//	!key                    the label doesn't exist
+package selector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Operator of a requirement
+type Operator string
+
+// Supported operators
+const (
+	OperatorEquals       Operator = "="
+	OperatorNotEquals    Operator = "!="
+	OperatorIn           Operator = "in"
+	OperatorNotIn        Operator = "notin"
+	OperatorExists       Operator = "exists"
+	OperatorDoesNotExist Operator = "!"
+)
+
+// Requirement is a single condition of a selector
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector matches labels. The empty selector matches everything.
+type Selector []Requirement
+
+// Parse parses the selector expression
+func Parse(s string) (Selector, error) {
+	sel := Selector{}
+
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+
+	return sel, nil
+}
+
+// Matches returns true if the labels fulfill all requirements
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, r := range sel {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns true if the selector has no requirements
+func (sel Selector) Empty() bool {
+	return len(sel) == 0
+}
+
+// String returns the selector expression
+func (sel Selector) String() string {
+	terms := make([]string, 0, len(sel))
+	for _, r := range sel {
+		terms = append(terms, r.String())
+	}
+	return strings.Join(terms, ",")
+}
+
+// Matches returns true if the labels fulfill the requirement
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+
+	switch r.Operator {
+	case OperatorEquals:
+		return ok && v == r.Values[0]
+	case OperatorNotEquals:
+		return !ok || v != r.Values[0]
+	case OperatorIn:
+		return ok && contains(r.Values, v)
+	case OperatorNotIn:
+		return !ok || !contains(r.Values, v)
+	case OperatorExists:
+		return ok
+	case OperatorDoesNotExist:
+		return !ok
+	}
+
+	return false
+}
+
+// String returns the requirement expression
+func (r Requirement) String() string {
+	switch r.Operator {
+	case OperatorEquals, OperatorNotEquals:
+		return r.Key + string(r.Operator) + r.Values[0]
+	case OperatorIn, OperatorNotIn:
+		values := append([]string{}, r.Values...)
+		sort.Strings(values)
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(values, ","))
+	case OperatorDoesNotExist:
+		return "!" + r.Key
+	}
+	return r.Key
+}
+
+// ValidateKey checks if the label key can be used in a selector
+func ValidateKey(key string) error {
+	if key == "" {
+		return errors.New("label key is empty")
+	}
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == '/':
+		default:
+			return errors.Errorf("label key '%s' contains invalid character '%c'", key, c)
+		}
+	}
+	return nil
+}
+
+// ValidateValue checks if the label value can be used in a selector
+func ValidateValue(value string) error {
+	if strings.ContainsAny(value, ",()=! ") {
+		return errors.Errorf("label value '%s' contains invalid characters", value)
+	}
+	return nil
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	if strings.HasPrefix(term, "!") && !strings.Contains(term, "=") {
+		key := strings.TrimSpace(term[1:])
+		return Requirement{Key: key, Operator: OperatorDoesNotExist}, ValidateKey(key)
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(term, op); i >= 0 {
+			key := strings.TrimSpace(term[:i])
+			value := strings.TrimSpace(term[i+len(op):])
+			if err := ValidateKey(key); err != nil {
+				return Requirement{}, err
+			}
+			if err := ValidateValue(value); err != nil {
+				return Requirement{}, err
+			}
+
+			operator := OperatorEquals
+			if op == "!=" {
+				operator = OperatorNotEquals
+			}
+			return Requirement{Key: key, Operator: operator, Values: []string{value}}, nil
+		}
+	}
+
+	if i := strings.Index(term, "("); i >= 0 {
+		fields := strings.Fields(term[:i])
+		if len(fields) != 2 || !strings.HasSuffix(term, ")") {
+			return Requirement{}, errors.Errorf("invalid selector requirement '%s'", term)
+		}
+
+		var operator Operator
+		switch fields[1] {
+		case "in":
+			operator = OperatorIn
+		case "notin":
+			operator = OperatorNotIn
+		default:
+			return Requirement{}, errors.Errorf("invalid selector operator '%s'", fields[1])
+		}
+		if err := ValidateKey(fields[0]); err != nil {
+			return Requirement{}, err
+		}
+
+		values := make([]string, 0)
+		for _, v := range strings.Split(term[i+1:len(term)-1], ",") {
+			v = strings.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if err := ValidateValue(v); err != nil {
+				return Requirement{}, err
+			}
+			values = append(values, v)
+		}
+		if len(values) == 0 {
+			return Requirement{}, errors.Errorf("selector requirement '%s' has no values", term)
+		}
+
+		return Requirement{Key: fields[0], Operator: operator, Values: values}, nil
+	}
+
+	return Requirement{Key: term, Operator: OperatorExists}, ValidateKey(term)
+}
+
+// splitTerms splits the expression at the commas which aren't enclosed in
+// parentheses
+func splitTerms(s string) []string {
+	terms := make([]string, 0)
+	depth := 0
+	start := 0
+
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(terms, s[start:])
+}
+
+func contains(values []string, v string) bool {
+	for _, e := range values {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package selector
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"site=regensburg,model=M3CPU", "site=regensburg,model=M3CPU", false},
+		{"site == regensburg", "site=regensburg", false},
+		{"site!=regensburg", "site!=regensburg", false},
+		{"site in (passau, regensburg)", "site in (passau,regensburg)", false},
+		{"site notin (regensburg,passau)", "site notin (passau,regensburg)", false},
+		{"site in (a,b),model=M3CPU", "site in (a,b),model=M3CPU", false},
+		{"site", "site", false},
+		{"!site", "!site", false},
+		{" site=a , , model ", "site=a,model", false},
+		{"example.com/rack=1", "example.com/rack=1", false},
+		{"=a", "", true},
+		{"!site=a", "", true},
+		{"si te=a", "", true},
+		{"site=a b", "", true},
+		{"site=(a", "", true},
+		{"site in ()", "", true},
+		{"site in (a", "", true},
+		{"site like (a)", "", true},
+		{"site in (a,b=c)", "", true},
+	}
+
+	for _, tc := range tests {
+		sel, err := Parse(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %q, want error", tc.in, sel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", tc.in, err)
+			continue
+		}
+		if got := sel.String(); got != tc.want {
+			t.Errorf("Parse(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	labels := map[string]string{"site": "regensburg", "model": "M3CPU"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"site=regensburg", true},
+		{"site=passau", false},
+		{"site!=passau", true},
+		{"rack!=1", true},
+		{"site in (passau,regensburg)", true},
+		{"site in (passau)", false},
+		{"rack in (1)", false},
+		{"site notin (passau)", true},
+		{"site notin (regensburg)", false},
+		{"rack notin (1)", true},
+		{"model", true},
+		{"rack", false},
+		{"!rack", true},
+		{"!model", false},
+		{"site=regensburg,model=M3CPU", true},
+		{"site=regensburg,model=M1", false},
+	}
+
+	for _, tc := range tests {
+		sel, err := Parse(tc.selector)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %s", tc.selector, err)
+		}
+		if got := sel.Matches(labels); got != tc.want {
+			t.Errorf("%q matches = %v, want %v", tc.selector, got, tc.want)
+		}
+	}
+
+	if !Selector(nil).Matches(nil) {
+		t.Error("empty selector doesn't match missing labels")
+	}
+}
@@ -4,6 +4,10 @@ type storageError string
 
 const ErrNotFound = storageError("not found")
 
+// ErrConflict is returned if a model was changed by someone else since it
+// was read.
+const ErrConflict = storageError("conflict")
+
 func (e storageError) Error() string {
 	return string(e)
 }
@@ -1,12 +1,32 @@
 package storage
 
-import "github.com/nsyszr/lcm/pkg/model"
+import (
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
 
 // Interface is implemented by the storage
 type Interface interface {
 	Sessions() SessionStore
 	Events() EventStore
+	Outbox() OutboxStore
 	Devices() DeviceStore
+	Transcripts() TranscriptStore
+	FileTransfers() FileTransferStore
+	FirmwareImages() FirmwareImageStore
+	FirmwareCampaigns() FirmwareCampaignStore
+	FirmwareUpdates() FirmwareUpdateStore
+	ConfigVersions() ConfigVersionStore
+	Twins() TwinStore
+	DeviceGroups() DeviceGroupStore
+	Maintenances() MaintenanceStore
+	Rules() RuleStore
+	Alerts() AlertStore
+	Webhooks() WebhookStore
+	WebhookDeliveries() WebhookDeliveryStore
+	MetricMappings() MetricMappingStore
+	Telemetry() TelemetryStore
 }
 
 // SessionStore is responsible for managing the Session model
@@ -19,11 +39,29 @@ type SessionStore interface {
 	Delete(id int32) error
 }
 
-// EventStore is responsible for managing the Event model
+// EventStore is responsible for managing the Event model. FindAfterID
+// returns up to limit events with the lowest IDs greater than id.
+// FindFirstIDSince returns the ID of the first event stored at or after t.
+// CreateWithOutbox stores the event and its outbox entry in one transaction.
 type EventStore interface {
 	FetchAll() (map[int32]model.Event, error)
 	FindByID(id int32) (*model.Event, error)
+	FindAfterID(id int32, limit int) (map[int32]model.Event, error)
+	FindFirstIDSince(t time.Time) (int32, error)
 	Create(m *model.Event) error
+	CreateWithOutbox(m *model.Event) error
+}
+
+// OutboxStore is responsible for managing the OutboxEntry model. ClaimDue
+// returns up to limit entries whose next attempt isn't after now and moves
+// their next attempt to now plus lease, so concurrent relays don't claim the
+// same entries. Count returns the number of entries.
+type OutboxStore interface {
+	FetchAll() (map[int32]model.OutboxEntry, error)
+	Count() (int, error)
+	ClaimDue(now time.Time, lease time.Duration, limit int) (map[int32]model.OutboxEntry, error)
+	Update(m *model.OutboxEntry) error
+	Delete(id int32) error
 }
 
 // DeviceStore is responsible for managing the Device model
@@ -32,5 +70,178 @@ type DeviceStore interface {
 	FindByID(id int32) (*model.Device, error)
 	FindByNamespaceAndDeviceID(namespace, deviceID string) (*model.Device, error)
 	Create(m *model.Device) error
+	Update(m *model.Device) error
+	Delete(id int32) error
+}
+
+// TranscriptStore is responsible for managing the Transcript model
+type TranscriptStore interface {
+	FetchAll() (map[int32]model.Transcript, error)
+	FindByID(id int32) (*model.Transcript, error)
+	Create(m *model.Transcript) error
+	Update(m *model.Transcript) error
+}
+
+// FileTransferStore is responsible for managing the FileTransfer model.
+// Claim sets the owner of the transfer and extends its lease unless another
+// owner holds an unexpired lease, it returns false then. Release removes the
+// owner if it's still the given one. Update doesn't change the owner.
+type FileTransferStore interface {
+	FetchAll() (map[int32]model.FileTransfer, error)
+	FindByID(id int32) (*model.FileTransfer, error)
+	FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.FileTransfer, error)
+	FindByStatus(status string) (map[int32]model.FileTransfer, error)
+	Create(m *model.FileTransfer) error
+	Update(m *model.FileTransfer) error
+	Claim(id int32, owner string, now time.Time, lease time.Duration) (bool, error)
+	Release(id int32, owner string) error
+}
+
+// FirmwareImageStore is responsible for managing the FirmwareImage model
+type FirmwareImageStore interface {
+	FetchAll() (map[int32]model.FirmwareImage, error)
+	FindByID(id int32) (*model.FirmwareImage, error)
+	Create(m *model.FirmwareImage) error
+	Delete(id int32) error
+}
+
+// FirmwareCampaignStore is responsible for managing the FirmwareCampaign
+// model. Claim sets the owner of the campaign and extends its lease unless
+// another owner holds an unexpired lease, it returns false then. Release
+// removes the owner if it's still the given one. Update doesn't change the
+// owner.
+type FirmwareCampaignStore interface {
+	FetchAll() (map[int32]model.FirmwareCampaign, error)
+	FindByID(id int32) (*model.FirmwareCampaign, error)
+	Create(m *model.FirmwareCampaign) error
+	Update(m *model.FirmwareCampaign) error
+	Claim(id int32, owner string, now time.Time, lease time.Duration) (bool, error)
+	Release(id int32, owner string) error
+}
+
+// FirmwareUpdateStore is responsible for managing the FirmwareUpdate model
+type FirmwareUpdateStore interface {
+	FetchAll() (map[int32]model.FirmwareUpdate, error)
+	FindByID(id int32) (*model.FirmwareUpdate, error)
+	FindByCampaignID(campaignID int32) (map[int32]model.FirmwareUpdate, error)
+	Create(m *model.FirmwareUpdate) error
+	Update(m *model.FirmwareUpdate) error
+}
+
+// ConfigVersionStore is responsible for managing the ConfigVersion model.
+// FindLatestByNamespaceAndDeviceID returns the version with the highest
+// version number of the device.
+type ConfigVersionStore interface {
+	FetchAll() (map[int32]model.ConfigVersion, error)
+	FindByID(id int32) (*model.ConfigVersion, error)
+	FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.ConfigVersion, error)
+	FindLatestByNamespaceAndDeviceID(namespace, deviceID string) (*model.ConfigVersion, error)
+	Create(m *model.ConfigVersion) error
+}
+
+// TwinStore is responsible for managing the Twin model. Update fails with
+// ErrConflict if the stored version differs from the version of the model.
+type TwinStore interface {
+	FetchAll() (map[int32]model.Twin, error)
+	FindByID(id int32) (*model.Twin, error)
+	FindByNamespaceAndDeviceID(namespace, deviceID string) (*model.Twin, error)
+	Create(m *model.Twin) error
+	Update(m *model.Twin) error
+}
+
+// DeviceGroupStore is responsible for managing the DeviceGroup model
+type DeviceGroupStore interface {
+	FetchAll() (map[int32]model.DeviceGroup, error)
+	FindByID(id int32) (*model.DeviceGroup, error)
+	FindByNamespaceAndName(namespace, name string) (*model.DeviceGroup, error)
+	Create(m *model.DeviceGroup) error
+	Update(m *model.DeviceGroup) error
+	Delete(id int32) error
+}
+
+// MaintenanceStore is responsible for managing the Maintenance model. A
+// device and a device group have at most one maintenance window.
+// FindByNamespaceAndDeviceID returns the window of the device itself, not
+// the windows of its groups. FindGroupWindowsByNamespace returns the windows
+// of the device groups of the namespace. DeleteExpired removes the windows
+// ended until now and returns them, a window is returned only to the caller
+// which removed it. Delete returns ErrNotFound if the window is removed
+// already.
+type MaintenanceStore interface {
+	FetchAll() (map[int32]model.Maintenance, error)
+	FindByID(id int32) (*model.Maintenance, error)
+	FindByNamespaceAndDeviceID(namespace, deviceID string) (*model.Maintenance, error)
+	FindByGroupID(groupID int32) (*model.Maintenance, error)
+	FindGroupWindowsByNamespace(namespace string) (map[int32]model.Maintenance, error)
+	Create(m *model.Maintenance) error
+	Update(m *model.Maintenance) error
+	Delete(id int32) error
+	DeleteExpired(now time.Time) ([]model.Maintenance, error)
+}
+
+// RuleStore is responsible for managing the Rule model
+type RuleStore interface {
+	FetchAll() (map[int32]model.Rule, error)
+	FindByID(id int32) (*model.Rule, error)
+	Create(m *model.Rule) error
+	Update(m *model.Rule) error
+	Delete(id int32) error
+}
+
+// AlertStore is responsible for managing the Alert model. FindUnresolved
+// returns the latest alert of the rule and the device which isn't resolved.
+type AlertStore interface {
+	FetchAll() (map[int32]model.Alert, error)
+	FindByID(id int32) (*model.Alert, error)
+	FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.Alert, error)
+	FindUnresolved(ruleID int32, namespace, deviceID string) (*model.Alert, error)
+	Create(m *model.Alert) error
+	Update(m *model.Alert) error
+}
+
+// WebhookStore is responsible for managing the Webhook model
+type WebhookStore interface {
+	FetchAll() (map[int32]model.Webhook, error)
+	FindByID(id int32) (*model.Webhook, error)
+	Create(m *model.Webhook) error
+	Update(m *model.Webhook) error
+	Delete(id int32) error
+}
+
+// WebhookDeliveryStore is responsible for managing the WebhookDelivery
+// model. ClaimDue returns up to limit pending deliveries whose next attempt
+// isn't after now and moves their next attempt to now plus lease, so
+// concurrent dispatchers don't claim the same deliveries.
+type WebhookDeliveryStore interface {
+	FetchAll() (map[int32]model.WebhookDelivery, error)
+	FindByID(id int32) (*model.WebhookDelivery, error)
+	FindByWebhookID(webhookID int32) (map[int32]model.WebhookDelivery, error)
+	FindByStatus(status string) (map[int32]model.WebhookDelivery, error)
+	ClaimDue(now time.Time, lease time.Duration, limit int) (map[int32]model.WebhookDelivery, error)
+	Create(m *model.WebhookDelivery) error
+	Update(m *model.WebhookDelivery) error
+	DeleteByWebhookID(webhookID int32) error
+}
+
+// MetricMappingStore is responsible for managing the MetricMapping model
+type MetricMappingStore interface {
+	FetchAll() (map[int32]model.MetricMapping, error)
+	FindByID(id int32) (*model.MetricMapping, error)
+	Create(m *model.MetricMapping) error
+	Update(m *model.MetricMapping) error
 	Delete(id int32) error
 }
+
+// TelemetryStore is responsible for managing the metric samples and their
+// rollups. Samples of an event and metric which are stored already are
+// ignored. The samples and the rollups are found within [from, to) ordered
+// by time. Rollup aggregates the samples within [from, to) to the buckets of
+// the resolution, existing buckets are replaced.
+type TelemetryStore interface {
+	AddSamples(samples []model.MetricSample) error
+	FindSamples(namespace, deviceID, metric string, from, to time.Time) ([]model.MetricSample, error)
+	DeleteSamplesBefore(t time.Time) error
+	Rollup(resolution time.Duration, from, to time.Time) error
+	FindRollups(namespace, deviceID, metric string, resolution time.Duration, from, to time.Time) ([]model.MetricRollup, error)
+	DeleteRollupsBefore(resolution time.Duration, t time.Time) error
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type alertStore struct {
+	store  map[int32]model.Alert
+	nextID int32
+	sync.RWMutex
+}
+
+func newAlertStore() *alertStore {
+	return &alertStore{
+		store:  make(map[int32]model.Alert),
+		nextID: 1,
+	}
+}
+
+func (s *alertStore) FetchAll() (models map[int32]model.Alert, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.Alert, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *alertStore) FindByID(id int32) (*model.Alert, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *alertStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.Alert, error) {
+	s.RLock()
+	defer s.RUnlock()
+	models := make(map[int32]model.Alert)
+
+	for id, m := range s.store {
+		if m.Namespace == namespace && m.DeviceID == deviceID {
+			models[id] = m
+		}
+	}
+
+	return models, nil
+}
+
+func (s *alertStore) FindUnresolved(ruleID int32, namespace, deviceID string) (*model.Alert, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var found *model.Alert
+	for _, m := range s.store {
+		if m.RuleID == ruleID && m.Namespace == namespace && m.DeviceID == deviceID &&
+			m.Status != model.AlertStatusResolved && (found == nil || m.ID > found.ID) {
+			elem := m
+			found = &elem
+		}
+	}
+
+	if found == nil {
+		return nil, storage.ErrNotFound
+	}
+	return found, nil
+}
+
+func (s *alertStore) Create(m *model.Alert) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *alertStore) Update(m *model.Alert) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
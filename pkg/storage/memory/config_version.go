@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type configVersionStore struct {
+	store  map[int32]model.ConfigVersion
+	nextID int32
+	sync.RWMutex
+}
+
+func newConfigVersionStore() *configVersionStore {
+	return &configVersionStore{
+		store:  make(map[int32]model.ConfigVersion),
+		nextID: 1,
+	}
+}
+
+func (s *configVersionStore) FetchAll() (models map[int32]model.ConfigVersion, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.ConfigVersion, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *configVersionStore) FindByID(id int32) (*model.ConfigVersion, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *configVersionStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (models map[int32]model.ConfigVersion, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.ConfigVersion)
+
+	for id, m := range s.store {
+		if m.Namespace == namespace && m.DeviceID == deviceID {
+			models[id] = m
+		}
+	}
+
+	return models, nil
+}
+
+func (s *configVersionStore) FindLatestByNamespaceAndDeviceID(namespace, deviceID string) (*model.ConfigVersion, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var latest *model.ConfigVersion
+	for _, elem := range s.store {
+		if elem.Namespace == namespace && elem.DeviceID == deviceID && (latest == nil || elem.Version > latest.Version) {
+			m := elem
+			latest = &m
+		}
+	}
+	if latest == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	return latest, nil
+}
+
+func (s *configVersionStore) Create(m *model.ConfigVersion) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
@@ -86,6 +86,22 @@ func (s *deviceStore) Create(m *model.Device) error {
 	return nil
 }
 
+func (s *deviceStore) Update(m *model.Device) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
 func (s *deviceStore) Delete(id int32) error {
 	s.Lock()
 	defer s.Unlock()
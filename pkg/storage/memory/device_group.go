@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type deviceGroupStore struct {
+	store  map[int32]model.DeviceGroup
+	nextID int32
+	sync.RWMutex
+}
+
+func newDeviceGroupStore() *deviceGroupStore {
+	return &deviceGroupStore{
+		store:  make(map[int32]model.DeviceGroup),
+		nextID: 1,
+	}
+}
+
+func (s *deviceGroupStore) FetchAll() (models map[int32]model.DeviceGroup, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.DeviceGroup, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *deviceGroupStore) FindByID(id int32) (*model.DeviceGroup, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *deviceGroupStore) FindByNamespaceAndName(namespace, name string) (*model.DeviceGroup, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, m := range s.store {
+		if m.Namespace == namespace && m.Name == name {
+			return &m, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *deviceGroupStore) Create(m *model.DeviceGroup) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *deviceGroupStore) Update(m *model.DeviceGroup) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *deviceGroupStore) Delete(id int32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.store[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.store, id)
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -11,13 +12,15 @@ import (
 type eventStore struct {
 	store  map[int32]model.Event
 	nextID int32
+	outbox *outboxStore
 	sync.RWMutex
 }
 
-func newEventStore() *eventStore {
+func newEventStore(outbox *outboxStore) *eventStore {
 	return &eventStore{
 		store:  make(map[int32]model.Event),
 		nextID: 1,
+		outbox: outbox,
 	}
 }
 
@@ -43,6 +46,46 @@ func (s *eventStore) FindByID(id int32) (*model.Event, error) {
 	return nil, storage.ErrNotFound
 }
 
+func (s *eventStore) FindAfterID(id int32, limit int) (map[int32]model.Event, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	ids := make([]int32, 0)
+	for elem := range s.store {
+		if elem > id {
+			ids = append(ids, elem)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	models := make(map[int32]model.Event, len(ids))
+	for _, elem := range ids {
+		models[elem] = s.store[elem]
+	}
+
+	return models, nil
+}
+
+func (s *eventStore) FindFirstIDSince(t time.Time) (int32, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var first int32
+	for id, m := range s.store {
+		if !m.CreatedAt.Before(t) && (first == 0 || id < first) {
+			first = id
+		}
+	}
+	if first == 0 {
+		return 0, storage.ErrNotFound
+	}
+
+	return first, nil
+}
+
 func (s *eventStore) Create(m *model.Event) error {
 	s.Lock()
 	defer s.Unlock()
@@ -56,6 +99,20 @@ func (s *eventStore) Create(m *model.Event) error {
 	return nil
 }
 
+func (s *eventStore) CreateWithOutbox(m *model.Event) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.getNextID()
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+	s.outbox.create(m.ID)
+
+	return nil
+}
+
 func (s *eventStore) getNextID() int32 {
 	id := s.nextID
 	s.nextID++
@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type fileTransferStore struct {
+	store  map[int32]model.FileTransfer
+	nextID int32
+	sync.RWMutex
+}
+
+func newFileTransferStore() *fileTransferStore {
+	return &fileTransferStore{
+		store:  make(map[int32]model.FileTransfer),
+		nextID: 1,
+	}
+}
+
+func (s *fileTransferStore) FetchAll() (models map[int32]model.FileTransfer, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.FileTransfer, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *fileTransferStore) FindByID(id int32) (*model.FileTransfer, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *fileTransferStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.FileTransfer, error) {
+	return s.filter(func(m *model.FileTransfer) bool {
+		return m.Namespace == namespace && m.DeviceID == deviceID
+	}), nil
+}
+
+func (s *fileTransferStore) FindByStatus(status string) (map[int32]model.FileTransfer, error) {
+	return s.filter(func(m *model.FileTransfer) bool {
+		return m.Status == status
+	}), nil
+}
+
+// filter returns the transfers matching the function
+func (s *fileTransferStore) filter(fn func(m *model.FileTransfer) bool) map[int32]model.FileTransfer {
+	s.RLock()
+	defer s.RUnlock()
+	models := make(map[int32]model.FileTransfer)
+
+	for id, m := range s.store {
+		if fn(&m) {
+			models[id] = m
+		}
+	}
+
+	return models
+}
+
+func (s *fileTransferStore) Create(m *model.FileTransfer) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.getNextID()
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *fileTransferStore) Update(m *model.FileTransfer) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.Owner = old.Owner
+	m.LeaseUntil = old.LeaseUntil
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *fileTransferStore) Claim(id int32, owner string, now time.Time, lease time.Duration) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	m, ok := s.store[id]
+	if !ok {
+		return false, storage.ErrNotFound
+	}
+	if m.Owner != "" && m.Owner != owner && m.LeaseUntil.After(now) {
+		return false, nil
+	}
+
+	m.Owner = owner
+	m.LeaseUntil = now.Add(lease)
+	s.store[id] = m
+
+	return true, nil
+}
+
+func (s *fileTransferStore) Release(id int32, owner string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m, ok := s.store[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if m.Owner == owner {
+		m.Owner = ""
+		s.store[id] = m
+	}
+
+	return nil
+}
+
+func (s *fileTransferStore) getNextID() int32 {
+	id := s.nextID
+	s.nextID++
+	return id
+}
@@ -0,0 +1,253 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type firmwareImageStore struct {
+	store  map[int32]model.FirmwareImage
+	nextID int32
+	sync.RWMutex
+}
+
+func newFirmwareImageStore() *firmwareImageStore {
+	return &firmwareImageStore{
+		store:  make(map[int32]model.FirmwareImage),
+		nextID: 1,
+	}
+}
+
+func (s *firmwareImageStore) FetchAll() (models map[int32]model.FirmwareImage, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.FirmwareImage, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *firmwareImageStore) FindByID(id int32) (*model.FirmwareImage, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *firmwareImageStore) Create(m *model.FirmwareImage) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *firmwareImageStore) Delete(id int32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	_, ok := s.store[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.store, id)
+
+	return nil
+}
+
+type firmwareCampaignStore struct {
+	store  map[int32]model.FirmwareCampaign
+	nextID int32
+	sync.RWMutex
+}
+
+func newFirmwareCampaignStore() *firmwareCampaignStore {
+	return &firmwareCampaignStore{
+		store:  make(map[int32]model.FirmwareCampaign),
+		nextID: 1,
+	}
+}
+
+func (s *firmwareCampaignStore) FetchAll() (models map[int32]model.FirmwareCampaign, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.FirmwareCampaign, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *firmwareCampaignStore) FindByID(id int32) (*model.FirmwareCampaign, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *firmwareCampaignStore) Create(m *model.FirmwareCampaign) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *firmwareCampaignStore) Update(m *model.FirmwareCampaign) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.Owner = old.Owner
+	m.LeaseUntil = old.LeaseUntil
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *firmwareCampaignStore) Claim(id int32, owner string, now time.Time, lease time.Duration) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	m, ok := s.store[id]
+	if !ok {
+		return false, storage.ErrNotFound
+	}
+	if m.Owner != "" && m.Owner != owner && m.LeaseUntil.After(now) {
+		return false, nil
+	}
+
+	m.Owner = owner
+	m.LeaseUntil = now.Add(lease)
+	s.store[id] = m
+
+	return true, nil
+}
+
+func (s *firmwareCampaignStore) Release(id int32, owner string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m, ok := s.store[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if m.Owner == owner {
+		m.Owner = ""
+		s.store[id] = m
+	}
+
+	return nil
+}
+
+type firmwareUpdateStore struct {
+	store  map[int32]model.FirmwareUpdate
+	nextID int32
+	sync.RWMutex
+}
+
+func newFirmwareUpdateStore() *firmwareUpdateStore {
+	return &firmwareUpdateStore{
+		store:  make(map[int32]model.FirmwareUpdate),
+		nextID: 1,
+	}
+}
+
+func (s *firmwareUpdateStore) FetchAll() (models map[int32]model.FirmwareUpdate, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.FirmwareUpdate, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *firmwareUpdateStore) FindByID(id int32) (*model.FirmwareUpdate, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *firmwareUpdateStore) FindByCampaignID(campaignID int32) (models map[int32]model.FirmwareUpdate, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.FirmwareUpdate)
+
+	for id, m := range s.store {
+		if m.CampaignID == campaignID {
+			models[id] = m
+		}
+	}
+
+	return models, nil
+}
+
+func (s *firmwareUpdateStore) Create(m *model.FirmwareUpdate) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *firmwareUpdateStore) Update(m *model.FirmwareUpdate) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type maintenanceStore struct {
+	store  map[int32]model.Maintenance
+	nextID int32
+	sync.RWMutex
+}
+
+func newMaintenanceStore() *maintenanceStore {
+	return &maintenanceStore{
+		store:  make(map[int32]model.Maintenance),
+		nextID: 1,
+	}
+}
+
+func (s *maintenanceStore) FetchAll() (models map[int32]model.Maintenance, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.Maintenance, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *maintenanceStore) FindByID(id int32) (*model.Maintenance, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *maintenanceStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (*model.Maintenance, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, m := range s.store {
+		if m.Namespace == namespace && m.DeviceID == deviceID && m.GroupID == 0 {
+			return &m, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *maintenanceStore) FindByGroupID(groupID int32) (*model.Maintenance, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, m := range s.store {
+		if m.GroupID == groupID {
+			return &m, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *maintenanceStore) FindGroupWindowsByNamespace(namespace string) (models map[int32]model.Maintenance, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.Maintenance)
+
+	for id, m := range s.store {
+		if m.Namespace == namespace && m.GroupID != 0 {
+			models[id] = m
+		}
+	}
+
+	return models, nil
+}
+
+func (s *maintenanceStore) Create(m *model.Maintenance) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *maintenanceStore) Update(m *model.Maintenance) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *maintenanceStore) Delete(id int32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.store[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.store, id)
+
+	return nil
+}
+
+func (s *maintenanceStore) DeleteExpired(now time.Time) ([]model.Maintenance, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	models := make([]model.Maintenance, 0)
+	for id, m := range s.store {
+		if m.Until.After(now) {
+			continue
+		}
+		delete(s.store, id)
+		models = append(models, m)
+	}
+
+	return models, nil
+}
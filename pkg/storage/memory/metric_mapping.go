@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type metricMappingStore struct {
+	store  map[int32]model.MetricMapping
+	nextID int32
+	sync.RWMutex
+}
+
+func newMetricMappingStore() *metricMappingStore {
+	return &metricMappingStore{
+		store:  make(map[int32]model.MetricMapping),
+		nextID: 1,
+	}
+}
+
+func (s *metricMappingStore) FetchAll() (models map[int32]model.MetricMapping, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.MetricMapping, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *metricMappingStore) FindByID(id int32) (*model.MetricMapping, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *metricMappingStore) Create(m *model.MetricMapping) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *metricMappingStore) Update(m *model.MetricMapping) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *metricMappingStore) Delete(id int32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.store[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.store, id)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type outboxStore struct {
+	store  map[int32]model.OutboxEntry
+	nextID int32
+	sync.RWMutex
+}
+
+func newOutboxStore() *outboxStore {
+	return &outboxStore{
+		store:  make(map[int32]model.OutboxEntry),
+		nextID: 1,
+	}
+}
+
+func (s *outboxStore) FetchAll() (models map[int32]model.OutboxEntry, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.OutboxEntry, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *outboxStore) Count() (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.store), nil
+}
+
+func (s *outboxStore) ClaimDue(now time.Time, lease time.Duration, limit int) (map[int32]model.OutboxEntry, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ids := make([]int32, 0)
+	for id, m := range s.store {
+		if !m.NextAttemptAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	models := make(map[int32]model.OutboxEntry, len(ids))
+	for _, id := range ids {
+		m := s.store[id]
+		m.NextAttemptAt = now.Add(lease)
+		m.UpdatedAt = time.Now().Round(time.Second).UTC()
+		s.store[id] = m
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *outboxStore) create(eventID int32) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UTC()
+	s.store[s.nextID] = model.OutboxEntry{
+		ID:            s.nextID,
+		EventID:       eventID,
+		NextAttemptAt: now,
+		CreatedAt:     now.Round(time.Second),
+		UpdatedAt:     now.Round(time.Second),
+	}
+	s.nextID++
+}
+
+func (s *outboxStore) Update(m *model.OutboxEntry) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *outboxStore) Delete(id int32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.store[id]; !ok {
+		return storage.ErrNotFound
+	}
+	delete(s.store, id)
+
+	return nil
+}
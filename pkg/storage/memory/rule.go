@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type ruleStore struct {
+	store  map[int32]model.Rule
+	nextID int32
+	sync.RWMutex
+}
+
+func newRuleStore() *ruleStore {
+	return &ruleStore{
+		store:  make(map[int32]model.Rule),
+		nextID: 1,
+	}
+}
+
+func (s *ruleStore) FetchAll() (models map[int32]model.Rule, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.Rule, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *ruleStore) FindByID(id int32) (*model.Rule, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *ruleStore) Create(m *model.Rule) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *ruleStore) Update(m *model.Rule) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *ruleStore) Delete(id int32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.store[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(s.store, id)
+
+	return nil
+}
@@ -61,6 +61,9 @@ func (s *sessionStore) Create(m *model.Session) error {
 	defer s.Unlock()
 
 	m.ID = s.getNextID()
+	if m.ProtocolVersion == 0 {
+		m.ProtocolVersion = 1
+	}
 	m.CreatedAt = time.Now().Round(time.Second).UTC()
 	m.UpdatedAt = time.Now().Round(time.Second).UTC()
 
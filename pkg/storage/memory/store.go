@@ -4,21 +4,56 @@ import "github.com/nsyszr/lcm/pkg/storage"
 
 // Store contains all memory-based sub-stores for managing the persistent models
 type store struct {
-	sessions *sessionStore
-	events   *eventStore
-	devices  *deviceStore
+	sessions          *sessionStore
+	events            *eventStore
+	outbox            *outboxStore
+	devices           *deviceStore
+	transcripts       *transcriptStore
+	fileTransfers     *fileTransferStore
+	firmwareImages    *firmwareImageStore
+	firmwareCampaigns *firmwareCampaignStore
+	firmwareUpdates   *firmwareUpdateStore
+	configVersions    *configVersionStore
+	twins             *twinStore
+	deviceGroups      *deviceGroupStore
+	maintenances      *maintenanceStore
+	rules             *ruleStore
+	alerts            *alertStore
+	webhooks          *webhookStore
+	webhookDeliveries *webhookDeliveryStore
+	metricMappings    *metricMappingStore
+	telemetry         *telemetryStore
 }
 
 // NewStore creates a new memory-based Storage interface
 func NewStore() storage.Interface {
 	sessionStore := newSessionStore()
-	eventStore := newEventStore()
+	outboxStore := newOutboxStore()
+	eventStore := newEventStore(outboxStore)
 	deviceStore := newDeviceStore()
+	transcriptStore := newTranscriptStore()
+	fileTransferStore := newFileTransferStore()
 
 	return &store{
-		sessions: sessionStore,
-		events:   eventStore,
-		devices:  deviceStore,
+		sessions:          sessionStore,
+		events:            eventStore,
+		outbox:            outboxStore,
+		devices:           deviceStore,
+		transcripts:       transcriptStore,
+		fileTransfers:     fileTransferStore,
+		firmwareImages:    newFirmwareImageStore(),
+		firmwareCampaigns: newFirmwareCampaignStore(),
+		firmwareUpdates:   newFirmwareUpdateStore(),
+		configVersions:    newConfigVersionStore(),
+		twins:             newTwinStore(),
+		deviceGroups:      newDeviceGroupStore(),
+		maintenances:      newMaintenanceStore(),
+		rules:             newRuleStore(),
+		alerts:            newAlertStore(),
+		webhooks:          newWebhookStore(),
+		webhookDeliveries: newWebhookDeliveryStore(),
+		metricMappings:    newMetricMappingStore(),
+		telemetry:         newTelemetryStore(),
 	}
 }
 
@@ -32,7 +67,88 @@ func (s *store) Events() storage.EventStore {
 	return s.events
 }
 
+// Outbox returns a sub-store for managing the outbox entries
+func (s *store) Outbox() storage.OutboxStore {
+	return s.outbox
+}
+
 // Devices returns a sub-store for managing the device model
 func (s *store) Devices() storage.DeviceStore {
 	return s.devices
 }
+
+// Transcripts returns a sub-store for managing the transcript model
+func (s *store) Transcripts() storage.TranscriptStore {
+	return s.transcripts
+}
+
+// FileTransfers returns a sub-store for managing the file transfer model
+func (s *store) FileTransfers() storage.FileTransferStore {
+	return s.fileTransfers
+}
+
+// FirmwareImages returns a sub-store for managing the firmware image model
+func (s *store) FirmwareImages() storage.FirmwareImageStore {
+	return s.firmwareImages
+}
+
+// FirmwareCampaigns returns a sub-store for managing the firmware campaign model
+func (s *store) FirmwareCampaigns() storage.FirmwareCampaignStore {
+	return s.firmwareCampaigns
+}
+
+// FirmwareUpdates returns a sub-store for managing the firmware update model
+func (s *store) FirmwareUpdates() storage.FirmwareUpdateStore {
+	return s.firmwareUpdates
+}
+
+// ConfigVersions returns a sub-store for managing the config version model
+func (s *store) ConfigVersions() storage.ConfigVersionStore {
+	return s.configVersions
+}
+
+// Twins returns a sub-store for managing the twin model
+func (s *store) Twins() storage.TwinStore {
+	return s.twins
+}
+
+// DeviceGroups returns a sub-store for managing the device group model
+func (s *store) DeviceGroups() storage.DeviceGroupStore {
+	return s.deviceGroups
+}
+
+// Maintenances returns a sub-store for managing the maintenance model
+func (s *store) Maintenances() storage.MaintenanceStore {
+	return s.maintenances
+}
+
+// Rules returns a sub-store for managing the rule model
+func (s *store) Rules() storage.RuleStore {
+	return s.rules
+}
+
+// Alerts returns a sub-store for managing the alert model
+func (s *store) Alerts() storage.AlertStore {
+	return s.alerts
+}
+
+// Webhooks returns a sub-store for managing the webhook model
+func (s *store) Webhooks() storage.WebhookStore {
+	return s.webhooks
+}
+
+// WebhookDeliveries returns a sub-store for managing the webhook delivery
+// model
+func (s *store) WebhookDeliveries() storage.WebhookDeliveryStore {
+	return s.webhookDeliveries
+}
+
+// MetricMappings returns a sub-store for managing the metric mapping model
+func (s *store) MetricMappings() storage.MetricMappingStore {
+	return s.metricMappings
+}
+
+// Telemetry returns a sub-store for managing the metric samples and rollups
+func (s *store) Telemetry() storage.TelemetryStore {
+	return s.telemetry
+}
@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+type sampleKey struct {
+	eventID int32
+	metric  string
+}
+
+type rollupKey struct {
+	namespace  string
+	deviceID   string
+	metric     string
+	resolution time.Duration
+	bucket     int64
+}
+
+type telemetryStore struct {
+	samples map[sampleKey]model.MetricSample
+	rollups map[rollupKey]model.MetricRollup
+	sync.RWMutex
+}
+
+func newTelemetryStore() *telemetryStore {
+	return &telemetryStore{
+		samples: make(map[sampleKey]model.MetricSample),
+		rollups: make(map[rollupKey]model.MetricRollup),
+	}
+}
+
+func (s *telemetryStore) AddSamples(samples []model.MetricSample) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, m := range samples {
+		key := sampleKey{eventID: m.EventID, metric: m.Metric}
+		if _, ok := s.samples[key]; !ok {
+			s.samples[key] = m
+		}
+	}
+
+	return nil
+}
+
+func (s *telemetryStore) FindSamples(namespace, deviceID, metric string, from, to time.Time) ([]model.MetricSample, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	models := make([]model.MetricSample, 0)
+	for _, m := range s.samples {
+		if m.Namespace == namespace && m.DeviceID == deviceID && m.Metric == metric &&
+			!m.Timestamp.Before(from) && m.Timestamp.Before(to) {
+			models = append(models, m)
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Timestamp.Before(models[j].Timestamp) })
+
+	return models, nil
+}
+
+func (s *telemetryStore) DeleteSamplesBefore(t time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for key, m := range s.samples {
+		if m.Timestamp.Before(t) {
+			delete(s.samples, key)
+		}
+	}
+
+	return nil
+}
+
+func (s *telemetryStore) Rollup(resolution time.Duration, from, to time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	rollups := make(map[rollupKey]model.MetricRollup)
+	for _, m := range s.samples {
+		if m.Timestamp.Before(from) || !m.Timestamp.Before(to) {
+			continue
+		}
+
+		bucket := m.Timestamp.Truncate(resolution)
+		key := rollupKey{
+			namespace:  m.Namespace,
+			deviceID:   m.DeviceID,
+			metric:     m.Metric,
+			resolution: resolution,
+			bucket:     bucket.Unix(),
+		}
+		r, ok := rollups[key]
+		if !ok {
+			r = model.MetricRollup{
+				Namespace:  m.Namespace,
+				DeviceID:   m.DeviceID,
+				Metric:     m.Metric,
+				Resolution: resolution,
+				Bucket:     bucket.UTC(),
+				Min:        math.Inf(1),
+				Max:        math.Inf(-1),
+			}
+		}
+		r.Count++
+		r.Sum += m.Value
+		r.Min = math.Min(r.Min, m.Value)
+		r.Max = math.Max(r.Max, m.Value)
+		rollups[key] = r
+	}
+
+	for key, r := range rollups {
+		s.rollups[key] = r
+	}
+
+	return nil
+}
+
+func (s *telemetryStore) FindRollups(namespace, deviceID, metric string, resolution time.Duration, from, to time.Time) ([]model.MetricRollup, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	models := make([]model.MetricRollup, 0)
+	for _, m := range s.rollups {
+		if m.Namespace == namespace && m.DeviceID == deviceID && m.Metric == metric && m.Resolution == resolution &&
+			!m.Bucket.Before(from) && m.Bucket.Before(to) {
+			models = append(models, m)
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Bucket.Before(models[j].Bucket) })
+
+	return models, nil
+}
+
+func (s *telemetryStore) DeleteRollupsBefore(resolution time.Duration, t time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for key, m := range s.rollups {
+		if m.Resolution == resolution && m.Bucket.Before(t) {
+			delete(s.rollups, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type transcriptStore struct {
+	store  map[int32]model.Transcript
+	nextID int32
+	sync.RWMutex
+}
+
+func newTranscriptStore() *transcriptStore {
+	return &transcriptStore{
+		store:  make(map[int32]model.Transcript),
+		nextID: 1,
+	}
+}
+
+func (s *transcriptStore) FetchAll() (models map[int32]model.Transcript, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.Transcript, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *transcriptStore) FindByID(id int32) (*model.Transcript, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *transcriptStore) Create(m *model.Transcript) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.getNextID()
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *transcriptStore) Update(m *model.Transcript) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *transcriptStore) getNextID() int32 {
+	id := s.nextID
+	s.nextID++
+	return id
+}
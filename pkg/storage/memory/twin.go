@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type twinStore struct {
+	store  map[int32]model.Twin
+	nextID int32
+	sync.RWMutex
+}
+
+func newTwinStore() *twinStore {
+	return &twinStore{
+		store:  make(map[int32]model.Twin),
+		nextID: 1,
+	}
+}
+
+func (s *twinStore) FetchAll() (models map[int32]model.Twin, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.Twin, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *twinStore) FindByID(id int32) (*model.Twin, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *twinStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (*model.Twin, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, m := range s.store {
+		if m.Namespace == namespace && m.DeviceID == deviceID {
+			return &m, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *twinStore) Create(m *model.Twin) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *twinStore) Update(m *model.Twin) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	if old.Version != m.Version {
+		return storage.ErrConflict
+	}
+
+	m.Version++
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+)
+
+type webhookDeliveryStore struct {
+	store  map[int32]model.WebhookDelivery
+	nextID int32
+	sync.RWMutex
+}
+
+func newWebhookDeliveryStore() *webhookDeliveryStore {
+	return &webhookDeliveryStore{
+		store:  make(map[int32]model.WebhookDelivery),
+		nextID: 1,
+	}
+}
+
+func (s *webhookDeliveryStore) FetchAll() (models map[int32]model.WebhookDelivery, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	models = make(map[int32]model.WebhookDelivery, len(s.store))
+
+	for id, m := range s.store {
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *webhookDeliveryStore) FindByID(id int32) (*model.WebhookDelivery, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if m, ok := s.store[id]; ok {
+		return &m, nil
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *webhookDeliveryStore) FindByWebhookID(webhookID int32) (map[int32]model.WebhookDelivery, error) {
+	return s.filter(func(m *model.WebhookDelivery) bool {
+		return m.WebhookID == webhookID
+	}, 0), nil
+}
+
+func (s *webhookDeliveryStore) FindByStatus(status string) (map[int32]model.WebhookDelivery, error) {
+	return s.filter(func(m *model.WebhookDelivery) bool {
+		return m.Status == status
+	}, 0), nil
+}
+
+func (s *webhookDeliveryStore) ClaimDue(now time.Time, lease time.Duration, limit int) (map[int32]model.WebhookDelivery, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ids := make([]int32, 0)
+	for id, m := range s.store {
+		if m.Status == model.WebhookDeliveryStatusPending && !m.NextAttemptAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.store[ids[i]], s.store[ids[j]]
+		if !a.NextAttemptAt.Equal(b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(b.NextAttemptAt)
+		}
+		return a.ID < b.ID
+	})
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	models := make(map[int32]model.WebhookDelivery, len(ids))
+	for _, id := range ids {
+		m := s.store[id]
+		m.NextAttemptAt = now.Add(lease)
+		m.UpdatedAt = time.Now().Round(time.Second).UTC()
+		s.store[id] = m
+		models[id] = m
+	}
+
+	return models, nil
+}
+
+func (s *webhookDeliveryStore) Create(m *model.WebhookDelivery) error {
+	s.Lock()
+	defer s.Unlock()
+
+	m.ID = s.nextID
+	s.nextID++
+	m.CreatedAt = time.Now().Round(time.Second).UTC()
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *webhookDeliveryStore) Update(m *model.WebhookDelivery) error {
+	s.Lock()
+	defer s.Unlock()
+
+	old, ok := s.store[m.ID]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	m.CreatedAt = old.CreatedAt
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+	s.store[m.ID] = *m
+
+	return nil
+}
+
+func (s *webhookDeliveryStore) DeleteByWebhookID(webhookID int32) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, m := range s.store {
+		if m.WebhookID == webhookID {
+			delete(s.store, id)
+		}
+	}
+
+	return nil
+}
+
+// filter returns up to limit deliveries matching the function, all if the
+// limit is zero
+func (s *webhookDeliveryStore) filter(fn func(m *model.WebhookDelivery) bool, limit int) map[int32]model.WebhookDelivery {
+	s.RLock()
+	defer s.RUnlock()
+	models := make(map[int32]model.WebhookDelivery)
+
+	for id, m := range s.store {
+		if limit > 0 && len(models) >= limit {
+			break
+		}
+		if fn(&m) {
+			models[id] = m
+		}
+	}
+
+	return models
+}
@@ -0,0 +1,241 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newAlertStore(db *sqlx.DB) *alertStore {
+	return &alertStore{
+		db: db,
+	}
+}
+
+type alertStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataAlert struct {
+	ID             int32      `db:"id"`
+	Namespace      string     `db:"namespace"`
+	DeviceID       string     `db:"device_id"`
+	RuleID         int32      `db:"rule_id"`
+	Severity       string     `db:"severity"`
+	Message        string     `db:"message"`
+	Status         string     `db:"status"`
+	Count          int        `db:"count"`
+	LastEventID    int32      `db:"last_event_id"`
+	AcknowledgedBy string     `db:"acknowledged_by"`
+	AcknowledgedAt *time.Time `db:"acknowledged_at"`
+	ResolvedBy     string     `db:"resolved_by"`
+	ResolvedAt     *time.Time `db:"resolved_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+}
+
+var sqlParamsAlert = []string{
+	"id",
+	"namespace",
+	"device_id",
+	"rule_id",
+	"severity",
+	"message",
+	"status",
+	"count",
+	"last_event_id",
+	"acknowledged_by",
+	"acknowledged_at",
+	"resolved_by",
+	"resolved_at",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataAlert) Scan(m *model.Alert) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.RuleID = m.RuleID
+	d.Severity = m.Severity
+	d.Message = m.Message
+	d.Status = m.Status
+	d.Count = m.Count
+	d.LastEventID = m.LastEventID
+	d.AcknowledgedBy = m.AcknowledgedBy
+	d.AcknowledgedAt = nullTime(m.AcknowledgedAt)
+	d.ResolvedBy = m.ResolvedBy
+	d.ResolvedAt = nullTime(m.ResolvedAt)
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataAlert) Model() (*model.Alert, error) {
+	m := &model.Alert{
+		ID:             d.ID,
+		Namespace:      d.Namespace,
+		DeviceID:       d.DeviceID,
+		RuleID:         d.RuleID,
+		Severity:       d.Severity,
+		Message:        d.Message,
+		Status:         d.Status,
+		Count:          d.Count,
+		LastEventID:    d.LastEventID,
+		AcknowledgedBy: d.AcknowledgedBy,
+		AcknowledgedAt: timeFromNull(d.AcknowledgedAt),
+		ResolvedBy:     d.ResolvedBy,
+		ResolvedAt:     timeFromNull(d.ResolvedAt),
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *alertStore) FetchAll() (map[int32]model.Alert, error) {
+	return fetchAllAlerts(s.db)
+}
+
+func (s *alertStore) FindByID(id int32) (*model.Alert, error) {
+	return findAlertByID(s.db, id)
+}
+
+func (s *alertStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.Alert, error) {
+	return selectAlerts(s.db, "SELECT * FROM alerts WHERE namespace=$1 AND device_id=$2", namespace, deviceID)
+}
+
+func (s *alertStore) FindUnresolved(ruleID int32, namespace, deviceID string) (*model.Alert, error) {
+	return findUnresolvedAlert(s.db, ruleID, namespace, deviceID)
+}
+
+func (s *alertStore) Create(m *model.Alert) error {
+	return createAlert(s.db, m)
+}
+
+func (s *alertStore) Update(m *model.Alert) error {
+	return updateAlert(s.db, m)
+}
+
+func fetchAllAlerts(db *sqlx.DB) (map[int32]model.Alert, error) {
+	return selectAlerts(db, "SELECT * FROM alerts")
+}
+
+func selectAlerts(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.Alert, error) {
+	rows := make([]sqlDataAlert, 0)
+	models := make(map[int32]model.Alert)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch alerts")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to alert model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findAlertByID(db *sqlx.DB, id int32) (*model.Alert, error) {
+	d := sqlDataAlert{}
+	query := "SELECT * FROM alerts WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find alert")
+	}
+
+	return d.Model()
+}
+
+func createAlert(db *sqlx.DB, m *model.Alert) error {
+	d := sqlDataAlert{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert alert model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsAlert {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO alerts (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created alert")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateAlert(db *sqlx.DB, m *model.Alert) error {
+	if _, err := findAlertByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataAlert{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert alert model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsAlert {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE alerts SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update alert")
+	}
+
+	return nil
+}
+
+func findUnresolvedAlert(db *sqlx.DB, ruleID int32, namespace, deviceID string) (*model.Alert, error) {
+	d := sqlDataAlert{}
+	query := "SELECT * FROM alerts WHERE rule_id=$1 AND namespace=$2 AND device_id=$3 AND status<>$4 ORDER BY id DESC LIMIT 1"
+	if err := db.Get(&d, query, ruleID, namespace, deviceID, model.AlertStatusResolved); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find alert")
+	}
+
+	return d.Model()
+}
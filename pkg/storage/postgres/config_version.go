@@ -0,0 +1,184 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newConfigVersionStore(db *sqlx.DB) *configVersionStore {
+	return &configVersionStore{
+		db: db,
+	}
+}
+
+type configVersionStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataConfigVersion struct {
+	ID        int32     `db:"id"`
+	Namespace string    `db:"namespace"`
+	DeviceID  string    `db:"device_id"`
+	Version   int       `db:"version"`
+	Checksum  string    `db:"checksum"`
+	Content   string    `db:"content"`
+	Source    string    `db:"source"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+var sqlParamsConfigVersion = []string{
+	"id",
+	"namespace",
+	"device_id",
+	"version",
+	"checksum",
+	"content",
+	"source",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataConfigVersion) Scan(m *model.ConfigVersion) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.Version = m.Version
+	d.Checksum = m.Checksum
+	d.Content = m.Content
+	d.Source = m.Source
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataConfigVersion) Model() (*model.ConfigVersion, error) {
+	m := &model.ConfigVersion{
+		ID:        d.ID,
+		Namespace: d.Namespace,
+		DeviceID:  d.DeviceID,
+		Version:   d.Version,
+		Checksum:  d.Checksum,
+		Content:   d.Content,
+		Source:    d.Source,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *configVersionStore) FetchAll() (map[int32]model.ConfigVersion, error) {
+	return fetchAllConfigVersions(s.db)
+}
+
+func (s *configVersionStore) FindByID(id int32) (*model.ConfigVersion, error) {
+	return findConfigVersionByID(s.db, id)
+}
+
+func (s *configVersionStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.ConfigVersion, error) {
+	return selectConfigVersions(s.db, "SELECT * FROM config_versions WHERE namespace=$1 AND device_id=$2", namespace, deviceID)
+}
+
+func (s *configVersionStore) FindLatestByNamespaceAndDeviceID(namespace, deviceID string) (*model.ConfigVersion, error) {
+	d := sqlDataConfigVersion{}
+	query := "SELECT * FROM config_versions WHERE namespace=$1 AND device_id=$2 ORDER BY version DESC LIMIT 1"
+	if err := s.db.Get(&d, query, namespace, deviceID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find latest config version")
+	}
+
+	return d.Model()
+}
+
+func (s *configVersionStore) Create(m *model.ConfigVersion) error {
+	return createConfigVersion(s.db, m)
+}
+
+func fetchAllConfigVersions(db *sqlx.DB) (map[int32]model.ConfigVersion, error) {
+	return selectConfigVersions(db, "SELECT * FROM config_versions")
+}
+
+func selectConfigVersions(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.ConfigVersion, error) {
+	rows := make([]sqlDataConfigVersion, 0)
+	models := make(map[int32]model.ConfigVersion)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch config versions")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to config version model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findConfigVersionByID(db *sqlx.DB, id int32) (*model.ConfigVersion, error) {
+	d := sqlDataConfigVersion{}
+	query := "SELECT * FROM config_versions WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find config version")
+	}
+
+	return d.Model()
+}
+
+func createConfigVersion(db *sqlx.DB, m *model.ConfigVersion) error {
+	d := sqlDataConfigVersion{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert config version model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsConfigVersion {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO config_versions (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created config version")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
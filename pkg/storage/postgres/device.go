@@ -23,16 +23,30 @@ type deviceStore struct {
 }
 
 type sqlDataDevice struct {
-	ID             int32     `db:"id"`
-	Namespace      string    `db:"namespace"`
-	DeviceID       string    `db:"device_id"`
-	DeviceURI      string    `db:"device_uri"`
-	SessionTimeout int       `db:"session_timeout"`
-	PingInterval   int       `db:"ping_interval"`
-	PongTimeout    int       `db:"pong_timeout"`
-	EventsTopic    string    `db:"events_topic"`
-	CreatedAt      time.Time `db:"created_at"`
-	UpdatedAt      time.Time `db:"updated_at"`
+	ID                        int32     `db:"id"`
+	Namespace                 string    `db:"namespace"`
+	DeviceID                  string    `db:"device_id"`
+	DeviceURI                 string    `db:"device_uri"`
+	SessionTimeout            int       `db:"session_timeout"`
+	PingInterval              int       `db:"ping_interval"`
+	PongTimeout               int       `db:"pong_timeout"`
+	EventsTopic               string    `db:"events_topic"`
+	TunnelPorts               string    `db:"tunnel_ports"`
+	DeviceType                string    `db:"device_type"`
+	Name                      string    `db:"name"`
+	Location                  string    `db:"location"`
+	AssetTag                  string    `db:"asset_tag"`
+	Group                     string    `db:"device_group"`
+	HardwareModel             string    `db:"hardware_model"`
+	HardwareRevision          string    `db:"hardware_revision"`
+	HardwareSerialNumber      string    `db:"hardware_serial_number"`
+	FirmwareVersion           string    `db:"firmware_version"`
+	NetworkHostname           string    `db:"network_hostname"`
+	NetworkDomainname         string    `db:"network_domainname"`
+	NetworkPrimaryIPv4Address string    `db:"network_primary_ipv4_address"`
+	Labels                    string    `db:"labels"`
+	CreatedAt                 time.Time `db:"created_at"`
+	UpdatedAt                 time.Time `db:"updated_at"`
 }
 
 var sqlParamsDevice = []string{
@@ -44,6 +58,20 @@ var sqlParamsDevice = []string{
 	"ping_interval",
 	"pong_timeout",
 	"events_topic",
+	"tunnel_ports",
+	"device_type",
+	"name",
+	"location",
+	"asset_tag",
+	"device_group",
+	"hardware_model",
+	"hardware_revision",
+	"hardware_serial_number",
+	"firmware_version",
+	"network_hostname",
+	"network_domainname",
+	"network_primary_ipv4_address",
+	"labels",
 	"created_at",
 	"updated_at",
 }
@@ -67,6 +95,20 @@ func (d *sqlDataDevice) Scan(m *model.Device) error {
 	d.PingInterval = m.PingInterval
 	d.PongTimeout = m.PongTimeout
 	d.EventsTopic = m.EventsTopic
+	d.TunnelPorts = joinInts(m.TunnelPorts)
+	d.DeviceType = m.DeviceType
+	d.Name = m.Name
+	d.Location = m.Location
+	d.AssetTag = m.AssetTag
+	d.Group = m.Group
+	d.HardwareModel = m.HardwareModel
+	d.HardwareRevision = m.HardwareRevision
+	d.HardwareSerialNumber = m.HardwareSerialNumber
+	d.FirmwareVersion = m.FirmwareVersion
+	d.NetworkHostname = m.NetworkHostname
+	d.NetworkDomainname = m.NetworkDomainname
+	d.NetworkPrimaryIPv4Address = m.NetworkPrimaryIPv4Address
+	d.Labels = marshalLabels(m.Labels)
 	d.CreatedAt = createdAt
 	d.UpdatedAt = updatedAt
 
@@ -75,18 +117,42 @@ func (d *sqlDataDevice) Scan(m *model.Device) error {
 
 func (d *sqlDataDevice) Model() (*model.Device, error) {
 	m := &model.Device{
-		ID:             d.ID,
-		Namespace:      d.Namespace,
-		DeviceID:       d.DeviceID,
-		DeviceURI:      d.DeviceURI,
-		SessionTimeout: d.SessionTimeout,
-		PingInterval:   d.PingInterval,
-		PongTimeout:    d.PongTimeout,
-		EventsTopic:    d.EventsTopic,
-		CreatedAt:      d.CreatedAt,
-		UpdatedAt:      d.UpdatedAt,
+		ID:                        d.ID,
+		Namespace:                 d.Namespace,
+		DeviceID:                  d.DeviceID,
+		DeviceURI:                 d.DeviceURI,
+		SessionTimeout:            d.SessionTimeout,
+		PingInterval:              d.PingInterval,
+		PongTimeout:               d.PongTimeout,
+		EventsTopic:               d.EventsTopic,
+		DeviceType:                d.DeviceType,
+		Name:                      d.Name,
+		Location:                  d.Location,
+		AssetTag:                  d.AssetTag,
+		Group:                     d.Group,
+		HardwareModel:             d.HardwareModel,
+		HardwareRevision:          d.HardwareRevision,
+		HardwareSerialNumber:      d.HardwareSerialNumber,
+		FirmwareVersion:           d.FirmwareVersion,
+		NetworkHostname:           d.NetworkHostname,
+		NetworkDomainname:         d.NetworkDomainname,
+		NetworkPrimaryIPv4Address: d.NetworkPrimaryIPv4Address,
+		CreatedAt:                 d.CreatedAt,
+		UpdatedAt:                 d.UpdatedAt,
 	}
 
+	tunnelPorts, err := splitInts(d.TunnelPorts)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid tunnel ports")
+	}
+	m.TunnelPorts = tunnelPorts
+
+	labels, err := unmarshalLabels(d.Labels)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid labels")
+	}
+	m.Labels = labels
+
 	return m, nil
 }
 
@@ -102,6 +168,10 @@ func (s *deviceStore) Create(m *model.Device) error {
 	return createDevice(s.db, m)
 }
 
+func (s *deviceStore) Update(m *model.Device) error {
+	return updateDevice(s.db, m)
+}
+
 func (s *deviceStore) Delete(id int32) error {
 	return deleteDevice(s.db, id)
 }
@@ -203,6 +273,31 @@ func createDevice(db *sqlx.DB, m *model.Device) error {
 	return nil
 }
 
+func updateDevice(db *sqlx.DB, m *model.Device) error {
+	if _, err := findDeviceByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataDevice{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert device model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsDevice {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE devices SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update device")
+	}
+
+	return nil
+}
+
 func deleteDevice(db *sqlx.DB, id int32) error {
 	query := "DELETE FROM devices WHERE id=$1"
 	_, err := db.Exec(query, id)
@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newDeviceGroupStore(db *sqlx.DB) *deviceGroupStore {
+	return &deviceGroupStore{
+		db: db,
+	}
+}
+
+type deviceGroupStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataDeviceGroup struct {
+	ID          int32     `db:"id"`
+	Namespace   string    `db:"namespace"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Selector    string    `db:"selector"`
+	Members     string    `db:"members"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+var sqlParamsDeviceGroup = []string{
+	"id",
+	"namespace",
+	"name",
+	"description",
+	"selector",
+	"members",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataDeviceGroup) Scan(m *model.DeviceGroup) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.Name = m.Name
+	d.Description = m.Description
+	d.Selector = m.Selector
+	d.Members = joinStrings(m.Members)
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataDeviceGroup) Model() (*model.DeviceGroup, error) {
+	m := &model.DeviceGroup{
+		ID:          d.ID,
+		Namespace:   d.Namespace,
+		Name:        d.Name,
+		Description: d.Description,
+		Selector:    d.Selector,
+		Members:     splitStrings(d.Members),
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *deviceGroupStore) FetchAll() (map[int32]model.DeviceGroup, error) {
+	return fetchAllDeviceGroups(s.db)
+}
+
+func (s *deviceGroupStore) FindByID(id int32) (*model.DeviceGroup, error) {
+	return findDeviceGroupByID(s.db, id)
+}
+
+func (s *deviceGroupStore) FindByNamespaceAndName(namespace, name string) (*model.DeviceGroup, error) {
+	return findDeviceGroupByNamespaceAndName(s.db, namespace, name)
+}
+
+func (s *deviceGroupStore) Create(m *model.DeviceGroup) error {
+	return createDeviceGroup(s.db, m)
+}
+
+func (s *deviceGroupStore) Update(m *model.DeviceGroup) error {
+	return updateDeviceGroup(s.db, m)
+}
+
+func (s *deviceGroupStore) Delete(id int32) error {
+	return deleteDeviceGroup(s.db, id)
+}
+
+func fetchAllDeviceGroups(db *sqlx.DB) (map[int32]model.DeviceGroup, error) {
+	return selectDeviceGroups(db, "SELECT * FROM device_groups")
+}
+
+func selectDeviceGroups(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.DeviceGroup, error) {
+	rows := make([]sqlDataDeviceGroup, 0)
+	models := make(map[int32]model.DeviceGroup)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch device groups")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to device group model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findDeviceGroupByID(db *sqlx.DB, id int32) (*model.DeviceGroup, error) {
+	d := sqlDataDeviceGroup{}
+	query := "SELECT * FROM device_groups WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find device group")
+	}
+
+	return d.Model()
+}
+
+func createDeviceGroup(db *sqlx.DB, m *model.DeviceGroup) error {
+	d := sqlDataDeviceGroup{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert device group model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsDeviceGroup {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO device_groups (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created device group")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateDeviceGroup(db *sqlx.DB, m *model.DeviceGroup) error {
+	if _, err := findDeviceGroupByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataDeviceGroup{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert device group model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsDeviceGroup {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE device_groups SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update device group")
+	}
+
+	return nil
+}
+
+func deleteDeviceGroup(db *sqlx.DB, id int32) error {
+	query := "DELETE FROM device_groups WHERE id=$1"
+	_, err := db.Exec(query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete device group")
+	}
+
+	return nil
+}
+
+func findDeviceGroupByNamespaceAndName(db *sqlx.DB, namespace, name string) (*model.DeviceGroup, error) {
+	d := sqlDataDeviceGroup{}
+	query := "SELECT * FROM device_groups WHERE namespace=$1 AND name=$2"
+	if err := db.Get(&d, query, namespace, name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find device group")
+	}
+
+	return d.Model()
+}
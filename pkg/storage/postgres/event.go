@@ -94,10 +94,39 @@ func (s *eventStore) FindByID(id int32) (*model.Event, error) {
 	return findEventByID(s.db, id)
 }
 
+func (s *eventStore) FindAfterID(id int32, limit int) (map[int32]model.Event, error) {
+	return findEventsAfterID(s.db, id, limit)
+}
+
+func (s *eventStore) FindFirstIDSince(t time.Time) (int32, error) {
+	return findFirstEventIDSince(s.db, t)
+}
+
 func (s *eventStore) Create(m *model.Event) error {
 	return createEvent(s.db, m)
 }
 
+func (s *eventStore) CreateWithOutbox(m *model.Event) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if err := createEvent(tx, m); err != nil {
+		return err
+	}
+	if err := createOutboxEntry(tx, m.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit event")
+	}
+
+	return nil
+}
+
 func fetchAllEvents(db *sqlx.DB) (map[int32]model.Event, error) {
 	rows := make([]sqlDataEvent, 0)
 	models := make(map[int32]model.Event)
@@ -132,7 +161,41 @@ func findEventByID(db *sqlx.DB, id int32) (*model.Event, error) {
 	return d.Model()
 }
 
-func createEvent(db *sqlx.DB, m *model.Event) error {
+func findEventsAfterID(db *sqlx.DB, id int32, limit int) (map[int32]model.Event, error) {
+	rows := make([]sqlDataEvent, 0)
+	models := make(map[int32]model.Event)
+
+	query := "SELECT * FROM events WHERE id>$1 ORDER BY id LIMIT $2"
+	if err := db.Select(&rows, query, id, limit); err != nil {
+		return nil, errors.Wrap(err, "failed to find events")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to event model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findFirstEventIDSince(db *sqlx.DB, t time.Time) (int32, error) {
+	var id int32
+	query := "SELECT id FROM events WHERE created_at>=$1 ORDER BY id LIMIT 1"
+	if err := db.Get(&id, query, t); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, storage.ErrNotFound
+		}
+		return 0, errors.Wrap(err, "failed to find event")
+	}
+
+	return id, nil
+}
+
+func createEvent(db sqlx.Ext, m *model.Event) error {
 	d := sqlDataEvent{}
 	if err := d.Scan(m); err != nil {
 		return errors.Wrap(err, "failed to convert event model to SQL data")
@@ -151,12 +214,15 @@ func createEvent(db *sqlx.DB, m *model.Event) error {
 		strings.Join(sqlParamsWithoutID, ", "),
 		":"+strings.Join(sqlParamsWithoutID, ", :"),
 	)
-	rows, err := db.NamedQuery(query, d)
+	rows, err := sqlx.NamedQuery(db, query, d)
 	if err != nil {
 		return errors.Wrap(err, "failed to created event")
 	}
+	defer rows.Close()
 	if rows.Next() {
-		rows.Scan(&m.ID)
+		if err := rows.Scan(&m.ID); err != nil {
+			return errors.Wrap(err, "failed to created event")
+		}
 	}
 
 	return nil
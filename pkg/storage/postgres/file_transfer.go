@@ -0,0 +1,258 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newFileTransferStore(db *sqlx.DB) *fileTransferStore {
+	return &fileTransferStore{
+		db: db,
+	}
+}
+
+type fileTransferStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataFileTransfer struct {
+	ID         int32     `db:"id"`
+	Namespace  string    `db:"namespace"`
+	DeviceID   string    `db:"device_id"`
+	Direction  string    `db:"direction"`
+	Path       string    `db:"path"`
+	Size       int64     `db:"size"`
+	Offset     int64     `db:"transfer_offset"`
+	Checksum   string    `db:"checksum"`
+	Status     string    `db:"status"`
+	Error      string    `db:"error"`
+	Blob       string    `db:"blob"`
+	Owner      string    `db:"owner"`
+	LeaseUntil time.Time `db:"lease_until"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+var sqlParamsFileTransfer = []string{
+	"id",
+	"namespace",
+	"device_id",
+	"direction",
+	"path",
+	"size",
+	"transfer_offset",
+	"checksum",
+	"status",
+	"error",
+	"blob",
+	"owner",
+	"lease_until",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataFileTransfer) Scan(m *model.FileTransfer) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.Direction = m.Direction
+	d.Path = m.Path
+	d.Size = m.Size
+	d.Offset = m.Offset
+	d.Checksum = m.Checksum
+	d.Status = m.Status
+	d.Error = m.Error
+	d.Blob = m.Blob
+	d.Owner = m.Owner
+	d.LeaseUntil = m.LeaseUntil
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataFileTransfer) Model() (*model.FileTransfer, error) {
+	m := &model.FileTransfer{
+		ID:         d.ID,
+		Namespace:  d.Namespace,
+		DeviceID:   d.DeviceID,
+		Direction:  d.Direction,
+		Path:       d.Path,
+		Size:       d.Size,
+		Offset:     d.Offset,
+		Checksum:   d.Checksum,
+		Status:     d.Status,
+		Error:      d.Error,
+		Blob:       d.Blob,
+		Owner:      d.Owner,
+		LeaseUntil: d.LeaseUntil,
+		CreatedAt:  d.CreatedAt,
+		UpdatedAt:  d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *fileTransferStore) FetchAll() (map[int32]model.FileTransfer, error) {
+	return fetchAllFileTransfers(s.db)
+}
+
+func (s *fileTransferStore) FindByID(id int32) (*model.FileTransfer, error) {
+	return findFileTransferByID(s.db, id)
+}
+
+func (s *fileTransferStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (map[int32]model.FileTransfer, error) {
+	return selectFileTransfers(s.db, "SELECT * FROM file_transfers WHERE namespace=$1 AND device_id=$2", namespace, deviceID)
+}
+
+func (s *fileTransferStore) FindByStatus(status string) (map[int32]model.FileTransfer, error) {
+	return selectFileTransfers(s.db, "SELECT * FROM file_transfers WHERE status=$1", status)
+}
+
+func (s *fileTransferStore) Create(m *model.FileTransfer) error {
+	return createFileTransfer(s.db, m)
+}
+
+func (s *fileTransferStore) Update(m *model.FileTransfer) error {
+	return updateFileTransfer(s.db, m)
+}
+
+func (s *fileTransferStore) Claim(id int32, owner string, now time.Time, lease time.Duration) (bool, error) {
+	// The condition is checked by the update itself, only one of concurrent
+	// owners succeeds
+	query := `UPDATE file_transfers SET owner=$2, lease_until=$3
+		WHERE id=$1 AND (owner='' OR owner=$2 OR lease_until<=$4)`
+	res, err := s.db.Exec(query, id, owner, now.Add(lease).UTC(), now.UTC())
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim file transfer")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim file transfer")
+	}
+
+	return n == 1, nil
+}
+
+func (s *fileTransferStore) Release(id int32, owner string) error {
+	query := "UPDATE file_transfers SET owner='' WHERE id=$1 AND owner=$2"
+	if _, err := s.db.Exec(query, id, owner); err != nil {
+		return errors.Wrap(err, "failed to release file transfer")
+	}
+
+	return nil
+}
+
+func fetchAllFileTransfers(db *sqlx.DB) (map[int32]model.FileTransfer, error) {
+	return selectFileTransfers(db, "SELECT * FROM file_transfers")
+}
+
+func selectFileTransfers(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.FileTransfer, error) {
+	rows := make([]sqlDataFileTransfer, 0)
+	models := make(map[int32]model.FileTransfer)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch file transfers")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to file transfer model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findFileTransferByID(db *sqlx.DB, id int32) (*model.FileTransfer, error) {
+	d := sqlDataFileTransfer{}
+	query := "SELECT * FROM file_transfers WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find file transfer")
+	}
+
+	return d.Model()
+}
+
+func createFileTransfer(db *sqlx.DB, m *model.FileTransfer) error {
+	d := sqlDataFileTransfer{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert file transfer model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsFileTransfer {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO file_transfers (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created file transfer")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateFileTransfer(db *sqlx.DB, m *model.FileTransfer) error {
+	if _, err := findFileTransferByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataFileTransfer{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert file transfer model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsFileTransfer {
+		// The owner is changed by Claim and Release only
+		if param == "owner" || param == "lease_until" {
+			continue
+		}
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE file_transfers SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update file transfer")
+	}
+
+	return nil
+}
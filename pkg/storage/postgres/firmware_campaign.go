@@ -0,0 +1,234 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newFirmwareCampaignStore(db *sqlx.DB) *firmwareCampaignStore {
+	return &firmwareCampaignStore{
+		db: db,
+	}
+}
+
+type firmwareCampaignStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataFirmwareCampaign struct {
+	ID             int32     `db:"id"`
+	Namespace      string    `db:"namespace"`
+	ImageID        int32     `db:"image_id"`
+	BatchSize      int       `db:"batch_size"`
+	MaxFailureRate float64   `db:"max_failure_rate"`
+	Status         string    `db:"status"`
+	Error          string    `db:"error"`
+	Owner          string    `db:"owner"`
+	LeaseUntil     time.Time `db:"lease_until"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+var sqlParamsFirmwareCampaign = []string{
+	"id",
+	"namespace",
+	"image_id",
+	"batch_size",
+	"max_failure_rate",
+	"status",
+	"error",
+	"owner",
+	"lease_until",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataFirmwareCampaign) Scan(m *model.FirmwareCampaign) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.ImageID = m.ImageID
+	d.BatchSize = m.BatchSize
+	d.MaxFailureRate = m.MaxFailureRate
+	d.Status = m.Status
+	d.Error = m.Error
+	d.Owner = m.Owner
+	d.LeaseUntil = m.LeaseUntil
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataFirmwareCampaign) Model() (*model.FirmwareCampaign, error) {
+	m := &model.FirmwareCampaign{
+		ID:             d.ID,
+		Namespace:      d.Namespace,
+		ImageID:        d.ImageID,
+		BatchSize:      d.BatchSize,
+		MaxFailureRate: d.MaxFailureRate,
+		Status:         d.Status,
+		Error:          d.Error,
+		Owner:          d.Owner,
+		LeaseUntil:     d.LeaseUntil,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *firmwareCampaignStore) FetchAll() (map[int32]model.FirmwareCampaign, error) {
+	return fetchAllFirmwareCampaigns(s.db)
+}
+
+func (s *firmwareCampaignStore) FindByID(id int32) (*model.FirmwareCampaign, error) {
+	return findFirmwareCampaignByID(s.db, id)
+}
+
+func (s *firmwareCampaignStore) Create(m *model.FirmwareCampaign) error {
+	return createFirmwareCampaign(s.db, m)
+}
+
+func (s *firmwareCampaignStore) Update(m *model.FirmwareCampaign) error {
+	return updateFirmwareCampaign(s.db, m)
+}
+
+func (s *firmwareCampaignStore) Claim(id int32, owner string, now time.Time, lease time.Duration) (bool, error) {
+	// The condition is checked by the update itself, only one of concurrent
+	// owners succeeds
+	query := `UPDATE firmware_campaigns SET owner=$2, lease_until=$3
+		WHERE id=$1 AND (owner='' OR owner=$2 OR lease_until<=$4)`
+	res, err := s.db.Exec(query, id, owner, now.Add(lease).UTC(), now.UTC())
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim firmware campaign")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to claim firmware campaign")
+	}
+
+	return n == 1, nil
+}
+
+func (s *firmwareCampaignStore) Release(id int32, owner string) error {
+	query := "UPDATE firmware_campaigns SET owner='' WHERE id=$1 AND owner=$2"
+	if _, err := s.db.Exec(query, id, owner); err != nil {
+		return errors.Wrap(err, "failed to release firmware campaign")
+	}
+
+	return nil
+}
+
+func fetchAllFirmwareCampaigns(db *sqlx.DB) (map[int32]model.FirmwareCampaign, error) {
+	return selectFirmwareCampaigns(db, "SELECT * FROM firmware_campaigns")
+}
+
+func selectFirmwareCampaigns(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.FirmwareCampaign, error) {
+	rows := make([]sqlDataFirmwareCampaign, 0)
+	models := make(map[int32]model.FirmwareCampaign)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch firmware campaigns")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to firmware campaign model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findFirmwareCampaignByID(db *sqlx.DB, id int32) (*model.FirmwareCampaign, error) {
+	d := sqlDataFirmwareCampaign{}
+	query := "SELECT * FROM firmware_campaigns WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find firmware campaign")
+	}
+
+	return d.Model()
+}
+
+func createFirmwareCampaign(db *sqlx.DB, m *model.FirmwareCampaign) error {
+	d := sqlDataFirmwareCampaign{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert firmware campaign model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsFirmwareCampaign {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO firmware_campaigns (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created firmware campaign")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateFirmwareCampaign(db *sqlx.DB, m *model.FirmwareCampaign) error {
+	if _, err := findFirmwareCampaignByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataFirmwareCampaign{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert firmware campaign model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsFirmwareCampaign {
+		// The owner is changed by Claim and Release only
+		if param == "owner" || param == "lease_until" {
+			continue
+		}
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE firmware_campaigns SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update firmware campaign")
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newFirmwareImageStore(db *sqlx.DB) *firmwareImageStore {
+	return &firmwareImageStore{
+		db: db,
+	}
+}
+
+type firmwareImageStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataFirmwareImage struct {
+	ID             int32     `db:"id"`
+	Version        string    `db:"version"`
+	HardwareModels string    `db:"hardware_models"`
+	Filename       string    `db:"filename"`
+	Size           int64     `db:"size"`
+	Checksum       string    `db:"checksum"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+var sqlParamsFirmwareImage = []string{
+	"id",
+	"version",
+	"hardware_models",
+	"filename",
+	"size",
+	"checksum",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataFirmwareImage) Scan(m *model.FirmwareImage) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Version = m.Version
+	d.HardwareModels = strings.Join(m.HardwareModels, ",")
+	d.Filename = m.Filename
+	d.Size = m.Size
+	d.Checksum = m.Checksum
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataFirmwareImage) Model() (*model.FirmwareImage, error) {
+	m := &model.FirmwareImage{
+		ID:        d.ID,
+		Version:   d.Version,
+		Filename:  d.Filename,
+		Size:      d.Size,
+		Checksum:  d.Checksum,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+
+	m.HardwareModels = make([]string, 0)
+	if d.HardwareModels != "" {
+		m.HardwareModels = strings.Split(d.HardwareModels, ",")
+	}
+
+	return m, nil
+}
+
+func (s *firmwareImageStore) FetchAll() (map[int32]model.FirmwareImage, error) {
+	return fetchAllFirmwareImages(s.db)
+}
+
+func (s *firmwareImageStore) FindByID(id int32) (*model.FirmwareImage, error) {
+	return findFirmwareImageByID(s.db, id)
+}
+
+func (s *firmwareImageStore) Create(m *model.FirmwareImage) error {
+	return createFirmwareImage(s.db, m)
+}
+
+func (s *firmwareImageStore) Delete(id int32) error {
+	return deleteFirmwareImage(s.db, id)
+}
+
+func fetchAllFirmwareImages(db *sqlx.DB) (map[int32]model.FirmwareImage, error) {
+	return selectFirmwareImages(db, "SELECT * FROM firmware_images")
+}
+
+func selectFirmwareImages(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.FirmwareImage, error) {
+	rows := make([]sqlDataFirmwareImage, 0)
+	models := make(map[int32]model.FirmwareImage)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch firmware images")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to firmware image model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findFirmwareImageByID(db *sqlx.DB, id int32) (*model.FirmwareImage, error) {
+	d := sqlDataFirmwareImage{}
+	query := "SELECT * FROM firmware_images WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find firmware image")
+	}
+
+	return d.Model()
+}
+
+func createFirmwareImage(db *sqlx.DB, m *model.FirmwareImage) error {
+	d := sqlDataFirmwareImage{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert firmware image model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsFirmwareImage {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO firmware_images (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created firmware image")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func deleteFirmwareImage(db *sqlx.DB, id int32) error {
+	query := "DELETE FROM firmware_images WHERE id=$1"
+	_, err := db.Exec(query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete firmware image")
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newFirmwareUpdateStore(db *sqlx.DB) *firmwareUpdateStore {
+	return &firmwareUpdateStore{
+		db: db,
+	}
+}
+
+type firmwareUpdateStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataFirmwareUpdate struct {
+	ID         int32     `db:"id"`
+	CampaignID int32     `db:"campaign_id"`
+	Namespace  string    `db:"namespace"`
+	DeviceID   string    `db:"device_id"`
+	Status     string    `db:"status"`
+	Error      string    `db:"error"`
+	TransferID int32     `db:"transfer_id"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+var sqlParamsFirmwareUpdate = []string{
+	"id",
+	"campaign_id",
+	"namespace",
+	"device_id",
+	"status",
+	"error",
+	"transfer_id",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataFirmwareUpdate) Scan(m *model.FirmwareUpdate) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.CampaignID = m.CampaignID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.Status = m.Status
+	d.Error = m.Error
+	d.TransferID = m.TransferID
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataFirmwareUpdate) Model() (*model.FirmwareUpdate, error) {
+	m := &model.FirmwareUpdate{
+		ID:         d.ID,
+		CampaignID: d.CampaignID,
+		Namespace:  d.Namespace,
+		DeviceID:   d.DeviceID,
+		Status:     d.Status,
+		Error:      d.Error,
+		TransferID: d.TransferID,
+		CreatedAt:  d.CreatedAt,
+		UpdatedAt:  d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *firmwareUpdateStore) FetchAll() (map[int32]model.FirmwareUpdate, error) {
+	return fetchAllFirmwareUpdates(s.db)
+}
+
+func (s *firmwareUpdateStore) FindByID(id int32) (*model.FirmwareUpdate, error) {
+	return findFirmwareUpdateByID(s.db, id)
+}
+
+func (s *firmwareUpdateStore) FindByCampaignID(campaignID int32) (map[int32]model.FirmwareUpdate, error) {
+	return selectFirmwareUpdates(s.db, "SELECT * FROM firmware_updates WHERE campaign_id=$1", campaignID)
+}
+
+func (s *firmwareUpdateStore) Create(m *model.FirmwareUpdate) error {
+	return createFirmwareUpdate(s.db, m)
+}
+
+func (s *firmwareUpdateStore) Update(m *model.FirmwareUpdate) error {
+	return updateFirmwareUpdate(s.db, m)
+}
+
+func fetchAllFirmwareUpdates(db *sqlx.DB) (map[int32]model.FirmwareUpdate, error) {
+	return selectFirmwareUpdates(db, "SELECT * FROM firmware_updates")
+}
+
+func selectFirmwareUpdates(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.FirmwareUpdate, error) {
+	rows := make([]sqlDataFirmwareUpdate, 0)
+	models := make(map[int32]model.FirmwareUpdate)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch firmware updates")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to firmware update model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findFirmwareUpdateByID(db *sqlx.DB, id int32) (*model.FirmwareUpdate, error) {
+	d := sqlDataFirmwareUpdate{}
+	query := "SELECT * FROM firmware_updates WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find firmware update")
+	}
+
+	return d.Model()
+}
+
+func createFirmwareUpdate(db *sqlx.DB, m *model.FirmwareUpdate) error {
+	d := sqlDataFirmwareUpdate{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert firmware update model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsFirmwareUpdate {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO firmware_updates (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created firmware update")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateFirmwareUpdate(db *sqlx.DB, m *model.FirmwareUpdate) error {
+	if _, err := findFirmwareUpdateByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataFirmwareUpdate{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert firmware update model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsFirmwareUpdate {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE firmware_updates SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update firmware update")
+	}
+
+	return nil
+}
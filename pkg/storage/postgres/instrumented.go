@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nsyszr/lcm/pkg/metrics"
+)
+
+// instrumentedDriverName is the name of the PostgreSQL driver observing the
+// latency of the queries
+const instrumentedDriverName = "postgres-instrumented"
+
+// queryTable matches the first table of a statement
+var queryTable = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE)\s+(\w+)`)
+
+func init() {
+	sql.Register(instrumentedDriverName, &instrumentedDriver{})
+}
+
+// Open opens the PostgreSQL database of the URL. The latency of the queries
+// is observed by the store query metrics.
+func Open(url string) (*sqlx.DB, error) {
+	db, err := sql.Open(instrumentedDriverName, url)
+	if err != nil {
+		return nil, err
+	}
+	// The driver name selects the bind variables of sqlx
+	return sqlx.NewDb(db, "postgres"), nil
+}
+
+// observeQuery observes the duration of the statement since start. The
+// operation is the first keyword of the statement.
+func observeQuery(query string, start time.Time) {
+	operation, table := "unknown", "unknown"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToLower(fields[0])
+	}
+	if m := queryTable.FindStringSubmatch(query); m != nil {
+		table = strings.ToLower(m[1])
+	}
+	metrics.StoreQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+}
+
+type instrumentedDriver struct {
+	pq.Driver
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+// instrumentedConn observes the queries of a connection. Statements which
+// the connection doesn't execute directly are prepared and observed by the
+// instrumentedStmt.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{stmt, query}, nil
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{stmt, query}, nil
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeQuery(query, time.Now())
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer observeQuery(query, time.Now())
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.Stmt.Exec(args)
+}
+
+func (s *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	defer observeQuery(s.query, time.Now())
+	return s.Stmt.Query(args)
+}
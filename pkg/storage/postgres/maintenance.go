@@ -0,0 +1,272 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newMaintenanceStore(db *sqlx.DB) *maintenanceStore {
+	return &maintenanceStore{
+		db: db,
+	}
+}
+
+type maintenanceStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataMaintenance struct {
+	ID          int32     `db:"id"`
+	Namespace   string    `db:"namespace"`
+	DeviceID    string    `db:"device_id"`
+	GroupID     int32     `db:"group_id"`
+	Reason      string    `db:"reason"`
+	RejectCalls bool      `db:"reject_calls"`
+	SetBy       string    `db:"set_by"`
+	Until       time.Time `db:"until"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+var sqlParamsMaintenance = []string{
+	"id",
+	"namespace",
+	"device_id",
+	"group_id",
+	"reason",
+	"reject_calls",
+	"set_by",
+	"until",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataMaintenance) Scan(m *model.Maintenance) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.GroupID = m.GroupID
+	d.Reason = m.Reason
+	d.RejectCalls = m.RejectCalls
+	d.SetBy = m.SetBy
+	d.Until = m.Until
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataMaintenance) Model() (*model.Maintenance, error) {
+	m := &model.Maintenance{
+		ID:          d.ID,
+		Namespace:   d.Namespace,
+		DeviceID:    d.DeviceID,
+		GroupID:     d.GroupID,
+		Reason:      d.Reason,
+		RejectCalls: d.RejectCalls,
+		SetBy:       d.SetBy,
+		Until:       d.Until,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *maintenanceStore) FetchAll() (map[int32]model.Maintenance, error) {
+	return fetchAllMaintenances(s.db)
+}
+
+func (s *maintenanceStore) FindByID(id int32) (*model.Maintenance, error) {
+	return findMaintenanceByID(s.db, id)
+}
+
+func (s *maintenanceStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (*model.Maintenance, error) {
+	return findMaintenanceByNamespaceAndDeviceID(s.db, namespace, deviceID)
+}
+
+func (s *maintenanceStore) FindByGroupID(groupID int32) (*model.Maintenance, error) {
+	d := sqlDataMaintenance{}
+	query := "SELECT * FROM maintenances WHERE group_id=$1"
+	if err := s.db.Get(&d, query, groupID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find maintenance")
+	}
+
+	return d.Model()
+}
+
+func (s *maintenanceStore) FindGroupWindowsByNamespace(namespace string) (map[int32]model.Maintenance, error) {
+	return selectMaintenances(s.db, "SELECT * FROM maintenances WHERE namespace=$1 AND group_id<>0", namespace)
+}
+
+func (s *maintenanceStore) Create(m *model.Maintenance) error {
+	return createMaintenance(s.db, m)
+}
+
+func (s *maintenanceStore) Update(m *model.Maintenance) error {
+	return updateMaintenance(s.db, m)
+}
+
+func (s *maintenanceStore) Delete(id int32) error {
+	return deleteMaintenance(s.db, id)
+}
+
+func (s *maintenanceStore) DeleteExpired(now time.Time) ([]model.Maintenance, error) {
+	// The rows are removed and returned by one statement, concurrent
+	// callers never receive the same window
+	rows := make([]sqlDataMaintenance, 0)
+	query := "DELETE FROM maintenances WHERE until<=$1 RETURNING *"
+	if err := s.db.Select(&rows, query, now); err != nil {
+		return nil, errors.Wrap(err, "failed to delete expired maintenances")
+	}
+
+	models := make([]model.Maintenance, 0, len(rows))
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to maintenance model")
+		}
+		models = append(models, *m)
+	}
+
+	return models, nil
+}
+
+func fetchAllMaintenances(db *sqlx.DB) (map[int32]model.Maintenance, error) {
+	return selectMaintenances(db, "SELECT * FROM maintenances")
+}
+
+func selectMaintenances(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.Maintenance, error) {
+	rows := make([]sqlDataMaintenance, 0)
+	models := make(map[int32]model.Maintenance)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch maintenances")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to maintenance model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findMaintenanceByID(db *sqlx.DB, id int32) (*model.Maintenance, error) {
+	d := sqlDataMaintenance{}
+	query := "SELECT * FROM maintenances WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find maintenance")
+	}
+
+	return d.Model()
+}
+
+func createMaintenance(db *sqlx.DB, m *model.Maintenance) error {
+	d := sqlDataMaintenance{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert maintenance model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsMaintenance {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO maintenances (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created maintenance")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateMaintenance(db *sqlx.DB, m *model.Maintenance) error {
+	if _, err := findMaintenanceByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataMaintenance{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert maintenance model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsMaintenance {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE maintenances SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update maintenance")
+	}
+
+	return nil
+}
+
+func deleteMaintenance(db *sqlx.DB, id int32) error {
+	query := "DELETE FROM maintenances WHERE id=$1"
+	res, err := db.Exec(query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete maintenance")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func findMaintenanceByNamespaceAndDeviceID(db *sqlx.DB, namespace, deviceID string) (*model.Maintenance, error) {
+	d := sqlDataMaintenance{}
+	query := "SELECT * FROM maintenances WHERE namespace=$1 AND device_id=$2 AND group_id=0"
+	if err := db.Get(&d, query, namespace, deviceID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find maintenance")
+	}
+
+	return d.Model()
+}
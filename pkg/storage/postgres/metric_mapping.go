@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newMetricMappingStore(db *sqlx.DB) *metricMappingStore {
+	return &metricMappingStore{
+		db: db,
+	}
+}
+
+type metricMappingStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataMetricMapping struct {
+	ID          int32     `db:"id"`
+	Namespace   string    `db:"namespace"`
+	Metric      string    `db:"metric"`
+	Topic       string    `db:"topic"`
+	Path        string    `db:"path"`
+	Unit        string    `db:"unit"`
+	Description string    `db:"description"`
+	Enabled     bool      `db:"enabled"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+var sqlParamsMetricMapping = []string{
+	"id",
+	"namespace",
+	"metric",
+	"topic",
+	"path",
+	"unit",
+	"description",
+	"enabled",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataMetricMapping) Scan(m *model.MetricMapping) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.Metric = m.Metric
+	d.Topic = m.Topic
+	d.Path = m.Path
+	d.Unit = m.Unit
+	d.Description = m.Description
+	d.Enabled = m.Enabled
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataMetricMapping) Model() (*model.MetricMapping, error) {
+	m := &model.MetricMapping{
+		ID:          d.ID,
+		Namespace:   d.Namespace,
+		Metric:      d.Metric,
+		Topic:       d.Topic,
+		Path:        d.Path,
+		Unit:        d.Unit,
+		Description: d.Description,
+		Enabled:     d.Enabled,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *metricMappingStore) FetchAll() (map[int32]model.MetricMapping, error) {
+	return fetchAllMetricMappings(s.db)
+}
+
+func (s *metricMappingStore) FindByID(id int32) (*model.MetricMapping, error) {
+	return findMetricMappingByID(s.db, id)
+}
+
+func (s *metricMappingStore) Create(m *model.MetricMapping) error {
+	return createMetricMapping(s.db, m)
+}
+
+func (s *metricMappingStore) Update(m *model.MetricMapping) error {
+	return updateMetricMapping(s.db, m)
+}
+
+func (s *metricMappingStore) Delete(id int32) error {
+	return deleteMetricMapping(s.db, id)
+}
+
+func fetchAllMetricMappings(db *sqlx.DB) (map[int32]model.MetricMapping, error) {
+	return selectMetricMappings(db, "SELECT * FROM metric_mappings")
+}
+
+func selectMetricMappings(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.MetricMapping, error) {
+	rows := make([]sqlDataMetricMapping, 0)
+	models := make(map[int32]model.MetricMapping)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch metric mappings")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to metric mapping model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findMetricMappingByID(db *sqlx.DB, id int32) (*model.MetricMapping, error) {
+	d := sqlDataMetricMapping{}
+	query := "SELECT * FROM metric_mappings WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find metric mapping")
+	}
+
+	return d.Model()
+}
+
+func createMetricMapping(db *sqlx.DB, m *model.MetricMapping) error {
+	d := sqlDataMetricMapping{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert metric mapping model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsMetricMapping {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO metric_mappings (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created metric mapping")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateMetricMapping(db *sqlx.DB, m *model.MetricMapping) error {
+	if _, err := findMetricMappingByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataMetricMapping{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert metric mapping model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsMetricMapping {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE metric_mappings SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update metric mapping")
+	}
+
+	return nil
+}
+
+func deleteMetricMapping(db *sqlx.DB, id int32) error {
+	query := "DELETE FROM metric_mappings WHERE id=$1"
+	_, err := db.Exec(query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete metric mapping")
+	}
+
+	return nil
+}
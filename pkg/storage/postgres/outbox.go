@@ -0,0 +1,181 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newOutboxStore(db *sqlx.DB) *outboxStore {
+	return &outboxStore{
+		db: db,
+	}
+}
+
+type outboxStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataOutboxEntry struct {
+	ID            int32     `db:"id"`
+	EventID       int32     `db:"event_id"`
+	Attempts      int       `db:"attempts"`
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastError     string    `db:"last_error"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+var sqlParamsOutboxEntry = []string{
+	"id",
+	"event_id",
+	"attempts",
+	"next_attempt_at",
+	"last_error",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataOutboxEntry) Scan(m *model.OutboxEntry) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.EventID = m.EventID
+	d.Attempts = m.Attempts
+	d.NextAttemptAt = m.NextAttemptAt
+	d.LastError = m.LastError
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataOutboxEntry) Model() (*model.OutboxEntry, error) {
+	m := &model.OutboxEntry{
+		ID:            d.ID,
+		EventID:       d.EventID,
+		Attempts:      d.Attempts,
+		NextAttemptAt: d.NextAttemptAt,
+		LastError:     d.LastError,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *outboxStore) FetchAll() (map[int32]model.OutboxEntry, error) {
+	return selectOutboxEntries(s.db, "SELECT * FROM outbox")
+}
+
+func (s *outboxStore) Count() (int, error) {
+	var n int
+	if err := s.db.Get(&n, "SELECT count(*) FROM outbox"); err != nil {
+		return 0, errors.Wrap(err, "failed to count outbox entries")
+	}
+
+	return n, nil
+}
+
+func (s *outboxStore) ClaimDue(now time.Time, lease time.Duration, limit int) (map[int32]model.OutboxEntry, error) {
+	// The claimed rows are locked until the update is done, concurrent
+	// relays skip them
+	query := `UPDATE outbox SET next_attempt_at=$2, updated_at=$3
+		WHERE id IN (SELECT id FROM outbox WHERE next_attempt_at<=$1 ORDER BY id LIMIT $4 FOR UPDATE SKIP LOCKED)
+		RETURNING *`
+	return selectOutboxEntries(s.db, query, now, now.Add(lease), time.Now().Round(time.Second).UTC(), limit)
+}
+
+func (s *outboxStore) Update(m *model.OutboxEntry) error {
+	return updateOutboxEntry(s.db, m)
+}
+
+func (s *outboxStore) Delete(id int32) error {
+	return deleteOutboxEntry(s.db, id)
+}
+
+func selectOutboxEntries(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.OutboxEntry, error) {
+	rows := make([]sqlDataOutboxEntry, 0)
+	models := make(map[int32]model.OutboxEntry)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch outbox entries")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to outbox entry model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+// createOutboxEntry creates the outbox entry of the event within the
+// transaction of the event
+func createOutboxEntry(tx *sqlx.Tx, eventID int32) error {
+	now := time.Now().UTC()
+	query := "INSERT INTO outbox (event_id, next_attempt_at, created_at, updated_at) VALUES ($1, $2, $3, $3)"
+	if _, err := tx.Exec(query, eventID, now, now.Round(time.Second)); err != nil {
+		return errors.Wrap(err, "failed to create outbox entry")
+	}
+
+	return nil
+}
+
+func updateOutboxEntry(db *sqlx.DB, m *model.OutboxEntry) error {
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataOutboxEntry{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert outbox entry model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsOutboxEntry {
+		if param == "created_at" {
+			continue
+		}
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE outbox SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	res, err := db.NamedExec(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to update outbox entry")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
+
+func deleteOutboxEntry(db *sqlx.DB, id int32) error {
+	query := "DELETE FROM outbox WHERE id=$1"
+	res, err := db.Exec(query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete outbox entry")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return storage.ErrNotFound
+	}
+
+	return nil
+}
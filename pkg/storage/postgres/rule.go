@@ -0,0 +1,236 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newRuleStore(db *sqlx.DB) *ruleStore {
+	return &ruleStore{
+		db: db,
+	}
+}
+
+type ruleStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataRule struct {
+	ID          int32     `db:"id"`
+	Namespace   string    `db:"namespace"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Enabled     bool      `db:"enabled"`
+	Topic       string    `db:"topic"`
+	SourceType  string    `db:"source_type"`
+	SourceID    string    `db:"source_id"`
+	Conditions  string    `db:"conditions"`
+	Actions     string    `db:"actions"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+var sqlParamsRule = []string{
+	"id",
+	"namespace",
+	"name",
+	"description",
+	"enabled",
+	"topic",
+	"source_type",
+	"source_id",
+	"conditions",
+	"actions",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataRule) Scan(m *model.Rule) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.Name = m.Name
+	d.Description = m.Description
+	d.Enabled = m.Enabled
+	d.Topic = m.Topic
+	d.SourceType = m.SourceType
+	d.SourceID = m.SourceID
+	conditions, err := marshalJSON(m.Conditions)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal rule conditions")
+	}
+	d.Conditions = conditions
+	actions, err := marshalJSON(m.Actions)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal rule actions")
+	}
+	d.Actions = actions
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataRule) Model() (*model.Rule, error) {
+	m := &model.Rule{
+		ID:          d.ID,
+		Namespace:   d.Namespace,
+		Name:        d.Name,
+		Description: d.Description,
+		Enabled:     d.Enabled,
+		Topic:       d.Topic,
+		SourceType:  d.SourceType,
+		SourceID:    d.SourceID,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+
+	if err := json.Unmarshal([]byte(d.Conditions), &m.Conditions); err != nil {
+		return nil, errors.Wrap(err, "invalid rule conditions")
+	}
+	if err := json.Unmarshal([]byte(d.Actions), &m.Actions); err != nil {
+		return nil, errors.Wrap(err, "invalid rule actions")
+	}
+
+	return m, nil
+}
+
+func (s *ruleStore) FetchAll() (map[int32]model.Rule, error) {
+	return fetchAllRules(s.db)
+}
+
+func (s *ruleStore) FindByID(id int32) (*model.Rule, error) {
+	return findRuleByID(s.db, id)
+}
+
+func (s *ruleStore) Create(m *model.Rule) error {
+	return createRule(s.db, m)
+}
+
+func (s *ruleStore) Update(m *model.Rule) error {
+	return updateRule(s.db, m)
+}
+
+func (s *ruleStore) Delete(id int32) error {
+	return deleteRule(s.db, id)
+}
+
+func fetchAllRules(db *sqlx.DB) (map[int32]model.Rule, error) {
+	return selectRules(db, "SELECT * FROM rules")
+}
+
+func selectRules(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.Rule, error) {
+	rows := make([]sqlDataRule, 0)
+	models := make(map[int32]model.Rule)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch rules")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to rule model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findRuleByID(db *sqlx.DB, id int32) (*model.Rule, error) {
+	d := sqlDataRule{}
+	query := "SELECT * FROM rules WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find rule")
+	}
+
+	return d.Model()
+}
+
+func createRule(db *sqlx.DB, m *model.Rule) error {
+	d := sqlDataRule{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert rule model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsRule {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO rules (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created rule")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateRule(db *sqlx.DB, m *model.Rule) error {
+	if _, err := findRuleByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataRule{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert rule model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsRule {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE rules SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update rule")
+	}
+
+	return nil
+}
+
+func deleteRule(db *sqlx.DB, id int32) error {
+	query := "DELETE FROM rules WHERE id=$1"
+	_, err := db.Exec(query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete rule")
+	}
+
+	return nil
+}
@@ -23,14 +23,18 @@ type sessionStore struct {
 }
 
 type sqlDataSession struct {
-	ID             int32     `db:"id"`
-	Namespace      string    `db:"namespace"`
-	DeviceID       string    `db:"device_id"`
-	DeviceURI      string    `db:"device_uri"`
-	SessionTimeout int       `db:"session_timeout"`
-	LastMessageAt  time.Time `db:"last_message_at"`
-	CreatedAt      time.Time `db:"created_at"`
-	UpdatedAt      time.Time `db:"updated_at"`
+	ID              int32     `db:"id"`
+	Namespace       string    `db:"namespace"`
+	DeviceID        string    `db:"device_id"`
+	DeviceURI       string    `db:"device_uri"`
+	SessionTimeout  int       `db:"session_timeout"`
+	LastMessageAt   time.Time `db:"last_message_at"`
+	ProtocolVersion int       `db:"protocol_version"`
+	Features        string    `db:"features"`
+	FirmwareVersion string    `db:"firmware_version"`
+	HardwareModel   string    `db:"hardware_model"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
 }
 
 var sqlParamsSession = []string{
@@ -40,6 +44,10 @@ var sqlParamsSession = []string{
 	"device_uri",
 	"session_timeout",
 	"last_message_at",
+	"protocol_version",
+	"features",
+	"firmware_version",
+	"hardware_model",
 	"created_at",
 	"updated_at",
 }
@@ -61,6 +69,10 @@ func (d *sqlDataSession) Scan(m *model.Session) error {
 	d.DeviceURI = m.DeviceURI
 	d.SessionTimeout = m.SessionTimeout
 	d.LastMessageAt = m.LastMessageAt
+	d.ProtocolVersion = m.ProtocolVersion
+	d.Features = strings.Join(m.Features, ",")
+	d.FirmwareVersion = m.FirmwareVersion
+	d.HardwareModel = m.HardwareModel
 	d.CreatedAt = createdAt
 	d.UpdatedAt = updatedAt
 
@@ -69,14 +81,22 @@ func (d *sqlDataSession) Scan(m *model.Session) error {
 
 func (d *sqlDataSession) Model() (*model.Session, error) {
 	m := &model.Session{
-		ID:             d.ID,
-		Namespace:      d.Namespace,
-		DeviceID:       d.DeviceID,
-		DeviceURI:      d.DeviceURI,
-		SessionTimeout: d.SessionTimeout,
-		LastMessageAt:  d.LastMessageAt,
-		CreatedAt:      d.CreatedAt,
-		UpdatedAt:      d.UpdatedAt,
+		ID:              d.ID,
+		Namespace:       d.Namespace,
+		DeviceID:        d.DeviceID,
+		DeviceURI:       d.DeviceURI,
+		SessionTimeout:  d.SessionTimeout,
+		LastMessageAt:   d.LastMessageAt,
+		ProtocolVersion: d.ProtocolVersion,
+		Features:        make([]string, 0),
+		FirmwareVersion: d.FirmwareVersion,
+		HardwareModel:   d.HardwareModel,
+		CreatedAt:       d.CreatedAt,
+		UpdatedAt:       d.UpdatedAt,
+	}
+
+	if d.Features != "" {
+		m.Features = strings.Split(d.Features, ",")
 	}
 
 	return m, nil
@@ -157,6 +177,9 @@ func createSession(db *sqlx.DB, m *model.Session) error {
 	if m.SessionTimeout == 0 {
 		m.SessionTimeout = 120
 	}
+	if m.ProtocolVersion == 0 {
+		m.ProtocolVersion = 1
+	}
 
 	d := sqlDataSession{}
 	if err := d.Scan(m); err != nil {
@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/pkg/errors"
+)
+
+func newTelemetryStore(db *sqlx.DB) *telemetryStore {
+	return &telemetryStore{
+		db: db,
+	}
+}
+
+type telemetryStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataMetricSample struct {
+	EventID   int32     `db:"event_id"`
+	Namespace string    `db:"namespace"`
+	DeviceID  string    `db:"device_id"`
+	Metric    string    `db:"metric"`
+	Timestamp time.Time `db:"timestamp"`
+	Value     float64   `db:"value"`
+}
+
+// sqlDataMetricRollup stores the resolution in seconds
+type sqlDataMetricRollup struct {
+	Namespace  string    `db:"namespace"`
+	DeviceID   string    `db:"device_id"`
+	Metric     string    `db:"metric"`
+	Resolution int       `db:"resolution"`
+	Bucket     time.Time `db:"bucket"`
+	Count      int       `db:"count"`
+	Sum        float64   `db:"sum"`
+	Min        float64   `db:"min"`
+	Max        float64   `db:"max"`
+}
+
+func (d *sqlDataMetricSample) Scan(m *model.MetricSample) error {
+	d.EventID = m.EventID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.Metric = m.Metric
+	d.Timestamp = m.Timestamp.UTC()
+	d.Value = m.Value
+
+	return nil
+}
+
+func (d *sqlDataMetricSample) Model() (*model.MetricSample, error) {
+	m := &model.MetricSample{
+		EventID:   d.EventID,
+		Namespace: d.Namespace,
+		DeviceID:  d.DeviceID,
+		Metric:    d.Metric,
+		Timestamp: d.Timestamp,
+		Value:     d.Value,
+	}
+
+	return m, nil
+}
+
+func (d *sqlDataMetricRollup) Model() (*model.MetricRollup, error) {
+	m := &model.MetricRollup{
+		Namespace:  d.Namespace,
+		DeviceID:   d.DeviceID,
+		Metric:     d.Metric,
+		Resolution: time.Duration(d.Resolution) * time.Second,
+		Bucket:     d.Bucket,
+		Count:      d.Count,
+		Sum:        d.Sum,
+		Min:        d.Min,
+		Max:        d.Max,
+	}
+
+	return m, nil
+}
+
+func (s *telemetryStore) AddSamples(samples []model.MetricSample) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO metric_samples (event_id, namespace, device_id, metric, timestamp, value) " +
+		"VALUES (:event_id, :namespace, :device_id, :metric, :timestamp, :value) " +
+		"ON CONFLICT (event_id, metric) DO NOTHING"
+	for _, m := range samples {
+		d := sqlDataMetricSample{}
+		if err := d.Scan(&m); err != nil {
+			return errors.Wrap(err, "failed to convert metric sample model to SQL data")
+		}
+		if _, err := tx.NamedExec(query, d); err != nil {
+			return errors.Wrap(err, "failed to create metric sample")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit metric samples")
+	}
+
+	return nil
+}
+
+func (s *telemetryStore) FindSamples(namespace, deviceID, metric string, from, to time.Time) ([]model.MetricSample, error) {
+	rows := make([]sqlDataMetricSample, 0)
+	models := make([]model.MetricSample, 0)
+
+	query := "SELECT * FROM metric_samples WHERE namespace=$1 AND device_id=$2 AND metric=$3 AND timestamp>=$4 AND timestamp<$5 ORDER BY timestamp"
+	if err := s.db.Select(&rows, query, namespace, deviceID, metric, from.UTC(), to.UTC()); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch metric samples")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to metric sample model")
+		}
+
+		models = append(models, *m)
+	}
+
+	return models, nil
+}
+
+func (s *telemetryStore) DeleteSamplesBefore(t time.Time) error {
+	query := "DELETE FROM metric_samples WHERE timestamp<$1"
+	if _, err := s.db.Exec(query, t.UTC()); err != nil {
+		return errors.Wrap(err, "failed to delete metric samples")
+	}
+
+	return nil
+}
+
+// Rollup aggregates the samples in the database. The timestamps are stored
+// in UTC, the buckets are aligned to the Unix epoch.
+func (s *telemetryStore) Rollup(resolution time.Duration, from, to time.Time) error {
+	query := "INSERT INTO metric_rollups (namespace, device_id, metric, resolution, bucket, count, sum, min, max) " +
+		"SELECT namespace, device_id, metric, $1, " +
+		"to_timestamp(floor(extract(epoch FROM timestamp) / $1) * $1) AT TIME ZONE 'UTC' AS bucket, " +
+		"count(*), sum(value), min(value), max(value) " +
+		"FROM metric_samples WHERE timestamp>=$2 AND timestamp<$3 " +
+		"GROUP BY namespace, device_id, metric, bucket " +
+		"ON CONFLICT (namespace, device_id, metric, resolution, bucket) DO UPDATE SET " +
+		"count=EXCLUDED.count, sum=EXCLUDED.sum, min=EXCLUDED.min, max=EXCLUDED.max"
+	if _, err := s.db.Exec(query, int(resolution/time.Second), from.UTC(), to.UTC()); err != nil {
+		return errors.Wrap(err, "failed to roll up metric samples")
+	}
+
+	return nil
+}
+
+func (s *telemetryStore) FindRollups(namespace, deviceID, metric string, resolution time.Duration, from, to time.Time) ([]model.MetricRollup, error) {
+	rows := make([]sqlDataMetricRollup, 0)
+	models := make([]model.MetricRollup, 0)
+
+	query := "SELECT * FROM metric_rollups WHERE namespace=$1 AND device_id=$2 AND metric=$3 AND resolution=$4 AND bucket>=$5 AND bucket<$6 ORDER BY bucket"
+	if err := s.db.Select(&rows, query, namespace, deviceID, metric, int(resolution/time.Second), from.UTC(), to.UTC()); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch metric rollups")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to metric rollup model")
+		}
+
+		models = append(models, *m)
+	}
+
+	return models, nil
+}
+
+func (s *telemetryStore) DeleteRollupsBefore(resolution time.Duration, t time.Time) error {
+	query := "DELETE FROM metric_rollups WHERE resolution=$1 AND bucket<$2"
+	if _, err := s.db.Exec(query, int(resolution/time.Second), t.UTC()); err != nil {
+		return errors.Wrap(err, "failed to delete metric rollups")
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newTranscriptStore(db *sqlx.DB) *transcriptStore {
+	return &transcriptStore{
+		db: db,
+	}
+}
+
+type transcriptStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataTranscript struct {
+	ID          int32      `db:"id"`
+	Namespace   string     `db:"namespace"`
+	DeviceID    string     `db:"device_id"`
+	Kind        string     `db:"kind"`
+	Username    string     `db:"username"`
+	StartedAt   time.Time  `db:"started_at"`
+	EndedAt     *time.Time `db:"ended_at"`
+	CloseReason string     `db:"close_reason"`
+	Content     string     `db:"content"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at"`
+}
+
+var sqlParamsTranscript = []string{
+	"id",
+	"namespace",
+	"device_id",
+	"kind",
+	"username",
+	"started_at",
+	"ended_at",
+	"close_reason",
+	"content",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataTranscript) Scan(m *model.Transcript) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.Kind = m.Kind
+	d.Username = m.Username
+	d.StartedAt = m.StartedAt
+	d.EndedAt = nil
+	if !m.EndedAt.IsZero() {
+		endedAt := m.EndedAt
+		d.EndedAt = &endedAt
+	}
+	d.CloseReason = m.CloseReason
+	d.Content = m.Content
+	if d.Content == "" {
+		d.Content = "[]"
+	}
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataTranscript) Model() (*model.Transcript, error) {
+	m := &model.Transcript{
+		ID:          d.ID,
+		Namespace:   d.Namespace,
+		DeviceID:    d.DeviceID,
+		Kind:        d.Kind,
+		Username:    d.Username,
+		StartedAt:   d.StartedAt,
+		CloseReason: d.CloseReason,
+		Content:     d.Content,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+
+	if d.EndedAt != nil {
+		m.EndedAt = *d.EndedAt
+	}
+
+	return m, nil
+}
+
+func (s *transcriptStore) FetchAll() (map[int32]model.Transcript, error) {
+	return fetchAllTranscripts(s.db)
+}
+
+func (s *transcriptStore) FindByID(id int32) (*model.Transcript, error) {
+	return findTranscriptByID(s.db, id)
+}
+
+func (s *transcriptStore) Create(m *model.Transcript) error {
+	return createTranscript(s.db, m)
+}
+
+func (s *transcriptStore) Update(m *model.Transcript) error {
+	return updateTranscript(s.db, m)
+}
+
+func fetchAllTranscripts(db *sqlx.DB) (map[int32]model.Transcript, error) {
+	rows := make([]sqlDataTranscript, 0)
+	models := make(map[int32]model.Transcript)
+
+	query := "SELECT * FROM transcripts"
+	if err := db.Select(&rows, query); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch all transcripts")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to transcript model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findTranscriptByID(db *sqlx.DB, id int32) (*model.Transcript, error) {
+	d := sqlDataTranscript{}
+	query := "SELECT * FROM transcripts WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find transcript")
+	}
+
+	return d.Model()
+}
+
+func createTranscript(db *sqlx.DB, m *model.Transcript) error {
+	d := sqlDataTranscript{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert transcript model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsTranscript {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO transcripts (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created transcript")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateTranscript(db *sqlx.DB, m *model.Transcript) error {
+	if _, err := findTranscriptByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataTranscript{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert transcript model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsTranscript {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE transcripts SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update transcript")
+	}
+
+	return nil
+}
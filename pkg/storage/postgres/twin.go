@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newTwinStore(db *sqlx.DB) *twinStore {
+	return &twinStore{
+		db: db,
+	}
+}
+
+type twinStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataTwin struct {
+	ID        int32     `db:"id"`
+	Namespace string    `db:"namespace"`
+	DeviceID  string    `db:"device_id"`
+	Desired   string    `db:"desired"`
+	Reported  string    `db:"reported"`
+	Version   int       `db:"version"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+var sqlParamsTwin = []string{
+	"id",
+	"namespace",
+	"device_id",
+	"desired",
+	"reported",
+	"version",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataTwin) Scan(m *model.Twin) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.DeviceID = m.DeviceID
+	d.Desired = m.Desired
+	d.Reported = m.Reported
+	d.Version = m.Version
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataTwin) Model() (*model.Twin, error) {
+	m := &model.Twin{
+		ID:        d.ID,
+		Namespace: d.Namespace,
+		DeviceID:  d.DeviceID,
+		Desired:   d.Desired,
+		Reported:  d.Reported,
+		Version:   d.Version,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *twinStore) FetchAll() (map[int32]model.Twin, error) {
+	return fetchAllTwins(s.db)
+}
+
+func (s *twinStore) FindByID(id int32) (*model.Twin, error) {
+	return findTwinByID(s.db, id)
+}
+
+func (s *twinStore) FindByNamespaceAndDeviceID(namespace, deviceID string) (*model.Twin, error) {
+	return findTwinByNamespaceAndDeviceID(s.db, namespace, deviceID)
+}
+
+func (s *twinStore) Create(m *model.Twin) error {
+	return createTwin(s.db, m)
+}
+
+func (s *twinStore) Update(m *model.Twin) error {
+	return updateTwin(s.db, m)
+}
+
+func fetchAllTwins(db *sqlx.DB) (map[int32]model.Twin, error) {
+	return selectTwins(db, "SELECT * FROM twins")
+}
+
+func selectTwins(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.Twin, error) {
+	rows := make([]sqlDataTwin, 0)
+	models := make(map[int32]model.Twin)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch twins")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to twin model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findTwinByID(db *sqlx.DB, id int32) (*model.Twin, error) {
+	d := sqlDataTwin{}
+	query := "SELECT * FROM twins WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find twin")
+	}
+
+	return d.Model()
+}
+
+func findTwinByNamespaceAndDeviceID(db *sqlx.DB, namespace, deviceID string) (*model.Twin, error) {
+	d := sqlDataTwin{}
+	query := "SELECT * FROM twins WHERE namespace=$1 AND device_id=$2"
+	if err := db.Get(&d, query, namespace, deviceID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find twin")
+	}
+
+	return d.Model()
+}
+
+func createTwin(db *sqlx.DB, m *model.Twin) error {
+	d := sqlDataTwin{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert twin model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsTwin {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO twins (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created twin")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+// updateTwin stores the twin if the stored version equals the version of
+// the model. The version of the model is incremented.
+func updateTwin(db *sqlx.DB, m *model.Twin) error {
+	if _, err := findTwinByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	updatedAt := time.Now().Round(time.Second).UTC()
+
+	d := struct {
+		sqlDataTwin
+		ExpectedVersion int `db:"expected_version"`
+	}{ExpectedVersion: m.Version}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert twin model to SQL data")
+	}
+	d.Version = m.Version + 1
+	d.UpdatedAt = updatedAt
+
+	var queryParams []string
+	for _, param := range sqlParamsTwin {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE twins SET %s WHERE id=:id AND version=:expected_version", strings.Join(queryParams, ", "))
+	res, err := db.NamedExec(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to update twin")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "failed to update twin")
+	} else if n == 0 {
+		return storage.ErrConflict
+	}
+
+	m.Version = d.Version
+	m.UpdatedAt = updatedAt
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// joinInts converts a list of integers to a comma separated text column
+func joinInts(values []int) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strconv.Itoa(v))
+	}
+	return strings.Join(out, ",")
+}
+
+// splitInts converts a comma separated text column to a list of integers
+func splitInts(s string) ([]int, error) {
+	out := make([]int, 0)
+	if s == "" {
+		return out, nil
+	}
+	for _, elem := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(elem))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// joinStrings converts a list of strings to a comma separated text column
+func joinStrings(values []string) string {
+	return strings.Join(values, ",")
+}
+
+// splitStrings converts a comma separated text column to a list of strings
+func splitStrings(s string) []string {
+	out := make([]string, 0)
+	if s == "" {
+		return out
+	}
+	for _, elem := range strings.Split(s, ",") {
+		out = append(out, strings.TrimSpace(elem))
+	}
+	return out
+}
+
+// marshalLabels converts the labels to a JSON text column
+func marshalLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		// A string map is always encodable
+		panic(err)
+	}
+	return string(data)
+}
+
+// unmarshalLabels converts a JSON text column to labels
+func unmarshalLabels(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	if s == "" {
+		return out, nil
+	}
+	if err := json.Unmarshal([]byte(s), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// nullTime converts a zero time to NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// timeFromNull converts NULL to a zero time
+func timeFromNull(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// marshalJSON converts a value to a JSON text column
+func marshalJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
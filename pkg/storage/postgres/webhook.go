@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newWebhookStore(db *sqlx.DB) *webhookStore {
+	return &webhookStore{
+		db: db,
+	}
+}
+
+type webhookStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataWebhook struct {
+	ID          int32     `db:"id"`
+	Namespace   string    `db:"namespace"`
+	URL         string    `db:"url"`
+	Secret      string    `db:"secret"`
+	Topics      string    `db:"topics"`
+	Description string    `db:"description"`
+	Enabled     bool      `db:"enabled"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+var sqlParamsWebhook = []string{
+	"id",
+	"namespace",
+	"url",
+	"secret",
+	"topics",
+	"description",
+	"enabled",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataWebhook) Scan(m *model.Webhook) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.Namespace = m.Namespace
+	d.URL = m.URL
+	d.Secret = m.Secret
+	d.Topics = joinStrings(m.Topics)
+	d.Description = m.Description
+	d.Enabled = m.Enabled
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataWebhook) Model() (*model.Webhook, error) {
+	m := &model.Webhook{
+		ID:          d.ID,
+		Namespace:   d.Namespace,
+		URL:         d.URL,
+		Secret:      d.Secret,
+		Topics:      splitStrings(d.Topics),
+		Description: d.Description,
+		Enabled:     d.Enabled,
+		CreatedAt:   d.CreatedAt,
+		UpdatedAt:   d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *webhookStore) FetchAll() (map[int32]model.Webhook, error) {
+	return fetchAllWebhooks(s.db)
+}
+
+func (s *webhookStore) FindByID(id int32) (*model.Webhook, error) {
+	return findWebhookByID(s.db, id)
+}
+
+func (s *webhookStore) Create(m *model.Webhook) error {
+	return createWebhook(s.db, m)
+}
+
+func (s *webhookStore) Update(m *model.Webhook) error {
+	return updateWebhook(s.db, m)
+}
+
+func (s *webhookStore) Delete(id int32) error {
+	return deleteWebhook(s.db, id)
+}
+
+func fetchAllWebhooks(db *sqlx.DB) (map[int32]model.Webhook, error) {
+	return selectWebhooks(db, "SELECT * FROM webhooks")
+}
+
+func selectWebhooks(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.Webhook, error) {
+	rows := make([]sqlDataWebhook, 0)
+	models := make(map[int32]model.Webhook)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch webhooks")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to webhook model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findWebhookByID(db *sqlx.DB, id int32) (*model.Webhook, error) {
+	d := sqlDataWebhook{}
+	query := "SELECT * FROM webhooks WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find webhook")
+	}
+
+	return d.Model()
+}
+
+func createWebhook(db *sqlx.DB, m *model.Webhook) error {
+	d := sqlDataWebhook{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert webhook model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsWebhook {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO webhooks (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created webhook")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateWebhook(db *sqlx.DB, m *model.Webhook) error {
+	if _, err := findWebhookByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataWebhook{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert webhook model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsWebhook {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE webhooks SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update webhook")
+	}
+
+	return nil
+}
+
+func deleteWebhook(db *sqlx.DB, id int32) error {
+	query := "DELETE FROM webhooks WHERE id=$1"
+	_, err := db.Exec(query, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete webhook")
+	}
+
+	return nil
+}
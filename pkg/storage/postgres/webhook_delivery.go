@@ -0,0 +1,243 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+func newWebhookDeliveryStore(db *sqlx.DB) *webhookDeliveryStore {
+	return &webhookDeliveryStore{
+		db: db,
+	}
+}
+
+type webhookDeliveryStore struct {
+	db *sqlx.DB
+}
+
+type sqlDataWebhookDelivery struct {
+	ID             int32      `db:"id"`
+	WebhookID      int32      `db:"webhook_id"`
+	Namespace      string     `db:"namespace"`
+	Topic          string     `db:"topic"`
+	Payload        string     `db:"payload"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	NextAttemptAt  *time.Time `db:"next_attempt_at"`
+	LastAttemptAt  *time.Time `db:"last_attempt_at"`
+	LastStatusCode int        `db:"last_status_code"`
+	LastError      string     `db:"last_error"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+}
+
+var sqlParamsWebhookDelivery = []string{
+	"id",
+	"webhook_id",
+	"namespace",
+	"topic",
+	"payload",
+	"status",
+	"attempts",
+	"next_attempt_at",
+	"last_attempt_at",
+	"last_status_code",
+	"last_error",
+	"created_at",
+	"updated_at",
+}
+
+func (d *sqlDataWebhookDelivery) Scan(m *model.WebhookDelivery) error {
+	var createdAt, updatedAt = m.CreatedAt, m.UpdatedAt
+
+	if m.CreatedAt.IsZero() {
+		createdAt = time.Now().Round(time.Second).UTC()
+	}
+
+	if m.UpdatedAt.IsZero() {
+		updatedAt = time.Now().Round(time.Second).UTC()
+	}
+
+	d.ID = m.ID
+	d.WebhookID = m.WebhookID
+	d.Namespace = m.Namespace
+	d.Topic = m.Topic
+	d.Payload = m.Payload
+	d.Status = m.Status
+	d.Attempts = m.Attempts
+	d.NextAttemptAt = nullTime(m.NextAttemptAt)
+	d.LastAttemptAt = nullTime(m.LastAttemptAt)
+	d.LastStatusCode = m.LastStatusCode
+	d.LastError = m.LastError
+	d.CreatedAt = createdAt
+	d.UpdatedAt = updatedAt
+
+	return nil
+}
+
+func (d *sqlDataWebhookDelivery) Model() (*model.WebhookDelivery, error) {
+	m := &model.WebhookDelivery{
+		ID:             d.ID,
+		WebhookID:      d.WebhookID,
+		Namespace:      d.Namespace,
+		Topic:          d.Topic,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  timeFromNull(d.NextAttemptAt),
+		LastAttemptAt:  timeFromNull(d.LastAttemptAt),
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+
+	return m, nil
+}
+
+func (s *webhookDeliveryStore) FetchAll() (map[int32]model.WebhookDelivery, error) {
+	return fetchAllWebhookDeliveries(s.db)
+}
+
+func (s *webhookDeliveryStore) FindByID(id int32) (*model.WebhookDelivery, error) {
+	return findWebhookDeliveryByID(s.db, id)
+}
+
+func (s *webhookDeliveryStore) FindByWebhookID(webhookID int32) (map[int32]model.WebhookDelivery, error) {
+	return selectWebhookDeliveries(s.db, "SELECT * FROM webhook_deliveries WHERE webhook_id=$1", webhookID)
+}
+
+func (s *webhookDeliveryStore) FindByStatus(status string) (map[int32]model.WebhookDelivery, error) {
+	return selectWebhookDeliveries(s.db, "SELECT * FROM webhook_deliveries WHERE status=$1", status)
+}
+
+func (s *webhookDeliveryStore) ClaimDue(now time.Time, lease time.Duration, limit int) (map[int32]model.WebhookDelivery, error) {
+	// The claimed rows are locked until the update is done, concurrent
+	// dispatchers skip them
+	query := `UPDATE webhook_deliveries SET next_attempt_at=$3, updated_at=$4
+		WHERE id IN (SELECT id FROM webhook_deliveries WHERE status=$1 AND next_attempt_at<=$2 ORDER BY next_attempt_at LIMIT $5 FOR UPDATE SKIP LOCKED)
+		RETURNING *`
+	return selectWebhookDeliveries(s.db, query, model.WebhookDeliveryStatusPending, now, now.Add(lease), time.Now().Round(time.Second).UTC(), limit)
+}
+
+func (s *webhookDeliveryStore) Create(m *model.WebhookDelivery) error {
+	return createWebhookDelivery(s.db, m)
+}
+
+func (s *webhookDeliveryStore) Update(m *model.WebhookDelivery) error {
+	return updateWebhookDelivery(s.db, m)
+}
+
+func (s *webhookDeliveryStore) DeleteByWebhookID(webhookID int32) error {
+	return deleteWebhookDeliveriesByWebhookID(s.db, webhookID)
+}
+
+func fetchAllWebhookDeliveries(db *sqlx.DB) (map[int32]model.WebhookDelivery, error) {
+	return selectWebhookDeliveries(db, "SELECT * FROM webhook_deliveries")
+}
+
+func selectWebhookDeliveries(db *sqlx.DB, query string, args ...interface{}) (map[int32]model.WebhookDelivery, error) {
+	rows := make([]sqlDataWebhookDelivery, 0)
+	models := make(map[int32]model.WebhookDelivery)
+
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch webhook deliveries")
+	}
+
+	for _, d := range rows {
+		m, err := d.Model()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to convert SQL data to webhook delivery model")
+		}
+
+		models[d.ID] = *m
+	}
+
+	return models, nil
+}
+
+func findWebhookDeliveryByID(db *sqlx.DB, id int32) (*model.WebhookDelivery, error) {
+	d := sqlDataWebhookDelivery{}
+	query := "SELECT * FROM webhook_deliveries WHERE id=$1"
+	if err := db.Get(&d, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, storage.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "failed to find webhook delivery")
+	}
+
+	return d.Model()
+}
+
+func createWebhookDelivery(db *sqlx.DB, m *model.WebhookDelivery) error {
+	d := sqlDataWebhookDelivery{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert webhook delivery model to SQL data")
+	}
+
+	// Remove the id column because it's of SQL type serial
+	sqlParamsWithoutID := make([]string, 0)
+	for _, s := range sqlParamsWebhookDelivery {
+		if s != "id" {
+			sqlParamsWithoutID = append(sqlParamsWithoutID, s)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO webhook_deliveries (%s) VALUES (%s) RETURNING id",
+		strings.Join(sqlParamsWithoutID, ", "),
+		":"+strings.Join(sqlParamsWithoutID, ", :"),
+	)
+	rows, err := db.NamedQuery(query, d)
+	if err != nil {
+		return errors.Wrap(err, "failed to created webhook delivery")
+	}
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&m.ID)
+	}
+
+	return nil
+}
+
+func updateWebhookDelivery(db *sqlx.DB, m *model.WebhookDelivery) error {
+	if _, err := findWebhookDeliveryByID(db, m.ID); err != nil {
+		return err
+	}
+
+	// Set the UpdateAt date to now
+	m.UpdatedAt = time.Now().Round(time.Second).UTC()
+
+	d := sqlDataWebhookDelivery{}
+	if err := d.Scan(m); err != nil {
+		return errors.Wrap(err, "failed to convert webhook delivery model to SQL data")
+	}
+
+	var queryParams []string
+	for _, param := range sqlParamsWebhookDelivery {
+		queryParams = append(queryParams, fmt.Sprintf("%s=:%s", param, param))
+	}
+	query := fmt.Sprintf("UPDATE webhook_deliveries SET %s WHERE id=:id", strings.Join(queryParams, ", "))
+	if _, err := db.NamedExec(query, d); err != nil {
+		return errors.Wrap(err, "failed to update webhook delivery")
+	}
+
+	return nil
+}
+
+func deleteWebhookDeliveriesByWebhookID(db *sqlx.DB, webhookID int32) error {
+	query := "DELETE FROM webhook_deliveries WHERE webhook_id=$1"
+	_, err := db.Exec(query, webhookID)
+	if err != nil {
+		return errors.Wrap(err, "failed to delete webhook deliveries")
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package targeting resolves the devices addressed by device IDs, label
+// selectors and device groups.
+package targeting
+
+import (
+	"sort"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/selector"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// ErrEmptyTarget is returned if the target addresses no devices at all
+var ErrEmptyTarget = errors.New("target contains neither device IDs, selector nor group")
+
+// Target addresses devices of a namespace. A device is addressed if it's
+// listed in DeviceIDs, or if it matches the selector and is member of the
+// group. The selector and the group are ignored if they are empty.
+type Target struct {
+	DeviceIDs []string `json:"deviceIds,omitempty"`
+	Selector  string   `json:"selector,omitempty"`
+	Group     string   `json:"group,omitempty"`
+}
+
+// Empty returns true if the target addresses no devices
+func (t Target) Empty() bool {
+	return len(t.DeviceIDs) == 0 && t.Selector == "" && t.Group == ""
+}
+
+// Resolve returns the devices addressed by the target sorted by device ID.
+// Unknown device IDs and groups return storage.ErrNotFound.
+func Resolve(store storage.Interface, namespace string, t Target) ([]model.Device, error) {
+	if t.Empty() {
+		return nil, ErrEmptyTarget
+	}
+
+	sel, err := selector.Parse(t.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var group *model.DeviceGroup
+	if t.Group != "" {
+		group, err = store.DeviceGroups().FindByNamespaceAndName(namespace, t.Group)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	devices, err := store.Devices().FetchAll()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.Device, 0)
+	found := make(map[string]bool)
+	listed := make(map[string]bool)
+	for _, id := range t.DeviceIDs {
+		listed[id] = true
+	}
+
+	for _, d := range devices {
+		if d.Namespace != namespace {
+			continue
+		}
+
+		if listed[d.DeviceID] {
+			found[d.DeviceID] = true
+		} else if t.Selector == "" && t.Group == "" {
+			continue
+		} else if !sel.Matches(d.Labels) {
+			continue
+		} else if group != nil && !IsMember(group, &d) {
+			continue
+		}
+
+		out = append(out, d)
+	}
+
+	for id := range listed {
+		if !found[id] {
+			return nil, storage.ErrNotFound
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].DeviceID < out[j].DeviceID
+	})
+
+	return out, nil
+}
+
+// IsMember returns true if the device is a static member of the group, its
+// labels match the selector of the group or its inventory group equals the
+// name of the group.
+func IsMember(g *model.DeviceGroup, d *model.Device) bool {
+	if g.Namespace != d.Namespace {
+		return false
+	}
+	if d.Group == g.Name {
+		return true
+	}
+	for _, id := range g.Members {
+		if id == d.DeviceID {
+			return true
+		}
+	}
+	if g.Selector == "" {
+		return false
+	}
+
+	sel, err := selector.Parse(g.Selector)
+	if err != nil {
+		// The selector is validated when the group is stored
+		return false
+	}
+	return sel.Matches(d.Labels)
+}
+
+// Members returns the devices of the group sorted by device ID
+func Members(store storage.Interface, g *model.DeviceGroup) ([]model.Device, error) {
+	return Resolve(store, g.Namespace, Target{Group: g.Name})
+}
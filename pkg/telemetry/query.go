@@ -0,0 +1,192 @@
+package telemetry
+
+import (
+	"math"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/pkg/errors"
+)
+
+// maxPoints limits the points returned by a query
+const maxPoints = 10000
+
+// Aggregations of a query
+const (
+	AggregationAvg   = "avg"
+	AggregationMin   = "min"
+	AggregationMax   = "max"
+	AggregationSum   = "sum"
+	AggregationCount = "count"
+)
+
+// Query selects the samples of a metric of a device within [From, To). The
+// samples are aggregated to buckets of the step, the buckets are aligned to
+// the Unix epoch. The range is extended to whole buckets.
+type Query struct {
+	Namespace   string
+	DeviceID    string
+	Metric      string
+	From        time.Time
+	To          time.Time
+	Step        time.Duration
+	Aggregation string
+}
+
+// Point is the aggregated value of the bucket starting at Timestamp
+type Point struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Series is the result of a query. Resolution is the resolution of the
+// rollups the points are aggregated from, zero for the samples. Buckets
+// without samples are omitted.
+type Series struct {
+	Query      Query
+	Resolution time.Duration
+	Points     []Point
+}
+
+// Validate checks the time range, the step and the aggregation of the query
+func (q *Query) Validate() error {
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+	if q.Step < time.Second {
+		return errors.New("step must be at least one second")
+	}
+	if q.To.Sub(q.From)/q.Step > maxPoints {
+		return errors.Errorf("query exceeds %d points, increase the step", maxPoints)
+	}
+	switch q.Aggregation {
+	case AggregationAvg, AggregationMin, AggregationMax, AggregationSum, AggregationCount:
+	default:
+		return errors.Errorf("unknown aggregation '%s'", q.Aggregation)
+	}
+	return nil
+}
+
+// Query returns the aggregated samples of the query
+func (s *Service) Query(q Query) (*Series, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Align the range to the buckets of the step
+	from := align(q.From, q.Step)
+	to := align(q.To.Add(q.Step-1), q.Step)
+
+	res := s.source(q.Step, from)
+
+	var rollups []model.MetricRollup
+	if res == 0 {
+		samples, err := s.store.Telemetry().FindSamples(q.Namespace, q.DeviceID, q.Metric, from, to)
+		if err != nil {
+			return nil, err
+		}
+		rollups = make([]model.MetricRollup, 0, len(samples))
+		for _, m := range samples {
+			rollups = append(rollups, model.MetricRollup{
+				Bucket: m.Timestamp,
+				Count:  1,
+				Sum:    m.Value,
+				Min:    m.Value,
+				Max:    m.Value,
+			})
+		}
+	} else {
+		var err error
+		rollups, err = s.store.Telemetry().FindRollups(q.Namespace, q.DeviceID, q.Metric, res, from, to)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Series{
+		Query:      q,
+		Resolution: res,
+		Points:     aggregate(rollups, q.Step, q.Aggregation),
+	}, nil
+}
+
+// source returns the coarsest resolution which divides the step and whose
+// rollups are kept since from. The rollups of a dividing resolution give the
+// same result as the samples. Zero selects the samples.
+func (s *Service) source(step time.Duration, from time.Time) time.Duration {
+	now := time.Now().UTC()
+	kept := func(retention time.Duration) bool {
+		return retention <= 0 || !from.Before(now.Add(-retention))
+	}
+
+	best, fallback := time.Duration(-1), time.Duration(0)
+	if kept(s.retention.Raw) {
+		best = 0
+	}
+	for _, res := range Resolutions {
+		if step%res != 0 {
+			continue
+		}
+		fallback = res
+		if kept(s.retention.Rollups[res]) {
+			best = res
+		}
+	}
+
+	// Nothing is kept for the whole range, the longest kept data is used
+	if best < 0 {
+		return fallback
+	}
+	return best
+}
+
+// aggregate combines the rollups ordered by time to points of the step
+func aggregate(rollups []model.MetricRollup, step time.Duration, aggregation string) []Point {
+	points := make([]Point, 0)
+
+	var acc model.MetricRollup
+	flush := func() {
+		if acc.Count == 0 {
+			return
+		}
+		p := Point{Timestamp: acc.Bucket}
+		switch aggregation {
+		case AggregationAvg:
+			p.Value = acc.Sum / float64(acc.Count)
+		case AggregationMin:
+			p.Value = acc.Min
+		case AggregationMax:
+			p.Value = acc.Max
+		case AggregationSum:
+			p.Value = acc.Sum
+		case AggregationCount:
+			p.Value = float64(acc.Count)
+		}
+		points = append(points, p)
+	}
+
+	for _, r := range rollups {
+		bucket := align(r.Bucket, step)
+		if acc.Count == 0 || !bucket.Equal(acc.Bucket) {
+			flush()
+			acc = model.MetricRollup{
+				Bucket: bucket,
+				Min:    math.Inf(1),
+				Max:    math.Inf(-1),
+			}
+		}
+		acc.Count += r.Count
+		acc.Sum += r.Sum
+		acc.Min = math.Min(acc.Min, r.Min)
+		acc.Max = math.Max(acc.Max, r.Max)
+	}
+	flush()
+
+	return points
+}
+
+// align returns the start of the bucket of the step containing the time
+func align(t time.Time, step time.Duration) time.Time {
+	epoch := time.Unix(0, 0).UTC()
+	return epoch.Add(t.Sub(epoch).Truncate(step))
+}
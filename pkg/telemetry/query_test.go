@@ -0,0 +1,131 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+var testBase = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestAlign(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		step time.Duration
+		want time.Time
+	}{
+		{testBase, time.Hour, testBase},
+		{testBase.Add(59 * time.Minute), time.Hour, testBase},
+		{testBase.Add(61 * time.Minute), time.Hour, testBase.Add(time.Hour)},
+		{testBase.Add(7 * time.Minute), 5 * time.Minute, testBase.Add(5 * time.Minute)},
+		{testBase.Add(90 * time.Second), time.Second, testBase.Add(90 * time.Second)},
+		// Buckets are aligned to the epoch, not to the day
+		{testBase.Add(time.Hour), 7 * time.Hour, time.Date(2019, 12, 31, 20, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		if got := align(tc.t, tc.step); !got.Equal(tc.want) {
+			t.Errorf("align(%s, %s) = %s, want %s", tc.t, tc.step, got, tc.want)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	rollups := []model.MetricRollup{
+		{Bucket: testBase, Count: 2, Sum: 9, Min: 4, Max: 5},
+		{Bucket: testBase.Add(5 * time.Minute), Count: 1, Sum: 3, Min: 3, Max: 3},
+		{Bucket: testBase.Add(20 * time.Minute), Count: 1, Sum: -8, Min: -8, Max: -8},
+	}
+
+	tests := []struct {
+		aggregation string
+		want        []float64
+	}{
+		{AggregationAvg, []float64{4, -8}},
+		{AggregationMin, []float64{3, -8}},
+		{AggregationMax, []float64{5, -8}},
+		{AggregationSum, []float64{12, -8}},
+		{AggregationCount, []float64{3, 1}},
+	}
+
+	for _, tc := range tests {
+		points := aggregate(rollups, 10*time.Minute, tc.aggregation)
+		if len(points) != len(tc.want) {
+			t.Errorf("%s: %d points, want %d", tc.aggregation, len(points), len(tc.want))
+			continue
+		}
+		// The bucket between the rollups has no samples and is omitted
+		for i, p := range points {
+			if want := testBase.Add(time.Duration(i) * 20 * time.Minute); !p.Timestamp.Equal(want) {
+				t.Errorf("%s: point %d at %s, want %s", tc.aggregation, i, p.Timestamp, want)
+			}
+			if p.Value != tc.want[i] {
+				t.Errorf("%s: point %d = %v, want %v", tc.aggregation, i, p.Value, tc.want[i])
+			}
+		}
+	}
+
+	if points := aggregate(nil, time.Minute, AggregationAvg); len(points) != 0 {
+		t.Errorf("aggregate without rollups = %v, want no points", points)
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    time.Time
+		to      time.Time
+		step    time.Duration
+		agg     string
+		wantErr bool
+	}{
+		{"valid", testBase, testBase.Add(time.Hour), time.Minute, AggregationAvg, false},
+		{"max points", testBase, testBase.Add(maxPoints * time.Second), time.Second, AggregationSum, false},
+		{"empty range", testBase, testBase, time.Minute, AggregationAvg, true},
+		{"reversed range", testBase.Add(time.Hour), testBase, time.Minute, AggregationAvg, true},
+		{"short step", testBase, testBase.Add(time.Hour), time.Millisecond, AggregationAvg, true},
+		{"too many points", testBase, testBase.Add((maxPoints + 1) * time.Second), time.Second, AggregationAvg, true},
+		{"unknown aggregation", testBase, testBase.Add(time.Hour), time.Minute, "median", true},
+	}
+
+	for _, tc := range tests {
+		q := Query{From: tc.from, To: tc.to, Step: tc.step, Aggregation: tc.agg}
+		if err := q.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	s := NewService(nil, nil, Retention{
+		Raw: 24 * time.Hour,
+		Rollups: map[time.Duration]time.Duration{
+			5 * time.Minute: 7 * 24 * time.Hour,
+			time.Hour:       0,
+		},
+	})
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name string
+		step time.Duration
+		from time.Time
+		want time.Duration
+	}{
+		{"samples for steps below the rollups", time.Minute, recent, 0},
+		{"coarsest dividing rollup", 10 * time.Minute, recent, 5 * time.Minute},
+		{"hourly rollups", 2 * time.Hour, recent, time.Hour},
+		{"step not divided by the hour", 90 * time.Minute, recent, 5 * time.Minute},
+		{"rollups kept forever", 2 * time.Hour, old, time.Hour},
+		{"longest kept rollups", 10 * time.Minute, old, 5 * time.Minute},
+		{"longest kept samples", time.Minute, old, 0},
+	}
+
+	for _, tc := range tests {
+		if got := s.source(tc.step, tc.from); got != tc.want {
+			t.Errorf("%s: source = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
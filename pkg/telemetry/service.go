@@ -0,0 +1,258 @@
+// Package telemetry extracts the metrics of the devices from their events.
+// The metric mappings select numeric values from the event details, the
+// values are stored as samples and rolled up to buckets of five minutes and
+// one hour. Queries aggregate the samples or the rollups to the requested
+// step.
+package telemetry
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/controlchannel/message"
+	"github.com/nsyszr/lcm/pkg/jsonpath"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// rollupInterval is the interval the rollups and the retention are updated
+const rollupInterval = time.Minute
+
+// Resolutions of the rollups in ascending order
+var Resolutions = []time.Duration{5 * time.Minute, time.Hour}
+
+// metricName is the format of metric names
+var metricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.:]*$`)
+
+// Retention is the time the samples and the rollups of each resolution are
+// kept. Zero keeps them forever.
+type Retention struct {
+	Raw     time.Duration
+	Rollups map[time.Duration]time.Duration
+}
+
+// Service stores the metrics of the events and answers the queries
+type Service struct {
+	nc        *nats.Conn
+	store     storage.Interface
+	retention Retention
+
+	// rolledUp is the start of the buckets of each resolution which are
+	// rolled up by the next run
+	rolledUp map[time.Duration]time.Time
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+	sub    *nats.Subscription
+}
+
+// NewService creates a new telemetry service
+func NewService(nc *nats.Conn, store storage.Interface, retention Retention) *Service {
+	return &Service{
+		nc:        nc,
+		store:     store,
+		retention: retention,
+		rolledUp:  make(map[time.Duration]time.Time),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start subscribes the events and updates the rollups periodically. The
+// events are distributed among all server instances by a queue group. The
+// first run rolls up all kept samples, which covers the time the service was
+// stopped.
+func (s *Service) Start() error {
+	sub, err := s.nc.QueueSubscribe("iotcore.devicecontrol.v1.*.events.*", "iotcore.devicecontrol.v1.queue.telemetry", s.handleEvent)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe events")
+	}
+	s.sub = sub
+
+	now := time.Now().UTC()
+	for _, res := range Resolutions {
+		if s.retention.Raw > 0 {
+			s.rolledUp[res] = now.Add(-s.retention.Raw).Truncate(res)
+		} else {
+			s.rolledUp[res] = time.Unix(0, 0).UTC()
+		}
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(rollupInterval)
+		defer ticker.Stop()
+
+		for {
+			s.rollup()
+
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops the service
+func (s *Service) Stop() {
+	if s.sub != nil {
+		s.sub.Unsubscribe()
+	}
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// handleEvent stores the samples of the mappings matching the event. Events
+// without publication ID or source are ignored, since their samples can't be
+// identified.
+func (s *Service) handleEvent(msg *nats.Msg) {
+	namespace, topic := parseSubject(msg.Subject)
+
+	ev := message.EventMessage{}
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		log.Debugf("telemetry failed to unmarshal event: %s", err)
+		return
+	}
+	if ev.PublicationID <= 0 || ev.SourceID == "" {
+		return
+	}
+
+	mappings, err := s.store.MetricMappings().FetchAll()
+	if err != nil {
+		log.Error("telemetry failed to fetch metric mappings: ", err)
+		return
+	}
+
+	samples := make([]model.MetricSample, 0)
+	for _, m := range mappings {
+		if !Matches(&m, namespace, topic) {
+			continue
+		}
+
+		value, ok := Extract(&m, ev.Details)
+		if !ok {
+			continue
+		}
+
+		samples = append(samples, model.MetricSample{
+			EventID:   ev.PublicationID,
+			Namespace: namespace,
+			DeviceID:  ev.SourceID,
+			Metric:    m.Metric,
+			Timestamp: ev.Timestamp.UTC(),
+			Value:     value,
+		})
+	}
+	if len(samples) == 0 {
+		return
+	}
+
+	if err := s.store.Telemetry().AddSamples(samples); err != nil {
+		log.Errorf("telemetry failed to store samples of event %d: %s", ev.PublicationID, err)
+	}
+}
+
+// rollup rolls up the samples since the last run, including the current
+// buckets. The last complete bucket is rolled up again by the next run for
+// samples which arrive late. Expired samples and rollups are deleted. Every
+// server instance runs the rollups, the results replace each other.
+func (s *Service) rollup() {
+	now := time.Now().UTC()
+
+	for _, res := range Resolutions {
+		if err := s.store.Telemetry().Rollup(res, s.rolledUp[res], now.Truncate(res).Add(res)); err != nil {
+			log.Errorf("telemetry failed to roll up samples to %s: %s", res, err)
+			continue
+		}
+		s.rolledUp[res] = now.Truncate(res).Add(-res)
+
+		if retention := s.retention.Rollups[res]; retention > 0 {
+			if err := s.store.Telemetry().DeleteRollupsBefore(res, now.Add(-retention)); err != nil {
+				log.Errorf("telemetry failed to delete rollups of %s: %s", res, err)
+			}
+		}
+	}
+
+	if s.retention.Raw > 0 {
+		if err := s.store.Telemetry().DeleteSamplesBefore(now.Add(-s.retention.Raw)); err != nil {
+			log.Error("telemetry failed to delete samples: ", err)
+		}
+	}
+}
+
+// Matches returns true if the mapping extracts samples from the events of
+// the topic in the namespace
+func Matches(m *model.MetricMapping, namespace, topic string) bool {
+	if !m.Enabled {
+		return false
+	}
+	if m.Namespace != "" && m.Namespace != namespace {
+		return false
+	}
+	if m.Topic == "" {
+		return true
+	}
+	ok, err := path.Match(m.Topic, topic)
+	return err == nil && ok
+}
+
+// Extract returns the first numeric value selected by the path of the
+// mapping. Booleans are 1 for true and 0 for false.
+func Extract(m *model.MetricMapping, details interface{}) (float64, bool) {
+	values, err := jsonpath.Select(details, m.Path)
+	if err != nil {
+		return 0, false
+	}
+
+	for _, v := range values {
+		switch t := v.(type) {
+		case float64:
+			return t, true
+		case bool:
+			if t {
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// Validate checks the metric name, the topic pattern and the path of the
+// mapping
+func Validate(m *model.MetricMapping) error {
+	if !metricName.MatchString(m.Metric) {
+		return errors.Errorf("invalid metric name '%s'", m.Metric)
+	}
+	if _, err := path.Match(m.Topic, ""); err != nil {
+		return errors.Errorf("invalid topic pattern '%s'", m.Topic)
+	}
+	if m.Path == "" {
+		return errors.New("path is required")
+	}
+	if _, err := jsonpath.Compile(m.Path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseSubject returns the namespace and the topic of an event subject
+func parseSubject(subj string) (namespace, topic string) {
+	parts := strings.Split(strings.TrimPrefix(subj, "iotcore.devicecontrol.v1."), ".")
+	if len(parts) != 3 {
+		return "", ""
+	}
+	return parts[0], parts[2]
+}
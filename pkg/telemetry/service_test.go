@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nsyszr/lcm/pkg/model"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping model.MetricMapping
+		wantErr bool
+	}{
+		{"valid", model.MetricMapping{Metric: "cpu.load", Topic: "sysinfo", Path: "$.load"}, false},
+		{"topic pattern", model.MetricMapping{Metric: "if_rx:bytes", Topic: "net*", Path: "$.rx"}, false},
+		{"all topics", model.MetricMapping{Metric: "temp", Path: "temp"}, false},
+		{"empty metric", model.MetricMapping{Path: "$.load"}, true},
+		{"metric with digit", model.MetricMapping{Metric: "1load", Path: "$.load"}, true},
+		{"metric with space", model.MetricMapping{Metric: "cpu load", Path: "$.load"}, true},
+		{"invalid topic pattern", model.MetricMapping{Metric: "load", Topic: "[sys", Path: "$.load"}, true},
+		{"missing path", model.MetricMapping{Metric: "load"}, true},
+		{"invalid path", model.MetricMapping{Metric: "load", Path: "$.load["}, true},
+	}
+
+	for _, tc := range tests {
+		if err := Validate(&tc.mapping); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	var details interface{}
+	if err := json.Unmarshal([]byte(`{"load": 0.5, "up": true, "down": false, "name": "eth0", "rx": ["x", 12]}`), &details); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		want   float64
+		wantOK bool
+	}{
+		{"$.load", 0.5, true},
+		{"$.up", 1, true},
+		{"$.down", 0, true},
+		{"$.rx[*]", 12, true},
+		{"$.name", 0, false},
+		{"$.missing", 0, false},
+		{"$.load[", 0, false},
+	}
+
+	for _, tc := range tests {
+		got, ok := Extract(&model.MetricMapping{Path: tc.path}, details)
+		if ok != tc.wantOK || got != tc.want {
+			t.Errorf("Extract(%s) = %v, %v, want %v, %v", tc.path, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
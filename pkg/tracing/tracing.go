@@ -0,0 +1,192 @@
+// Package tracing contains the OpenTelemetry tracing of the devicecontrol
+// server. The trace context is propagated by the W3C trace context headers
+// of the HTTP requests and the NATS messages. Without exporter the spans
+// aren't recorded, but incoming trace contexts are still passed on.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName         = "iotcore-devicecontrol"
+	instrumentationName = "github.com/nsyszr/lcm"
+)
+
+// Exporters of the spans
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Init installs the tracer provider of the exporter. The OTLP exporter sends
+// the spans to the collector endpoint (host:port) via HTTP. New traces are
+// sampled by the ratio, spans of a sampled parent are always sampled. The
+// returned function flushes the spans and stops the exporter.
+func Init(exporter, endpoint string, ratio float64) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New()
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithInsecure())
+	default:
+		return nil, errors.Errorf("unknown tracing exporter '%s'", exporter)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tracing exporter")
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// Start starts a span as child of the span in the context
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// StartStore starts a span for the access of the store, the operation names
+// the sub-store and its method, e.g. 'Sessions.FindByID'
+func StartStore(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return Start(ctx, "store "+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("store.operation", operation)))
+}
+
+// End records the error, if any, and ends the span
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// RecordError marks the span as failed by the error, if any
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Fail marks the span as failed with the error reason of a reply
+func Fail(span trace.Span, reason string) {
+	span.SetAttributes(attribute.String("error.reason", reason))
+	span.SetStatus(codes.Error, reason)
+}
+
+// TraceID returns the trace ID of the span in the context. It's empty if the
+// context doesn't contain a trace.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// headerCarrier adapts the NATS message headers to the propagator
+type headerCarrier nats.Header
+
+func (c headerCarrier) Get(key string) string {
+	return nats.Header(c).Get(key)
+}
+
+func (c headerCarrier) Set(key, value string) {
+	nats.Header(c).Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// NewMsg creates a NATS message carrying the trace context. The context
+// isn't propagated if the server doesn't support headers, e.g. servers
+// before version 2.2.
+func NewMsg(ctx context.Context, nc *nats.Conn, subj string, data []byte) *nats.Msg {
+	msg := nats.NewMsg(subj)
+	msg.Data = data
+	if nc.HeadersSupported() {
+		otel.GetTextMapPropagator().Inject(ctx, headerCarrier(msg.Header))
+	} else {
+		msg.Header = nil
+	}
+	return msg
+}
+
+// Extract returns the context of the trace context carried by the NATS
+// message
+func Extract(ctx context.Context, msg *nats.Msg) context.Context {
+	if msg.Header == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(msg.Header))
+}
+
+// Middleware returns a middleware that traces the HTTP requests. The span
+// is passed on by the context of the request. Websocket upgrades aren't
+// traced, since the span would last as long as the connection.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.IsWebSocket() {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := Start(ctx, req.Method+" "+c.Path(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.method", req.Method),
+					attribute.String("http.route", c.Path()),
+				))
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(attribute.Int("http.status_code", status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
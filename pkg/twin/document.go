@@ -0,0 +1,97 @@
+// Package twin keeps the desired and the reported state of the devices and
+// pushes the difference to the devices.
+package twin
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Document is a JSON object of the twin
+type Document map[string]interface{}
+
+// ParseDocument decodes a stored document. An empty string is an empty
+// document.
+func ParseDocument(s string) (Document, error) {
+	d := Document{}
+	if s == "" {
+		return d, nil
+	}
+	if err := json.Unmarshal([]byte(s), &d); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal twin document")
+	}
+	return d, nil
+}
+
+// String encodes the document for storing it
+func (d Document) String() string {
+	data, err := json.Marshal(d)
+	if err != nil {
+		// A decoded JSON document is always encodable
+		panic(err)
+	}
+	return string(data)
+}
+
+// Merge applies the patch like a JSON merge patch (RFC 7386). Null values
+// remove the members, objects are merged recursively and all other values
+// replace the members.
+func (d Document) Merge(patch Document) Document {
+	out := Document{}
+	for k, v := range d {
+		out[k] = v
+	}
+
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+
+		p, ok := v.(map[string]interface{})
+		if !ok {
+			out[k] = v
+			continue
+		}
+
+		target, ok := out[k].(map[string]interface{})
+		if !ok {
+			target = Document{}
+		}
+		out[k] = map[string]interface{}(Document(target).Merge(p))
+	}
+
+	return out
+}
+
+// Delta returns the members of the desired document which differ from the
+// reported document. Objects are compared recursively, members which are
+// only reported are ignored.
+func Delta(desired, reported Document) Document {
+	out := Document{}
+
+	for k, v := range desired {
+		r, ok := reported[k]
+		if !ok {
+			out[k] = v
+			continue
+		}
+
+		dObj, dIsObj := v.(map[string]interface{})
+		rObj, rIsObj := r.(map[string]interface{})
+		if dIsObj && rIsObj {
+			if sub := Delta(dObj, rObj); len(sub) > 0 {
+				out[k] = map[string]interface{}(sub)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(v, r) {
+			out[k] = v
+		}
+	}
+
+	return out
+}
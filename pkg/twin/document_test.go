@@ -0,0 +1,72 @@
+package twin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDocumentMerge(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{}`, `{"a":1}`, `{"a":1}`},
+		{`{"a":1}`, `{"a":2}`, `{"a":2}`},
+		{`{"a":1,"b":2}`, `{"a":null}`, `{"b":2}`},
+		{`{"a":1}`, `{"b":null}`, `{"a":1}`},
+		{`{"a":{"b":1,"c":2}}`, `{"a":{"b":3}}`, `{"a":{"b":3,"c":2}}`},
+		{`{"a":{"b":1,"c":2}}`, `{"a":{"b":null}}`, `{"a":{"c":2}}`},
+		{`{"a":{"b":1}}`, `{"a":null}`, `{}`},
+		{`{"a":1}`, `{"a":{"b":1,"c":null}}`, `{"a":{"b":1}}`},
+		{`{"a":{"b":1}}`, `{"a":[1,2]}`, `{"a":[1,2]}`},
+		{`{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{`{"a":{"b":{"c":1}}}`, `{"a":{"b":{"d":2}}}`, `{"a":{"b":{"c":1,"d":2}}}`},
+	}
+
+	for _, tc := range tests {
+		doc := mustParse(t, tc.doc)
+		got := doc.Merge(mustParse(t, tc.patch))
+		if want := mustParse(t, tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s merge %s = %s, want %s", tc.doc, tc.patch, got, tc.want)
+		}
+		// The document itself is left unchanged
+		if !reflect.DeepEqual(doc, mustParse(t, tc.doc)) {
+			t.Errorf("%s merge %s modified the document: %s", tc.doc, tc.patch, doc)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		desired  string
+		reported string
+		want     string
+	}{
+		{`{}`, `{"a":1}`, `{}`},
+		{`{"a":1}`, `{}`, `{"a":1}`},
+		{`{"a":1}`, `{"a":1}`, `{}`},
+		{`{"a":1}`, `{"a":2}`, `{"a":1}`},
+		{`{"a":{"b":1,"c":2}}`, `{"a":{"b":1,"c":3}}`, `{"a":{"c":2}}`},
+		{`{"a":{"b":1}}`, `{"a":{"b":1,"c":3}}`, `{}`},
+		{`{"a":{"b":1}}`, `{"a":1}`, `{"a":{"b":1}}`},
+		{`{"a":[1,2]}`, `{"a":[1,2]}`, `{}`},
+		{`{"a":[1,2]}`, `{"a":[2,1]}`, `{"a":[1,2]}`},
+		{`{"a":{"b":{"c":1}}}`, `{"a":{"b":{"c":2}}}`, `{"a":{"b":{"c":1}}}`},
+	}
+
+	for _, tc := range tests {
+		got := Delta(mustParse(t, tc.desired), mustParse(t, tc.reported))
+		if want := mustParse(t, tc.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("Delta(%s, %s) = %s, want %s", tc.desired, tc.reported, got, tc.want)
+		}
+	}
+}
+
+func mustParse(t *testing.T, s string) Document {
+	d, err := ParseDocument(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
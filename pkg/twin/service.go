@@ -0,0 +1,247 @@
+package twin
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/devicecontrol/client"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TopicReported is the event topic the devices publish their reported state
+// to. The arguments of the publish message are merged into the reported
+// document.
+const TopicReported = "twinreported"
+
+// CommandDelta is the device command which receives the difference between
+// the desired and the reported state.
+const CommandDelta = "twin.delta"
+
+// queueGroup is the queue group of the event subscriptions
+const queueGroup = "iotcore.devicecontrol.v1.queue.twin"
+
+// maxRetries limits the retries of conflicting updates of the reported
+// state
+const maxRetries = 5
+
+// deltaArguments are the arguments of the delta command
+type deltaArguments struct {
+	Version int      `json:"version"`
+	State   Document `json:"state"`
+}
+
+// Service manages the twins of the devices
+type Service struct {
+	nc     *nats.Conn
+	store  storage.Interface
+	client *client.Client
+
+	subs []*nats.Subscription
+}
+
+// NewService creates a new twin service
+func NewService(nc *nats.Conn, store storage.Interface) *Service {
+	return &Service{
+		nc:     nc,
+		store:  store,
+		client: client.New(nc),
+	}
+}
+
+// Start listens for reported states and reconnecting devices. The instances
+// of the service share the events through a queue group, every event is
+// handled once.
+func (s *Service) Start() error {
+	sub, err := s.nc.QueueSubscribe("iotcore.devicecontrol.v1.*.events."+TopicReported, queueGroup, s.handleReported)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe reported state events")
+	}
+	s.subs = append(s.subs, sub)
+
+	sub, err = s.nc.QueueSubscribe("iotcore.devicecontrol.v1.*.events.devicestatus", queueGroup, s.handleDeviceStatus)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe device status events")
+	}
+	s.subs = append(s.subs, sub)
+
+	return nil
+}
+
+// Stop stops listening
+func (s *Service) Stop() {
+	for _, sub := range s.subs {
+		sub.Unsubscribe()
+	}
+}
+
+// Twin returns the twin of the device. An empty twin is created if the
+// device has none yet.
+func (s *Service) Twin(namespace, deviceID string) (*model.Twin, error) {
+	t, err := s.store.Twins().FindByNamespaceAndDeviceID(namespace, deviceID)
+	if err == nil || err != storage.ErrNotFound {
+		return t, err
+	}
+
+	t = &model.Twin{
+		Namespace: namespace,
+		DeviceID:  deviceID,
+		Desired:   "{}",
+		Reported:  "{}",
+		Version:   1,
+	}
+	if err := s.store.Twins().Create(t); err != nil {
+		// The twin may be created concurrently
+		if t, err := s.store.Twins().FindByNamespaceAndDeviceID(namespace, deviceID); err == nil {
+			return t, nil
+		}
+		return nil, errors.Wrap(err, "failed to create twin")
+	}
+
+	return t, nil
+}
+
+// SetDesired replaces the desired state of the device, or merges the given
+// state into it if merge is true. The update fails with
+// storage.ErrConflict if ifMatch isn't zero and differs from the version of
+// the twin.
+func (s *Service) SetDesired(namespace, deviceID string, state Document, merge bool, ifMatch int) (*model.Twin, error) {
+	t, err := s.Twin(namespace, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if ifMatch != 0 && ifMatch != t.Version {
+		return nil, storage.ErrConflict
+	}
+
+	if merge {
+		desired, err := ParseDocument(t.Desired)
+		if err != nil {
+			return nil, err
+		}
+		state = desired.Merge(state)
+	}
+	t.Desired = state.String()
+
+	if err := s.store.Twins().Update(t); err != nil {
+		return nil, err
+	}
+
+	go s.pushDelta(t)
+
+	return t, nil
+}
+
+// Drift returns the difference between the desired and the reported state
+func Drift(t *model.Twin) (Document, error) {
+	desired, err := ParseDocument(t.Desired)
+	if err != nil {
+		return nil, err
+	}
+	reported, err := ParseDocument(t.Reported)
+	if err != nil {
+		return nil, err
+	}
+	return Delta(desired, reported), nil
+}
+
+// report merges the state published by the device into the reported state.
+// Concurrent updates are retried.
+func (s *Service) report(namespace, deviceID string, state Document) error {
+	for i := 0; i < maxRetries; i++ {
+		t, err := s.Twin(namespace, deviceID)
+		if err != nil {
+			return err
+		}
+
+		reported, err := ParseDocument(t.Reported)
+		if err != nil {
+			return err
+		}
+		t.Reported = reported.Merge(state).String()
+
+		err = s.store.Twins().Update(t)
+		if err != storage.ErrConflict {
+			return err
+		}
+	}
+
+	return storage.ErrConflict
+}
+
+// pushDelta sends the difference between the desired and the reported
+// state to the device. Nothing is sent if the device is in sync. A device
+// which isn't connected receives the delta after reconnecting.
+func (s *Service) pushDelta(t *model.Twin) {
+	delta, err := Drift(t)
+	if err != nil {
+		log.Error("twin failed to compute delta: ", err)
+		return
+	}
+	if len(delta) == 0 {
+		return
+	}
+
+	args := deltaArguments{Version: t.Version, State: delta}
+	if err := s.client.Call(t.Namespace, t.DeviceID, CommandDelta, args, nil); err != nil {
+		if client.IsUnavailable(err) {
+			log.Debugf("twin delta of device '%s' is pushed after reconnect: %s", t.DeviceID, err)
+			return
+		}
+		log.Errorf("twin failed to push delta to device '%s': %s", t.DeviceID, err)
+	}
+}
+
+func (s *Service) handleReported(msg *nats.Msg) {
+	ev := struct {
+		SourceID string   `json:"source_id"`
+		Details  Document `json:"details"`
+	}{}
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		log.Error("twin failed to unmarshal reported state: ", err)
+		return
+	}
+	if ev.SourceID == "" {
+		log.Warn("twin dropped reported state without source")
+		return
+	}
+
+	if err := s.report(namespaceFromSubject(msg.Subject), ev.SourceID, ev.Details); err != nil {
+		log.Errorf("twin failed to update reported state of device '%s': %s", ev.SourceID, err)
+	}
+}
+
+func (s *Service) handleDeviceStatus(msg *nats.Msg) {
+	ev := struct {
+		SourceID string `json:"source_id"`
+		Details  struct {
+			Status string `json:"status"`
+		} `json:"details"`
+	}{}
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		log.Error("twin failed to unmarshal device status: ", err)
+		return
+	}
+	if ev.Details.Status != "CONNECTED" {
+		return
+	}
+
+	t, err := s.store.Twins().FindByNamespaceAndDeviceID(namespaceFromSubject(msg.Subject), ev.SourceID)
+	if err == storage.ErrNotFound {
+		return
+	} else if err != nil {
+		log.Error("twin failed to find twin: ", err)
+		return
+	}
+
+	// The device status is published after the control channel subscribed
+	// the calls of the device, the delta can be pushed right away.
+	go s.pushDelta(t)
+}
+
+func namespaceFromSubject(subj string) string {
+	return strings.SplitN(strings.TrimPrefix(subj, "iotcore.devicecontrol.v1."), ".", 2)[0]
+}
@@ -0,0 +1,370 @@
+// Package webhook delivers the events to the HTTP endpoints subscribed by
+// webhooks. Every delivery is stored before it's sent, failed deliveries are
+// retried with exponential backoff and end up in the dead letters after the
+// maximum attempts.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// pollInterval is the interval the due deliveries are checked
+const pollInterval = time.Second
+
+// maxBackoff limits the delay between two attempts
+const maxBackoff = time.Hour
+
+// leaseMargin is added to the request timeout for the lease of a claimed
+// delivery. Other instances claim the delivery again after the lease, e.g.
+// if this instance stopped during the attempt.
+const leaseMargin = time.Minute
+
+// maxConcurrent limits the requests running in parallel
+const maxConcurrent = 8
+
+// maxErrorLength limits the response body stored as error of an attempt
+const maxErrorLength = 512
+
+// payload is the body of a webhook request
+type payload struct {
+	Namespace string          `json:"namespace"`
+	Topic     string          `json:"topic"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// Dispatcher stores the events for the matching webhooks and delivers them
+type Dispatcher struct {
+	nc          *nats.Conn
+	store       storage.Interface
+	http        *http.Client
+	maxAttempts int
+	backoff     time.Duration
+
+	mu       sync.Mutex
+	inflight map[int32]bool
+	sem      chan struct{}
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+
+	sub *nats.Subscription
+}
+
+// NewDispatcher creates a new dispatcher. A failed delivery is retried after
+// the backoff, which doubles with every attempt, until maxAttempts are
+// reached. Each request may take up to the timeout.
+func NewDispatcher(nc *nats.Conn, store storage.Interface, maxAttempts int, backoff, timeout time.Duration) *Dispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return &Dispatcher{
+		nc:          nc,
+		store:       store,
+		http:        &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		inflight:    make(map[int32]bool),
+		sem:         make(chan struct{}, maxConcurrent),
+		wakeCh:      make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// Start subscribes the events and delivers the pending deliveries. The
+// events are distributed among all server instances by a queue group.
+func (d *Dispatcher) Start() error {
+	sub, err := d.nc.QueueSubscribe("iotcore.devicecontrol.v1.*.events.*", "iotcore.devicecontrol.v1.queue.webhooks", d.handleEvent)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe events")
+	}
+	d.sub = sub
+
+	d.wg.Add(1)
+	go d.run()
+
+	return nil
+}
+
+// Stop stops the dispatcher and waits for the running requests
+func (d *Dispatcher) Stop() {
+	if d.sub != nil {
+		d.sub.Unsubscribe()
+	}
+	close(d.stopCh)
+	d.wg.Wait()
+}
+
+// Redeliver schedules the delivery again, e.g. a dead letter. The attempts
+// are reset.
+func (d *Dispatcher) Redeliver(id int32) (*model.WebhookDelivery, error) {
+	m, err := d.store.WebhookDeliveries().FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.Status == model.WebhookDeliveryStatusPending {
+		return nil, storage.ErrConflict
+	}
+
+	m.Status = model.WebhookDeliveryStatusPending
+	m.Attempts = 0
+	m.NextAttemptAt = time.Now().Round(time.Second).UTC()
+	if err := d.store.WebhookDeliveries().Update(m); err != nil {
+		return nil, err
+	}
+	d.wake()
+
+	return m, nil
+}
+
+// handleEvent creates a delivery for every webhook matching the event
+func (d *Dispatcher) handleEvent(msg *nats.Msg) {
+	namespace, topic := parseSubject(msg.Subject)
+
+	webhooks, err := d.store.Webhooks().FetchAll()
+	if err != nil {
+		log.Error("webhook failed to fetch webhooks: ", err)
+		return
+	}
+
+	data, err := json.Marshal(payload{
+		Namespace: namespace,
+		Topic:     topic,
+		Event:     json.RawMessage(msg.Data),
+	})
+	if err != nil {
+		log.Error("webhook failed to marshal payload: ", err)
+		return
+	}
+
+	created := false
+	for _, w := range webhooks {
+		if !Matches(&w, namespace, topic) {
+			continue
+		}
+
+		m := &model.WebhookDelivery{
+			WebhookID:     w.ID,
+			Namespace:     namespace,
+			Topic:         topic,
+			Payload:       string(data),
+			Status:        model.WebhookDeliveryStatusPending,
+			NextAttemptAt: time.Now().UTC(),
+		}
+		if err := d.store.WebhookDeliveries().Create(m); err != nil {
+			log.Errorf("webhook failed to create delivery for webhook %d: %s", w.ID, err)
+			continue
+		}
+		created = true
+	}
+
+	if created {
+		d.wake()
+	}
+}
+
+// Matches returns true if the webhook subscribed the events of the topic in
+// the namespace
+func Matches(w *model.Webhook, namespace, topic string) bool {
+	if !w.Enabled {
+		return false
+	}
+	if w.Namespace != "" && w.Namespace != namespace {
+		return false
+	}
+	if len(w.Topics) == 0 {
+		return true
+	}
+	for _, pattern := range w.Topics {
+		if ok, err := path.Match(pattern, topic); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dispatcher) wake() {
+	select {
+	case d.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchDue()
+
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+		case <-d.wakeCh:
+		}
+	}
+}
+
+// dispatchDue claims the due deliveries and starts their attempts. The
+// claim keeps other server instances from sending the same deliveries. Only
+// as many deliveries are claimed as requests can be started right away,
+// otherwise the lease could expire before the attempt.
+func (d *Dispatcher) dispatchDue() {
+	limit := cap(d.sem) - len(d.sem)
+	if limit <= 0 {
+		return
+	}
+
+	due, err := d.store.WebhookDeliveries().ClaimDue(time.Now().UTC(), d.http.Timeout+leaseMargin, limit)
+	if err != nil {
+		log.Error("webhook failed to claim due deliveries: ", err)
+		return
+	}
+
+	ids := make([]int32, 0, len(due))
+	for id := range due {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		d.mu.Lock()
+		if d.inflight[id] {
+			d.mu.Unlock()
+			continue
+		}
+		d.inflight[id] = true
+		d.mu.Unlock()
+
+		select {
+		case d.sem <- struct{}{}:
+		case <-d.stopCh:
+			return
+		}
+
+		m := due[id]
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer func() {
+				<-d.sem
+				d.mu.Lock()
+				delete(d.inflight, m.ID)
+				d.mu.Unlock()
+			}()
+
+			if err := d.attempt(&m); err != nil {
+				log.Errorf("webhook failed to update delivery %d: %s", m.ID, err)
+			}
+		}()
+	}
+}
+
+// attempt sends the delivery and stores the result of the attempt
+func (d *Dispatcher) attempt(m *model.WebhookDelivery) error {
+	now := time.Now().UTC()
+	m.Attempts++
+	m.LastAttemptAt = now.Round(time.Second)
+
+	w, err := d.store.Webhooks().FindByID(m.WebhookID)
+	if err == storage.ErrNotFound {
+		m.Status = model.WebhookDeliveryStatusDead
+		m.LastError = "webhook deleted"
+		return d.store.WebhookDeliveries().Update(m)
+	} else if err != nil {
+		return err
+	}
+
+	statusCode, err := d.send(w, m, now)
+	m.LastStatusCode = statusCode
+	m.LastError = ""
+	if err != nil {
+		m.LastError = err.Error()
+	}
+
+	switch {
+	case err == nil:
+		m.Status = model.WebhookDeliveryStatusDelivered
+		log.Debugf("webhook delivered %d to '%s'", m.ID, w.URL)
+	case m.Attempts >= d.maxAttempts:
+		m.Status = model.WebhookDeliveryStatusDead
+		log.Warnf("webhook delivery %d to '%s' is dead after %d attempts: %s", m.ID, w.URL, m.Attempts, err)
+	default:
+		m.NextAttemptAt = now.Add(d.nextBackoff(m.Attempts))
+		log.Debugf("webhook delivery %d to '%s' failed, retry at %s: %s", m.ID, w.URL, m.NextAttemptAt, err)
+	}
+
+	return d.store.WebhookDeliveries().Update(m)
+}
+
+// nextBackoff returns the delay after the given number of attempts
+func (d *Dispatcher) nextBackoff(attempts int) time.Duration {
+	backoff := d.backoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// send posts the payload to the webhook. Only 2xx responses are successful.
+func (d *Dispatcher) send(w *model.Webhook, m *model.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(m.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookID, strconv.Itoa(int(w.ID)))
+	req.Header.Set(HeaderDelivery, strconv.Itoa(int(m.ID)))
+	req.Header.Set(HeaderTopic, m.Topic)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	if w.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, now.Unix(), body))
+	}
+
+	res, err := d.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+		return res.StatusCode, fmt.Errorf("status %d: %s", res.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return res.StatusCode, nil
+}
+
+// parseSubject returns the namespace and the topic of an event subject
+func parseSubject(subj string) (namespace, topic string) {
+	parts := strings.Split(strings.TrimPrefix(subj, "iotcore.devicecontrol.v1."), ".")
+	if len(parts) != 3 {
+		return "", ""
+	}
+	return parts[0], parts[2]
+}
@@ -0,0 +1,246 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nsyszr/lcm/pkg/model"
+	"github.com/nsyszr/lcm/pkg/storage"
+	"github.com/nsyszr/lcm/pkg/storage/memory"
+)
+
+// receiver is a webhook endpoint which verifies the signature of the
+// requests and responds with the given status code
+type receiver struct {
+	*httptest.Server
+	t        *testing.T
+	secret   string
+	status   int32
+	requests int32
+}
+
+func newReceiver(t *testing.T, secret string, status int) *receiver {
+	r := &receiver{t: t, secret: secret, status: int32(status)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&r.requests, 1)
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Errorf("receiver failed to read body: %s", err)
+		}
+		timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+		if err != nil {
+			t.Errorf("receiver got invalid timestamp: %s", err)
+		}
+		if !Verify(r.secret, timestamp, body, req.Header.Get(HeaderSignature)) {
+			t.Errorf("receiver got invalid signature '%s'", req.Header.Get(HeaderSignature))
+		}
+
+		w.WriteHeader(int(atomic.LoadInt32(&r.status)))
+		w.Write([]byte("response body"))
+	}))
+	return r
+}
+
+func setupDispatcher(t *testing.T, url string, maxAttempts int) (*Dispatcher, storage.Interface, *model.WebhookDelivery) {
+	store := memory.NewStore()
+	w := &model.Webhook{Namespace: "default", URL: url, Secret: "secret", Enabled: true}
+	if err := store.Webhooks().Create(w); err != nil {
+		t.Fatal(err)
+	}
+	m := &model.WebhookDelivery{
+		WebhookID:     w.ID,
+		Namespace:     "default",
+		Topic:         "devicestatus",
+		Payload:       `{"namespace":"default","topic":"devicestatus","event":{}}`,
+		Status:        model.WebhookDeliveryStatusPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if err := store.WebhookDeliveries().Create(m); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewDispatcher(nil, store, maxAttempts, time.Second, 5*time.Second), store, m
+}
+
+// dispatch runs the attempts of the due deliveries and returns the delivery
+// afterwards
+func dispatch(t *testing.T, d *Dispatcher, store storage.Interface, id int32) *model.WebhookDelivery {
+	d.dispatchDue()
+	d.wg.Wait()
+
+	m, err := store.WebhookDeliveries().FindByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// makeDue moves the next attempt of the delivery to now
+func makeDue(t *testing.T, store storage.Interface, m *model.WebhookDelivery) {
+	m.NextAttemptAt = time.Now().UTC()
+	if err := store.WebhookDeliveries().Update(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	r := newReceiver(t, "secret", http.StatusNoContent)
+	defer r.Close()
+
+	d, store, m := setupDispatcher(t, r.URL, 3)
+	m = dispatch(t, d, store, m.ID)
+
+	if m.Status != model.WebhookDeliveryStatusDelivered || m.Attempts != 1 || m.LastStatusCode != http.StatusNoContent {
+		t.Errorf("delivery = %s after %d attempts with status code %d, want delivered after 1 attempt with 204",
+			m.Status, m.Attempts, m.LastStatusCode)
+	}
+
+	// A delivered delivery isn't claimed again
+	dispatch(t, d, store, m.ID)
+	if n := atomic.LoadInt32(&r.requests); n != 1 {
+		t.Errorf("receiver got %d requests, want 1", n)
+	}
+}
+
+func TestDispatcherRetriesAndDeadLetters(t *testing.T) {
+	r := newReceiver(t, "secret", http.StatusInternalServerError)
+	defer r.Close()
+
+	d, store, m := setupDispatcher(t, r.URL, 2)
+
+	before := time.Now()
+	m = dispatch(t, d, store, m.ID)
+	if m.Status != model.WebhookDeliveryStatusPending || m.Attempts != 1 || m.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("delivery = %s after %d attempts with status code %d, want pending after 1 attempt with 500",
+			m.Status, m.Attempts, m.LastStatusCode)
+	}
+	if m.LastError != "status 500: response body" {
+		t.Errorf("last error = %q", m.LastError)
+	}
+	if m.NextAttemptAt.Before(before.Add(time.Second)) {
+		t.Errorf("next attempt at %s is before the backoff", m.NextAttemptAt)
+	}
+
+	// The delivery isn't due before the backoff
+	dispatch(t, d, store, m.ID)
+	if n := atomic.LoadInt32(&r.requests); n != 1 {
+		t.Fatalf("receiver got %d requests during the backoff, want 1", n)
+	}
+
+	makeDue(t, store, m)
+	m = dispatch(t, d, store, m.ID)
+	if m.Status != model.WebhookDeliveryStatusDead || m.Attempts != 2 {
+		t.Fatalf("delivery = %s after %d attempts, want dead after 2 attempts", m.Status, m.Attempts)
+	}
+
+	// Redelivering the dead letter resets the attempts
+	atomic.StoreInt32(&r.status, http.StatusOK)
+	m, err := d.Redeliver(m.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeDue(t, store, m)
+	m = dispatch(t, d, store, m.ID)
+	if m.Status != model.WebhookDeliveryStatusDelivered || m.Attempts != 1 {
+		t.Errorf("delivery = %s after %d attempts, want delivered after 1 attempt", m.Status, m.Attempts)
+	}
+}
+
+func TestDispatcherDeletedWebhook(t *testing.T) {
+	d, store, m := setupDispatcher(t, "http://127.0.0.1:1", 3)
+	if err := store.Webhooks().Delete(m.WebhookID); err != nil {
+		t.Fatal(err)
+	}
+
+	m = dispatch(t, d, store, m.ID)
+	if m.Status != model.WebhookDeliveryStatusDead || m.LastError != "webhook deleted" {
+		t.Errorf("delivery = %s with error %q, want dead", m.Status, m.LastError)
+	}
+}
+
+func TestClaimDue(t *testing.T) {
+	store := memory.NewStore()
+	now := time.Now().UTC()
+	for _, at := range []time.Time{now.Add(-time.Minute), now.Add(-time.Second), now.Add(time.Minute)} {
+		m := &model.WebhookDelivery{Status: model.WebhookDeliveryStatusPending, NextAttemptAt: at}
+		if err := store.WebhookDeliveries().Create(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := store.WebhookDeliveries().ClaimDue(now, time.Minute, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := first[1]; !ok || len(first) != 1 {
+		t.Fatalf("first claim = %v, want the oldest delivery", first)
+	}
+
+	// Claimed deliveries aren't claimed again until the lease expired
+	second, err := store.WebhookDeliveries().ClaimDue(now, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := second[2]; !ok || len(second) != 1 {
+		t.Fatalf("second claim = %v, want the remaining due delivery", second)
+	}
+
+	expired, err := store.WebhookDeliveries().ClaimDue(now.Add(2*time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 3 {
+		t.Errorf("claim after the lease = %d deliveries, want 3", len(expired))
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	d := NewDispatcher(nil, nil, 10, time.Second, time.Second)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{12, 2048 * time.Second},
+		{13, maxBackoff},
+		{100, maxBackoff},
+	}
+
+	for _, tc := range tests {
+		if got := d.nextBackoff(tc.attempts); got != tc.want {
+			t.Errorf("nextBackoff(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook model.Webhook
+		ns      string
+		topic   string
+		want    bool
+	}{
+		{"all events", model.Webhook{Enabled: true}, "default", "devicestatus", true},
+		{"disabled", model.Webhook{}, "default", "devicestatus", false},
+		{"other namespace", model.Webhook{Enabled: true, Namespace: "other"}, "default", "devicestatus", false},
+		{"topic", model.Webhook{Enabled: true, Topics: []string{"alert"}}, "default", "alert", true},
+		{"glob", model.Webhook{Enabled: true, Topics: []string{"device*"}}, "default", "devicestatus", true},
+		{"no matching topic", model.Webhook{Enabled: true, Topics: []string{"alert"}}, "default", "devicestatus", false},
+	}
+
+	for _, tc := range tests {
+		if got := Matches(&tc.webhook, tc.ns, tc.topic); got != tc.want {
+			t.Errorf("%s: Matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
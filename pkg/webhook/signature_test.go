@@ -0,0 +1,30 @@
+package webhook
+
+import "testing"
+
+func TestSignVerify(t *testing.T) {
+	payload := []byte(`{"namespace":"default","topic":"devicestatus"}`)
+	signature := Sign("secret", 1500000000, payload)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		payload   []byte
+		signature string
+		want      bool
+	}{
+		{"valid", "secret", 1500000000, payload, signature, true},
+		{"wrong secret", "other", 1500000000, payload, signature, false},
+		{"replayed timestamp", "secret", 1500000001, payload, signature, false},
+		{"modified payload", "secret", 1500000000, []byte(`{}`), signature, false},
+		{"missing prefix", "secret", 1500000000, payload, signature[len(signaturePrefix):], false},
+		{"empty signature", "secret", 1500000000, payload, "", false},
+	}
+
+	for _, tc := range tests {
+		if got := Verify(tc.secret, tc.timestamp, tc.payload, tc.signature); got != tc.want {
+			t.Errorf("%s: Verify = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}